@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/hoangtu1372k2/vms/internal/app"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -20,6 +22,7 @@ func main() {
 
 	// Set Default Configs
 	// Important: Viper configuration keys are case insensitive.
+	cfg.SetDefault("environment", "development")
 	cfg.SetDefault("enable_tls", false)
 	cfg.SetDefault("listen_addr", "0.0.0.0:8080")
 	cfg.SetDefault("base_url", "127.0.0.1:8080")
@@ -29,6 +32,109 @@ func main() {
 
 	cfg.SetDefault("redis_host", "localhost")
 	cfg.SetDefault("redis_post", "6379")
+	cfg.SetDefault("redis_password", "")
+	cfg.SetDefault("redis_db", 0)
+
+	// Cache of hot read endpoints: memory, redis or none
+	cfg.SetDefault("cache_driver", "memory")
+	cfg.SetDefault("cache_size", 10000)
+	cfg.SetDefault("cache_ttl", "5m")
+
+	// File storage: minio or local
+	cfg.SetDefault("storage_driver", "minio")
+	cfg.SetDefault("storage_bucket", "lms")
+	cfg.SetDefault("storage_prefix", "")
+	cfg.SetDefault("storage_public_url", "")
+	cfg.SetDefault("storage_local_path", "./data/storage")
+	cfg.SetDefault("storage_signing_key", "")
+	cfg.SetDefault("storage_required", true)
+	cfg.SetDefault("storage_timeout", "10s")
+	// The stored objects are checked against the rows referencing them every storage_reconcile_interval, 0 disables it.
+	// Orphans older than storage_orphan_grace are deleted and broken rows flagged only with storage_reconcile_apply.
+	cfg.SetDefault("storage_reconcile_interval", "24h")
+	cfg.SetDefault("storage_reconcile_apply", false)
+	cfg.SetDefault("storage_orphan_grace", "72h")
+	cfg.SetDefault("minio_endpoint", "127.0.0.1:9000")
+	cfg.SetDefault("minio_access_key", "minioadmin")
+	cfg.SetDefault("minio_secret_key", "minioadmin")
+	cfg.SetDefault("minio_use_ssl", false)
+	cfg.SetDefault("minio_region", "")
+
+	// Largest accepted file per category, in bytes
+	cfg.SetDefault("upload_max_size_images", 10<<20)
+	cfg.SetDefault("upload_max_size_videos", 2<<30)
+	cfg.SetDefault("upload_max_size_documents", 50<<20)
+	cfg.SetDefault("upload_max_size_spreadsheets", 20<<20)
+
+	// Malware scanning with clamd (tcp://host:port or unix:///path), disabled without an address.
+	// Failed scans are retried every scan_interval. Files above scan_max_size or the StreamMaxLength of clamd cannot be scanned and are
+	// blocked, both must be at least the largest upload_max_size_*.
+	cfg.SetDefault("clamd_address", "")
+	cfg.SetDefault("scan_interval", "30s")
+	cfg.SetDefault("scan_timeout", "10m")
+	cfg.SetDefault("scan_max_size", 2<<30)
+	cfg.SetDefault("scan_max_attempts", 5)
+
+	// Image variants (WebP and JPEG thumbnails) made in the background after the scan, images above
+	// image_max_pixels are not decoded. Failures are retried every image_interval.
+	cfg.SetDefault("image_interval", "30s")
+	cfg.SetDefault("image_max_attempts", 3)
+	cfg.SetDefault("image_max_pixels", 50_000_000)
+	cfg.SetDefault("image_jpeg_quality", 82)
+
+	// HLS transcoding of uploaded videos with ffmpeg, video_workers videos are transcoded at once per instance.
+	// Failures are retried every video_interval, transcodings running past video_timeout are taken over.
+	cfg.SetDefault("ffmpeg_path", "ffmpeg")
+	cfg.SetDefault("ffprobe_path", "ffprobe")
+	cfg.SetDefault("video_workers", 1)
+	cfg.SetDefault("video_interval", "30s")
+	cfg.SetDefault("video_timeout", "2h")
+	cfg.SetDefault("video_max_attempts", 3)
+	cfg.SetDefault("video_max_duration", "4h")
+	cfg.SetDefault("video_segment_duration", 6)
+	cfg.SetDefault("video_preset", "veryfast")
+	cfg.SetDefault("video_work_dir", "")
+
+	// Transcoded videos get a poster at most video_poster_width wide and scrub bar previews video_thumbnail_width wide
+	// every video_thumbnail_interval, 0 makes none.
+	cfg.SetDefault("video_poster_width", 1280)
+	cfg.SetDefault("video_thumbnail_width", 160)
+	cfg.SetDefault("video_thumbnail_interval", "10s")
+
+	// Playback tokens of the streaming endpoints, signed with playback_secret or else jwt_secret.
+	// They are valid playback_token_ttl plus the duration of the video.
+	cfg.SetDefault("playback_secret", "")
+	cfg.SetDefault("playback_token_ttl", "15m")
+
+	// HLS segments are encrypted with AES-128, a new key every video_key_rotation segments, 0 leaves them in the clear.
+	// Keys are only released by GET /videos/{id}/keys/{key_id} to viewers with a playback token.
+	cfg.SetDefault("video_key_rotation", 10)
+
+	// Watch progress heartbeats are buffered and written every progress_flush_interval, or as soon as progress_batch_size viewers wait.
+	// A lesson is complete once lesson_complete_percent of its video was watched.
+	cfg.SetDefault("progress_flush_interval", "10s")
+	cfg.SetDefault("progress_batch_size", 500)
+	cfg.SetDefault("progress_cache_ttl", "30m")
+	// A heartbeat is credited with at most progress_max_playback_rate times the time since the previous one, plus progress_heartbeat_slack.
+	cfg.SetDefault("progress_max_playback_rate", 2)
+	cfg.SetDefault("progress_heartbeat_slack", "10s")
+	cfg.SetDefault("lesson_complete_percent", 90)
+	// Checkpoints keep the video paused until answered correctly unless created with blocking false.
+	cfg.SetDefault("video_checkpoint_blocking", true)
+	// Video analytics count views per video_analytics_bucket seconds of video, changing it only applies to what is watched afterwards.
+	cfg.SetDefault("video_analytics_bucket", 5)
+
+	// Direct uploads: presigned URLs and pending uploads expire after upload_expiry
+	cfg.SetDefault("upload_expiry", "1h")
+	cfg.SetDefault("upload_sweep_interval", "5m")
+	cfg.SetDefault("upload_multipart_threshold", 64<<20)
+	cfg.SetDefault("upload_part_size", 16<<20)
+
+	// Resumable uploads (tus): unfinished uploads expire tus_expiry after their last chunk
+	cfg.SetDefault("tus_max_size", 4<<30)
+	cfg.SetDefault("tus_chunk_size", 8<<20)
+	cfg.SetDefault("tus_expiry", "24h")
+	cfg.SetDefault("tus_max_concurrent", 3)
 
 	cfg.SetDefault("global_limit", "5")
 	cfg.SetDefault("rate_limit_fixed", "5")
@@ -45,6 +151,9 @@ func main() {
 	cfg.SetDefault("sql_password", "12345678")
 	cfg.SetDefault("sql_schema", "public")
 
+	// Bulk endpoints
+	cfg.SetDefault("bulk_max_items", 100)
+
 	// Load Config
 	cfg.AddConfigPath("./conf")
 	cfg.SetEnvPrefix("app")
@@ -79,6 +188,47 @@ func main() {
 		}
 	}
 
+	// Run admin command
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "serve":
+	case "recount":
+		err = app.Recount(cfg)
+		if err != nil {
+			log.Fatalf("Recount failed - %s", err)
+		}
+		return
+	case "export":
+		err = app.Export(cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Export failed - %s", err)
+		}
+		return
+	case "import":
+		err = app.Import(cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Import failed - %s", err)
+		}
+		return
+	case "reconcile":
+		err = app.Reconcile(cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Reconcile failed - %s", err)
+		}
+		return
+	case "seed":
+		err = app.Seed(cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Seed failed - %s", err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown command %s, expected one of: serve, recount, export, import, reconcile, seed", command)
+	}
+
 	// Run application
 	log.Info("Start running vms service............................................")
 	err = app.Run(cfg)
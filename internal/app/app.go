@@ -15,7 +15,6 @@ import (
 	"github.com/hoangtu1372k2/vms/docs/swagger"
 	"github.com/hoangtu1372k2/vms/internal/auth"
 	controllers "github.com/hoangtu1372k2/vms/internal/controller"
-	"github.com/hoangtu1372k2/vms/internal/model"
 	"gorm.io/gorm"
 
 	cors "github.com/gin-contrib/cors"
@@ -50,66 +49,41 @@ func Run(c *viper.Viper) error {
 	var err error
 
 	runCtx, runCancel = context.WithCancel(context.Background())
-	cfg = c
-	log = logrus.New()
-
-	if cfg.GetBool("debug") {
-		log.Level = logrus.DebugLevel
-		log.Debug("Enabling Debug Logging")
+	err = setup(c)
+	if err != nil {
+		return err
 	}
-	if cfg.GetBool("trace") {
-		log.Level = logrus.TraceLevel
-		log.Debug("Enabling Trace Logging")
+	defer reposity.Close()
+	controllers.InitDB(db)
+	controllers.InitConfig(cfg)
+	store, err := newCache(cfg)
+	if err != nil {
+		return err
 	}
-	if cfg.GetBool("disable_logging") {
-		log.Level = logrus.FatalLevel
+	controllers.InitCache(store)
+	files, err := initStorage(cfg)
+	if err != nil {
+		return err
 	}
-
-	if cfg.GetBool("enable_sql") {
-		log.Infof("Connecting to DB")
-		db, err = reposity.Connect(
-			cfg.GetString("sql_host"),
-			cfg.GetString("sql_port"),
-			cfg.GetString("sql_dbname"),
-			cfg.GetString("sql_sslmode"),
-			cfg.GetString("sql_user"),
-			cfg.GetString("sql_password"),
-			cfg.GetString("sql_schema"))
-		if err != nil {
-			return fmt.Errorf("could not establish database connection - %s", err)
-		}
+	controllers.InitStorage(files)
+	go expireUploads(runCtx, cfg.GetDuration("upload_sweep_interval"))
+	if files != nil {
+		go reconcileStorage(runCtx, cfg.GetDuration("storage_reconcile_interval"))
 	}
-	if !reposity.Connected {
-		log.Infof("SQL DB not configured, skipping")
-	} else {
-		err = reposity.Ping()
-		if err != nil {
-			log.Errorf(err.Error())
-		} else {
-			log.Info("Successfully connected to database")
-			// Migrate tables
-			err = reposity.Migrate(
-				&model.User{},
-				&model.Course{},
-				&model.Assignment{},
-				&model.Notification{},
-				&model.Profile{},
-				&model.Message{},
-				&model.Grade{},
-				&model.AssignmentSubmission{},
-				&model.AssignmentSubmissionFile{},
-				&model.AssignmentDocument{},
-				&model.CourseDocument{},
-				&model.CourseEnrollment{},
-				&model.Lesson{},
-			)
-			if err != nil {
-				panic("Failed to AutoMigrate table! err: " + err.Error())
-			}
+	scanner, err := initScanner(cfg)
+	if err != nil {
+		return err
+	}
+	controllers.InitScanner(scanner)
+	go scanFiles(runCtx, cfg.GetDuration("scan_interval"))
+	go processImages(runCtx, cfg.GetDuration("image_interval"))
+	go flushProgress(runCtx, cfg.GetDuration("progress_flush_interval"))
+	if transcoder := initTranscoder(cfg); transcoder != nil {
+		controllers.InitTranscoder(transcoder)
+		for i := 0; i < cfg.GetInt("video_workers"); i++ {
+			go transcodeVideos(runCtx, cfg.GetDuration("video_interval"))
 		}
 	}
-	defer reposity.Close()
-	controllers.InitMinIO()
 
 	// Cấu hình Swagger
 	swagger.SwaggerInfo.Title = "VMS"
@@ -130,12 +104,14 @@ func Run(c *viper.Viper) error {
 		AllowWildcard:          true,
 		AllowBrowserExtensions: true,
 		AllowOrigins:           []string{"*"},
-		AllowMethods:           []string{"POST", "PUT", "PATCH", "DELETE", "GET", "OPTIONS", "UPDATE"},
+		AllowMethods:           []string{"POST", "PUT", "PATCH", "DELETE", "GET", "HEAD", "OPTIONS", "UPDATE"},
 		AllowHeaders: []string{
 			"Content-Type, content-length, accept-encoding, X-CSRF-Token, " +
 				"access-control-allow-origin, Authorization, X-Max, access-control-allow-headers, " +
-				"accept, origin, Cache-Control, X-Requested-With, X-Request-Source"},
-		MaxAge: 12 * time.Hour,
+				"accept, origin, Cache-Control, X-Requested-With, X-Request-Source, " +
+				strings.Join(controllers.TusAllowHeaders, ", ")},
+		ExposeHeaders: controllers.TusExposeHeaders,
+		MaxAge:        12 * time.Hour,
 	}))
 
 	apiV0 := router.Group(cfg.GetString("service_path"))
@@ -174,6 +150,9 @@ func Run(c *viper.Viper) error {
 		apiV0.GET("/users/:id", handleWrapper(controllers.GetUserByID, false))
 		apiV0.PUT("/users/:id", handleWrapper(controllers.UpdateUser, false))
 		apiV0.DELETE("/users/:id", handleWrapper(controllers.DeleteUser, false))
+		apiV0.POST("/users/bulk", handleWrapper(controllers.BulkCreateUsers, false))
+		apiV0.PUT("/users/bulk", handleWrapper(controllers.BulkUpdateUsers, false))
+		apiV0.DELETE("/users/bulk", handleWrapper(controllers.BulkDeleteUsers, false))
 		apiV0.GET("/users/me", handleWrapper(controllers.GetCurrentUser, false))
 
 		// Course routes
@@ -191,6 +170,9 @@ func Run(c *viper.Viper) error {
 		apiV0.GET("/enrollments/:id", handleWrapper(controllers.GetCourseEnrollmentByID, false))
 		apiV0.PUT("/enrollments/:id", handleWrapper(controllers.UpdateCourseEnrollment, false))
 		apiV0.DELETE("/enrollments/:id", handleWrapper(controllers.DeleteCourseEnrollment, false))
+		apiV0.POST("/enrollments/bulk", handleWrapper(controllers.BulkCreateCourseEnrollments, false))
+		apiV0.PUT("/enrollments/bulk", handleWrapper(controllers.BulkUpdateCourseEnrollments, false))
+		apiV0.DELETE("/enrollments/bulk", handleWrapper(controllers.BulkDeleteCourseEnrollments, false))
 		apiV0.GET("/enrollments/student/:student_id", handleWrapper(controllers.GetStudentEnrollments, false))
 		apiV0.GET("/enrollments/course/:course_id", handleWrapper(controllers.GetCourseEnrollmentsByCourse, false))
 
@@ -216,8 +198,9 @@ func Run(c *viper.Viper) error {
 		apiV0.GET("/assignment-submissions/:id", handleWrapper(controllers.GetAssignmentSubmissionByID, false))
 		apiV0.PUT("/assignment-submissions/:id", handleWrapper(controllers.UpdateAssignmentSubmission, false))
 		apiV0.DELETE("/assignment-submissions/:id", handleWrapper(controllers.DeleteAssignmentSubmission, false))
-		apiV0.GET("/assignment-submissions/assignment/:id", handleWrapper(controllers.GetAssignmentSubmissionsByAssignment, false))
-		apiV0.GET("/assignment-submissions/student/:id", handleWrapper(controllers.GetAssignmentSubmissionsByStudent, false))
+		apiV0.GET("/assignment-submissions/assignment/:assignment_id", handleWrapper(controllers.GetAssignmentSubmissionsByAssignment, false))
+		apiV0.GET("/assignment-submissions/student/:student_id", handleWrapper(controllers.GetAssignmentSubmissionsByStudent, false))
+		apiV0.GET("/assignment-submissions/assignment/:assignment_id/student/:student_id", handleWrapper(controllers.GetSubmissionAttempts, false))
 
 		// Assignment Submission File routes
 		apiV0.GET("/assignment-submission-files", handleWrapper(controllers.GetAssignmentSubmissionFiles, false))
@@ -241,7 +224,15 @@ func Run(c *viper.Viper) error {
 		apiV0.GET("/lessons/:id", handleWrapper(controllers.GetLessonByID, false))
 		apiV0.PUT("/lessons/:id", handleWrapper(controllers.UpdateLesson, false))
 		apiV0.DELETE("/lessons/:id", handleWrapper(controllers.DeleteLesson, false))
-		apiV0.GET("/lessons/course/:id", handleWrapper(controllers.GetLessonsByCourse, false))
+		apiV0.POST("/lessons/bulk", handleWrapper(controllers.BulkCreateLessons, false))
+		apiV0.PUT("/lessons/bulk", handleWrapper(controllers.BulkUpdateLessons, false))
+		apiV0.DELETE("/lessons/bulk", handleWrapper(controllers.BulkDeleteLessons, false))
+		apiV0.GET("/lessons/course/:course_id", handleWrapper(controllers.GetLessonsByCourse, false))
+		apiV0.POST("/lessons/:id/progress", handleWrapper(controllers.RecordLessonProgress, true))
+		apiV0.GET("/lessons/:id/progress", handleWrapper(controllers.GetLessonProgress, true))
+		apiV0.GET("/lessons/:id/checkpoints", handleWrapper(controllers.ListLessonCheckpoints, true))
+		apiV0.POST("/lessons/:id/checkpoints/:checkpoint_id/answers", handleWrapper(controllers.AnswerLessonCheckpoint, true))
+		apiV0.GET("/lessons/:id/checkpoint-results", handleWrapper(controllers.GetLessonCheckpointResults, true))
 
 		// Comment routes
 		apiV0.GET("/comments", handleWrapper(controllers.GetComments, false))
@@ -254,13 +245,19 @@ func Run(c *viper.Viper) error {
 
 		// Grade routes
 		apiV0.GET("/grades", handleWrapper(controllers.GetGrades, false))
-		apiV0.POST("/grades", handleWrapper(controllers.CreateGrade, false))
+		apiV0.POST("/grades", handleWrapper(controllers.CreateGrade, true))
 		apiV0.GET("/grades/:id", handleWrapper(controllers.GetGradeByID, false))
-		apiV0.PUT("/grades/:id", handleWrapper(controllers.UpdateGrade, false))
-		apiV0.DELETE("/grades/:id", handleWrapper(controllers.DeleteGrade, false))
+		apiV0.PUT("/grades/:id", handleWrapper(controllers.UpdateGrade, true))
+		apiV0.DELETE("/grades/:id", handleWrapper(controllers.DeleteGrade, true))
+		apiV0.POST("/grades/bulk", handleWrapper(controllers.BulkCreateGrades, true))
+		apiV0.PUT("/grades/bulk", handleWrapper(controllers.BulkUpdateGrades, true))
+		apiV0.DELETE("/grades/bulk", handleWrapper(controllers.BulkDeleteGrades, true))
 		apiV0.GET("/grades/student/:id", handleWrapper(controllers.GetStudentGrades, false))
 		apiV0.GET("/grades/assignment/:id", handleWrapper(controllers.GetAssignmentGrades, false))
 		apiV0.GET("/grades/course/:id", handleWrapper(controllers.GetCourseGrades, false))
+		apiV0.GET("/grades/:id/history", handleWrapper(controllers.GetGradeHistory, true))
+		apiV0.POST("/grades/:id/restore", handleWrapper(controllers.RestoreGrade, true))
+		apiV0.GET("/grades/student/:id/as-of", handleWrapper(controllers.GetStudentGradebookAsOf, true))
 
 		// Submission routes
 		apiV0.GET("/submissions", handleWrapper(controllers.GetSubmissions, false))
@@ -268,16 +265,59 @@ func Run(c *viper.Viper) error {
 		apiV0.GET("/submissions/:id", handleWrapper(controllers.GetSubmissionByID, false))
 		apiV0.PUT("/submissions/:id", handleWrapper(controllers.UpdateSubmission, false))
 		apiV0.DELETE("/submissions/:id", handleWrapper(controllers.DeleteSubmission, false))
-		apiV0.GET("/submissions/student/:id", handleWrapper(controllers.GetStudentSubmissions, false))
+		apiV0.GET("/submissions/student/:student_id", handleWrapper(controllers.GetStudentSubmissions, false))
 		apiV0.GET("/submissions/latest/:student_id/:assignment_id", handleWrapper(controllers.GetLatestSubmission, false))
 
+		// Search routes
+		apiV0.GET("/search", handleWrapper(controllers.Search, true))
+
 		// Notification routes
 		apiV0.GET("/notifications", handleWrapper(controllers.GetNotifications, false))
 
 		// Other utility routes
 		apiV0.GET("/health", handleWrapper(controllers.Health, false))
+		apiV0.GET("/health/ready", handleWrapper(controllers.Ready, false))
 		apiV0.POST("/upload", handleWrapper(controllers.UploadFile, false))
 		apiV0.GET("/file", handleWrapper(controllers.GetFile, false))
+		apiV0.GET("/storage/*key", handleWrapper(controllers.ServeStoredFile, false))
+		apiV0.PUT("/storage/*key", handleWrapper(controllers.ReceiveStoredFile, false))
+		apiV0.POST("/uploads/initiate", handleWrapper(controllers.InitiateUpload, true))
+		apiV0.POST("/uploads/complete", handleWrapper(controllers.CompleteUpload, true))
+
+		// Resumable upload routes (tus 1.0)
+		apiV0.OPTIONS("/tus", handleWrapper(controllers.TusOptions, false))
+		apiV0.POST("/tus", handleWrapper(controllers.CreateTusUpload, true))
+		apiV0.HEAD("/tus/:id", handleWrapper(controllers.GetTusUploadOffset, true))
+		apiV0.PATCH("/tus/:id", handleWrapper(controllers.PatchTusUpload, true))
+		apiV0.DELETE("/tus/:id", handleWrapper(controllers.TerminateTusUpload, true))
+
+		// Video routes
+		apiV0.POST("/videos", handleWrapper(controllers.CreateVideoAsset, true))
+		apiV0.GET("/videos/:id", handleWrapper(controllers.GetVideoAsset, true))
+		apiV0.POST("/videos/:id/retry", handleWrapper(controllers.RetryVideoAsset, true))
+		apiV0.POST("/videos/:id/playback", handleWrapper(controllers.CreatePlaybackToken, true))
+		apiV0.GET("/videos/:id/stream", handleWrapper(controllers.StreamVideo, false))
+		apiV0.HEAD("/videos/:id/stream", handleWrapper(controllers.StreamVideo, false))
+		apiV0.GET("/videos/:id/hls/*path", handleWrapper(controllers.StreamHLS, false))
+		apiV0.HEAD("/videos/:id/hls/*path", handleWrapper(controllers.StreamHLS, false))
+		apiV0.GET("/videos/:id/keys/:key_id", handleWrapper(controllers.GetVideoKey, false))
+		apiV0.POST("/videos/:id/keys/revoke", handleWrapper(controllers.RevokeVideoKeys, true))
+		apiV0.GET("/videos/:id/key-accesses", handleWrapper(controllers.ListVideoKeyAccesses, true))
+		apiV0.POST("/videos/:id/captions", handleWrapper(controllers.CreateVideoCaption, true))
+		apiV0.GET("/videos/:id/captions", handleWrapper(controllers.ListVideoCaptions, true))
+		apiV0.GET("/videos/:id/captions/:caption_id", handleWrapper(controllers.GetVideoCaption, true))
+		apiV0.PUT("/videos/:id/captions/:caption_id", handleWrapper(controllers.UpdateVideoCaption, true))
+		apiV0.DELETE("/videos/:id/captions/:caption_id", handleWrapper(controllers.DeleteVideoCaption, true))
+		apiV0.POST("/videos/:id/captions/:caption_id/cues", handleWrapper(controllers.AddCaptionCue, true))
+		apiV0.PUT("/videos/:id/captions/:caption_id/cues/:cue_id", handleWrapper(controllers.UpdateCaptionCue, true))
+		apiV0.DELETE("/videos/:id/captions/:caption_id/cues/:cue_id", handleWrapper(controllers.DeleteCaptionCue, true))
+		apiV0.GET("/videos/:id/chapters", handleWrapper(controllers.ListVideoChapters, true))
+		apiV0.PUT("/videos/:id/chapters", handleWrapper(controllers.SetVideoChapters, true))
+		apiV0.POST("/videos/:id/checkpoints", handleWrapper(controllers.CreateVideoCheckpoint, true))
+		apiV0.GET("/videos/:id/checkpoints", handleWrapper(controllers.ListVideoCheckpoints, true))
+		apiV0.PUT("/videos/:id/checkpoints/:checkpoint_id", handleWrapper(controllers.UpdateVideoCheckpoint, true))
+		apiV0.DELETE("/videos/:id/checkpoints/:checkpoint_id", handleWrapper(controllers.DeleteVideoCheckpoint, true))
+		apiV0.GET("/videos/:id/analytics", handleWrapper(controllers.GetVideoAnalytics, true))
 
 		srv = &http.Server{
 			Addr:    cfg.GetString("listen_addr"),
@@ -403,59 +443,14 @@ func handleWrapper(n gin.HandlerFunc, tokenRequired bool) gin.HandlerFunc {
 
 		// Kiểm tra token nếu endpoint yêu cầu xác thực
 		if tokenRequired {
-			// Lấy token từ header Authorization
-			authHeader := c.GetHeader("Authorization")
-			log.WithFields(logrus.Fields{
-				"auth_header": authHeader,
-				"path":        c.Request.URL.Path,
-			}).Debug("Checking authorization header")
-
-			if authHeader == "" {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
-				return
-			}
-
-			// Kiểm tra format của token
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
+			if err := authenticate(c); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 				return
 			}
-
-			tokenString := parts[1]
-			log.WithFields(logrus.Fields{
-				"token": tokenString[:10] + "...", // Log một phần của token để debug
-			}).Debug("Validating token")
-
-			// Xác thực JWT token
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(cfg.GetString("jwt_secret")), nil
-			})
-
-			if err != nil {
-				log.WithError(err).Error("Token validation failed")
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
-				return
-			}
-
-			if !token.Valid {
-				log.Error("Token is invalid")
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-				return
-			}
-
-			// Lấy thông tin user từ token
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				c.Set("user_id", claims["user_id"])
-				c.Set("username", claims["username"])
-				c.Set("role", claims["role"])
-				log.WithFields(logrus.Fields{
-					"user_id":  claims["user_id"],
-					"username": claims["username"],
-				}).Debug("User authenticated successfully")
+		} else if c.GetHeader("Authorization") != "" {
+			// Endpoint công khai: token hợp lệ thì nhận diện caller, token lỗi thì coi như ẩn danh
+			if err := authenticate(c); err != nil {
+				log.WithError(err).Debug("Ignoring invalid token on public endpoint")
 			}
 		}
 
@@ -464,3 +459,59 @@ func handleWrapper(n gin.HandlerFunc, tokenRequired bool) gin.HandlerFunc {
 		stats.Srv.WithLabelValues(c.Request.URL.Path).Observe(time.Since(now).Seconds())
 	}
 }
+
+// authenticate validates the bearer token of the request and stores its claims
+// on the gin context
+func authenticate(c *gin.Context) error {
+	// Lấy token từ header Authorization
+	authHeader := c.GetHeader("Authorization")
+	log.WithFields(logrus.Fields{
+		"auth_header": authHeader,
+		"path":        c.Request.URL.Path,
+	}).Debug("Checking authorization header")
+
+	if authHeader == "" {
+		return fmt.Errorf("authorization header is required")
+	}
+
+	// Kiểm tra format của token
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return fmt.Errorf("invalid authorization header format")
+	}
+
+	tokenString := parts[1]
+	log.WithFields(logrus.Fields{
+		"token": tokenString[:min(len(tokenString), 10)] + "...", // Log một phần của token để debug
+	}).Debug("Validating token")
+
+	// Xác thực JWT token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(cfg.GetString("jwt_secret")), nil
+	})
+
+	if err != nil {
+		log.WithError(err).Error("Token validation failed")
+		return fmt.Errorf("invalid token: %s", err)
+	}
+
+	if !token.Valid {
+		log.Error("Token is invalid")
+		return fmt.Errorf("invalid token")
+	}
+
+	// Lấy thông tin user từ token
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		c.Set("user_id", claims["id"])
+		c.Set("username", claims["username"])
+		c.Set("role", claims["role"])
+		log.WithFields(logrus.Fields{
+			"user_id":  claims["id"],
+			"username": claims["username"],
+		}).Debug("User authenticated successfully")
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/archive"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"github.com/spf13/viper"
+)
+
+// Export writes a logical backup archive.
+//
+//	export [-o file] [-course id,...] [-instructor id,...] [-skip-objects]
+//
+// Without -course or -instructor the whole instance is exported. The tree has
+// no organization entity, an instructor's courses are the widest grouping
+// below the whole instance.
+func Export(c *viper.Viper, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", fmt.Sprintf("vms-export-%s.tar.gz", time.Now().Format("20060102-150405")), "archive file to write, - for stdout")
+	courses := flags.String("course", "", "comma separated course ids to export")
+	instructors := flags.String("instructor", "", "comma separated instructor ids whose courses are exported")
+	skipObjects := flags.Bool("skip-objects", false, "do not include the stored files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var scope archive.Scope
+	var err error
+	if scope.Courses, err = parseIDs(*courses); err != nil {
+		return fmt.Errorf("invalid -course - %s", err)
+	}
+	if scope.Instructors, err = parseIDs(*instructors); err != nil {
+		return fmt.Errorf("invalid -instructor - %s", err)
+	}
+
+	if err := setup(c); err != nil {
+		return err
+	}
+	defer reposity.Close()
+	if !reposity.Connected {
+		return fmt.Errorf("export requires a database connection")
+	}
+
+	var objects archive.ObjectStore
+	if !*skipObjects {
+		if objects, err = newArchiveObjects(); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	manifest, err := archive.Export(context.Background(), db, objects, scope, w)
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+	for _, key := range manifest.MissingObjects {
+		log.Warnf("Object %s is referenced but missing from storage, skipped", key)
+	}
+	log.WithField("entities", manifest.Entities).Infof("Exported archive %s with %d object(s)", *output, len(manifest.Objects))
+	return nil
+}
+
+// Import merges an archive written by Export into the database.
+//
+//	import [-skip-objects] file
+//
+// Rows get new ids which are remembered per source instance, so running the
+// same import again updates what the first run created.
+func Import(c *viper.Viper, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	skipObjects := flags.Bool("skip-objects", false, "do not upload the stored files, file URLs are kept unchanged")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-skip-objects] file")
+	}
+
+	if err := setup(c); err != nil {
+		return err
+	}
+	defer reposity.Close()
+	if !reposity.Connected {
+		return fmt.Errorf("import requires a database connection")
+	}
+
+	var objects archive.ObjectStore
+	var err error
+	if !*skipObjects {
+		if objects, err = newArchiveObjects(); err != nil {
+			return err
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	_, report, err := archive.Import(context.Background(), db, objects, r)
+	if err != nil {
+		return err
+	}
+	summary, _ := json.Marshal(report.Entities)
+	log.Infof("Imported archive from instance %s: %s, %d object(s)", report.SourceInstance, summary, report.Objects)
+	if report.Dangling > 0 {
+		log.Warnf("%d reference(s) point to rows missing from both the archive and this instance, kept unchanged", report.Dangling)
+	}
+	return nil
+}
+
+func parseIDs(list string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// storageObjects stores archive objects in the file storage used for uploads
+type storageObjects struct {
+	storage.Storage
+}
+
+func newArchiveObjects() (archive.ObjectStore, error) {
+	store, err := newStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("file storage (%s) is not available - %s, use -skip-objects to leave the stored files out", cfg.GetString("storage_driver"), err)
+	}
+	return &storageObjects{store}, nil
+}
+
+func (s *storageObjects) Stat(ctx context.Context, key string) (archive.ObjectInfo, error) {
+	info, err := s.Storage.Stat(ctx, key)
+	if err != nil {
+		return archive.ObjectInfo{}, err
+	}
+	return archive.ObjectInfo{Key: key, Size: info.Size, ContentType: info.ContentType}, nil
+}
+
+func (s *storageObjects) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, _, err := s.Storage.Get(ctx, key)
+	return r, err
+}
+
+func (s *storageObjects) Put(ctx context.Context, info archive.ObjectInfo, r io.Reader) error {
+	_, err := s.Storage.Put(ctx, info.Key, r, info.Size, storage.PutOptions{ContentType: info.ContentType})
+	return err
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/hoangtu1372k2/vms/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+)
+
+// cacheStats counts cache lookups next to the telemetry metrics, in the same
+// default registry
+type cacheStats struct {
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+var cacheMetrics = &cacheStats{
+	hits: promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_hits_total",
+		Help: "Number of reads served from the cache",
+	},
+		[]string{"resource"},
+	),
+	misses: promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_misses_total",
+		Help: "Number of reads that had to load from the database",
+	},
+		[]string{"resource"},
+	),
+}
+
+func (s *cacheStats) Hit(resource string) {
+	s.hits.WithLabelValues(resource).Inc()
+}
+
+func (s *cacheStats) Miss(resource string) {
+	s.misses.WithLabelValues(resource).Inc()
+}
+
+// newCache builds the cache selected by cache_driver: memory, redis or none.
+// A nil store disables caching.
+func newCache(c *viper.Viper) (*cache.Store, error) {
+	var backend cache.Cache
+	switch c.GetString("cache_driver") {
+	case "none":
+		return nil, nil
+	case "memory":
+		backend = cache.NewLRU(c.GetInt("cache_size"))
+	case "redis":
+		redis, err := cache.NewRedis(cache.RedisOptions{
+			Addr:     c.GetString("redis_host") + ":" + c.GetString("redis_post"),
+			Password: c.GetString("redis_password"),
+			DB:       c.GetInt("redis_db"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to redis - %s", err)
+		}
+		backend = redis
+	default:
+		return nil, fmt.Errorf("unknown cache_driver %s, expected one of: memory, redis, none", c.GetString("cache_driver"))
+	}
+	return cache.NewStore(backend, cacheMetrics, c.GetDuration("cache_ttl"), log), nil
+}
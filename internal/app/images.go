@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+)
+
+// processImages makes the variants of the queued images when one is queued
+// and every interval until ctx ends
+func processImages(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-controllers.ImagesQueued():
+		}
+		for {
+			n, err := controllers.ProcessImages(ctx, 100)
+			if err != nil {
+				log.Errorf("Could not process the uploaded images - %s", err)
+				break
+			}
+			if n > 0 {
+				log.Infof("Made the variants of %d image(s)", n)
+			}
+			if n < 100 {
+				break
+			}
+		}
+	}
+}
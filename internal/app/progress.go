@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+)
+
+// flushProgress writes the buffered watch progress every interval and when a
+// batch is full, and once more when ctx ends so no heartbeat is lost
+func flushProgress(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := controllers.FlushProgress(flushCtx); err != nil {
+				log.Errorf("Could not write the watch progress on shutdown - %s", err)
+			}
+			return
+		case <-ticker.C:
+		case <-controllers.ProgressFull():
+		}
+		n, err := controllers.FlushProgress(ctx)
+		if err != nil {
+			log.Errorf("Could not write the watch progress - %s", err)
+			continue
+		}
+		if n > 0 {
+			log.Debugf("Wrote the watch progress of %d viewer(s)", n)
+		}
+	}
+}
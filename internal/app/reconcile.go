@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hoangtu1372k2/common-go/reposity"
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+	"github.com/spf13/viper"
+)
+
+// Reconcile lists the stored objects against the rows referencing them.
+//
+//	reconcile [-apply] [-grace duration]
+//
+// Orphaned objects and rows whose file is missing are reported. With -apply
+// orphans older than the grace period are deleted and the broken rows are
+// flagged with file_missing_at.
+func Reconcile(c *viper.Viper, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	apply := flags.Bool("apply", false, "delete the expired orphans and flag the broken rows")
+	grace := flags.Duration("grace", c.GetDuration("storage_orphan_grace"), "age below which orphans are kept")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := setup(c); err != nil {
+		return err
+	}
+	defer reposity.Close()
+	if !reposity.Connected {
+		return fmt.Errorf("reconcile requires a database connection")
+	}
+	files, err := newStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("file storage (%s) is not available - %s", cfg.GetString("storage_driver"), err)
+	}
+	controllers.InitDB(db)
+	controllers.InitConfig(cfg)
+	controllers.InitStorage(files)
+
+	report, err := controllers.ReconcileStorage(context.Background(), *apply, *grace)
+	if err != nil {
+		return err
+	}
+	for _, orphan := range report.Orphans {
+		state := "kept, within the grace period"
+		switch {
+		case orphan.Deleted:
+			state = "deleted"
+		case orphan.Expired && *apply:
+			state = "could not be deleted"
+		case orphan.Expired:
+			state = "expired"
+		}
+		log.Infof("Orphan %s (%d bytes, stored %s) %s", orphan.Key, orphan.Size, orphan.ModTime.Format(time.RFC3339), state)
+	}
+	for _, row := range report.Dangling {
+		state := ""
+		if row.Flagged {
+			state = ", flagged"
+		}
+		log.Warnf("Dangling %s %s: %s %s is missing%s", row.Table, row.ID, row.Column, row.Key, state)
+	}
+	logReconcile(report)
+	if !*apply && (len(report.Orphans) > 0 || len(report.Dangling) > 0 || report.Restored > 0) {
+		log.Infof("Run again with -apply to delete the orphans older than %s and flag the broken rows", *grace)
+	}
+	return nil
+}
+
+// reconcileStorage reconciles the file storage every interval until ctx
+// ends, applying the result when storage_reconcile_apply is set
+func reconcileStorage(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := controllers.ReconcileStorage(ctx, cfg.GetBool("storage_reconcile_apply"), cfg.GetDuration("storage_orphan_grace"))
+		if err != nil {
+			log.Errorf("Could not reconcile the file storage - %s", err)
+			continue
+		}
+		logReconcile(report)
+	}
+}
+
+// logReconcile logs the summary of a reconciliation
+func logReconcile(report controllers.StorageReport) {
+	entry := log.WithField("objects", report.Objects).WithField("referenced", report.Referenced).WithField("external", report.External)
+	if !report.Applied {
+		entry.Infof("Storage reconciled: %d orphan(s) holding %d bytes, %d dangling reference(s), %d missing file(s) back", len(report.Orphans), report.OrphanBytes, len(report.Dangling), report.Restored)
+		return
+	}
+	entry.Infof("Storage reconciled: %d orphan(s) holding %d bytes, %d deleted, %d dangling reference(s), %d flagged, %d missing file(s) back and cleared",
+		len(report.Orphans), report.OrphanBytes, report.Deleted, len(report.Dangling), report.Flagged, report.Restored)
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/migration"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Recount repairs drifted course aggregate counters.
+//
+// The source tables are locked in SHARE mode while counting, so the recount
+// never races with writers whose triggers would otherwise be overwritten.
+func Recount(c *viper.Viper) error {
+	err := setup(c)
+	if err != nil {
+		return err
+	}
+	defer reposity.Close()
+	if !reposity.Connected {
+		return fmt.Errorf("recount requires a database connection")
+	}
+
+	var repaired int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		lock := fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", strings.Join(migration.CounterTables, ", "))
+		if err := tx.Exec(lock).Error; err != nil {
+			return err
+		}
+		result := tx.Exec(migration.RecountCourseCounters)
+		repaired = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not recount course counters - %s", err)
+	}
+
+	log.Infof("Recounted course counters, repaired %d course(s)", repaired)
+	return nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+	"github.com/hoangtu1372k2/vms/internal/scan"
+	"github.com/spf13/viper"
+)
+
+// initScanner connects to clamd at clamd_address. Without an address files
+// are not scanned and can be downloaded right after the upload.
+func initScanner(c *viper.Viper) (scan.Scanner, error) {
+	address := c.GetString("clamd_address")
+	if address == "" {
+		log.Warnf("No clamd_address configured, uploaded files are not scanned for malware")
+		return nil, nil
+	}
+	clamd, err := scan.NewClamd(address, c.GetDuration("scan_timeout"))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.GetDuration("storage_timeout"))
+	defer cancel()
+	if err := clamd.Ping(ctx); err != nil {
+		// Files wait in pending_scan until clamd is reachable
+		log.Errorf("clamd at %s is not reachable, uploaded files stay pending - %s", address, err)
+	}
+	return clamd, nil
+}
+
+// scanFiles scans the files waiting for their scan when one is queued and
+// every interval until ctx ends
+func scanFiles(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-controllers.ScanQueued():
+		}
+		for {
+			n, err := controllers.ScanPendingFiles(ctx, 100)
+			if err != nil {
+				log.Errorf("Could not scan the uploaded files - %s", err)
+				break
+			}
+			if n > 0 {
+				log.Infof("Scanned %d uploaded file(s)", n)
+			}
+			if n < 100 {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/archive"
+	"github.com/hoangtu1372k2/vms/internal/seed"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Seed fills the database with a generated demo dataset.
+//
+//	seed [-seed n] [-size small|medium|large] [-students n] ... [-reset] [-skip-objects]
+//
+// A database that already holds users or courses is refused. Outside of the
+// production environment -reset empties the seeded tables first; production
+// databases are never reset.
+func Seed(c *viper.Viper, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	seedValue := flags.Uint64("seed", 1, "seed value, the same seed gives the same dataset")
+	preset := flags.String("size", "small", "size preset: small, medium or large")
+	admins := flags.Int("admins", 0, "number of admins, overrides the preset")
+	teachers := flags.Int("teachers", 0, "number of teachers, overrides the preset")
+	students := flags.Int("students", 0, "number of students, overrides the preset")
+	courses := flags.Int("courses", 0, "number of courses, overrides the preset")
+	lessons := flags.Int("lessons", 0, "lessons per course, overrides the preset")
+	assignments := flags.Int("assignments", 0, "assignments per course, overrides the preset")
+	enrollments := flags.Int("enrollments", 0, "students enrolled per course, overrides the preset")
+	epoch := flags.String("epoch", "2025-09-01", "start date of the generated courses")
+	password := flags.String("password", "demo1234", "password of every generated user")
+	reset := flags.Bool("reset", false, "empty the seeded tables first, refused in production")
+	skipObjects := flags.Bool("skip-objects", false, "do not generate documents and submission files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	size, ok := seed.Sizes[*preset]
+	if !ok {
+		return fmt.Errorf("unknown size %s, expected one of: small, medium, large", *preset)
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "admins":
+			size.Admins = *admins
+		case "teachers":
+			size.Teachers = *teachers
+		case "students":
+			size.Students = *students
+		case "courses":
+			size.Courses = *courses
+		case "lessons":
+			size.LessonsPerCourse = *lessons
+		case "assignments":
+			size.AssignmentsPerCourse = *assignments
+		case "enrollments":
+			size.StudentsPerCourse = *enrollments
+		}
+	})
+	start, err := time.Parse("2006-01-02", *epoch)
+	if err != nil {
+		return fmt.Errorf("invalid -epoch - %s", err)
+	}
+
+	if err := setup(c); err != nil {
+		return err
+	}
+	defer reposity.Close()
+	if !reposity.Connected {
+		return fmt.Errorf("seed requires a database connection")
+	}
+
+	production := cfg.GetString("environment") == "production"
+	if *reset && production {
+		return fmt.Errorf("refusing to reset a production database")
+	}
+	var existing int64
+	err = db.Raw(`SELECT (SELECT count(*) FROM "user") + (SELECT count(*) FROM course)`).Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing > 0 && !*reset {
+		if production {
+			return fmt.Errorf("refusing to seed a non-empty production database")
+		}
+		return fmt.Errorf("database is not empty, use -reset to empty it first")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	opts := seed.Options{
+		Seed:         *seedValue,
+		Size:         size,
+		Epoch:        start,
+		PasswordHash: string(hash),
+	}
+	var objects archive.ObjectStore
+	if !*skipObjects {
+		if objects, err = newArchiveObjects(); err != nil {
+			return err
+		}
+		opts.URL = objects.URL
+	}
+
+	data, err := seed.Generate(opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range data.Files {
+		info := archive.ObjectInfo{Key: f.Key, Size: int64(len(f.Data)), ContentType: f.ContentType}
+		if err := objects.Put(context.Background(), info, bytes.NewReader(f.Data)); err != nil {
+			return fmt.Errorf("could not store %s - %s", f.Key, err)
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if *reset {
+			if err := seed.Reset(tx); err != nil {
+				return err
+			}
+		}
+		return data.Insert(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("could not insert the dataset - %s", err)
+	}
+
+	counts := data.Counts()
+	tables := make([]string, 0, len(counts))
+	for table := range counts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		log.Infof("Seeded %d %s row(s)", counts[table], table)
+	}
+	log.Infof("Seeded with seed %d, log in as admin01, teacher001 or student0001 (@%s) with password %q",
+		*seedValue, seed.EmailDomain, *password)
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/migration"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// setup prepares the config, the logger and the migrated database connection
+// shared by the server and the admin commands.
+func setup(c *viper.Viper) error {
+	var err error
+
+	cfg = c
+	log = logrus.New()
+
+	if cfg.GetBool("debug") {
+		log.Level = logrus.DebugLevel
+		log.Debug("Enabling Debug Logging")
+	}
+	if cfg.GetBool("trace") {
+		log.Level = logrus.TraceLevel
+		log.Debug("Enabling Trace Logging")
+	}
+	if cfg.GetBool("disable_logging") {
+		log.Level = logrus.FatalLevel
+	}
+
+	if cfg.GetBool("enable_sql") {
+		log.Infof("Connecting to DB")
+		db, err = reposity.Connect(
+			cfg.GetString("sql_host"),
+			cfg.GetString("sql_port"),
+			cfg.GetString("sql_dbname"),
+			cfg.GetString("sql_sslmode"),
+			cfg.GetString("sql_user"),
+			cfg.GetString("sql_password"),
+			cfg.GetString("sql_schema"))
+		if err != nil {
+			return fmt.Errorf("could not establish database connection - %s", err)
+		}
+	}
+	if !reposity.Connected {
+		log.Infof("SQL DB not configured, skipping")
+	} else {
+		err = reposity.Ping()
+		if err != nil {
+			log.Error(err)
+		} else {
+			log.Info("Successfully connected to database")
+			// Migrate tables
+			err = reposity.Migrate(
+				&model.User{},
+				&model.Course{},
+				&model.Assignment{},
+				&model.Notification{},
+				&model.Profile{},
+				&model.Message{},
+				&model.Grade{},
+				&model.GradeRevision{},
+				&model.AssignmentSubmission{},
+				&model.AssignmentSubmissionFile{},
+				&model.Comment{},
+				&model.AssignmentDocument{},
+				&model.CourseDocument{},
+				&model.CourseEnrollment{},
+				&model.Lesson{},
+				&model.Upload{},
+				&model.ResumableUpload{},
+				&model.ResumableUploadChunk{},
+				&model.FileScan{},
+				&model.ImageAsset{},
+				&model.VideoAsset{},
+				&model.VideoKey{},
+				&model.VideoKeyAccess{},
+				&model.VideoCaption{},
+				&model.VideoChapter{},
+				&model.VideoCheckpoint{},
+				&model.CheckpointAnswer{},
+				&model.LessonProgress{},
+				&model.VideoEngagementBucket{},
+				&model.VideoEngagementDay{},
+				&model.VideoEngagementViewer{},
+			)
+			if err != nil {
+				panic("Failed to AutoMigrate table! err: " + err.Error())
+			}
+			err = migration.Apply(db)
+			if err != nil {
+				panic("Failed to apply migrations! err: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
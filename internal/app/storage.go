@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"github.com/spf13/viper"
+)
+
+// newStorage builds the file storage selected by storage_driver: minio or
+// local. The store is checked before it is returned.
+func newStorage(c *viper.Viper) (storage.Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.GetDuration("storage_timeout"))
+	defer cancel()
+
+	var store storage.Storage
+	switch c.GetString("storage_driver") {
+	case "minio":
+		minio, err := storage.NewMinIO(ctx, storage.MinIOOptions{
+			Endpoint:  c.GetString("minio_endpoint"),
+			AccessKey: c.GetString("minio_access_key"),
+			SecretKey: c.GetString("minio_secret_key"),
+			UseSSL:    c.GetBool("minio_use_ssl"),
+			Region:    c.GetString("minio_region"),
+			Bucket:    c.GetString("storage_bucket"),
+			Prefix:    c.GetString("storage_prefix"),
+			PublicURL: c.GetString("storage_public_url"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		store = minio
+	case "local":
+		publicURL := c.GetString("storage_public_url")
+		if publicURL == "" {
+			scheme := "http"
+			if c.GetBool("enable_tls") {
+				scheme = "https"
+			}
+			publicURL = fmt.Sprintf("%s://%s%s/storage", scheme, c.GetString("base_url"), c.GetString("service_path"))
+		}
+		local, err := storage.NewLocal(storage.LocalOptions{
+			Root:       c.GetString("storage_local_path"),
+			Prefix:     c.GetString("storage_prefix"),
+			PublicURL:  publicURL,
+			SigningKey: storageSigningKey(c),
+		})
+		if err != nil {
+			return nil, err
+		}
+		store = local
+	default:
+		return nil, fmt.Errorf("unknown storage_driver %s, expected one of: minio, local", c.GetString("storage_driver"))
+	}
+
+	if err := store.Health(ctx); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// storageSigningKey signs the URLs of the local store. Without
+// storage_signing_key or jwt_secret a random key is used and signed URLs stop
+// working when the service restarts.
+func storageSigningKey(c *viper.Viper) []byte {
+	for _, name := range []string{"storage_signing_key", "jwt_secret"} {
+		if key := c.GetString(name); key != "" {
+			return []byte(key)
+		}
+	}
+	log.Warnf("No storage_signing_key configured, signed file URLs will not survive a restart")
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// initStorage sets up the store of the server. When storage_required is
+// false the service starts without it and the file endpoints answer 503.
+func initStorage(c *viper.Viper) (storage.Storage, error) {
+	start := time.Now()
+	store, err := newStorage(c)
+	if err != nil {
+		if c.GetBool("storage_required") {
+			return nil, fmt.Errorf("file storage (%s) is not available - %s", c.GetString("storage_driver"), err)
+		}
+		log.Errorf("File storage (%s) is not available, file endpoints are disabled - %s", c.GetString("storage_driver"), err)
+		return nil, nil
+	}
+	log.Infof("Connected to %s file storage in %s", store.Driver(), time.Since(start).Round(time.Millisecond))
+	return store, nil
+}
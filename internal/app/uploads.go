@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+)
+
+// expireUploads drops abandoned direct and resumable uploads every interval
+// until ctx ends
+func expireUploads(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sweepUploads(ctx, "abandoned upload", controllers.ExpireUploads)
+		sweepUploads(ctx, "resumable upload", controllers.ExpireTusUploads)
+	}
+}
+
+// sweepUploads calls expire in batches of 100 until a batch is not full
+func sweepUploads(ctx context.Context, what string, expire func(context.Context, int) (int, error)) {
+	for {
+		n, err := expire(ctx, 100)
+		if err != nil {
+			log.Errorf("Could not expire %ss - %s", what, err)
+			return
+		}
+		if n > 0 {
+			log.Infof("Expired %d %s(s)", n, what)
+		}
+		if n < 100 {
+			return
+		}
+	}
+}
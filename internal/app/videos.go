@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	controllers "github.com/hoangtu1372k2/vms/internal/controller"
+	"github.com/hoangtu1372k2/vms/internal/video"
+	"github.com/spf13/viper"
+)
+
+// initTranscoder finds ffmpeg and ffprobe. Without them videos are not
+// transcoded and stay queued until an instance with ffmpeg picks them up.
+func initTranscoder(c *viper.Viper) *video.Transcoder {
+	ffmpeg, err := exec.LookPath(c.GetString("ffmpeg_path"))
+	if err != nil {
+		log.Warnf("ffmpeg not found, uploaded videos are not transcoded - %s", err)
+		return nil
+	}
+	ffprobe, err := exec.LookPath(c.GetString("ffprobe_path"))
+	if err != nil {
+		log.Warnf("ffprobe not found, uploaded videos are not transcoded - %s", err)
+		return nil
+	}
+	return &video.Transcoder{
+		FFmpeg:          ffmpeg,
+		FFprobe:         ffprobe,
+		SegmentDuration: c.GetInt("video_segment_duration"),
+		Preset:          c.GetString("video_preset"),
+	}
+}
+
+// transcodeVideos transcodes the queued videos when one is queued and every
+// interval until ctx ends. Each of the video_workers runs one ffmpeg.
+func transcodeVideos(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || db == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-controllers.VideosQueued():
+		}
+		for {
+			n, err := controllers.TranscodeVideos(ctx, 1)
+			if err != nil {
+				log.Errorf("Could not transcode the uploaded videos - %s", err)
+				break
+			}
+			if n > 0 {
+				log.Infof("Transcoded %d video(s)", n)
+			}
+			if n < 1 {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Package archive implements the logical backup format used by the export and
+import commands.
+
+An archive is a gzip compressed tar file holding, in this order:
+
+	manifest.json        format, version, source instance and contents
+	data/<entity>.jsonl  one JSON object per row
+	objects/<key>        the stored files referenced by the rows
+
+Imports give every row a new id and remember the mapping per source instance,
+so importing the same archive again, or a newer export of the same source,
+updates the rows created the first time instead of duplicating them.
+*/
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Format identifies vms archives and Version is the layout written by Export.
+// Import reads every version up to Version.
+const (
+	Format  = "vms-archive"
+	Version = 1
+)
+
+const (
+	manifestName = "manifest.json"
+	dataDir      = "data/"
+	objectsDir   = "objects/"
+)
+
+// Scope selects what Export writes. Courses and Instructors are combined, an
+// empty scope exports the whole instance.
+type Scope struct {
+	Courses     []uuid.UUID `json:"courses,omitempty"`
+	Instructors []uuid.UUID `json:"instructors,omitempty"`
+}
+
+// Manifest describes an archive
+type Manifest struct {
+	Format         string         `json:"format"`
+	Version        int            `json:"version"`
+	SourceInstance uuid.UUID      `json:"source_instance"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Scope          Scope          `json:"scope"`
+	Entities       map[string]int `json:"entities"`
+	Objects        []ObjectInfo   `json:"objects"`
+	MissingObjects []string       `json:"missing_objects,omitempty"`
+}
+
+// ObjectInfo is one stored file included in the archive
+type ObjectInfo struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// ObjectStore gives access to the stored files referenced by rows
+type ObjectStore interface {
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, info ObjectInfo, r io.Reader) error
+	// Key returns the object key of a file URL stored in a row, false when
+	// the URL does not point into a store of this kind. The host is ignored so
+	// URLs written by another instance are recognized too.
+	Key(url string) (string, bool)
+	// URL returns the URL rows use to reference the object
+	URL(key string) string
+}
+
+// EntityReport counts what an import did with the rows of one entity
+type EntityReport struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// Report summarizes an import
+type Report struct {
+	SourceInstance uuid.UUID               `json:"source_instance"`
+	Entities       map[string]EntityReport `json:"entities"`
+	Objects        int                     `json:"objects"`
+	// Dangling counts references to rows that are neither in the archive nor
+	// known in the target, they are kept unchanged
+	Dangling int `json:"dangling"`
+}
+
+type exportState struct {
+	courses []uuid.UUID
+	users   map[uuid.UUID]struct{}
+	keys    map[string]struct{}
+	objects ObjectStore
+}
+
+// all reports whether the whole instance is exported
+func (s *exportState) all() bool {
+	return s.courses == nil
+}
+
+// InstanceID returns the id of the database instance
+func InstanceID(db *gorm.DB) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := db.Raw("SELECT id FROM vms_instance").Scan(&id).Error
+	if err == nil && id == uuid.Nil {
+		err = fmt.Errorf("instance id not found, run the migrations first")
+	}
+	return id, err
+}
+
+// Export writes an archive of the scope to w. Rows are read in one repeatable
+// read transaction so the archive is a consistent snapshot.
+func Export(ctx context.Context, db *gorm.DB, objects ObjectStore, scope Scope, w io.Writer) (Manifest, error) {
+	manifest := Manifest{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Scope:     scope,
+		Entities:  make(map[string]int),
+	}
+
+	tmp, err := os.MkdirTemp("", "vms-export-")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(tmp)
+
+	state := &exportState{
+		users:   make(map[uuid.UUID]struct{}),
+		keys:    make(map[string]struct{}),
+		objects: objects,
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY").Error; err != nil {
+			return err
+		}
+		if manifest.SourceInstance, err = InstanceID(tx); err != nil {
+			return err
+		}
+		if len(scope.Courses) > 0 || len(scope.Instructors) > 0 {
+			state.courses = make([]uuid.UUID, 0)
+			err := tx.Table("course").
+				Where("id IN ? OR instructor_id IN ?", append(scope.Courses, uuid.Nil), append(scope.Instructors, uuid.Nil)).
+				Order("id").Pluck("id", &state.courses).Error
+			if err != nil {
+				return err
+			}
+			if len(state.courses) == 0 {
+				return fmt.Errorf("no course matches the scope")
+			}
+		}
+		for _, e := range exportOrder {
+			f, err := os.Create(path.Join(tmp, e.name()+".jsonl"))
+			if err != nil {
+				return err
+			}
+			n, err := e.export(tx, state, f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("export of %s failed - %s", e.name(), err)
+			}
+			manifest.Entities[e.name()] = n
+		}
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	if objects != nil {
+		keys := make([]string, 0, len(state.keys))
+		for key := range state.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			info, err := objects.Stat(ctx, key)
+			if err != nil {
+				manifest.MissingObjects = append(manifest.MissingObjects, key)
+				continue
+			}
+			manifest.Objects = append(manifest.Objects, info)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(raw)), strings.NewReader(string(raw))); err != nil {
+		return manifest, err
+	}
+	for _, e := range exportOrder {
+		if err := writeFile(tw, dataDir+e.name()+".jsonl", path.Join(tmp, e.name()+".jsonl")); err != nil {
+			return manifest, err
+		}
+	}
+	for _, info := range manifest.Objects {
+		r, err := objects.Get(ctx, info.Key)
+		if err != nil {
+			return manifest, fmt.Errorf("could not read object %s - %s", info.Key, err)
+		}
+		err = writeEntry(tw, objectsDir+info.Key, info.Size, r)
+		r.Close()
+		if err != nil {
+			return manifest, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeEntry(tw, name, info.Size(), f)
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
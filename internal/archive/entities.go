@@ -0,0 +1,620 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+)
+
+// entity is one table of the archive
+type entity interface {
+	name() string
+	// export writes the rows of the scope as JSON lines
+	export(tx *gorm.DB, s *exportState, w io.Writer) (int, error)
+	// restore imports the JSON lines into the target database
+	restore(tx *gorm.DB, s *importState, data []byte) (EntityReport, error)
+}
+
+// ref is a column holding the id of a row of another entity
+type ref[T any] struct {
+	entity string
+	get    func(*T) uuid.UUID
+	set    func(*T, uuid.UUID)
+}
+
+// spec describes how one model is exported and imported
+type spec[T any] struct {
+	table string
+	id    func(*T) *uuid.UUID
+	refs  []ref[T]
+	// files are the columns holding URLs of stored objects
+	files []func(*T) *string
+	// variants are the columns holding the URLs of the variants of an image
+	variants []func(*T) model.ImageVariants
+	// keys are the columns holding object keys, objects keep their key
+	keys []func(*T) *string
+	// imported resets the columns that do not carry over to the target
+	imported func(*T)
+	// scope restricts the export to the selected courses, nil means the
+	// entity is only exported with the whole instance
+	scope func(tx *gorm.DB, s *exportState) *gorm.DB
+	// order keeps parents before the rows that reference them
+	order string
+	// natural finds an existing target row that is the same as the imported one
+	natural func(tx *gorm.DB, row *T) *gorm.DB
+	// idFrom makes the target id the one given to the row of another entity
+	idFrom string
+	// keepExisting leaves matched target rows untouched
+	keepExisting bool
+	// immutable rows are only ever inserted
+	immutable bool
+	// written is called with the rows created or updated by the import
+	written func(s *importState, row *T)
+}
+
+func (e *spec[T]) name() string {
+	return e.table
+}
+
+func (e *spec[T]) export(tx *gorm.DB, s *exportState, w io.Writer) (int, error) {
+	query := tx.Model(new(T))
+	if !s.all() {
+		if e.scope == nil {
+			return 0, nil
+		}
+		query = e.scope(query, s)
+	}
+	if e.order != "" {
+		query = query.Order(e.order)
+	}
+
+	count := 0
+	enc := json.NewEncoder(w)
+	var rows []T
+	result := query.FindInBatches(&rows, 500, func(batch *gorm.DB, _ int) error {
+		for i := range rows {
+			row := &rows[i]
+			for _, r := range e.refs {
+				if r.entity == userEntity {
+					s.users[r.get(row)] = struct{}{}
+				}
+			}
+			for _, file := range e.files {
+				if s.objects == nil {
+					break
+				}
+				if key, ok := s.objects.Key(stringValue(file(row))); ok {
+					s.keys[key] = struct{}{}
+				}
+			}
+			for _, variants := range e.variants {
+				if s.objects == nil {
+					break
+				}
+				for _, formats := range variants(row) {
+					for _, url := range formats {
+						if key, ok := s.objects.Key(url); ok {
+							s.keys[key] = struct{}{}
+						}
+					}
+				}
+			}
+			for _, key := range e.keys {
+				if s.objects != nil && *key(row) != "" {
+					s.keys[*key(row)] = struct{}{}
+				}
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, result.Error
+}
+
+func (e *spec[T]) restore(tx *gorm.DB, s *importState, data []byte) (EntityReport, error) {
+	var report EntityReport
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var row T
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return report, fmt.Errorf("%s line %d - %s", e.table, line, err)
+		}
+		outcome, err := e.restoreRow(tx, s, &row)
+		if err != nil {
+			return report, fmt.Errorf("%s line %d - %s", e.table, line, err)
+		}
+		switch outcome {
+		case outcomeCreated:
+			report.Created++
+		case outcomeUpdated:
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+	}
+	return report, scanner.Err()
+}
+
+type outcome int
+
+const (
+	outcomeCreated outcome = iota
+	outcomeUpdated
+	outcomeSkipped
+)
+
+func (e *spec[T]) restoreRow(tx *gorm.DB, s *importState, row *T) (outcome, error) {
+	sourceID := *e.id(row)
+
+	for _, r := range e.refs {
+		value := r.get(row)
+		if value == uuid.Nil {
+			continue
+		}
+		target, ok, err := s.lookup(tx, r.entity, value)
+		if err != nil {
+			return outcomeSkipped, err
+		}
+		if ok {
+			r.set(row, target)
+		} else {
+			s.dangling[r.entity+"."+value.String()] = struct{}{}
+		}
+	}
+	for _, file := range e.files {
+		url := file(row)
+		if url == nil || s.objects == nil {
+			continue
+		}
+		if key, ok := s.objects.Key(*url); ok {
+			*url = s.objects.URL(key)
+		}
+	}
+	for _, variants := range e.variants {
+		if s.objects == nil {
+			break
+		}
+		for _, formats := range variants(row) {
+			for format, url := range formats {
+				if key, ok := s.objects.Key(url); ok {
+					formats[format] = s.objects.URL(key)
+				}
+			}
+		}
+	}
+	if e.imported != nil {
+		e.imported(row)
+	}
+
+	target, mapped, err := s.lookup(tx, e.table, sourceID)
+	if err != nil {
+		return outcomeSkipped, err
+	}
+	if !mapped && e.idFrom != "" {
+		target, mapped, err = s.lookup(tx, e.idFrom, sourceID)
+		if err != nil {
+			return outcomeSkipped, err
+		}
+	}
+	if !mapped && e.natural != nil {
+		var existing T
+		err := e.natural(tx.Model(new(T)), row).Take(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return outcomeSkipped, err
+		}
+		if err == nil {
+			target, mapped = *e.id(&existing), true
+		}
+	}
+
+	if mapped {
+		var exists int64
+		if err := tx.Model(new(T)).Where("id = ?", target).Count(&exists).Error; err != nil {
+			return outcomeSkipped, err
+		}
+		if err := s.remember(tx, e.table, sourceID, target); err != nil {
+			return outcomeSkipped, err
+		}
+		*e.id(row) = target
+		if exists > 0 {
+			if e.keepExisting || e.immutable {
+				return outcomeSkipped, nil
+			}
+			if err := tx.Save(row).Error; err != nil {
+				return outcomeSkipped, err
+			}
+			if e.written != nil {
+				e.written(s, row)
+			}
+			return outcomeUpdated, nil
+		}
+	} else {
+		*e.id(row) = uuid.New()
+		if err := s.remember(tx, e.table, sourceID, *e.id(row)); err != nil {
+			return outcomeSkipped, err
+		}
+	}
+	if err := tx.Create(row).Error; err != nil {
+		return outcomeSkipped, err
+	}
+	if e.written != nil {
+		e.written(s, row)
+	}
+	return outcomeCreated, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Helpers building refs for uuid.UUID and *uuid.UUID fields
+func refTo[T any](entity string, field func(*T) *uuid.UUID) ref[T] {
+	return ref[T]{
+		entity: entity,
+		get:    func(row *T) uuid.UUID { return *field(row) },
+		set:    func(row *T, id uuid.UUID) { *field(row) = id },
+	}
+}
+
+func optionalRefTo[T any](entity string, field func(*T) **uuid.UUID) ref[T] {
+	return ref[T]{
+		entity: entity,
+		get: func(row *T) uuid.UUID {
+			if *field(row) == nil {
+				return uuid.Nil
+			}
+			return **field(row)
+		},
+		set: func(row *T, id uuid.UUID) { *field(row) = &id },
+	}
+}
+
+// Entity names used in refs
+const (
+	userEntity                 = "user"
+	courseEntity               = "course"
+	assignmentEntity           = "assignment"
+	assignmentSubmissionEntity = "assignment_submission"
+	gradeEntity                = "grade"
+	gradeRevisionEntity        = "grade_revision"
+	messageEntity              = "message"
+	videoAssetEntity           = "video_asset"
+	lessonEntity               = "lesson"
+	videoCheckpointEntity      = "video_checkpoint"
+)
+
+// Scope filters shared by the course level entities
+func inCourses(column string) func(tx *gorm.DB, s *exportState) *gorm.DB {
+	return func(tx *gorm.DB, s *exportState) *gorm.DB {
+		return tx.Where(column+" IN ?", s.courses)
+	}
+}
+
+func inCourseAssignments(tx *gorm.DB, s *exportState) *gorm.DB {
+	return tx.Where("assignment_id IN (SELECT id FROM assignment WHERE course_id IN ?)", s.courses)
+}
+
+func inReferencedUsers(tx *gorm.DB, s *exportState) *gorm.DB {
+	ids := make([]uuid.UUID, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	return tx.Where("id IN ?", ids)
+}
+
+// exportOrder lists the entities in the order they are exported. Users come
+// last because a course export only includes the users its rows reference.
+var exportOrder = []entity{
+	&spec[model.Course]{
+		table: courseEntity,
+		id:    func(r *model.Course) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Course]{
+			refTo(userEntity, func(r *model.Course) *uuid.UUID { return &r.InstructorID }),
+		},
+		files:    []func(*model.Course) *string{func(r *model.Course) *string { return r.Thumbnail }},
+		variants: []func(*model.Course) model.ImageVariants{func(r *model.Course) model.ImageVariants { return r.ThumbnailVariants }},
+		scope:    inCourses("id"),
+		order:    "created_at, id",
+	},
+	&spec[model.VideoAsset]{
+		table: videoAssetEntity,
+		id:    func(r *model.VideoAsset) *uuid.UUID { return &r.ID },
+		refs: []ref[model.VideoAsset]{
+			refTo(userEntity, func(r *model.VideoAsset) *uuid.UUID { return &r.UploaderID }),
+		},
+		keys: []func(*model.VideoAsset) *string{func(r *model.VideoAsset) *string { return &r.Key }},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("id IN (SELECT video_asset_id FROM lesson WHERE course_id IN ?)", s.courses)
+		},
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.VideoAsset) *gorm.DB {
+			return tx.Where("key = ?", r.Key)
+		},
+		keepExisting: true,
+		// Only the original is exported, the target transcodes it again
+		imported: func(r *model.VideoAsset) {
+			*r = model.VideoAsset{ID: r.ID, Key: r.Key, UploaderID: r.UploaderID, Status: model.VideoStatusQueued,
+				Duration: r.Duration, Width: r.Width, Height: r.Height, CreatedAt: r.CreatedAt}
+		},
+	},
+	&spec[model.VideoCaption]{
+		table: "video_caption",
+		id:    func(r *model.VideoCaption) *uuid.UUID { return &r.ID },
+		refs: []ref[model.VideoCaption]{
+			refTo(videoAssetEntity, func(r *model.VideoCaption) *uuid.UUID { return &r.AssetID }),
+			refTo(userEntity, func(r *model.VideoCaption) *uuid.UUID { return &r.CreatedBy }),
+		},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("asset_id IN (SELECT video_asset_id FROM lesson WHERE course_id IN ?)", s.courses)
+		},
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.VideoCaption) *gorm.DB {
+			return tx.Where("asset_id = ? AND language = ? AND kind = ?", r.AssetID, r.Language, r.Kind)
+		},
+	},
+	&spec[model.VideoChapter]{
+		table: "video_chapter",
+		id:    func(r *model.VideoChapter) *uuid.UUID { return &r.ID },
+		refs: []ref[model.VideoChapter]{
+			refTo(videoAssetEntity, func(r *model.VideoChapter) *uuid.UUID { return &r.AssetID }),
+			refTo(userEntity, func(r *model.VideoChapter) *uuid.UUID { return &r.CreatedBy }),
+		},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("asset_id IN (SELECT video_asset_id FROM lesson WHERE course_id IN ?)", s.courses)
+		},
+		order: "asset_id, start, id",
+		natural: func(tx *gorm.DB, r *model.VideoChapter) *gorm.DB {
+			return tx.Where("asset_id = ? AND start = ?", r.AssetID, r.Start)
+		},
+	},
+	&spec[model.VideoCheckpoint]{
+		table: videoCheckpointEntity,
+		id:    func(r *model.VideoCheckpoint) *uuid.UUID { return &r.ID },
+		refs: []ref[model.VideoCheckpoint]{
+			refTo(videoAssetEntity, func(r *model.VideoCheckpoint) *uuid.UUID { return &r.AssetID }),
+			refTo(userEntity, func(r *model.VideoCheckpoint) *uuid.UUID { return &r.CreatedBy }),
+		},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("asset_id IN (SELECT video_asset_id FROM lesson WHERE course_id IN ?)", s.courses)
+		},
+		order: "created_at, id",
+	},
+	&spec[model.Lesson]{
+		table: lessonEntity,
+		id:    func(r *model.Lesson) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Lesson]{
+			refTo(courseEntity, func(r *model.Lesson) *uuid.UUID { return &r.CourseID }),
+			optionalRefTo(videoAssetEntity, func(r *model.Lesson) **uuid.UUID { return &r.VideoAssetID }),
+		},
+		scope: inCourses("course_id"),
+		order: "course_id, order_index, id",
+	},
+	&spec[model.Assignment]{
+		table: assignmentEntity,
+		id:    func(r *model.Assignment) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Assignment]{
+			refTo(courseEntity, func(r *model.Assignment) *uuid.UUID { return &r.CourseID }),
+			refTo(userEntity, func(r *model.Assignment) *uuid.UUID { return &r.CreatedBy }),
+		},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+	},
+	&spec[model.CourseDocument]{
+		table: "course_document",
+		id:    func(r *model.CourseDocument) *uuid.UUID { return &r.ID },
+		refs: []ref[model.CourseDocument]{
+			refTo(courseEntity, func(r *model.CourseDocument) *uuid.UUID { return &r.CourseID }),
+			refTo(userEntity, func(r *model.CourseDocument) *uuid.UUID { return &r.UploadedBy }),
+		},
+		files: []func(*model.CourseDocument) *string{func(r *model.CourseDocument) *string { return &r.FilePath }},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+	},
+	&spec[model.AssignmentDocument]{
+		table: "assignment_document",
+		id:    func(r *model.AssignmentDocument) *uuid.UUID { return &r.ID },
+		refs: []ref[model.AssignmentDocument]{
+			refTo(assignmentEntity, func(r *model.AssignmentDocument) *uuid.UUID { return &r.AssignmentID }),
+			refTo(userEntity, func(r *model.AssignmentDocument) *uuid.UUID { return &r.UploadedBy }),
+		},
+		files: []func(*model.AssignmentDocument) *string{func(r *model.AssignmentDocument) *string { return &r.FilePath }},
+		scope: inCourseAssignments,
+		order: "created_at, id",
+	},
+	&spec[model.CourseEnrollment]{
+		table: "course_enrollment",
+		id:    func(r *model.CourseEnrollment) *uuid.UUID { return &r.ID },
+		refs: []ref[model.CourseEnrollment]{
+			refTo(courseEntity, func(r *model.CourseEnrollment) *uuid.UUID { return &r.CourseID }),
+			refTo(userEntity, func(r *model.CourseEnrollment) *uuid.UUID { return &r.StudentID }),
+		},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.CourseEnrollment) *gorm.DB {
+			return tx.Where("course_id = ? AND student_id = ?", r.CourseID, r.StudentID)
+		},
+	},
+	&spec[model.LessonProgress]{
+		table: "lesson_progress",
+		id:    func(r *model.LessonProgress) *uuid.UUID { return &r.ID },
+		refs: []ref[model.LessonProgress]{
+			refTo(lessonEntity, func(r *model.LessonProgress) *uuid.UUID { return &r.LessonID }),
+			refTo(courseEntity, func(r *model.LessonProgress) *uuid.UUID { return &r.CourseID }),
+			refTo(userEntity, func(r *model.LessonProgress) *uuid.UUID { return &r.UserID }),
+		},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.LessonProgress) *gorm.DB {
+			return tx.Where("lesson_id = ? AND user_id = ?", r.LessonID, r.UserID)
+		},
+	},
+	&spec[model.CheckpointAnswer]{
+		table: "checkpoint_answer",
+		id:    func(r *model.CheckpointAnswer) *uuid.UUID { return &r.ID },
+		refs: []ref[model.CheckpointAnswer]{
+			refTo(videoCheckpointEntity, func(r *model.CheckpointAnswer) *uuid.UUID { return &r.CheckpointID }),
+			refTo(lessonEntity, func(r *model.CheckpointAnswer) *uuid.UUID { return &r.LessonID }),
+			refTo(courseEntity, func(r *model.CheckpointAnswer) *uuid.UUID { return &r.CourseID }),
+			refTo(userEntity, func(r *model.CheckpointAnswer) *uuid.UUID { return &r.UserID }),
+		},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.CheckpointAnswer) *gorm.DB {
+			return tx.Where("checkpoint_id = ? AND user_id = ? AND lesson_id = ? AND attempt = ?", r.CheckpointID, r.UserID, r.LessonID, r.Attempt)
+		},
+	},
+	&spec[model.AssignmentSubmission]{
+		table: assignmentSubmissionEntity,
+		id:    func(r *model.AssignmentSubmission) *uuid.UUID { return &r.ID },
+		refs: []ref[model.AssignmentSubmission]{
+			refTo(assignmentEntity, func(r *model.AssignmentSubmission) *uuid.UUID { return &r.AssignmentID }),
+			refTo(userEntity, func(r *model.AssignmentSubmission) *uuid.UUID { return &r.StudentID }),
+		},
+		scope: inCourseAssignments,
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.AssignmentSubmission) *gorm.DB {
+			return tx.Where("assignment_id = ? AND student_id = ? AND attempt = ?", r.AssignmentID, r.StudentID, r.Attempt)
+		},
+	},
+	&spec[model.AssignmentSubmissionFile]{
+		table: "assignment_submission_file",
+		id:    func(r *model.AssignmentSubmissionFile) *uuid.UUID { return &r.ID },
+		refs: []ref[model.AssignmentSubmissionFile]{
+			optionalRefTo(assignmentSubmissionEntity, func(r *model.AssignmentSubmissionFile) **uuid.UUID { return &r.SubmissionID }),
+		},
+		files: []func(*model.AssignmentSubmissionFile) *string{func(r *model.AssignmentSubmissionFile) *string { return &r.FilePath }},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("submission_id IN (SELECT s.id FROM assignment_submission s JOIN assignment a ON a.id = s.assignment_id WHERE a.course_id IN ?)", s.courses)
+		},
+		order: "created_at, id",
+	},
+	&spec[model.Comment]{
+		table: "comment",
+		id:    func(r *model.Comment) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Comment]{
+			refTo(userEntity, func(r *model.Comment) *uuid.UUID { return &r.UserID }),
+			refTo(assignmentSubmissionEntity, func(r *model.Comment) *uuid.UUID { return &r.SubmissionID }),
+		},
+		scope: func(tx *gorm.DB, s *exportState) *gorm.DB {
+			return tx.Where("submission_id IN (SELECT s.id FROM assignment_submission s JOIN assignment a ON a.id = s.assignment_id WHERE a.course_id IN ?)", s.courses)
+		},
+		order: "created_at, id",
+	},
+	&spec[model.Grade]{
+		table: gradeEntity,
+		id:    func(r *model.Grade) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Grade]{
+			refTo(courseEntity, func(r *model.Grade) *uuid.UUID { return &r.CourseID }),
+			refTo(assignmentEntity, func(r *model.Grade) *uuid.UUID { return &r.AssignmentID }),
+			refTo(userEntity, func(r *model.Grade) *uuid.UUID { return &r.StudentID }),
+			refTo(userEntity, func(r *model.Grade) *uuid.UUID { return &r.GradedBy }),
+		},
+		scope: inCourses("course_id"),
+		order: "created_at, id",
+		natural: func(tx *gorm.DB, r *model.Grade) *gorm.DB {
+			return tx.Where("student_id = ? AND assignment_id = ?", r.StudentID, r.AssignmentID)
+		},
+		written: func(s *importState, r *model.Grade) {
+			s.grades = append(s.grades, r.ID)
+		},
+	},
+	&spec[model.GradeRevision]{
+		table: gradeRevisionEntity,
+		id:    func(r *model.GradeRevision) *uuid.UUID { return &r.ID },
+		refs: []ref[model.GradeRevision]{
+			refTo(gradeEntity, func(r *model.GradeRevision) *uuid.UUID { return &r.GradeID }),
+			refTo(courseEntity, func(r *model.GradeRevision) *uuid.UUID { return &r.CourseID }),
+			refTo(assignmentEntity, func(r *model.GradeRevision) *uuid.UUID { return &r.AssignmentID }),
+			refTo(userEntity, func(r *model.GradeRevision) *uuid.UUID { return &r.StudentID }),
+			refTo(userEntity, func(r *model.GradeRevision) *uuid.UUID { return &r.GradedBy }),
+			optionalRefTo(gradeRevisionEntity, func(r *model.GradeRevision) **uuid.UUID { return &r.RestoredFrom }),
+		},
+		scope: inCourses("course_id"),
+		order: "grade_id, revision",
+		natural: func(tx *gorm.DB, r *model.GradeRevision) *gorm.DB {
+			return tx.Where("grade_id = ? AND revision = ?", r.GradeID, r.Revision)
+		},
+		immutable: true,
+	},
+	&spec[model.Message]{
+		table: messageEntity,
+		id:    func(r *model.Message) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Message]{
+			refTo(userEntity, func(r *model.Message) *uuid.UUID { return &r.SenderID }),
+			refTo(userEntity, func(r *model.Message) *uuid.UUID { return &r.ReceiverID }),
+			refTo(messageEntity, func(r *model.Message) *uuid.UUID { return &r.RepliedTo }),
+		},
+		order: "created_at, id",
+	},
+	&spec[model.Notification]{
+		table: "notification",
+		id:    func(r *model.Notification) *uuid.UUID { return &r.ID },
+		refs: []ref[model.Notification]{
+			refTo(userEntity, func(r *model.Notification) *uuid.UUID { return &r.UserID }),
+		},
+		order: "created_at, id",
+	},
+	&spec[model.User]{
+		table:    userEntity,
+		id:       func(r *model.User) *uuid.UUID { return &r.ID },
+		files:    []func(*model.User) *string{func(r *model.User) *string { return &r.ProfilePictureURL }},
+		variants: []func(*model.User) model.ImageVariants{func(r *model.User) model.ImageVariants { return r.ProfilePictureVariants }},
+		scope:    inReferencedUsers,
+		order:    "created_at, id",
+		// Accounts that already exist in the target are reused, never overwritten
+		natural: func(tx *gorm.DB, r *model.User) *gorm.DB {
+			if r.UserName == "" {
+				return tx.Where("lower(email) = lower(?)", r.Email)
+			}
+			return tx.Where("lower(email) = lower(?) OR user_name = ?", r.Email, r.UserName)
+		},
+		keepExisting: true,
+	},
+	&spec[model.Profile]{
+		table:    "profile",
+		id:       func(r *model.Profile) *uuid.UUID { return &r.ID },
+		files:    []func(*model.Profile) *string{func(r *model.Profile) *string { return r.AvatarURL }},
+		variants: []func(*model.Profile) model.ImageVariants{func(r *model.Profile) model.ImageVariants { return r.AvatarVariants }},
+		scope:    inReferencedUsers,
+		order:    "created_at, id",
+		idFrom:   userEntity,
+		// Profiles of reused accounts stay as they are in the target
+		keepExisting: true,
+	},
+}
+
+// importOrder lists the entities so every row is imported after the rows it
+// references
+var importOrder = func() []entity {
+	order := make([]entity, 0, len(exportOrder))
+	for _, e := range exportOrder {
+		if e.name() == userEntity || e.name() == "profile" {
+			order = append(order, e)
+		}
+	}
+	for _, e := range exportOrder {
+		if e.name() != userEntity && e.name() != "profile" {
+			order = append(order, e)
+		}
+	}
+	return order
+}()
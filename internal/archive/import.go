@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/gradebook"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type importState struct {
+	source uuid.UUID
+	// identity is set when importing into the source instance itself
+	identity bool
+	objects  ObjectStore
+	mapping  map[string]map[uuid.UUID]uuid.UUID
+	dangling map[string]struct{}
+	// grades are the grades created or updated by the import
+	grades []uuid.UUID
+}
+
+// lookup returns the target id of a source row, from this import or an
+// earlier one. Rows of the target instance itself map to their own id.
+func (s *importState) lookup(tx *gorm.DB, entity string, sourceID uuid.UUID) (uuid.UUID, bool, error) {
+	if s.identity {
+		return sourceID, true, nil
+	}
+	if target, ok := s.mapping[entity][sourceID]; ok {
+		return target, true, nil
+	}
+	var target uuid.UUID
+	err := tx.Raw("SELECT target_id FROM archive_import_map WHERE source_instance = ? AND entity = ? AND source_id = ?",
+		s.source, entity, sourceID).Scan(&target).Error
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	if target == uuid.Nil {
+		return uuid.Nil, false, nil
+	}
+	s.cache(entity, sourceID, target)
+	return target, true, nil
+}
+
+// remember records the target id of a source row
+func (s *importState) remember(tx *gorm.DB, entity string, sourceID uuid.UUID, target uuid.UUID) error {
+	if s.identity {
+		return nil
+	}
+	s.cache(entity, sourceID, target)
+	return tx.Exec(`INSERT INTO archive_import_map (source_instance, entity, source_id, target_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (source_instance, entity, source_id) DO UPDATE SET target_id = EXCLUDED.target_id, imported_at = now()`,
+		s.source, entity, sourceID, target).Error
+}
+
+func (s *importState) cache(entity string, sourceID uuid.UUID, target uuid.UUID) {
+	if s.mapping[entity] == nil {
+		s.mapping[entity] = make(map[uuid.UUID]uuid.UUID)
+	}
+	s.mapping[entity][sourceID] = target
+}
+
+// Import reads an archive from r and merges it into the database in a single
+// transaction. Stored files are uploaded while the archive is read, before the
+// rows are written; without an object store they are skipped and file URLs
+// are kept unchanged.
+func Import(ctx context.Context, db *gorm.DB, objects ObjectStore, r io.Reader) (Manifest, Report, error) {
+	var manifest Manifest
+	report := Report{Entities: make(map[string]EntityReport)}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, report, fmt.Errorf("not a vms archive - %s", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestName {
+		return manifest, report, fmt.Errorf("not a vms archive - %s must be the first entry", manifestName)
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, report, fmt.Errorf("invalid manifest - %s", err)
+	}
+	if manifest.Format != Format {
+		return manifest, report, fmt.Errorf("not a vms archive - unknown format %q", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return manifest, report, fmt.Errorf("archive version %d is not supported, expected at most %d", manifest.Version, Version)
+	}
+	report.SourceInstance = manifest.SourceInstance
+
+	data := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, report, err
+		}
+		switch {
+		case strings.HasPrefix(header.Name, dataDir):
+			name := strings.TrimSuffix(strings.TrimPrefix(header.Name, dataDir), ".jsonl")
+			if data[name], err = io.ReadAll(tr); err != nil {
+				return manifest, report, err
+			}
+		case strings.HasPrefix(header.Name, objectsDir):
+			if objects == nil {
+				continue
+			}
+			info := ObjectInfo{Key: strings.TrimPrefix(header.Name, objectsDir), Size: header.Size}
+			if info.Key == "" || path.Clean(info.Key) != info.Key || strings.HasPrefix(info.Key, "../") || path.IsAbs(info.Key) {
+				return manifest, report, fmt.Errorf("invalid object key %q", info.Key)
+			}
+			for _, o := range manifest.Objects {
+				if o.Key == info.Key {
+					info.ContentType = o.ContentType
+				}
+			}
+			if err := objects.Put(ctx, info, tr); err != nil {
+				return manifest, report, fmt.Errorf("could not store object %s - %s", info.Key, err)
+			}
+			report.Objects++
+		}
+	}
+
+	state := &importState{
+		source:   manifest.SourceInstance,
+		objects:  objects,
+		mapping:  make(map[string]map[uuid.UUID]uuid.UUID),
+		dangling: make(map[string]struct{}),
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		target, err := InstanceID(tx)
+		if err != nil {
+			return err
+		}
+		// Importing into the instance the archive comes from restores the rows
+		// in place and recreates deleted ones with their original id
+		state.identity = target == state.source
+		for _, e := range importOrder {
+			lines, ok := data[e.name()]
+			if !ok {
+				continue
+			}
+			entityReport, err := e.restore(tx, state, lines)
+			if err != nil {
+				return fmt.Errorf("import of %s failed - %s", e.name(), err)
+			}
+			report.Entities[e.name()] = entityReport
+		}
+		return recordImportedGrades(tx, state)
+	})
+	report.Dangling = len(state.dangling)
+	return manifest, report, err
+}
+
+// recordImportedGrades adds a revision to the grades written by the import
+// whose history, once the revisions of the archive are imported, does not end
+// with their current state: grades overwritten with a different score, and
+// those whose revisions were left out of the archive or collide with the ones
+// of the target.
+func recordImportedGrades(tx *gorm.DB, s *importState) error {
+	for _, id := range s.grades {
+		var grade model.Grade
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&grade).Error; err != nil {
+			return fmt.Errorf("could not read grade %s - %s", id, err)
+		}
+		current, err := gradebook.Current(tx, grade)
+		if err != nil {
+			return err
+		}
+		if current {
+			continue
+		}
+		if _, err := gradebook.RecordRevision(tx, grade, model.GradeRevisionReasonImported, nil, false); err != nil {
+			return fmt.Errorf("could not record the revision of grade %s - %s", id, err)
+		}
+	}
+	return nil
+}
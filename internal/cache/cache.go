@@ -0,0 +1,109 @@
+/*
+Package cache provides a read-through cache for hot read endpoints.
+
+Values are stored as JSON under a key together with tags. Writes invalidate
+every entry carrying one of their tags, so a key never has to be known by the
+code that changes the underlying rows. Two backends are available: an
+in-process LRU and Redis, which keeps several API instances consistent.
+*/
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cache is a key value store whose entries can be dropped by tag
+type Cache interface {
+	// Get returns the value stored under key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Generations returns the generation of each tag, bumped by every
+	// invalidation of the tag
+	Generations(ctx context.Context, tags ...string) ([]int64, error)
+	// Set stores value under key for ttl and attaches it to the tags. Unless
+	// generations is nil, nothing is stored if a tag was invalidated since
+	// its generation was read.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, generations []int64, tags ...string) error
+	// Invalidate removes every entry attached to one of the tags
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// Stats receives one event per lookup, labelled with the cached resource
+type Stats interface {
+	Hit(resource string)
+	Miss(resource string)
+}
+
+// Store wraps a Cache with the default ttl and the hit and miss counters.
+// A nil Store disables caching: reads go to the loader and invalidation is a
+// no-op.
+type Store struct {
+	backend Cache
+	stats   Stats
+	ttl     time.Duration
+	log     *logrus.Logger
+}
+
+// NewStore returns a Store using backend, reporting to stats
+func NewStore(backend Cache, stats Stats, ttl time.Duration, log *logrus.Logger) *Store {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	return &Store{backend: backend, stats: stats, ttl: ttl, log: log}
+}
+
+// Invalidate drops every entry attached to one of the tags. Failures are only
+// logged, entries then expire with their ttl.
+func (s *Store) Invalidate(ctx context.Context, tags ...string) {
+	if s == nil || len(tags) == 0 {
+		return
+	}
+	if err := s.backend.Invalidate(ctx, tags...); err != nil {
+		s.log.WithField("tags", tags).Errorf("Cache invalidation failed - %s", err)
+	}
+}
+
+// Remember returns the cached value of key, or calls load and caches its
+// result with the tags. A result is not cached if one of the tags is
+// invalidated while it loads, it may predate the write. Errors of the cache
+// itself never fail the read.
+func Remember[T any](ctx context.Context, s *Store, resource string, key string, tags []string, load func() (T, error)) (T, error) {
+	if s == nil {
+		return load()
+	}
+
+	key = resource + ":" + key
+	raw, found, err := s.backend.Get(ctx, key)
+	if err != nil {
+		s.log.WithField("key", key).Errorf("Cache read failed - %s", err)
+	}
+	if found {
+		var value T
+		if err := json.Unmarshal(raw, &value); err == nil {
+			s.stats.Hit(resource)
+			return value, nil
+		}
+	}
+	s.stats.Miss(resource)
+
+	generations, genErr := s.backend.Generations(ctx, tags...)
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	if genErr != nil {
+		s.log.WithField("key", key).Errorf("Cache read failed - %s", genErr)
+		return value, nil
+	}
+	raw, err = json.Marshal(value)
+	if err == nil {
+		err = s.backend.Set(ctx, key, raw, s.ttl, generations, tags...)
+	}
+	if err != nil {
+		s.log.WithField("key", key).Errorf("Cache write failed - %s", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process Cache holding at most size entries. The least recently
+// used entry is evicted first, expired entries are dropped when read.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{}
+	// generations of the tags invalidated at least once
+	generations map[string]int64
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	tags    []string
+}
+
+// NewLRU returns an empty LRU cache holding up to size entries
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+
+		generations: make(map[string]int64),
+	}
+}
+
+// Get implements Cache
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.remove(elem)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Generations implements Cache
+func (l *LRU) Generations(_ context.Context, tags ...string) ([]int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	generations := make([]int64, len(tags))
+	for i, tag := range tags {
+		generations[i] = l.generations[tag]
+	}
+	return generations, nil
+}
+
+// Set implements Cache
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration, generations []int64, tags ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if generations != nil {
+		for i, tag := range tags {
+			if i >= len(generations) || l.generations[tag] != generations[i] {
+				return nil
+			}
+		}
+	}
+
+	if elem, ok := l.entries[key]; ok {
+		l.remove(elem)
+	}
+
+	entry := &lruEntry{key: key, value: value, tags: tags}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for _, tag := range tags {
+		keys, ok := l.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			l.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+	return nil
+}
+
+// Invalidate implements Cache
+func (l *LRU) Invalidate(_ context.Context, tags ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			if elem, ok := l.entries[key]; ok {
+				l.remove(elem)
+			}
+		}
+		delete(l.tags, tag)
+		l.generations[tag]++
+	}
+	return nil
+}
+
+// remove drops the entry and its tag references, l.mu must be held
+func (l *LRU) remove(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	l.order.Remove(elem)
+	delete(l.entries, entry.key)
+	for _, tag := range entry.tags {
+		if keys, ok := l.tags[tag]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(l.tags, tag)
+			}
+		}
+	}
+}
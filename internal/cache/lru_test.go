@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func lruGet(t *testing.T, l *LRU, key string) (string, bool) {
+	t.Helper()
+	value, found, err := l.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(value), found
+}
+
+func lruSet(t *testing.T, l *LRU, key string, value string, ttl time.Duration, tags ...string) {
+	t.Helper()
+	if err := l.Set(context.Background(), key, []byte(value), ttl, nil, tags...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	l := NewLRU(2)
+	lruSet(t, l, "a", "1", 0)
+	lruSet(t, l, "b", "2", 0)
+	// Reading a makes b the least recently used entry
+	if value, found := lruGet(t, l, "a"); !found || value != "1" {
+		t.Fatalf("got %q, %v", value, found)
+	}
+	lruSet(t, l, "c", "3", 0)
+
+	if _, found := lruGet(t, l, "b"); found {
+		t.Fatal("b should have been evicted")
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if value, found := lruGet(t, l, key); !found || value != want {
+			t.Fatalf("%s: got %q, %v", key, value, found)
+		}
+	}
+}
+
+func TestLRUOverwrite(t *testing.T) {
+	l := NewLRU(2)
+	lruSet(t, l, "a", "1", 0, "old")
+	lruSet(t, l, "a", "2", 0, "new")
+	lruSet(t, l, "b", "3", 0)
+
+	if value, _ := lruGet(t, l, "a"); value != "2" {
+		t.Fatalf("got %q", value)
+	}
+	// The old tags go with the old value
+	if err := l.Invalidate(context.Background(), "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := lruGet(t, l, "a"); !found {
+		t.Fatal("a was dropped by a tag it no longer carries")
+	}
+	if _, ok := l.tags["old"]; ok {
+		t.Fatal("the old tag is still tracked")
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	l := NewLRU(10)
+	lruSet(t, l, "short", "1", time.Millisecond, "tag")
+	lruSet(t, l, "forever", "2", 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, found := lruGet(t, l, "short"); found {
+		t.Fatal("expired entry returned")
+	}
+	if _, found := lruGet(t, l, "forever"); !found {
+		t.Fatal("entry without ttl expired")
+	}
+	if len(l.entries) != 1 || len(l.tags) != 0 {
+		t.Fatalf("expired entry kept: %d entries, %d tags", len(l.entries), len(l.tags))
+	}
+}
+
+func TestLRUInvalidate(t *testing.T) {
+	l := NewLRU(10)
+	lruSet(t, l, "course:1", "a", 0, "course", "course:1")
+	lruSet(t, l, "course:2", "b", 0, "course", "course:2")
+	lruSet(t, l, "courses", "c", 0, "course")
+	lruSet(t, l, "user:1", "d", 0, "user")
+
+	if err := l.Invalidate(context.Background(), "course:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := lruGet(t, l, "course:1"); found {
+		t.Fatal("course:1 not invalidated")
+	}
+	if _, found := lruGet(t, l, "course:2"); !found {
+		t.Fatal("course:2 invalidated with course:1")
+	}
+
+	if err := l.Invalidate(context.Background(), "course", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"course:2", "courses"} {
+		if _, found := lruGet(t, l, key); found {
+			t.Fatalf("%s not invalidated", key)
+		}
+	}
+	if _, found := lruGet(t, l, "user:1"); !found {
+		t.Fatal("user:1 invalidated")
+	}
+	if len(l.entries) != 1 || len(l.tags) != 1 || l.order.Len() != 1 {
+		t.Fatalf("invalidated entries kept: %d entries, %d tags", len(l.entries), len(l.tags))
+	}
+}
+
+// countingStats counts the lookups of Remember
+type countingStats struct {
+	hits, misses int
+}
+
+func (s *countingStats) Hit(string)  { s.hits++ }
+func (s *countingStats) Miss(string) { s.misses++ }
+
+func TestRemember(t *testing.T) {
+	stats := &countingStats{}
+	store := NewStore(NewLRU(10), stats, time.Minute, nil)
+	ctx := context.Background()
+	loads := 0
+	load := func() ([]int, error) {
+		loads++
+		return []int{loads}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := Remember(ctx, store, "course", "1", []string{"course:1"}, load)
+		if err != nil || len(value) != 1 || value[0] != 1 {
+			t.Fatalf("got %v, %v", value, err)
+		}
+	}
+	store.Invalidate(ctx, "course:1")
+	value, err := Remember(ctx, store, "course", "1", []string{"course:1"}, load)
+	if err != nil || value[0] != 2 {
+		t.Fatalf("got %v, %v after invalidation", value, err)
+	}
+	if loads != 2 || stats.hits != 1 || stats.misses != 2 {
+		t.Fatalf("%d loads, %d hits, %d misses", loads, stats.hits, stats.misses)
+	}
+
+	// A value loaded while its tag is invalidated is not cached
+	store.Invalidate(ctx, "course:1")
+	stale := func() ([]int, error) {
+		store.Invalidate(ctx, "course:1")
+		return load()
+	}
+	if value, err := Remember(ctx, store, "course", "1", []string{"course:1"}, stale); err != nil || value[0] != 3 {
+		t.Fatalf("got %v, %v", value, err)
+	}
+	if _, found, _ := store.backend.Get(ctx, "course:1"); found {
+		t.Fatal("value loaded during an invalidation was cached")
+	}
+
+	// A nil store always loads
+	var disabled *Store
+	if value, _ := Remember(ctx, disabled, "course", "1", nil, load); value[0] != 4 {
+		t.Fatalf("got %v", value)
+	}
+	disabled.Invalidate(ctx, "course:1")
+}
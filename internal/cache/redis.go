@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Keys written by the Redis backend, tags are sets of the keys carrying them
+// and generations count the invalidations of a tag
+const (
+	redisKeyPrefix        = "vms:cache:"
+	redisTagPrefix        = "vms:cache-tag:"
+	redisGenerationPrefix = "vms:cache-gen:"
+)
+
+// Deletes every key of a tag set and the set itself and bumps the generation
+// of the tag in one atomic step, so an entry cached while the tag is
+// invalidated cannot lose its tag membership
+const redisInvalidateScript = `
+local keys = redis.call('SMEMBERS', KEYS[1])
+for i = 1, #keys, 500 do
+	redis.call('DEL', unpack(keys, i, math.min(i + 499, #keys)))
+end
+redis.call('DEL', KEYS[1])
+redis.call('INCR', KEYS[2])
+return #keys`
+
+// Stores ARGV[1] under KEYS[1] for ARGV[2] milliseconds, 0 for no expiry, and
+// adds it to the tag sets KEYS[2..n+1], unless the generation KEYS[n+1+i] of
+// a tag is no longer ARGV[2+i]. Returns 1 once stored.
+const redisSetScript = `
+local n = #ARGV - 2
+for i = 1, n do
+	if tonumber(redis.call('GET', KEYS[n + 1 + i]) or '0') ~= tonumber(ARGV[2 + i]) then
+		return 0
+	end
+end
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+for i = 1, n do
+	redis.call('SADD', KEYS[1 + i], KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[1 + i], ttl)
+	end
+end
+return 1`
+
+// RedisOptions configures the Redis backend
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// Redis is a Cache shared by every API instance. It talks RESP directly over
+// a small pool of connections and only uses GET, SET, SADD, PEXPIRE and EVAL.
+type Redis struct {
+	opts RedisOptions
+	pool chan *redisConn
+}
+
+// NewRedis connects to Redis and checks the connection with a PING
+func NewRedis(opts RedisOptions) (*Redis, error) {
+	if opts.PoolSize < 1 {
+		opts.PoolSize = 8
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	r := &Redis{opts: opts, pool: make(chan *redisConn, opts.PoolSize)}
+
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do("PING"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r.release(conn, nil)
+	return r, nil
+}
+
+// Get implements Cache
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	replies, err := r.pipeline(ctx, []string{"GET", redisKeyPrefix + key})
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := replies[0].([]byte)
+	return value, ok, nil
+}
+
+// Generations implements Cache
+func (r *Redis) Generations(ctx context.Context, tags ...string) ([]int64, error) {
+	if len(tags) == 0 {
+		return []int64{}, nil
+	}
+	commands := make([][]string, len(tags))
+	for i, tag := range tags {
+		commands[i] = []string{"GET", redisGenerationPrefix + tag}
+	}
+	replies, err := r.pipeline(ctx, commands...)
+	if err != nil {
+		return nil, err
+	}
+	generations := make([]int64, len(tags))
+	for i, reply := range replies {
+		if value, ok := reply.([]byte); ok {
+			if generations[i], err = strconv.ParseInt(string(value), 10, 64); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return generations, nil
+}
+
+// Set implements Cache
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, generations []int64, tags ...string) error {
+	key = redisKeyPrefix + key
+	if generations != nil {
+		if len(generations) != len(tags) {
+			return fmt.Errorf("%d generations for %d tags", len(generations), len(tags))
+		}
+		eval := []string{"EVAL", redisSetScript, strconv.Itoa(1 + 2*len(tags)), key}
+		for _, tag := range tags {
+			eval = append(eval, redisTagPrefix+tag)
+		}
+		for _, tag := range tags {
+			eval = append(eval, redisGenerationPrefix+tag)
+		}
+		eval = append(eval, string(value), strconv.FormatInt(max(ttl.Milliseconds(), 0), 10))
+		for _, generation := range generations {
+			eval = append(eval, strconv.FormatInt(generation, 10))
+		}
+		_, err := r.pipeline(ctx, eval)
+		return err
+	}
+	set := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		set = append(set, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	commands := [][]string{set}
+	for _, tag := range tags {
+		commands = append(commands, []string{"SADD", redisTagPrefix + tag, key})
+		if ttl > 0 {
+			// Every entry uses the store ttl, so the set lives as long as its newest member
+			commands = append(commands, []string{"PEXPIRE", redisTagPrefix + tag, strconv.FormatInt(ttl.Milliseconds(), 10)})
+		}
+	}
+	_, err := r.pipeline(ctx, commands...)
+	return err
+}
+
+// Invalidate implements Cache
+func (r *Redis) Invalidate(ctx context.Context, tags ...string) error {
+	commands := make([][]string, 0, len(tags))
+	for _, tag := range tags {
+		commands = append(commands, []string{"EVAL", redisInvalidateScript, "2", redisTagPrefix + tag, redisGenerationPrefix + tag})
+	}
+	_, err := r.pipeline(ctx, commands...)
+	return err
+}
+
+// Close closes the pooled connections
+func (r *Redis) Close() error {
+	for {
+		select {
+		case conn := <-r.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// pipeline sends the commands on one connection and reads all replies. The
+// first Redis error reply is returned as error.
+func (r *Redis) pipeline(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	conn, err := r.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(r.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	replies, err := conn.pipeline(commands...)
+	r.release(conn, err)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if replyErr, ok := reply.(redisError); ok {
+			return replies, replyErr
+		}
+	}
+	return replies, nil
+}
+
+func (r *Redis) acquire() (*redisConn, error) {
+	select {
+	case conn := <-r.pool:
+		return conn, nil
+	default:
+		return r.dial()
+	}
+}
+
+// release returns a healthy connection to the pool and closes broken ones
+func (r *Redis) release(conn *redisConn, err error) {
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return
+	}
+	select {
+	case r.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (r *Redis) dial() (*redisConn, error) {
+	c, err := net.DialTimeout("tcp", r.opts.Addr, r.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, reader: bufio.NewReader(c), writer: bufio.NewWriter(c)}
+	conn.SetDeadline(time.Now().Add(r.opts.Timeout))
+	if r.opts.Password != "" {
+		if _, err := conn.do("AUTH", r.opts.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.opts.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(r.opts.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is one RESP connection
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// do sends one command and returns its reply, error replies included as error
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	replies, err := c.pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(redisError); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+func (c *redisConn) pipeline(commands ...[]string) ([]interface{}, error) {
+	for _, args := range commands {
+		fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// read parses one RESP reply: strings, integers, bulk strings as []byte, nil
+// for null replies, arrays and error replies as redisError
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+		err   bool
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "error", input: "-ERR unknown command\r\n", want: redisError("ERR unknown command")},
+		{name: "integer", input: ":42\r\n", want: int64(42)},
+		{name: "negative integer", input: ":-2\r\n", want: int64(-2)},
+		{name: "bulk string", input: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with line breaks", input: "$7\r\na\r\nb\r\nc\r\n", want: []byte("a\r\nb\r\nc")},
+		{name: "empty bulk string", input: "$0\r\n\r\n", want: []byte{}},
+		{name: "nil bulk string", input: "$-1\r\n", want: nil},
+		{name: "nil array", input: "*-1\r\n", want: nil},
+		{name: "empty array", input: "*0\r\n", want: []interface{}{}},
+		{
+			name:  "array",
+			input: "*4\r\n$3\r\nfoo\r\n$-1\r\n:1\r\n*2\r\n+a\r\n-ERR b\r\n",
+			want:  []interface{}{[]byte("foo"), nil, int64(1), []interface{}{"a", redisError("ERR b")}},
+		},
+		{name: "truncated bulk string", input: "$5\r\nhel", err: true},
+		{name: "truncated array", input: "*2\r\n:1\r\n", err: true},
+		{name: "missing carriage return", input: "+OK\n", err: true},
+		{name: "invalid length", input: "$x\r\n", err: true},
+		{name: "invalid integer", input: ":x\r\n", err: true},
+		{name: "unknown type", input: "?1\r\n", err: true},
+		{name: "empty", input: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &redisConn{reader: bufio.NewReader(strings.NewReader(tt.input))}
+			got, err := conn.read()
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisReadConsecutiveReplies(t *testing.T) {
+	conn := &redisConn{reader: bufio.NewReader(strings.NewReader("$3\r\nfoo\r\n$-1\r\n+OK\r\n"))}
+	for _, want := range []interface{}{[]byte("foo"), nil, "OK"} {
+		got, err := conn.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+	}
+}
+
+// fakeRedis serves the commands used by the Redis backend from memory. Keys
+// do not expire, PX and PEXPIRE are recorded but not applied.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu     sync.Mutex
+	values map[string]string
+	sets   map[string]map[string]struct{}
+	ttls   map[string]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		listener: listener,
+		password: password,
+		values:   make(map[string]string),
+		sets:     make(map[string]map[string]struct{}),
+		ttls:     make(map[string]string),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if !authenticated && strings.ToUpper(args[0]) != "AUTH" {
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		} else {
+			authenticated = f.execute(w, args) || authenticated
+		}
+		// Replies are flushed once the pipelined commands are all read
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("not an array: %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid array: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// execute runs one command and tells if it authenticated the connection
+func (f *fakeRedis) execute(w io.Writer, args []string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if len(args) != 2 || args[1] != f.password {
+			fmt.Fprint(w, "-WRONGPASS invalid password\r\n")
+			return false
+		}
+		fmt.Fprint(w, "+OK\r\n")
+		return true
+	case "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case "SELECT":
+		fmt.Fprint(w, "+OK\r\n")
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			fmt.Fprint(w, "$-1\r\n")
+			break
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			f.ttls[args[1]] = args[4]
+		}
+		fmt.Fprint(w, "+OK\r\n")
+	case "SADD":
+		members, ok := f.sets[args[1]]
+		if !ok {
+			members = make(map[string]struct{})
+			f.sets[args[1]] = members
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if _, ok := members[member]; !ok {
+				members[member] = struct{}{}
+				added++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "PEXPIRE":
+		f.ttls[args[1]] = args[2]
+		fmt.Fprint(w, ":1\r\n")
+	case "EVAL":
+		switch {
+		case args[1] == redisInvalidateScript && args[2] == "2":
+			members := f.sets[args[3]]
+			for key := range members {
+				delete(f.values, key)
+			}
+			delete(f.sets, args[3])
+			generation, _ := strconv.Atoi(f.values[args[4]])
+			f.values[args[4]] = strconv.Itoa(generation + 1)
+			fmt.Fprintf(w, ":%d\r\n", len(members))
+		case args[1] == redisSetScript:
+			numKeys, _ := strconv.Atoi(args[2])
+			keys, argv := args[3:3+numKeys], args[3+numKeys:]
+			n := len(argv) - 2
+			for i := 0; i < n; i++ {
+				if generation, _ := strconv.Atoi(f.values[keys[1+n+i]]); strconv.Itoa(generation) != argv[2+i] {
+					fmt.Fprint(w, ":0\r\n")
+					return false
+				}
+			}
+			f.values[keys[0]] = argv[0]
+			for i := 0; i < n; i++ {
+				members, ok := f.sets[keys[1+i]]
+				if !ok {
+					members = make(map[string]struct{})
+					f.sets[keys[1+i]] = members
+				}
+				members[keys[0]] = struct{}{}
+				if argv[1] != "0" {
+					f.ttls[keys[1+i]] = argv[1]
+				}
+			}
+			if argv[1] != "0" {
+				f.ttls[keys[0]] = argv[1]
+			}
+			fmt.Fprint(w, ":1\r\n")
+		default:
+			fmt.Fprint(w, "-ERR unexpected script\r\n")
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+	return false
+}
+
+func TestRedis(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	r, err := NewRedis(RedisOptions{Addr: f.listener.Addr().String(), Password: "secret", DB: 2, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ctx := context.Background()
+
+	if _, found, err := r.Get(ctx, "course:1"); err != nil || found {
+		t.Fatalf("got found %v, %v for a missing key", found, err)
+	}
+	if err := r.Set(ctx, "course:1", []byte("a\r\nb"), time.Minute, nil, "course", "course:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set(ctx, "course:2", []byte("c"), 0, nil, "course"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set(ctx, "user:1", nil, 0, nil, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	value, found, err := r.Get(ctx, "course:1")
+	if err != nil || !found || string(value) != "a\r\nb" {
+		t.Fatalf("got %q, %v, %v", value, found, err)
+	}
+	if value, found, err := r.Get(ctx, "user:1"); err != nil || !found || len(value) != 0 {
+		t.Fatalf("got %q, %v, %v for an empty value", value, found, err)
+	}
+	f.mu.Lock()
+	ttl, tagTTL := f.ttls[redisKeyPrefix+"course:1"], f.ttls[redisTagPrefix+"course:1"]
+	_, tagged := f.sets[redisTagPrefix+"course"][redisKeyPrefix+"course:2"]
+	f.mu.Unlock()
+	if ttl != "60000" || tagTTL != "60000" || !tagged {
+		t.Fatalf("got ttl %q, tag ttl %q, tagged %v", ttl, tagTTL, tagged)
+	}
+
+	if err := r.Invalidate(ctx, "course", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"course:1", "course:2"} {
+		if _, found, err := r.Get(ctx, key); err != nil || found {
+			t.Fatalf("%s: got found %v, %v after invalidation", key, found, err)
+		}
+	}
+	if _, found, _ := r.Get(ctx, "user:1"); !found {
+		t.Fatal("user:1 invalidated")
+	}
+}
+
+func TestRedisSetAfterInvalidation(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, err := NewRedis(RedisOptions{Addr: f.listener.Addr().String(), Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ctx := context.Background()
+
+	generations, err := r.Generations(ctx, "course", "course:1")
+	if err != nil || len(generations) != 2 {
+		t.Fatalf("got %v, %v", generations, err)
+	}
+	if err := r.Invalidate(ctx, "course:1"); err != nil {
+		t.Fatal(err)
+	}
+	// Loaded before the invalidation, the value is not stored
+	if err := r.Set(ctx, "course:1", []byte("stale"), time.Minute, generations, "course", "course:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := r.Get(ctx, "course:1"); err != nil || found {
+		t.Fatalf("got found %v, %v for a stale value", found, err)
+	}
+
+	if generations, err = r.Generations(ctx, "course", "course:1"); err != nil || generations[0] != 0 || generations[1] != 1 {
+		t.Fatalf("got %v, %v", generations, err)
+	}
+	if err := r.Set(ctx, "course:1", []byte("fresh"), time.Minute, generations, "course", "course:1"); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := r.Get(ctx, "course:1"); err != nil || !found || string(value) != "fresh" {
+		t.Fatalf("got %q, %v, %v", value, found, err)
+	}
+	f.mu.Lock()
+	ttl := f.ttls[redisKeyPrefix+"course:1"]
+	_, tagged := f.sets[redisTagPrefix+"course"][redisKeyPrefix+"course:1"]
+	f.mu.Unlock()
+	if ttl != "60000" || !tagged {
+		t.Fatalf("got ttl %q, tagged %v", ttl, tagged)
+	}
+}
+
+func TestRedisErrorReplyKeepsConnection(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, err := NewRedis(RedisOptions{Addr: f.listener.Addr().String(), PoolSize: 1, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	_, err = r.pipeline(context.Background(), []string{"SET", redisKeyPrefix + "a", "1"}, []string{"NOPE"}, []string{"GET", redisKeyPrefix + "a"})
+	var replyErr redisError
+	if !errors.As(err, &replyErr) || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("got error %v", err)
+	}
+	// The connection stays in sync and goes back to the pool
+	if len(r.pool) != 1 {
+		t.Fatalf("%d pooled connections", len(r.pool))
+	}
+	if value, found, err := r.Get(context.Background(), "a"); err != nil || !found || string(value) != "1" {
+		t.Fatalf("got %q, %v, %v", value, found, err)
+	}
+}
+
+func TestRedisWrongPassword(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	if _, err := NewRedis(RedisOptions{Addr: f.listener.Addr().String(), Password: "wrong", Timeout: time.Second}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := NewRedis(RedisOptions{Addr: f.listener.Addr().String(), Timeout: time.Second}); err == nil {
+		t.Fatal("expected an error without password")
+	}
+}
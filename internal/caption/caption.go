@@ -0,0 +1,330 @@
+/*
+Package caption reads WebVTT and SRT caption files, validates their cues and
+writes them back as WebVTT.
+
+Only the cues are kept: their identifier, timing, settings and text. NOTE,
+STYLE and REGION blocks of WebVTT files are dropped, as are the ASS override
+tags and font tags some SRT files carry.
+*/
+package caption
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cue is a caption shown from Start to End
+type Cue struct {
+	ID       string        // optional identifier
+	Start    time.Duration // from the start of the video
+	End      time.Duration
+	Settings string // WebVTT cue settings, e.g. "line:0 align:start"
+	Text     string // may span several lines
+}
+
+// Formats of caption files
+const (
+	FormatVTT = "vtt"
+	FormatSRT = "srt"
+)
+
+var errNoCues = errors.New("caption file has no cues")
+
+// Parse reads a WebVTT file, or an SRT file when it does not start with the
+// WEBVTT signature, and returns its cues and format
+func Parse(data []byte) ([]Cue, string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(data, []byte("WEBVTT")) {
+		cues, err := ParseVTT(data)
+		return cues, FormatVTT, err
+	}
+	cues, err := ParseSRT(data)
+	return cues, FormatSRT, err
+}
+
+// ParseVTT reads the cues of a WebVTT file
+func ParseVTT(data []byte) ([]Cue, error) {
+	blocks := splitBlocks(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(blocks) == 0 || !isVTTSignature(blocks[0][0]) {
+		return nil, errors.New("WebVTT file does not start with WEBVTT")
+	}
+
+	var cues []Cue
+	for _, block := range blocks[1:] {
+		if isVTTSignature(block[0]) || strings.HasPrefix(block[0], "NOTE") ||
+			block[0] == "STYLE" || block[0] == "REGION" {
+			continue
+		}
+		var cue Cue
+		if !strings.Contains(block[0], "-->") {
+			cue.ID, block = block[0], block[1:]
+		}
+		if len(block) == 0 {
+			return nil, fmt.Errorf("cue %d: identifier %q has no timing", len(cues)+1, cue.ID)
+		}
+		var err error
+		cue.Start, cue.End, cue.Settings, err = parseTiming(block[0], '.')
+		if err != nil {
+			return nil, fmt.Errorf("cue %d: %w", len(cues)+1, err)
+		}
+		cue.Text = strings.Join(block[1:], "\n")
+		cues = append(cues, cue)
+	}
+	if len(cues) == 0 {
+		return nil, errNoCues
+	}
+	return cues, nil
+}
+
+// ParseSRT reads the cues of an SRT file
+func ParseSRT(data []byte) ([]Cue, error) {
+	var cues []Cue
+	for _, block := range splitBlocks(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))) {
+		// The counter is optional in practice, some tools leave it out
+		if !strings.Contains(block[0], "-->") {
+			if _, err := strconv.Atoi(block[0]); err != nil || len(block) == 1 {
+				return nil, fmt.Errorf("cue %d: expected a counter and a timing, got %q", len(cues)+1, block[0])
+			}
+			block = block[1:]
+		}
+		start, end, _, err := parseTiming(block[0], ',')
+		if err != nil {
+			return nil, fmt.Errorf("cue %d: %w", len(cues)+1, err)
+		}
+		lines := make([]string, 0, len(block)-1)
+		for _, line := range block[1:] {
+			lines = append(lines, srtText(line))
+		}
+		cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(lines, "\n")})
+	}
+	if len(cues) == 0 {
+		return nil, errNoCues
+	}
+	return cues, nil
+}
+
+func isVTTSignature(line string) bool {
+	return line == "WEBVTT" || strings.HasPrefix(line, "WEBVTT ") || strings.HasPrefix(line, "WEBVTT\t")
+}
+
+// splitBlocks splits a file into blocks of lines separated by blank lines.
+// CRLF, CR and LF all end a line.
+func splitBlocks(data []byte) [][]string {
+	var blocks [][]string
+	var block []string
+	data = bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// parseTiming reads "<start> --> <end> [settings]", fractions of seconds
+// following the separator
+func parseTiming(line string, separator byte) (time.Duration, time.Duration, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[1] != "-->" {
+		return 0, 0, "", fmt.Errorf("invalid timing %q", line)
+	}
+	start, err := parseTimestamp(fields[0], separator)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	end, err := parseTimestamp(fields[2], separator)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	settings := ""
+	if separator == '.' {
+		settings = strings.Join(fields[3:], " ")
+	}
+	return start, end, settings, nil
+}
+
+// parseTimestamp reads [hh:]mm:ss<separator>ttt
+func parseTimestamp(s string, separator byte) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid timestamp %q", s)
+	i := strings.LastIndexByte(s, separator)
+	if i < 0 || len(s)-i-1 != 3 {
+		return 0, invalid
+	}
+	millis, err := strconv.Atoi(s[i+1:])
+	if err != nil || millis < 0 {
+		return 0, invalid
+	}
+	parts := strings.Split(s[:i], ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+	total := time.Duration(millis) * time.Millisecond
+	unit := time.Second
+	for j := len(parts) - 1; j >= 0; j-- {
+		v, err := strconv.Atoi(parts[j])
+		if err != nil || v < 0 || (j > 0 && len(parts[j]) != 2) || (unit < time.Hour && v > 59) {
+			return 0, invalid
+		}
+		total += time.Duration(v) * unit
+		unit *= 60
+	}
+	return total, nil
+}
+
+var (
+	assTag  = regexp.MustCompile(`\{\\[^}]*\}`)
+	fontTag = regexp.MustCompile(`(?i)</?font[^>]*>`)
+	// & not starting one of the character references WebVTT knows
+	bareAmpersand = regexp.MustCompile(`&([^&;\s]*;?)`)
+)
+
+// srtText turns a line of SRT text into WebVTT cue text: <b>, <i> and <u>
+// are kept, other markup is dropped and the rest is escaped
+func srtText(line string) string {
+	line = fontTag.ReplaceAllString(assTag.ReplaceAllString(line, ""), "")
+	line = bareAmpersand.ReplaceAllStringFunc(line, func(ref string) string {
+		switch ref {
+		case "&amp;", "&lt;", "&gt;", "&nbsp;", "&lrm;", "&rlm;":
+			return ref
+		}
+		return "&amp;" + ref[1:]
+	})
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '<' && isKeptTag(line[i:]):
+			end := strings.IndexByte(line[i:], '>')
+			b.WriteString(line[i : i+end+1])
+			i += end
+		case line[i] == '<':
+			b.WriteString("&lt;")
+		case line[i] == '>':
+			b.WriteString("&gt;")
+		default:
+			b.WriteByte(line[i])
+		}
+	}
+	return b.String()
+}
+
+func isKeptTag(s string) bool {
+	for _, tag := range []string{"<b>", "</b>", "<i>", "</i>", "<u>", "</u>"} {
+		if len(s) >= len(tag) && strings.EqualFold(s[:len(tag)], tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// CueError is a problem with the cue at Index, counted from 1
+type CueError struct {
+	Index  int
+	Reason string
+}
+
+func (e CueError) Error() string {
+	return fmt.Sprintf("cue %d: %s", e.Index, e.Reason)
+}
+
+// ValidationError lists the problems of the cues of a track
+type ValidationError []CueError
+
+func (e ValidationError) Error() string {
+	reasons := make([]string, 0, len(e))
+	for _, cueErr := range e {
+		reasons = append(reasons, cueErr.Error())
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Validate checks that every cue has text, ends after it starts and within
+// the video when duration is positive, and that cues are ordered by start
+// without overlapping. Identifiers, settings and text must not hold anything
+// WebVTT reads as the end of the cue. It returns a ValidationError listing
+// the problems.
+func Validate(cues []Cue, duration time.Duration) error {
+	var problems ValidationError
+	for i, cue := range cues {
+		fail := func(format string, args ...interface{}) {
+			problems = append(problems, CueError{Index: i + 1, Reason: fmt.Sprintf(format, args...)})
+		}
+		switch {
+		case cue.Start < 0:
+			fail("starts before the video")
+		case cue.End <= cue.Start:
+			fail("ends at %s, not after its start at %s", Timestamp(cue.End), Timestamp(cue.Start))
+		case duration > 0 && cue.End > duration:
+			fail("ends at %s, after the video ends at %s", Timestamp(cue.End), Timestamp(duration))
+		}
+		if strings.TrimSpace(cue.Text) == "" {
+			fail("has no text")
+		}
+		if strings.Contains(cue.Text, "-->") || strings.Contains(cue.Text, "\n\n") || strings.Contains(cue.Text, "\r") {
+			fail("text cannot contain -->, blank lines or carriage returns")
+		}
+		if strings.Contains(cue.ID, "-->") || strings.ContainsAny(cue.ID, "\r\n") {
+			fail("identifier cannot contain --> or line breaks")
+		}
+		if strings.Contains(cue.Settings, "-->") || strings.ContainsAny(cue.Settings, "\r\n") {
+			fail("settings cannot contain --> or line breaks")
+		}
+		if i == 0 {
+			continue
+		}
+		switch prev := cues[i-1]; {
+		case cue.Start < prev.Start:
+			fail("starts at %s, before cue %d", Timestamp(cue.Start), i)
+		case cue.Start < prev.End:
+			fail("starts at %s, overlapping cue %d which ends at %s", Timestamp(cue.Start), i, Timestamp(prev.End))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Timestamp formats d as a WebVTT timestamp, hh:mm:ss.ttt
+func Timestamp(d time.Duration) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+// VTT writes the cues as a WebVTT file, with the header lines following the
+// signature
+func VTT(cues []Cue, header ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n")
+	for _, line := range header {
+		b.WriteString(line + "\n")
+	}
+	for _, cue := range cues {
+		b.WriteString("\n")
+		if cue.ID != "" {
+			b.WriteString(cue.ID + "\n")
+		}
+		b.WriteString(Timestamp(cue.Start) + " --> " + Timestamp(cue.End))
+		if cue.Settings != "" {
+			b.WriteString(" " + cue.Settings)
+		}
+		b.WriteString("\n" + cue.Text + "\n")
+	}
+	return b.Bytes()
+}
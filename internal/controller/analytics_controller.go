@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+)
+
+// GetVideoAnalytics godoc
+// @Summary      Get how the viewers of a video watched it
+// @Description  Returns the heatmap of the video in video_analytics_bucket seconds stretches with the views, the viewers and the rewatches of
+// @Description  each, the drop-off curve as the share of the viewers who watched each stretch, the unique viewers, the completions and the
+// @Description  average share of the video watched. Viewers of the heatmap and the averages count once on every day they watched. Filtered by the course of the viewers and the days they watched it (from and to
+// @Description  included, YYYY-MM-DD in UTC). Teachers who did not upload the video only see the viewers of their own courses.
+// @Description  Figures are precomputed as watch progress is written, they lag behind by progress_flush_interval.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id         path   string  true   "Video asset ID"
+// @Param        course_id  query  string  false  "Course ID"
+// @Param        from       query  string  false  "First day, YYYY-MM-DD"
+// @Param        to         query  string  false  "Last day, YYYY-MM-DD"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoAnalytics]
+// @Router       /videos/{id}/analytics [get]
+// @Security     BearerAuth
+func GetVideoAnalytics(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoAnalytics]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	analytics := model.VideoAnalytics{AssetID: asset.ID, BucketSeconds: max(cfg.GetInt("video_analytics_bucket"), 1)}
+	if asset.Duration != nil {
+		analytics.Duration = *asset.Duration
+	}
+
+	filter := db.Where("asset_id = ?", asset.ID)
+	if value := c.Query("course_id"); value != "" {
+		courseID, err := uuid.Parse(value)
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+			jsonRsp.Message = "course_id is not a valid id"
+			c.JSON(http.StatusBadRequest, &jsonRsp)
+			return
+		}
+		analytics.CourseID = &courseID
+		filter = filter.Where("course_id = ?", courseID)
+	}
+	if !caller.IsAdmin() && asset.UploaderID != caller.ID {
+		filter = filter.Where("course_id IN (SELECT id FROM course WHERE instructor_id = ?)", caller.ID)
+	}
+	for _, bound := range []struct {
+		param string
+		op    string
+		value **string
+	}{{"from", ">=", &analytics.From}, {"to", "<=", &analytics.To}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+			jsonRsp.Message = bound.param + " must be a day as YYYY-MM-DD"
+			c.JSON(http.StatusBadRequest, &jsonRsp)
+			return
+		}
+		*bound.value = &value
+		filter = filter.Where("day "+bound.op+" ?", day)
+	}
+
+	var totals struct {
+		Viewers        int64
+		Completions    int64
+		WatchedSeconds float64
+	}
+	err := db.Model(&model.VideoEngagementDay{}).Where(filter).
+		Select("COALESCE(sum(viewers), 0) AS viewers, COALESCE(sum(completions), 0) AS completions, COALESCE(sum(watched_seconds), 0) AS watched_seconds").
+		Scan(&totals).Error
+	// Viewers are counted on every day they watch, the distinct ones are
+	// counted from the viewers of each day
+	if err == nil {
+		err = db.Model(&model.VideoEngagementViewer{}).Where(filter).
+			Select("count(DISTINCT user_id)").Scan(&analytics.UniqueViewers).Error
+	}
+	var buckets []model.VideoAnalyticsBucket
+	if err == nil {
+		err = db.Model(&model.VideoEngagementBucket{}).Where(filter).
+			Select("second AS start, sum(views) AS views, sum(viewers) AS viewers").
+			Group("second").Order("second").Scan(&buckets).Error
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	analytics.Completions = totals.Completions
+	if totals.Viewers > 0 && analytics.Duration > 0 {
+		// Averaged over the days of each viewer, what they watched on a day
+		// is counted once that day
+		percent := totals.WatchedSeconds / (float64(totals.Viewers) * analytics.Duration) * 100
+		analytics.AverageWatchPercent = math.Min(100, math.Round(percent*10)/10)
+	}
+	analytics.Heatmap = videoHeatmap(buckets, analytics.BucketSeconds, analytics.Duration, totals.Viewers)
+
+	jsonRsp.Data = analytics
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// videoHeatmap fills in the stretches nobody watched up to the end of the
+// video and works out the rewatches and the retention of every stretch
+func videoHeatmap(counted []model.VideoAnalyticsBucket, bucketSeconds int, duration float64, viewers int64) []model.VideoAnalyticsBucket {
+	n := int(math.Ceil(duration / float64(bucketSeconds)))
+	if len(counted) > 0 {
+		n = max(n, counted[len(counted)-1].Start/bucketSeconds+1)
+	}
+	heatmap := make([]model.VideoAnalyticsBucket, n)
+	for i := range heatmap {
+		heatmap[i].Start = i * bucketSeconds
+	}
+	for _, bucket := range counted {
+		heatmap[bucket.Start/bucketSeconds] = bucket
+	}
+	for i := range heatmap {
+		bucket := &heatmap[i]
+		bucket.Rewatches = max(bucket.Views-bucket.Viewers, 0)
+		if viewers > 0 {
+			bucket.Retention = math.Min(100, math.Round(float64(bucket.Viewers)/float64(viewers)*1000)/10)
+		}
+	}
+	return heatmap
+}
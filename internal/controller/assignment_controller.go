@@ -52,6 +52,7 @@ func CreateAssignment(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read assignment by id"
+// @Param        include  query  string  false  "Relations to embed (course, creator, documents, submissions, grades), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.UpdateAssignment]
 // @Failure      404  {object}  model.JsonDTORsp[model.UpdateAssignment]
 // @Failure      500  {object}  model.JsonDTORsp[model.UpdateAssignment]
@@ -66,6 +67,18 @@ func GetAssignmentByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if c.Query("include") != "" {
+		// UpdateAssignment carries no ids, relations are resolved from the full row
+		assignment, err := reposity.ReadItemByIDIntoDTO[model.Assignment, model.Assignment](c.Param("id"))
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusReadItemFailed
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+			return
+		}
+		respondWithIncludes(c, "assignment", assignment)
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +89,7 @@ func GetAssignmentByID(c *gin.Context) {
 // @Tags         Assignment
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (course, creator, documents, submissions, grades), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Assignment]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Assignment]
 // @Router       /assignments [get]
@@ -92,6 +106,9 @@ func GetAssignments(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "assignment", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -168,6 +185,7 @@ func DeleteAssignment(c *gin.Context) {
 // @Param        course_id    path    string  true  "Course ID"
 // @Param        title       query   string  false "Search by title"
 // @Param        description query   string  false "Search by description"
+// @Param        include  query  string  false  "Relations to embed (course, creator, documents, submissions, grades), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Assignment]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Assignment]
 // @Router       /assignments/course/{course_id} [get]
@@ -205,6 +223,9 @@ func GetAssignmentsByCourseID(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "assignment", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
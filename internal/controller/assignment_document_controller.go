@@ -53,6 +53,7 @@ func CreateAssignmentDocument(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read assignment document by id"
+// @Param        include  query  string  false  "Relations to embed (assignment, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.AssignmentDocument]
 // @Failure      404  {object}  model.JsonDTORsp[model.AssignmentDocument]
 // @Failure      500  {object}  model.JsonDTORsp[model.AssignmentDocument]
@@ -67,6 +68,9 @@ func GetAssignmentDocumentByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "assignment_document", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -77,6 +81,7 @@ func GetAssignmentDocumentByID(c *gin.Context) {
 // @Tags         AssignmentDocument
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (assignment, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentDocument]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentDocument]
 // @Router       /assignment-documents [get]
@@ -93,6 +98,9 @@ func GetAssignmentDocuments(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "assignment_document", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -167,6 +175,7 @@ func DeleteAssignmentDocument(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        assignmentID  path  string  true  "Assignment ID"
+// @Param        include  query  string  false  "Relations to embed (assignment, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentDocument]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentDocument]
 // @Router       /assignment-documents/assignment/{assignmentID} [get]
@@ -197,6 +206,9 @@ func GetAssignmentDocumentsByAssignment(c *gin.Context) {
 		return
 	}
 
+	if respondWithIncludes(c, "assignment_document", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
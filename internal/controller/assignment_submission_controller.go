@@ -5,20 +5,24 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/hoangtu1372k2/common-go/reposity"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
 )
 
 // CreateAssignmentSubmission godoc
 // @Summary      Create a new assignment submission
-// @Description  Takes an assignment submission JSON and stores in DB. Returns saved JSON.
+// @Description  Takes an assignment submission JSON and stores it as the next attempt of the student. Returns saved JSON.
+// @Description  Earlier attempts still waiting for grading are marked superseded.
 // @Tags         AssignmentSubmission
 // @Accept       json
 // @Produce      json
 // @Param        submission  body  model.CreateAssignmentSubmission  true  "Assignment Submission JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateAssignmentSubmission]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateAssignmentSubmission]
+// @Failure      409  {object}  model.JsonDTORsp[model.CreateAssignmentSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateAssignmentSubmission]
 // @Router       /assignment-submissions [post]
 // @Security     BearerAuth
@@ -33,7 +37,24 @@ func CreateAssignmentSubmission(c *gin.Context) {
 		return
 	}
 
-	dto, err := reposity.CreateItemFromDTO[model.CreateAssignmentSubmission, model.AssignmentSubmission](dto)
+	submission := model.AssignmentSubmission{
+		ID:           dto.ID,
+		AssignmentID: dto.AssignmentID,
+		StudentID:    dto.StudentID,
+		Grade:        dto.Grade,
+		Feedback:     dto.Feedback,
+		Content:      dto.Content,
+		Status:       dto.Status,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return createAttempt(tx, &submission)
+	})
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusCreateItemFailed
 		jsonRsp.Message = err.Error()
@@ -41,6 +62,8 @@ func CreateAssignmentSubmission(c *gin.Context) {
 		return
 	}
 
+	dto.ID = submission.ID
+	dto.Attempt = submission.Attempt
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
 }
@@ -52,6 +75,7 @@ func CreateAssignmentSubmission(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read assignment submission by id"
+// @Param        include  query  string  false  "Relations to embed (assignment, student, files, comments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.AssignmentSubmission]
 // @Failure      404  {object}  model.JsonDTORsp[model.AssignmentSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[model.AssignmentSubmission]
@@ -66,6 +90,9 @@ func GetAssignmentSubmissionByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "submission", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +103,7 @@ func GetAssignmentSubmissionByID(c *gin.Context) {
 // @Tags         AssignmentSubmission
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (assignment, student, files, comments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Router       /assignment-submissions [get]
@@ -92,6 +120,9 @@ func GetAssignmentSubmissions(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -166,6 +197,7 @@ func DeleteAssignmentSubmission(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        assignment_id  path  string  true  "Assignment ID"
+// @Param        include  query  string  false  "Relations to embed (assignment, student, files, comments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Router       /assignment-submissions/assignment/{assignment_id} [get]
@@ -185,6 +217,9 @@ func GetAssignmentSubmissionsByAssignment(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -196,6 +231,7 @@ func GetAssignmentSubmissionsByAssignment(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        student_id  path  string  true  "Student ID"
+// @Param        include  query  string  false  "Relations to embed (assignment, student, files, comments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
 // @Router       /assignment-submissions/student/{student_id} [get]
@@ -215,6 +251,54 @@ func GetAssignmentSubmissionsByStudent(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission", dtos) {
+		return
+	}
+	jsonRsp.Data = dtos
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// GetSubmissionAttempts godoc
+// @Summary      Get the attempts of a student for an assignment
+// @Description  Returns every attempt of the student for the assignment, oldest first.
+// @Tags         AssignmentSubmission
+// @Accept       json
+// @Produce      json
+// @Param        assignment_id  path  string  true  "Assignment ID"
+// @Param        student_id     path  string  true  "Student ID"
+// @Param        include  query  string  false  "Relations to embed (assignment, student, files, comments), nested with dots"
+// @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
+// @Failure      400  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmission]
+// @Router       /assignment-submissions/assignment/{assignment_id}/student/{student_id} [get]
+// @Security     BearerAuth
+func GetSubmissionAttempts(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.AssignmentSubmission]()
+
+	assignmentID, err := uuid.Parse(c.Param("assignment_id"))
+	if err == nil {
+		_, err = uuid.Parse(c.Param("student_id"))
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+
+	filter := fmt.Sprintf("assignment_id = '%s' AND student_id = '%s' ORDER BY attempt ASC", assignmentID, c.Param("student_id"))
+	dtos, total, err := reposity.ReadAllItemsIntoDTO[model.AssignmentSubmission, model.AssignmentSubmission](filter)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
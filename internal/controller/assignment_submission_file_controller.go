@@ -52,6 +52,7 @@ func CreateAssignmentSubmissionFile(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read assignment submission file by id"
+// @Param        include  query  string  false  "Relations to embed (submission), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.AssignmentSubmissionFile]
 // @Failure      404  {object}  model.JsonDTORsp[model.AssignmentSubmissionFile]
 // @Failure      500  {object}  model.JsonDTORsp[model.AssignmentSubmissionFile]
@@ -66,6 +67,9 @@ func GetAssignmentSubmissionFileByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "submission_file", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +80,7 @@ func GetAssignmentSubmissionFileByID(c *gin.Context) {
 // @Tags         AssignmentSubmissionFile
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (submission), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmissionFile]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmissionFile]
 // @Router       /assignment-submission-files [get]
@@ -92,6 +97,9 @@ func GetAssignmentSubmissionFiles(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission_file", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -166,6 +174,7 @@ func DeleteAssignmentSubmissionFile(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        submission_id  path  string  true  "Submission ID"
+// @Param        include  query  string  false  "Relations to embed (submission), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.AssignmentSubmissionFile]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.AssignmentSubmissionFile]
 // @Router       /assignment-submission-files/submission/{submission_id} [get]
@@ -185,6 +194,9 @@ func GetAssignmentSubmissionFilesBySubmission(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "submission_file", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
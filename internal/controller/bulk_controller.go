@@ -0,0 +1,579 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Status reported for items that were valid but not applied because the
+// atomic batch they belong to failed
+const bulkStatusRolledBack = http.StatusFailedDependency
+
+// bulkOperation applies one item inside the transaction and returns the id
+// and data to report for it
+type bulkOperation[T any] func(tx *gorm.DB, item T) (string, interface{}, error)
+
+// bulkMaxItems returns the largest batch accepted by the bulk endpoints
+func bulkMaxItems() int {
+	if cfg == nil || cfg.GetInt("bulk_max_items") < 1 {
+		return 100
+	}
+	return cfg.GetInt("bulk_max_items")
+}
+
+// bulkItemStatus maps the error of one item to the status reported for it
+func bulkItemStatus(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+	if _, ok := conflictError(err); ok {
+		return http.StatusConflict
+	}
+	if errors.Is(err, errVideoAssetNotFound) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// bulkItemError describes the error of one item, naming the conflicting field
+// for unique constraint violations
+func bulkItemError(err error) string {
+	if conflict, ok := conflictError(err); ok {
+		return conflict.Error()
+	}
+	return err.Error()
+}
+
+// executeBulk validates every item with its binding tags, applies them in the
+// requested mode and writes the per item results. It tells which items were
+// applied and committed.
+//
+// In atomic mode all items run in a single transaction: one invalid or failing
+// item rolls everything back. In best effort mode every item gets its own
+// transaction and failures only affect that item.
+func executeBulk[T any](c *gin.Context, mode string, items []T, successStatus int, apply bulkOperation[T]) []bool {
+	jsonRsp := model.NewJsonDTORsp[model.BulkResult]()
+	applied := make([]bool, len(items))
+
+	if mode == "" {
+		mode = model.BulkModeAtomic
+	}
+	if len(items) == 0 || len(items) > bulkMaxItems() {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = fmt.Sprintf("a batch must contain between 1 and %d items", bulkMaxItems())
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return applied
+	}
+
+	result := model.BulkResult{Mode: mode, Items: make([]model.BulkItemResult, len(items))}
+	valid := make([]bool, len(items))
+	invalid := 0
+	for i, item := range items {
+		result.Items[i].Index = i
+		if err := binding.Validator.ValidateStruct(item); err != nil {
+			result.Items[i].Status = http.StatusBadRequest
+			result.Items[i].Error = err.Error()
+			invalid++
+			continue
+		}
+		valid[i] = true
+	}
+
+	if mode == model.BulkModeAtomic {
+		if invalid > 0 {
+			for i := range items {
+				if valid[i] {
+					result.Items[i].Status = bulkStatusRolledBack
+					result.Items[i].Error = "not applied, another item of the batch is invalid"
+				}
+			}
+			writeBulkResult(c, jsonRsp, result, http.StatusBadRequest)
+			return applied
+		}
+
+		failed := -1
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, item := range items {
+				id, data, err := apply(tx, item)
+				if err != nil {
+					failed = i
+					result.Items[i].Status = bulkItemStatus(err)
+					result.Items[i].Error = bulkItemError(err)
+					return err
+				}
+				result.Items[i].ID = id
+				result.Items[i].Status = successStatus
+				result.Items[i].Data = data
+			}
+			return nil
+		})
+		if err != nil {
+			for i := range items {
+				if i != failed {
+					result.Items[i] = model.BulkItemResult{
+						Index:  i,
+						Status: bulkStatusRolledBack,
+						Error:  "rolled back, another item of the batch failed",
+					}
+				}
+			}
+			status := http.StatusInternalServerError
+			if failed >= 0 {
+				status = result.Items[failed].Status
+			}
+			writeBulkResult(c, jsonRsp, result, status)
+			return applied
+		}
+		for i := range applied {
+			applied[i] = true
+		}
+		writeBulkResult(c, jsonRsp, result, successStatus)
+		return applied
+	}
+
+	for i, item := range items {
+		if !valid[i] {
+			continue
+		}
+		var id string
+		var data interface{}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			id, data, err = apply(tx, item)
+			return err
+		})
+		if err != nil {
+			result.Items[i].Status = bulkItemStatus(err)
+			result.Items[i].Error = bulkItemError(err)
+			continue
+		}
+		result.Items[i].ID = id
+		result.Items[i].Status = successStatus
+		result.Items[i].Data = data
+		applied[i] = true
+	}
+
+	status := successStatus
+	for _, item := range result.Items {
+		if item.Status != successStatus {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	writeBulkResult(c, jsonRsp, result, status)
+	return applied
+}
+
+// writeBulkResult counts the outcomes and sends the response
+func writeBulkResult(c *gin.Context, jsonRsp *model.JsonDTORsp[model.BulkResult], result model.BulkResult, status int) {
+	for _, item := range result.Items {
+		if item.Status >= http.StatusBadRequest {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+	}
+	if result.Failed > 0 {
+		jsonRsp.Code = statuscode.StatusCommonBackendError
+		jsonRsp.Message = fmt.Sprintf("%d of %d items failed", result.Failed, len(result.Items))
+	}
+	jsonRsp.Data = result
+	c.JSON(status, &jsonRsp)
+}
+
+// bindBulkDelete reads a bulk delete body and turns the ids into validatable items
+func bindBulkDelete(c *gin.Context) (string, []bulkDeleteItem, bool) {
+	var dto model.BulkDelete
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp := model.NewJsonDTORsp[model.BulkResult]()
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return "", nil, false
+	}
+	items := make([]bulkDeleteItem, len(dto.IDs))
+	for i, id := range dto.IDs {
+		items[i] = bulkDeleteItem{ID: id}
+	}
+	return dto.Mode, items, true
+}
+
+// bulkDeleteItem wraps one id of a bulk delete so it is validated like other items
+type bulkDeleteItem struct {
+	ID string `binding:"required,uuid"`
+}
+
+// bindBulk reads the body of a bulk create or update request
+func bindBulk(c *gin.Context, dto interface{}) bool {
+	if err := c.ShouldBindJSON(dto); err != nil {
+		jsonRsp := model.NewJsonDTORsp[model.BulkResult]()
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return false
+	}
+	return true
+}
+
+// BulkCreateGrades godoc
+// @Summary      Create grades in bulk
+// @Description  Creates up to bulk_max_items grades, atomically or best effort. Each grade gets its first revision.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        grades  body  model.BulkCreate[model.CreateGrade]  true  "Grades"
+// @Success      201  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      401  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      409  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /grades/bulk [post]
+// @Security     BearerAuth
+func BulkCreateGrades(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.BulkResult]()
+	gradedBy, ok := grader(c, jsonRsp)
+	if !ok {
+		return
+	}
+	var dto model.BulkCreate[model.CreateGrade]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	executeBulk(c, dto.Mode, dto.Items, http.StatusCreated, func(tx *gorm.DB, item model.CreateGrade) (string, interface{}, error) {
+		grade, err := createGrade(tx, item, gradedBy)
+		item.ID = grade.ID
+		item.GradedBy = grade.GradedBy
+		return grade.ID.String(), item, err
+	})
+}
+
+// BulkUpdateGrades godoc
+// @Summary      Update grades in bulk
+// @Description  Updates up to bulk_max_items grades, atomically or best effort. Every change is recorded as a revision.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        grades  body  model.BulkUpdate[model.UpdateGrade]  true  "Grades"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      401  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /grades/bulk [put]
+// @Security     BearerAuth
+func BulkUpdateGrades(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.BulkResult]()
+	gradedBy, ok := grader(c, jsonRsp)
+	if !ok {
+		return
+	}
+	var dto model.BulkUpdate[model.UpdateGrade]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	executeBulk(c, dto.Mode, dto.Items, http.StatusOK, func(tx *gorm.DB, item model.BulkUpdateItem[model.UpdateGrade]) (string, interface{}, error) {
+		return item.ID, item.Data, updateGrade(tx, item.ID, item.Data, gradedBy)
+	})
+}
+
+// BulkDeleteGrades godoc
+// @Summary      Delete grades in bulk
+// @Description  Deletes up to bulk_max_items grades, atomically or best effort.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        grades  body  model.BulkDelete  true  "Grade IDs"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /grades/bulk [delete]
+// @Security     BearerAuth
+func BulkDeleteGrades(c *gin.Context) {
+	mode, items, ok := bindBulkDelete(c)
+	if !ok {
+		return
+	}
+	executeBulk(c, mode, items, http.StatusOK, func(tx *gorm.DB, item bulkDeleteItem) (string, interface{}, error) {
+		return item.ID, nil, deleteGrade(tx, item.ID)
+	})
+}
+
+// BulkCreateCourseEnrollments godoc
+// @Summary      Create course enrollments in bulk
+// @Description  Creates up to bulk_max_items course enrollments, atomically or best effort.
+// @Tags         CourseEnrollment
+// @Accept       json
+// @Produce      json
+// @Param        enrollments  body  model.BulkCreate[model.CreateCourseEnrollment]  true  "Course enrollments"
+// @Success      201  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      409  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /enrollments/bulk [post]
+// @Security     BearerAuth
+func BulkCreateCourseEnrollments(c *gin.Context) {
+	var dto model.BulkCreate[model.CreateCourseEnrollment]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	var tags []string
+	executeBulk(c, dto.Mode, dto.Items, http.StatusCreated, func(tx *gorm.DB, item model.CreateCourseEnrollment) (string, interface{}, error) {
+		tags = append(tags, courseTag(item.CourseID.String()))
+		enrollment, err := createFromDTO[model.CreateCourseEnrollment, model.CourseEnrollment](tx, item)
+		return enrollment.ID.String(), enrollment, err
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkUpdateCourseEnrollments godoc
+// @Summary      Update course enrollments in bulk
+// @Description  Updates up to bulk_max_items course enrollments, atomically or best effort.
+// @Tags         CourseEnrollment
+// @Accept       json
+// @Produce      json
+// @Param        enrollments  body  model.BulkUpdate[model.UpdateCourseEnrollment]  true  "Course enrollments"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /enrollments/bulk [put]
+// @Security     BearerAuth
+func BulkUpdateCourseEnrollments(c *gin.Context) {
+	var dto model.BulkUpdate[model.UpdateCourseEnrollment]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	var tags []string
+	executeBulk(c, dto.Mode, dto.Items, http.StatusOK, func(tx *gorm.DB, item model.BulkUpdateItem[model.UpdateCourseEnrollment]) (string, interface{}, error) {
+		tags = append(tags, courseTag(courseIDOf[model.CourseEnrollment](item.ID)))
+		data, err := updateFromDTO[model.UpdateCourseEnrollment, model.CourseEnrollment](tx, item.ID, item.Data)
+		return item.ID, data, err
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkDeleteCourseEnrollments godoc
+// @Summary      Delete course enrollments in bulk
+// @Description  Deletes up to bulk_max_items course enrollments, atomically or best effort.
+// @Tags         CourseEnrollment
+// @Accept       json
+// @Produce      json
+// @Param        enrollments  body  model.BulkDelete  true  "Course enrollment IDs"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /enrollments/bulk [delete]
+// @Security     BearerAuth
+func BulkDeleteCourseEnrollments(c *gin.Context) {
+	mode, items, ok := bindBulkDelete(c)
+	if !ok {
+		return
+	}
+	var tags []string
+	executeBulk(c, mode, items, http.StatusOK, func(tx *gorm.DB, item bulkDeleteItem) (string, interface{}, error) {
+		tags = append(tags, courseTag(courseIDOf[model.CourseEnrollment](item.ID)))
+		return item.ID, nil, deleteByID[model.CourseEnrollment](tx, item.ID)
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkCreateLessons godoc
+// @Summary      Create lessons in bulk
+// @Description  Creates up to bulk_max_items lessons, atomically or best effort.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        lessons  body  model.BulkCreate[model.CreateLesson]  true  "Lessons"
+// @Success      201  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /lessons/bulk [post]
+// @Security     BearerAuth
+func BulkCreateLessons(c *gin.Context) {
+	var dto model.BulkCreate[model.CreateLesson]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	var tags []string
+	executeBulk(c, dto.Mode, dto.Items, http.StatusCreated, func(tx *gorm.DB, item model.CreateLesson) (string, interface{}, error) {
+		tags = append(tags, courseTag(item.CourseID.String()), courseLessonsTag(item.CourseID.String()))
+		if err := checkVideoAsset(tx, item.VideoAssetID); err != nil {
+			return "", nil, err
+		}
+		lesson, err := createFromDTO[model.CreateLesson, model.Lesson](tx, item)
+		return lesson.ID.String(), lesson, err
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkUpdateLessons godoc
+// @Summary      Update lessons in bulk
+// @Description  Updates up to bulk_max_items lessons, atomically or best effort.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        lessons  body  model.BulkUpdate[model.UpdateLesson]  true  "Lessons"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /lessons/bulk [put]
+// @Security     BearerAuth
+func BulkUpdateLessons(c *gin.Context) {
+	var dto model.BulkUpdate[model.UpdateLesson]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	var tags []string
+	executeBulk(c, dto.Mode, dto.Items, http.StatusOK, func(tx *gorm.DB, item model.BulkUpdateItem[model.UpdateLesson]) (string, interface{}, error) {
+		courseID := courseIDOf[model.Lesson](item.ID)
+		tags = append(tags, courseTag(courseID), courseLessonsTag(courseID))
+		if err := checkVideoAsset(tx, item.Data.VideoAssetID); err != nil {
+			return item.ID, nil, err
+		}
+		data, err := updateFromDTO[model.UpdateLesson, model.Lesson](tx, item.ID, item.Data)
+		return item.ID, data, err
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkDeleteLessons godoc
+// @Summary      Delete lessons in bulk
+// @Description  Deletes up to bulk_max_items lessons, atomically or best effort.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        lessons  body  model.BulkDelete  true  "Lesson IDs"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /lessons/bulk [delete]
+// @Security     BearerAuth
+func BulkDeleteLessons(c *gin.Context) {
+	mode, items, ok := bindBulkDelete(c)
+	if !ok {
+		return
+	}
+	var tags []string
+	executeBulk(c, mode, items, http.StatusOK, func(tx *gorm.DB, item bulkDeleteItem) (string, interface{}, error) {
+		courseID := courseIDOf[model.Lesson](item.ID)
+		tags = append(tags, courseTag(courseID), courseLessonsTag(courseID))
+		return item.ID, nil, deleteByID[model.Lesson](tx, item.ID)
+	})
+	cacheStore.Invalidate(c.Request.Context(), tags...)
+}
+
+// BulkCreateUsers godoc
+// @Summary      Create users in bulk
+// @Description  Creates up to bulk_max_items users, atomically or best effort. Passwords are hashed and never returned.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        users  body  model.BulkCreate[model.CreateUser]  true  "Users"
+// @Success      201  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      409  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /users/bulk [post]
+// @Security     BearerAuth
+func BulkCreateUsers(c *gin.Context) {
+	var dto model.BulkCreate[model.CreateUser]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	applied := executeBulk(c, dto.Mode, dto.Items, http.StatusCreated, func(tx *gorm.DB, item model.CreateUser) (string, interface{}, error) {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(item.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", nil, err
+		}
+		item.Password = string(hashedPassword)
+		user, err := createFromDTO[model.CreateUser, model.User](tx, item)
+		user.Password = ""
+		return user.ID.String(), user, err
+	})
+	// Pictures of users that were not stored stay unclaimed
+	for i, item := range dto.Items {
+		if applied[i] && item.ProfilePictureURL != "" {
+			linkImage(c.Request.Context(), userProfilePicture, &item.ProfilePictureURL)
+		}
+	}
+}
+
+// BulkUpdateUsers godoc
+// @Summary      Update users in bulk
+// @Description  Updates up to bulk_max_items users, atomically or best effort.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        users  body  model.BulkUpdate[model.UpdateUser]  true  "Users"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      409  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /users/bulk [put]
+// @Security     BearerAuth
+func BulkUpdateUsers(c *gin.Context) {
+	var dto model.BulkUpdate[model.UpdateUser]
+	if !bindBulk(c, &dto) {
+		return
+	}
+	applied := executeBulk(c, dto.Mode, dto.Items, http.StatusOK, func(tx *gorm.DB, item model.BulkUpdateItem[model.UpdateUser]) (string, interface{}, error) {
+		item.Data.ID = uuid.Nil
+		item.Data.ProfilePictureVariants = nil
+		data, err := updateFromDTO[model.UpdateUser, model.User](tx, item.ID, item.Data)
+		return item.ID, data, err
+	})
+	for i, item := range dto.Items {
+		if applied[i] && item.Data.ProfilePictureURL != "" {
+			linkImage(c.Request.Context(), userProfilePicture, &item.Data.ProfilePictureURL)
+		}
+	}
+}
+
+// BulkDeleteUsers godoc
+// @Summary      Delete users in bulk
+// @Description  Deletes up to bulk_max_items users, atomically or best effort.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        users  body  model.BulkDelete  true  "User IDs"
+// @Success      200  {object}  model.JsonDTORsp[model.BulkResult]
+// @Success      207  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.BulkResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.BulkResult]
+// @Router       /users/bulk [delete]
+// @Security     BearerAuth
+func BulkDeleteUsers(c *gin.Context) {
+	mode, items, ok := bindBulkDelete(c)
+	if !ok {
+		return
+	}
+	executeBulk(c, mode, items, http.StatusOK, func(tx *gorm.DB, item bulkDeleteItem) (string, interface{}, error) {
+		return item.ID, nil, deleteByID[model.User](tx, item.ID)
+	})
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/cache"
+)
+
+// Read-through cache of the hot read endpoints, nil when caching is disabled
+var cacheStore *cache.Store
+
+// InitCache sets the cache used by the controllers
+func InitCache(store *cache.Store) {
+	cacheStore = store
+}
+
+// cachedList is how list endpoints keep their rows and total count in the cache
+type cachedList[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+}
+
+// Cache tags. A course entry carries its lesson and student counters, so
+// lesson and enrollment writes drop it too; the other counters may lag by
+// up to cache_ttl.
+func courseTag(courseID string) string {
+	return "course:" + courseID
+}
+
+func courseLessonsTag(courseID string) string {
+	return "course-lessons:" + courseID
+}
+
+func courseDocumentsTag(courseID string) string {
+	return "course-documents:" + courseID
+}
+
+// courseIDOf returns the course a row belongs to, so writes addressed by the
+// row id know which cache tags to drop. It returns "" for unknown rows.
+func courseIDOf[E any](id string) string {
+	var courseID uuid.UUID
+	if err := db.Model(new(E)).Select("course_id").Where("id = ?", id).Scan(&courseID).Error; err != nil || courseID == uuid.Nil {
+		return ""
+	}
+	return courseID.String()
+}
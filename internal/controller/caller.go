@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Caller is the authenticated user of a request, resolved from the JWT claims
+// that handleWrapper stores on the gin context.
+type Caller struct {
+	ID   uuid.UUID
+	Role string
+}
+
+// IsAdmin reports whether the caller has the admin role
+func (caller Caller) IsAdmin() bool {
+	return caller.Role == "admin"
+}
+
+// currentCaller returns the authenticated caller of the request
+func currentCaller(c *gin.Context) (Caller, error) {
+	var caller Caller
+
+	rawID, ok := c.Get("user_id")
+	if !ok || rawID == nil {
+		return caller, fmt.Errorf("missing user id in token")
+	}
+	id, err := uuid.Parse(fmt.Sprintf("%v", rawID))
+	if err != nil {
+		return caller, fmt.Errorf("invalid user id in token: %v", err)
+	}
+	caller.ID = id
+
+	if role, ok := c.Get("role"); ok && role != nil {
+		caller.Role = fmt.Sprintf("%v", role)
+	}
+	return caller, nil
+}
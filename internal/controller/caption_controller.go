@@ -0,0 +1,632 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/caption"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/video"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCaptionSize bounds the caption files, an hour of dense dialog is well
+// under 200 KB
+const maxCaptionSize = 2 << 20
+
+var (
+	errCaptionNotFound    = errors.New("caption track does not exist")
+	errCaptionCueNotFound = errors.New("cue does not exist")
+)
+
+// videoDuration is the probed duration of the video, 0 before it is probed
+func videoDuration(asset model.VideoAsset) time.Duration {
+	if asset.Duration == nil {
+		return 0
+	}
+	return time.Duration(*asset.Duration * float64(time.Second))
+}
+
+// captionCues gives the parsed cues their IDs
+func captionCues(cues []caption.Cue) model.CaptionCues {
+	stored := make(model.CaptionCues, 0, len(cues))
+	for _, cue := range cues {
+		stored = append(stored, model.CaptionCue{
+			ID: uuid.New(), Identifier: cue.ID, StartMS: cue.Start.Milliseconds(), EndMS: cue.End.Milliseconds(),
+			Settings: cue.Settings, Text: cue.Text,
+		})
+	}
+	return stored
+}
+
+// vttCues are the stored cues as written to WebVTT
+func vttCues(cues model.CaptionCues) []caption.Cue {
+	out := make([]caption.Cue, 0, len(cues))
+	for _, cue := range cues {
+		out = append(out, caption.Cue{
+			ID: cue.Identifier, Start: time.Duration(cue.StartMS) * time.Millisecond, End: time.Duration(cue.EndMS) * time.Millisecond,
+			Settings: cue.Settings, Text: cue.Text,
+		})
+	}
+	return out
+}
+
+// CreateVideoCaption godoc
+// @Summary      Upload a caption track
+// @Description  Adds a WebVTT or SRT file as the caption track of the video in a language, SRT files are converted to WebVTT.
+// @Description  Replaces the track of the same language and kind if there is one. Cues must be in order, must not overlap and must end within the video.
+// @Description  Tracks are listed in the HLS master playlist as subtitle renditions. Only the uploader, the teachers of the video and admins can add tracks.
+// @Tags         Caption
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id          path      string  true   "Video asset ID"
+// @Param        file        formData  file    true   "WebVTT or SRT file, UTF-8"
+// @Param        language    formData  string  true   "BCP 47 language tag, e.g. en or vi"
+// @Param        kind        formData  string  false  "subtitles (default) or captions"
+// @Param        label       formData  string  false  "Name shown in the player, defaults to the language"
+// @Param        is_default  formData  bool    false  "Shown when the viewer did not pick a track"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Success      201  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions [post]
+// @Security     BearerAuth
+func CreateVideoCaption(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCaption]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	var dto model.CreateVideoCaption
+	if err := c.ShouldBind(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	tag, err := language.Parse(dto.Language)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "language must be a BCP 47 tag, e.g. en or vi"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "file is required"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	if file.Size > maxCaptionSize {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "caption files are at most 2 MB"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxCaptionSize))
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if !utf8.Valid(data) {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = "caption file must be UTF-8"
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+	cues, format, err := caption.Parse(data)
+	if err == nil {
+		err = caption.Validate(cues, videoDuration(asset))
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	track := model.VideoCaption{
+		AssetID: asset.ID, Language: tag.String(), Kind: dto.Kind, Label: strings.TrimSpace(dto.Label),
+		IsDefault: dto.IsDefault, Format: format, Cues: captionCues(cues), CreatedBy: caller.ID,
+	}
+	if track.Kind == "" {
+		track.Kind = model.CaptionKindSubtitles
+	}
+	if track.Label == "" {
+		track.Label = track.Language
+	}
+	created := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing model.VideoCaption
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("asset_id = ? AND language = ? AND kind = ?", track.AssetID, track.Language, track.Kind).
+			Take(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created = true
+			track.ID = uuid.New()
+			err = tx.Create(&track).Error
+		case err == nil:
+			track.ID, track.CreatedAt = existing.ID, existing.CreatedAt
+			err = tx.Model(&track).Select("label", "is_default", "format", "cues", "created_by").Updates(&track).Error
+		}
+		if err != nil || !track.IsDefault {
+			return err
+		}
+		return unsetDefaultCaptions(tx, track)
+	})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = track
+	if created {
+		c.JSON(http.StatusCreated, &jsonRsp)
+		return
+	}
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// unsetDefaultCaptions leaves track the only default track of its video
+func unsetDefaultCaptions(tx *gorm.DB, track model.VideoCaption) error {
+	return tx.Model(&model.VideoCaption{}).Where("asset_id = ? AND id <> ?", track.AssetID, track.ID).
+		Update("is_default", false).Error
+}
+
+// ListVideoCaptions godoc
+// @Summary      List the caption tracks of a video
+// @Description  Returns the tracks of the video without their cues, by language.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Video asset ID"
+// @Success      200  {object}  model.JsonDTORsp[[]model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.VideoCaption]
+// @Router       /videos/{id}/captions [get]
+// @Security     BearerAuth
+func ListVideoCaptions(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.VideoCaption]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, false) {
+		return
+	}
+	tracks, err := videoCaptions(db, asset.ID)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = tracks
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// videoCaptions lists the tracks of a video without their cues
+func videoCaptions(tx *gorm.DB, assetID uuid.UUID) ([]model.VideoCaption, error) {
+	tracks := make([]model.VideoCaption, 0)
+	err := tx.Omit("cues").Where("asset_id = ?", assetID).Order("language, kind").Find(&tracks).Error
+	return tracks, err
+}
+
+// GetVideoCaption godoc
+// @Summary      Get a caption track
+// @Description  Returns the track with its cues, or the WebVTT file with format=vtt.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Produce      text/vtt
+// @Param        id          path   string  true   "Video asset ID"
+// @Param        caption_id  path   string  true   "Caption track ID"
+// @Param        format      query  string  false  "vtt for the WebVTT file"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id} [get]
+// @Security     BearerAuth
+func GetVideoCaption(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCaption]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, false) {
+		return
+	}
+	track, ok := videoCaptionOf(c, jsonRsp, db, asset)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") == "vtt" {
+		c.Data(http.StatusOK, "text/vtt; charset=utf-8", caption.VTT(vttCues(track.Cues)))
+		return
+	}
+	jsonRsp.Data = track
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// UpdateVideoCaption godoc
+// @Summary      Change a caption track
+// @Description  Changes the label of the track or makes it the default one of the video.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                    true  "Video asset ID"
+// @Param        caption_id  path  string                    true  "Caption track ID"
+// @Param        caption     body  model.UpdateVideoCaption  true  "Changes"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id} [put]
+// @Security     BearerAuth
+func UpdateVideoCaption(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCaption]()
+
+	var dto model.UpdateVideoCaption
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	if dto.Label != nil && strings.TrimSpace(*dto.Label) == "" {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "label cannot be empty"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+
+	var track model.VideoCaption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if track, err = lockVideoCaption(tx, c.Param("caption_id"), asset.ID); err != nil {
+			return err
+		}
+		if dto.Label != nil {
+			track.Label = strings.TrimSpace(*dto.Label)
+		}
+		if dto.IsDefault != nil {
+			track.IsDefault = *dto.IsDefault
+		}
+		if err := tx.Model(&track).Select("label", "is_default").Updates(&track).Error; err != nil {
+			return err
+		}
+		if !track.IsDefault {
+			return nil
+		}
+		return unsetDefaultCaptions(tx, track)
+	})
+	if errors.Is(err, errCaptionNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = track
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// DeleteVideoCaption godoc
+// @Summary      Delete a caption track
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string  true  "Video asset ID"
+// @Param        caption_id  path  string  true  "Caption track ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id} [delete]
+// @Security     BearerAuth
+func DeleteVideoCaption(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCaption]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	track, ok := videoCaptionOf(c, jsonRsp, db, asset)
+	if !ok {
+		return
+	}
+	if err := db.Delete(&track).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusDeleteItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = track
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// AddCaptionCue godoc
+// @Summary      Add a cue to a caption track
+// @Description  Inserts the cue at its place by start time, it must not overlap the other cues. Returns the track.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                 true  "Video asset ID"
+// @Param        caption_id  path  string                 true  "Caption track ID"
+// @Param        cue         body  model.CaptionCueInput  true  "Cue"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id}/cues [post]
+// @Security     BearerAuth
+func AddCaptionCue(c *gin.Context) {
+	var dto model.CaptionCueInput
+	editCaptionCues(c, &dto, func(cues model.CaptionCues) (model.CaptionCues, error) {
+		return append(cues, captionCue(uuid.New(), dto)), nil
+	})
+}
+
+// UpdateCaptionCue godoc
+// @Summary      Change a cue of a caption track
+// @Description  Replaces the timing, settings and text of the cue, it must not overlap the other cues. Returns the track.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                 true  "Video asset ID"
+// @Param        caption_id  path  string                 true  "Caption track ID"
+// @Param        cue_id      path  string                 true  "Cue ID"
+// @Param        cue         body  model.CaptionCueInput  true  "Cue"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id}/cues/{cue_id} [put]
+// @Security     BearerAuth
+func UpdateCaptionCue(c *gin.Context) {
+	var dto model.CaptionCueInput
+	editCaptionCues(c, &dto, func(cues model.CaptionCues) (model.CaptionCues, error) {
+		for i, cue := range cues {
+			if cue.ID.String() == c.Param("cue_id") {
+				cues[i] = captionCue(cue.ID, dto)
+				return cues, nil
+			}
+		}
+		return nil, errCaptionCueNotFound
+	})
+}
+
+// DeleteCaptionCue godoc
+// @Summary      Delete a cue of a caption track
+// @Description  Returns the track. The last cue of a track cannot be deleted, delete the track instead.
+// @Tags         Caption
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string  true  "Video asset ID"
+// @Param        caption_id  path  string  true  "Caption track ID"
+// @Param        cue_id      path  string  true  "Cue ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCaption]
+// @Router       /videos/{id}/captions/{caption_id}/cues/{cue_id} [delete]
+// @Security     BearerAuth
+func DeleteCaptionCue(c *gin.Context) {
+	editCaptionCues(c, nil, func(cues model.CaptionCues) (model.CaptionCues, error) {
+		for i, cue := range cues {
+			if cue.ID.String() == c.Param("cue_id") {
+				if len(cues) == 1 {
+					return nil, caption.ValidationError{{Index: 1, Reason: "is the last cue of the track"}}
+				}
+				return append(cues[:i], cues[i+1:]...), nil
+			}
+		}
+		return nil, errCaptionCueNotFound
+	})
+}
+
+// captionLineBreaks turns CRLF and lone CR line breaks into LF
+var captionLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func captionCue(id uuid.UUID, dto model.CaptionCueInput) model.CaptionCue {
+	return model.CaptionCue{
+		ID: id, Identifier: strings.TrimSpace(dto.Identifier), StartMS: *dto.StartMS, EndMS: *dto.EndMS,
+		Settings: strings.TrimSpace(dto.Settings), Text: strings.TrimSpace(captionLineBreaks.Replace(dto.Text)),
+	}
+}
+
+// editCaptionCues binds the body to dto unless it is nil, then changes the
+// cues of the caption track with edit and saves them ordered by start once
+// they are valid
+func editCaptionCues(c *gin.Context, dto *model.CaptionCueInput, edit func(model.CaptionCues) (model.CaptionCues, error)) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCaption]()
+
+	if dto != nil {
+		if err := c.ShouldBindJSON(dto); err != nil {
+			jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusBadRequest, &jsonRsp)
+			return
+		}
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+
+	var track model.VideoCaption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if track, err = lockVideoCaption(tx, c.Param("caption_id"), asset.ID); err != nil {
+			return err
+		}
+		cues, err := edit(append(model.CaptionCues(nil), track.Cues...))
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(cues, func(i, j int) bool { return cues[i].StartMS < cues[j].StartMS })
+		if err := caption.Validate(vttCues(cues), videoDuration(asset)); err != nil {
+			return err
+		}
+		track.Cues = cues
+		return tx.Model(&track).Update("cues", cues).Error
+	})
+	var invalid caption.ValidationError
+	switch {
+	case errors.Is(err, errCaptionNotFound), errors.Is(err, errCaptionCueNotFound):
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	case errors.As(err, &invalid):
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	case err != nil:
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = track
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// videoCaptionOf reads the caption track of the caption_id path parameter, it
+// answers the request and returns false when it cannot
+func videoCaptionOf[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T], tx *gorm.DB, asset model.VideoAsset) (model.VideoCaption, bool) {
+	var track model.VideoCaption
+	err := tx.Where("id = ? AND asset_id = ?", c.Param("caption_id"), asset.ID).Take(&track).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = errCaptionNotFound.Error()
+		c.JSON(http.StatusNotFound, jsonRsp)
+		return track, false
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return track, false
+	}
+	return track, true
+}
+
+// lockVideoCaption reads a caption track of the asset and locks it until the
+// transaction ends
+func lockVideoCaption(tx *gorm.DB, id string, assetID uuid.UUID) (model.VideoCaption, error) {
+	var track model.VideoCaption
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND asset_id = ?", id, assetID).Take(&track).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return track, errCaptionNotFound
+	}
+	return track, err
+}
+
+// masterPlaylist lists the renditions and the caption tracks of a ready video
+func masterPlaylist(asset model.VideoAsset) ([]byte, error) {
+	tracks, err := videoCaptions(db, asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	renditions := make([]video.Rendition, 0, len(asset.Renditions))
+	for _, r := range asset.Renditions {
+		renditions = append(renditions, video.Rendition{
+			Name: r.Name, Width: r.Width, Height: r.Height, VideoBitrate: r.VideoBitrate, AudioBitrate: r.AudioBitrate,
+		})
+	}
+	subtitles := make([]video.Subtitle, 0, len(tracks))
+	for _, track := range tracks {
+		subtitles = append(subtitles, video.Subtitle{
+			Name: track.Label, Language: track.Language, URI: "captions/" + track.ID.String() + ".m3u8",
+			Default: track.IsDefault, Captions: track.Kind == model.CaptionKindCaptions,
+		})
+	}
+	return video.MasterPlaylist(renditions, subtitles...), nil
+}
+
+// serveCaptionRendition serves the media playlist (<caption id>.m3u8) or the
+// WebVTT segment (<caption id>.vtt) of a caption track
+func serveCaptionRendition(c *gin.Context, asset model.VideoAsset, name string) {
+	ext := path.Ext(name)
+	id, err := uuid.Parse(strings.TrimSuffix(name, ext))
+	if err != nil || (ext != ".m3u8" && ext != ".vtt") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist or segment not found"})
+		return
+	}
+	var track model.VideoCaption
+	err = db.Where("id = ? AND asset_id = ?", id, asset.ID).Take(&track).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "caption track not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Cues can be edited at any time
+	c.Header("Cache-Control", "private, no-cache")
+	if ext == ".vtt" {
+		c.Data(http.StatusOK, "text/vtt; charset=utf-8", caption.VTT(vttCues(track.Cues), video.SubtitleTimestampMap))
+		return
+	}
+	playlist := video.SubtitlePlaylist(id.String()+".vtt", videoDuration(asset).Seconds())
+	c.Data(http.StatusOK, hlsContentType(name), withPlaybackToken(playlist, c.Query("token")))
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/caption"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/video"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// chapterError lists the problems of the chapters set on a video
+type chapterError []string
+
+func (e chapterError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// validateChapters checks that the chapters, ordered by start, have a title
+// on one line and start at distinct times within the video
+func validateChapters(chapters []model.VideoChapter, duration float64) error {
+	var problems chapterError
+	for i, chapter := range chapters {
+		fail := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Sprintf("chapter %d: ", i+1)+fmt.Sprintf(format, args...))
+		}
+		if strings.TrimSpace(chapter.Title) == "" {
+			fail("has no title")
+		}
+		if strings.ContainsAny(chapter.Title, "\r\n") || strings.Contains(chapter.Title, "-->") {
+			fail("title cannot contain --> or line breaks")
+		}
+		if chapter.Start >= duration {
+			fail("starts at %s, after the video ends at %s", caption.Timestamp(seconds(chapter.Start)), caption.Timestamp(seconds(duration)))
+		}
+		if i > 0 && chapter.Start == chapters[i-1].Start {
+			fail("starts at %s like chapter %d", caption.Timestamp(seconds(chapter.Start)), i)
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// videoChapters reads the chapters of a video ordered by start, with their end
+func videoChapters(tx *gorm.DB, asset model.VideoAsset) ([]model.VideoChapter, error) {
+	chapters := make([]model.VideoChapter, 0)
+	if err := tx.Where("asset_id = ?", asset.ID).Order("start").Find(&chapters).Error; err != nil {
+		return nil, err
+	}
+	withEnds(chapters, videoDuration(asset).Seconds())
+	return chapters, nil
+}
+
+// withEnds ends every chapter at the start of the next one, the last one at
+// the end of the video
+func withEnds(chapters []model.VideoChapter, duration float64) {
+	for i := range chapters {
+		chapters[i].End = duration
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		}
+	}
+}
+
+// chaptersVTT is the WebVTT chapters track of the chapters
+func chaptersVTT(chapters []model.VideoChapter) []byte {
+	cues := make([]caption.Cue, 0, len(chapters))
+	for i, chapter := range chapters {
+		cues = append(cues, caption.Cue{
+			ID: fmt.Sprintf("chapter-%d", i+1), Start: seconds(chapter.Start), End: seconds(chapter.End),
+			Text: strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(strings.TrimSpace(chapter.Title)),
+		})
+	}
+	return caption.VTT(cues)
+}
+
+// ListVideoChapters godoc
+// @Summary      List the chapters of a video
+// @Description  Returns the chapters ordered by start, each ending where the next one starts, or the WebVTT chapters track with format=vtt.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Produce      text/vtt
+// @Param        id      path   string  true   "Video asset ID"
+// @Param        format  query  string  false  "vtt for the WebVTT file"
+// @Success      200  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Router       /videos/{id}/chapters [get]
+// @Security     BearerAuth
+func ListVideoChapters(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.VideoChapter]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, false) {
+		return
+	}
+	chapters, err := videoChapters(db, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	if c.Query("format") == "vtt" {
+		c.Data(http.StatusOK, "text/vtt; charset=utf-8", chaptersVTT(chapters))
+		return
+	}
+	jsonRsp.Data = chapters
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// SetVideoChapters godoc
+// @Summary      Set the chapters of a video
+// @Description  Replaces the chapters of the video, an empty list removes them. Chapters are ordered by start and end where the next one starts.
+// @Description  Starts must be distinct and within the probed duration of the video, so the video must be probed first.
+// @Description  Only the uploader, the teachers of the video and admins can set chapters.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id        path  string                  true  "Video asset ID"
+// @Param        chapters  body  model.SetVideoChapters  true  "Chapters"
+// @Success      200  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      400  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      422  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.VideoChapter]
+// @Router       /videos/{id}/chapters [put]
+// @Security     BearerAuth
+func SetVideoChapters(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.VideoChapter]()
+
+	var dto model.SetVideoChapters
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	if asset.Duration == nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = "video is not probed yet, chapters are checked against its duration"
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	chapters := make([]model.VideoChapter, 0, len(dto.Chapters))
+	for _, input := range dto.Chapters {
+		chapters = append(chapters, model.VideoChapter{
+			ID: uuid.New(), AssetID: asset.ID, Title: strings.TrimSpace(input.Title), Start: *input.Start, CreatedBy: caller.ID,
+		})
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	if err := validateChapters(chapters, *asset.Duration); err != nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("asset_id = ?", asset.ID).Delete(&model.VideoChapter{}).Error; err != nil {
+			return err
+		}
+		if len(chapters) == 0 {
+			return nil
+		}
+		return tx.Create(&chapters).Error
+	})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	withEnds(chapters, *asset.Duration)
+
+	jsonRsp.Data = chapters
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// serveVideoTrack serves the WebVTT chapters (chapters.vtt) or thumbnails
+// (thumbnails.vtt) track of a ready video, the sprite sheets of the
+// thumbnails carry the playback token
+func serveVideoTrack(c *gin.Context, asset model.VideoAsset, name string) {
+	var track []byte
+	switch name {
+	case "chapters.vtt":
+		chapters, err := videoChapters(db, asset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Chapters can be changed at any time
+		c.Header("Cache-Control", "private, no-cache")
+		track = chaptersVTT(chapters)
+	case "thumbnails.vtt":
+		if asset.Thumbnails == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "video has no thumbnails"})
+			return
+		}
+		t := asset.Thumbnails
+		sprites := video.Sprites{Interval: t.Interval, Width: t.Width, Height: t.Height, Columns: t.Columns, Rows: t.Rows, Count: t.Count}
+		query := ""
+		if token := c.Query("token"); token != "" {
+			query = "?token=" + url.QueryEscape(token)
+		}
+		// The sprites carry the token of the viewer
+		c.Header("Cache-Control", "private, no-store")
+		track = sprites.VTT(videoDuration(asset).Seconds(), func(sheet int) string {
+			return "thumbnails/" + video.SpriteName(sheet) + query
+		})
+	}
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", track)
+}
@@ -0,0 +1,616 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+var errCheckpointNotFound = errors.New("checkpoint does not exist")
+
+// pendingCheckpoints returns the checkpoints of the video the viewer did not
+// pass yet in the lesson, ordered by time. Blocking checkpoints are passed by
+// a correct answer, the others by any answer.
+func pendingCheckpoints(tx *gorm.DB, lessonID uuid.UUID, assetID uuid.UUID, userID uuid.UUID) ([]model.VideoCheckpoint, error) {
+	var checkpoints []model.VideoCheckpoint
+	err := tx.Where("asset_id = ?", assetID).
+		Where(`NOT EXISTS (SELECT 1 FROM checkpoint_answer a
+			WHERE a.checkpoint_id = video_checkpoint.id AND a.lesson_id = ? AND a.user_id = ? AND (a.correct OR NOT video_checkpoint.blocking))`,
+			lessonID, userID).
+		Order("at").Find(&checkpoints).Error
+	return checkpoints, err
+}
+
+// blockingCheckpoint returns the time of the first blocking checkpoint of the
+// ordered checkpoints
+func blockingCheckpoint(checkpoints []model.VideoCheckpoint) (float64, bool) {
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Blocking {
+			return checkpoint.At, true
+		}
+	}
+	return 0, false
+}
+
+// correctOptions are the ids of the correct options of a checkpoint
+func correctOptions(checkpoint model.VideoCheckpoint) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, 1)
+	for _, option := range checkpoint.Options {
+		if option.Correct {
+			ids = append(ids, option.ID)
+		}
+	}
+	return ids
+}
+
+// gradeCheckpoint reports whether the picked options are exactly the correct
+// ones of the checkpoint
+func gradeCheckpoint(checkpoint model.VideoCheckpoint, picked []uuid.UUID) (bool, error) {
+	if checkpoint.Kind == model.CheckpointKindSingle && len(picked) > 1 {
+		return false, errors.New("pick a single option")
+	}
+	options := make(map[uuid.UUID]bool, len(checkpoint.Options))
+	for _, option := range checkpoint.Options {
+		options[option.ID] = option.Correct
+	}
+	chosen := make(map[uuid.UUID]bool, len(picked))
+	for _, id := range picked {
+		if _, ok := options[id]; !ok {
+			return false, fmt.Errorf("option %s is not an option of the checkpoint", id)
+		}
+		chosen[id] = true
+	}
+	for id, correct := range options {
+		if correct != chosen[id] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// videoCheckpoint builds the checkpoint of the request, checked against the
+// probed duration of the video
+func videoCheckpoint(dto model.SaveVideoCheckpoint, asset model.VideoAsset) (model.VideoCheckpoint, error) {
+	checkpoint := model.VideoCheckpoint{
+		AssetID: asset.ID, At: *dto.At, Question: strings.TrimSpace(dto.Question), Kind: dto.Kind,
+		Explanation: dto.Explanation, Blocking: cfg.GetBool("video_checkpoint_blocking"),
+	}
+	if checkpoint.Kind == "" {
+		checkpoint.Kind = model.CheckpointKindSingle
+	}
+	if dto.Blocking != nil {
+		checkpoint.Blocking = *dto.Blocking
+	}
+	if asset.Duration == nil {
+		return checkpoint, errors.New("video is not probed yet, checkpoints are checked against its duration")
+	}
+	if checkpoint.At >= *asset.Duration {
+		return checkpoint, fmt.Errorf("checkpoint is at %.3f seconds, after the video ends at %.3f", checkpoint.At, *asset.Duration)
+	}
+	if checkpoint.Question == "" {
+		return checkpoint, errors.New("checkpoint has no question")
+	}
+	correct := 0
+	for i, input := range dto.Options {
+		option := model.CheckpointOption{ID: uuid.New(), Text: strings.TrimSpace(input.Text), Correct: input.Correct}
+		if option.Text == "" {
+			return checkpoint, fmt.Errorf("option %d has no text", i+1)
+		}
+		if option.Correct {
+			correct++
+		}
+		checkpoint.Options = append(checkpoint.Options, option)
+	}
+	switch {
+	case checkpoint.Kind == model.CheckpointKindSingle && correct != 1:
+		return checkpoint, errors.New("single choice checkpoints need exactly one correct option")
+	case correct == 0:
+		return checkpoint, errors.New("checkpoints need a correct option")
+	}
+	return checkpoint, nil
+}
+
+// CreateVideoCheckpoint godoc
+// @Summary      Add a checkpoint to a video
+// @Description  Adds a question the player asks when the video reaches the time of the checkpoint, single or multiple choice.
+// @Description  Blocking checkpoints (video_checkpoint_blocking by default) keep the video paused until the student answers correctly.
+// @Description  Lessons showing the video are only complete once every checkpoint is passed. Only the uploader, the teachers of the video and admins can add checkpoints.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id          path  string                     true  "Video asset ID"
+// @Param        checkpoint  body  model.SaveVideoCheckpoint  true  "Checkpoint"
+// @Success      201  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Router       /videos/{id}/checkpoints [post]
+// @Security     BearerAuth
+func CreateVideoCheckpoint(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCheckpoint]()
+
+	var dto model.SaveVideoCheckpoint
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	checkpoint, err := videoCheckpoint(dto, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+	checkpoint.ID = uuid.New()
+	checkpoint.CreatedBy = caller.ID
+	if err := db.Create(&checkpoint).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = checkpoint
+	c.JSON(http.StatusCreated, &jsonRsp)
+}
+
+// ListVideoCheckpoints godoc
+// @Summary      List the checkpoints of a video
+// @Description  Returns the checkpoints ordered by time with their correct options, for the uploader, the teachers of the video and admins.
+// @Description  Players get the checkpoints of a lesson from GET /lessons/{id}/checkpoints.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Video asset ID"
+// @Success      200  {object}  model.JsonDTORsp[[]model.VideoCheckpoint]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.VideoCheckpoint]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.VideoCheckpoint]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.VideoCheckpoint]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.VideoCheckpoint]
+// @Router       /videos/{id}/checkpoints [get]
+// @Security     BearerAuth
+func ListVideoCheckpoints(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.VideoCheckpoint]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	checkpoints := make([]model.VideoCheckpoint, 0)
+	if err := db.Where("asset_id = ?", asset.ID).Order("at, created_at").Find(&checkpoints).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = checkpoints
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// UpdateVideoCheckpoint godoc
+// @Summary      Replace a checkpoint of a video
+// @Description  Replaces the question, the options and the settings of the checkpoint. Options get new ids, answers given before keep their grade.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id             path  string                     true  "Video asset ID"
+// @Param        checkpoint_id  path  string                     true  "Checkpoint ID"
+// @Param        checkpoint     body  model.SaveVideoCheckpoint  true  "Checkpoint"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      422  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Router       /videos/{id}/checkpoints/{checkpoint_id} [put]
+// @Security     BearerAuth
+func UpdateVideoCheckpoint(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCheckpoint]()
+
+	var dto model.SaveVideoCheckpoint
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	existing, ok := videoCheckpointOf(c, jsonRsp, asset)
+	if !ok {
+		return
+	}
+	checkpoint, err := videoCheckpoint(dto, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+	checkpoint.ID, checkpoint.CreatedBy, checkpoint.CreatedAt = existing.ID, existing.CreatedBy, existing.CreatedAt
+	err = db.Model(&checkpoint).Select("at", "question", "kind", "options", "explanation", "blocking").Updates(&checkpoint).Error
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = checkpoint
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// DeleteVideoCheckpoint godoc
+// @Summary      Remove a checkpoint from a video
+// @Description  Removes the checkpoint and the answers given to it.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id             path  string  true  "Video asset ID"
+// @Param        checkpoint_id  path  string  true  "Checkpoint ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoCheckpoint]
+// @Router       /videos/{id}/checkpoints/{checkpoint_id} [delete]
+// @Security     BearerAuth
+func DeleteVideoCheckpoint(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoCheckpoint]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok || !authorizeVideo(c, jsonRsp, caller, asset, true) {
+		return
+	}
+	checkpoint, ok := videoCheckpointOf(c, jsonRsp, asset)
+	if !ok {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("checkpoint_id = ?", checkpoint.ID).Delete(&model.CheckpointAnswer{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&checkpoint).Error
+	})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusDeleteItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = checkpoint
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// videoCheckpointOf reads the checkpoint of the checkpoint_id path parameter,
+// it answers the request and returns false when it cannot
+func videoCheckpointOf[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T], asset model.VideoAsset) (model.VideoCheckpoint, bool) {
+	var checkpoint model.VideoCheckpoint
+	err := db.Where("id = ? AND asset_id = ?", c.Param("checkpoint_id"), asset.ID).Take(&checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = errCheckpointNotFound.Error()
+		c.JSON(http.StatusNotFound, jsonRsp)
+		return checkpoint, false
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return checkpoint, false
+	}
+	return checkpoint, true
+}
+
+// checkpointAttempts counts the answers of the viewers of a lesson per
+// checkpoint
+type checkpointAttempts struct {
+	UserID          uuid.UUID
+	CheckpointID    uuid.UUID
+	Attempts        int
+	Correct         bool
+	FirstTryCorrect bool
+	LastAnsweredAt  time.Time
+}
+
+// lessonCheckpointAttempts sums up the answers given in the lesson, of a
+// single user unless userID is nil
+func lessonCheckpointAttempts(tx *gorm.DB, lessonID uuid.UUID, userID *uuid.UUID) ([]checkpointAttempts, error) {
+	query := tx.Model(&model.CheckpointAnswer{}).
+		Select(`user_id, checkpoint_id, count(*) AS attempts, bool_or(correct) AS correct,
+			bool_or(correct AND attempt = 1) AS first_try_correct, max(created_at) AS last_answered_at`).
+		Where("lesson_id = ?", lessonID)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	var attempts []checkpointAttempts
+	err := query.Group("user_id, checkpoint_id").Order("user_id").Scan(&attempts).Error
+	return attempts, err
+}
+
+// ListLessonCheckpoints godoc
+// @Summary      Get the checkpoints of a lesson video
+// @Description  Returns the checkpoints of the video of the lesson ordered by time, for the player to pause at, with the attempts of the caller.
+// @Description  Correct options and explanations are only shown for the checkpoints the caller passed.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Lesson ID"
+// @Success      200  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Failure      422  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.LessonCheckpoint]
+// @Router       /lessons/{id}/checkpoints [get]
+// @Security     BearerAuth
+func ListLessonCheckpoints(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.LessonCheckpoint]()
+
+	lesson, asset, caller, ok := videoLessonOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	var checkpoints []model.VideoCheckpoint
+	err := db.Where("asset_id = ?", asset.ID).Order("at, created_at").Find(&checkpoints).Error
+	var attempts []checkpointAttempts
+	if err == nil {
+		attempts, err = lessonCheckpointAttempts(db, lesson.ID, &caller.ID)
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	byCheckpoint := make(map[uuid.UUID]checkpointAttempts, len(attempts))
+	for _, a := range attempts {
+		byCheckpoint[a.CheckpointID] = a
+	}
+	out := make([]model.LessonCheckpoint, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		a, answered := byCheckpoint[checkpoint.ID]
+		item := model.LessonCheckpoint{VideoCheckpoint: checkpoint, Attempts: a.Attempts, Passed: a.Correct || (answered && !checkpoint.Blocking)}
+		if !item.Passed {
+			item.Explanation = nil
+			item.Options = make(model.CheckpointOptions, 0, len(checkpoint.Options))
+			for _, option := range checkpoint.Options {
+				option.Correct = false
+				item.Options = append(item.Options, option)
+			}
+		}
+		out = append(out, item)
+	}
+
+	jsonRsp.Data = out
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// AnswerLessonCheckpoint godoc
+// @Summary      Answer a checkpoint of a lesson video
+// @Description  Records the answer of the caller and grades it: correct when exactly the correct options are picked. Answers can be given again.
+// @Description  The result tells whether the checkpoint is passed, then the video may go on and the correct options and the explanation are shown.
+// @Description  Passing the last checkpoint completes the lesson when enough of the video was watched.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        id             path  string                       true  "Lesson ID"
+// @Param        checkpoint_id  path  string                       true  "Checkpoint ID"
+// @Param        answer         body  model.CheckpointAnswerInput  true  "Answer"
+// @Success      201  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      400  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      401  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      403  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      404  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      422  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Failure      500  {object}  model.JsonDTORsp[model.CheckpointResult]
+// @Router       /lessons/{id}/checkpoints/{checkpoint_id}/answers [post]
+// @Security     BearerAuth
+func AnswerLessonCheckpoint(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.CheckpointResult]()
+
+	var dto model.CheckpointAnswerInput
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	lesson, asset, caller, ok := videoLessonOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	checkpoint, ok := videoCheckpointOf(c, jsonRsp, asset)
+	if !ok {
+		return
+	}
+	correct, err := gradeCheckpoint(checkpoint, dto.OptionIDs)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	answer := model.CheckpointAnswer{
+		ID: uuid.New(), CheckpointID: checkpoint.ID, UserID: caller.ID, LessonID: lesson.ID, CourseID: lesson.CourseID,
+		OptionIDs: dto.OptionIDs, Correct: correct,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var previous int64
+		err := tx.Model(&model.CheckpointAnswer{}).
+			Where("checkpoint_id = ? AND user_id = ? AND lesson_id = ?", checkpoint.ID, caller.ID, lesson.ID).
+			Count(&previous).Error
+		if err != nil {
+			return err
+		}
+		answer.Attempt = int(previous) + 1
+		return tx.Create(&answer).Error
+	})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	result := model.CheckpointResult{Answer: answer, Passed: correct || !checkpoint.Blocking}
+	if result.Passed {
+		result.CorrectOptionIDs = correctOptions(checkpoint)
+		result.Explanation = checkpoint.Explanation
+		if err := checkpointPassed(c, lesson, asset, caller); err != nil {
+			log.Printf("could not update the progress of lesson %s for user %s - %s", lesson.ID, caller.ID, err)
+		}
+	}
+
+	jsonRsp.Data = result
+	c.JSON(http.StatusCreated, &jsonRsp)
+}
+
+// checkpointPassed completes the lesson of a viewer who passed its last
+// checkpoint after watching enough of the video, through a heartbeat at the
+// position they are at
+func checkpointPassed(c *gin.Context, lesson model.Lesson, asset model.VideoAsset, caller Caller) error {
+	pending, err := pendingCheckpoints(db, lesson.ID, asset.ID, caller.ID)
+	if err != nil || len(pending) > 0 {
+		return err
+	}
+	key := progressKey{lesson.ID, caller.ID}
+	current, err := currentProgress(c.Request.Context(), key)
+	if err != nil || current == nil || current.CompletedAt != nil {
+		return err
+	}
+	heartbeat := pendingProgress{
+		courseID: lesson.CourseID, assetID: asset.ID, position: current.Position, at: time.Now(), checkpointsPassed: true,
+	}
+	if asset.Duration != nil {
+		heartbeat.duration = *asset.Duration
+	}
+	_, err = recordHeartbeat(c.Request.Context(), key, heartbeat)
+	return err
+}
+
+// GetLessonCheckpointResults godoc
+// @Summary      Get the checkpoint results of the students of a lesson
+// @Description  Returns per student the attempts at each checkpoint of the lesson video, whether it was answered correctly, at the first attempt,
+// @Description  and whether it is passed. Filtered to a student with user_id. Only the teacher of the course and admins see the results.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        id       path   string  true   "Lesson ID"
+// @Param        user_id  query  string  false  "Student ID"
+// @Success      200  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      400  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      401  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      403  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      404  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      422  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Failure      500  {object}  model.JsonDTORsp[model.LessonCheckpointResults]
+// @Router       /lessons/{id}/checkpoint-results [get]
+// @Security     BearerAuth
+func GetLessonCheckpointResults(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.LessonCheckpointResults]()
+
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+			jsonRsp.Message = "user_id is not a valid id"
+			c.JSON(http.StatusBadRequest, &jsonRsp)
+			return
+		}
+		userID = &id
+	}
+	lesson, asset, caller, ok := videoLessonOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	var course model.Course
+	if err := db.Where("id = ?", lesson.CourseID).Take(&course).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if !caller.IsAdmin() && course.InstructorID != caller.ID {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "only the teacher of the course can see the results of its students"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	var checkpoints []model.VideoCheckpoint
+	err := db.Select("id", "at", "blocking").Where("asset_id = ?", asset.ID).Find(&checkpoints).Error
+	var attempts []checkpointAttempts
+	if err == nil {
+		attempts, err = lessonCheckpointAttempts(db, lesson.ID, userID)
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	byID := make(map[uuid.UUID]model.VideoCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		byID[checkpoint.ID] = checkpoint
+	}
+	results := model.LessonCheckpointResults{LessonID: lesson.ID, Checkpoints: len(checkpoints), Students: []model.CheckpointStudentResults{}}
+	for _, a := range attempts {
+		checkpoint, current := byID[a.CheckpointID]
+		if !current {
+			continue
+		}
+		if n := len(results.Students); n == 0 || results.Students[n-1].UserID != a.UserID {
+			results.Students = append(results.Students, model.CheckpointStudentResults{UserID: a.UserID})
+		}
+		student := &results.Students[len(results.Students)-1]
+		result := model.CheckpointStudentResult{
+			CheckpointID: a.CheckpointID, Attempts: a.Attempts, Correct: a.Correct, FirstTryCorrect: a.FirstTryCorrect,
+			Passed: a.Correct || !checkpoint.Blocking, LastAnsweredAt: a.LastAnsweredAt,
+		}
+		if result.Passed {
+			student.Passed++
+		}
+		if result.Correct {
+			student.Correct++
+		}
+		student.Checkpoints = append(student.Checkpoints, result)
+	}
+	// In the order the video asks them
+	for _, student := range results.Students {
+		sort.SliceStable(student.Checkpoints, func(i, j int) bool {
+			return byID[student.Checkpoints[i].CheckpointID].At < byID[student.Checkpoints[j].CheckpointID].At
+		})
+	}
+
+	jsonRsp.Data = results
+	c.JSON(http.StatusOK, &jsonRsp)
+}
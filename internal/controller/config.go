@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"github.com/spf13/viper"
+)
+
+// Service configuration for controllers that need tunables
+var cfg *viper.Viper
+
+// InitConfig sets the configuration used by the controllers
+func InitConfig(c *viper.Viper) {
+	cfg = c
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/cache"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
 )
@@ -40,6 +41,7 @@ func CreateCourse(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, &jsonRsp)
 		return
 	}
+	linkImage(c.Request.Context(), courseThumbnail, dto.Thumbnail)
 
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
@@ -52,6 +54,7 @@ func CreateCourse(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read course by id"
+// @Param        include  query  string  false  "Relations to embed (instructor, lessons, documents, assignments, enrollments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.Course]
 // @Failure      404  {object}  model.JsonDTORsp[model.Course]
 // @Failure      500  {object}  model.JsonDTORsp[model.Course]
@@ -59,13 +62,19 @@ func CreateCourse(c *gin.Context) {
 // @Security     BearerAuth
 func GetCourseByID(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.Course]()
-	dto, err := reposity.ReadItemByIDIntoDTO[model.Course, model.Course](c.Param("id"))
+	id := c.Param("id")
+	dto, err := cache.Remember(c.Request.Context(), cacheStore, "course", id, []string{courseTag(id)}, func() (model.Course, error) {
+		return reposity.ReadItemByIDIntoDTO[model.Course, model.Course](id)
+	})
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusReadItemFailed
 		jsonRsp.Message = err.Error()
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "course", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +85,7 @@ func GetCourseByID(c *gin.Context) {
 // @Tags         Course
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (instructor, lessons, documents, assignments, enrollments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Course]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Course]
 // @Router       /courses [get]
@@ -92,6 +102,9 @@ func GetCourses(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "course", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -128,6 +141,9 @@ func UpdateCourse(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, &jsonRsp)
 		return
 	}
+	linkImage(c.Request.Context(), courseThumbnail, dto.Thumbnail)
+
+	cacheStore.Invalidate(c.Request.Context(), courseTag(c.Param("id")))
 
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
@@ -156,6 +172,8 @@ func DeleteCourse(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(c.Param("id")))
+
 	c.JSON(http.StatusNoContent, &jsonRsp)
 }
 
@@ -168,6 +186,7 @@ func DeleteCourse(c *gin.Context) {
 // @Param        instructor_id  query  string  true  "Instructor ID"
 // @Param        title         query  string  false "Search by title"
 // @Param        description   query  string  false "Search by description"
+// @Param        include  query  string  false  "Relations to embed (instructor, lessons, documents, assignments, enrollments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Course]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Course]
 // @Router       /courses/instructor [get]
@@ -205,6 +224,9 @@ func GetCoursesByInstructor(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "course", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -218,6 +240,7 @@ func GetCoursesByInstructor(c *gin.Context) {
 // @Param        student_id  query  string  true  "Student ID"
 // @Param        title       query  string  false "Search by title"
 // @Param        description query  string  false "Search by description"
+// @Param        include  query  string  false  "Relations to embed (instructor, lessons, documents, assignments, enrollments), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Course]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Course]
 // @Router       /courses/enrolled [get]
@@ -255,6 +278,9 @@ func GetEnrolledCourses(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "course", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
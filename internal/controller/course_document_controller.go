@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/cache"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
 )
@@ -41,6 +42,8 @@ func CreateCourseDocument(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseDocumentsTag(dto.CourseID.String()))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
 }
@@ -52,6 +55,7 @@ func CreateCourseDocument(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read course document by id"
+// @Param        include  query  string  false  "Relations to embed (course, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.CourseDocument]
 // @Failure      404  {object}  model.JsonDTORsp[model.CourseDocument]
 // @Failure      500  {object}  model.JsonDTORsp[model.CourseDocument]
@@ -66,6 +70,9 @@ func GetCourseDocumentByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "course_document", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +83,7 @@ func GetCourseDocumentByID(c *gin.Context) {
 // @Tags         CourseDocument
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (course, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.CourseDocument]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.CourseDocument]
 // @Router       /course-documents [get]
@@ -92,6 +100,9 @@ func GetCourseDocuments(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "course_document", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -121,6 +132,7 @@ func UpdateCourseDocument(c *gin.Context) {
 		return
 	}
 
+	courseID := courseIDOf[model.CourseDocument](c.Param("id"))
 	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateCourseDocument, model.CourseDocument](c.Param("id"), dto)
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
@@ -129,6 +141,8 @@ func UpdateCourseDocument(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseDocumentsTag(courseID))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -148,6 +162,7 @@ func UpdateCourseDocument(c *gin.Context) {
 func DeleteCourseDocument(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.CourseDocument]()
 
+	courseID := courseIDOf[model.CourseDocument](c.Param("id"))
 	err := reposity.DeleteItemByID[model.CourseDocument](c.Param("id"))
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusDeleteItemFailed
@@ -156,6 +171,8 @@ func DeleteCourseDocument(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseDocumentsTag(courseID))
+
 	c.JSON(http.StatusNoContent, &jsonRsp)
 }
 
@@ -166,6 +183,7 @@ func DeleteCourseDocument(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        course_id  path  string  true  "Course ID"
+// @Param        include  query  string  false  "Relations to embed (course, uploader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.CourseDocument]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.CourseDocument]
 // @Router       /course-documents/course/{course_id} [get]
@@ -173,10 +191,14 @@ func DeleteCourseDocument(c *gin.Context) {
 func GetCourseDocumentsByCourse(c *gin.Context) {
 	jsonRsp := model.NewJsonDTOListRsp[model.CourseDocument]()
 
-	query := reposity.NewQuery[model.CourseDocument, model.CourseDocument]()
-	query.AddConditionOfTextField("AND", "course_id", "=", c.Param("course_id"))
+	courseID := c.Param("course_id")
+	dtos, err := cache.Remember(c.Request.Context(), cacheStore, "course_documents", courseID, []string{courseDocumentsTag(courseID)}, func() ([]model.CourseDocument, error) {
+		query := reposity.NewQuery[model.CourseDocument, model.CourseDocument]()
+		query.AddConditionOfTextField("AND", "course_id", "=", courseID)
 
-	dtos, _, err := query.ExecNoPaging("-created_at")
+		dtos, _, err := query.ExecNoPaging("-created_at")
+		return dtos, err
+	})
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusReadItemFailed
 		jsonRsp.Message = err.Error()
@@ -184,6 +206,9 @@ func GetCourseDocumentsByCourse(c *gin.Context) {
 		return
 	}
 
+	if respondWithIncludes(c, "course_document", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 
@@ -19,6 +19,7 @@ import (
 // @Param        enrollment  body  model.CreateCourseEnrollment  true  "Course Enrollment JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateCourseEnrollment]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateCourseEnrollment]
+// @Failure      409  {object}  model.JsonDTORsp[model.CreateCourseEnrollment]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateCourseEnrollment]
 // @Router       /enrollments [post]
 // @Security     BearerAuth
@@ -34,6 +35,12 @@ func CreateCourseEnrollment(c *gin.Context) {
 	}
 
 	dto, err := reposity.CreateItemFromDTO[model.CreateCourseEnrollment, model.CourseEnrollment](dto)
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusCreateItemFailed
 		jsonRsp.Message = err.Error()
@@ -41,6 +48,8 @@ func CreateCourseEnrollment(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(dto.CourseID.String()))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
 }
@@ -52,6 +61,7 @@ func CreateCourseEnrollment(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read course enrollment by id"
+// @Param        include  query  string  false  "Relations to embed (course, student), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.CourseEnrollment]
 // @Failure      404  {object}  model.JsonDTORsp[model.CourseEnrollment]
 // @Failure      500  {object}  model.JsonDTORsp[model.CourseEnrollment]
@@ -66,6 +76,9 @@ func GetCourseEnrollmentByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "enrollment", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +89,7 @@ func GetCourseEnrollmentByID(c *gin.Context) {
 // @Tags         CourseEnrollment
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (course, student), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Router       /enrollments [get]
@@ -92,6 +106,9 @@ func GetCourseEnrollments(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "enrollment", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -121,6 +138,7 @@ func UpdateCourseEnrollment(c *gin.Context) {
 		return
 	}
 
+	courseID := courseIDOf[model.CourseEnrollment](c.Param("id"))
 	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateCourseEnrollment, model.CourseEnrollment](c.Param("id"), dto)
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
@@ -129,6 +147,8 @@ func UpdateCourseEnrollment(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(courseID))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -148,6 +168,7 @@ func UpdateCourseEnrollment(c *gin.Context) {
 func DeleteCourseEnrollment(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.CourseEnrollment]()
 
+	courseID := courseIDOf[model.CourseEnrollment](c.Param("id"))
 	err := reposity.DeleteItemByID[model.CourseEnrollment](c.Param("id"))
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusDeleteItemFailed
@@ -156,6 +177,8 @@ func DeleteCourseEnrollment(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(courseID))
+
 	c.JSON(http.StatusNoContent, &jsonRsp)
 }
 
@@ -166,6 +189,7 @@ func DeleteCourseEnrollment(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        student_id  path  string  true  "Student ID"
+// @Param        include  query  string  false  "Relations to embed (course, student), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Router       /enrollments/student/{student_id} [get]
@@ -186,6 +210,9 @@ func GetStudentEnrollments(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "enrollment", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -197,6 +224,7 @@ func GetStudentEnrollments(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        course_id  path  string  true  "Course ID"
+// @Param        include  query  string  false  "Relations to embed (course, student), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.CourseEnrollment]
 // @Router       /enrollments/course/{course_id} [get]
@@ -215,6 +243,9 @@ func GetCourseEnrollmentsByCourse(c *gin.Context) {
 		return
 	}
 
+	if respondWithIncludes(c, "enrollment", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"gorm.io/gorm"
+)
+
+// Database handle for controllers that need more than the generic reposity helpers
+var db *gorm.DB
+
+// InitDB sets the database handle used by the controllers
+func InitDB(database *gorm.DB) {
+	db = database
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// engagementKey is a video watched by the viewers of a course on a day
+type engagementKey struct {
+	assetID  uuid.UUID
+	courseID uuid.UUID
+	day      time.Time
+}
+
+// engagement accumulates the increments of the engagement aggregates of a
+// batch of watch progress, so every row is written once per batch
+type engagement struct {
+	bucketSeconds int
+	buckets       map[engagementKey]map[int]*model.VideoEngagementBucket
+	days          map[engagementKey]*model.VideoEngagementDay
+	viewers       []model.VideoEngagementViewer
+}
+
+func newEngagement() *engagement {
+	return &engagement{
+		bucketSeconds: max(cfg.GetInt("video_analytics_bucket"), 1),
+		buckets:       make(map[engagementKey]map[int]*model.VideoEngagementBucket),
+		days:          make(map[engagementKey]*model.VideoEngagementDay),
+	}
+}
+
+// coveredBuckets returns the start of the buckets the intervals play a part of
+func (e *engagement) coveredBuckets(intervals model.WatchedIntervals) map[int]bool {
+	covered := make(map[int]bool)
+	for _, interval := range intervals {
+		last := int(math.Ceil(interval.End/float64(e.bucketSeconds))) - 1
+		for b := int(interval.Start) / e.bucketSeconds; b <= last; b++ {
+			covered[b*e.bucketSeconds] = true
+		}
+	}
+	return covered
+}
+
+// utcDay is the UTC day of t, the engagement aggregates are counted per day
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// sameDay tells if a and b fall on the same UTC day
+func sameDay(a, b time.Time) bool {
+	return utcDay(a).Equal(utcDay(b))
+}
+
+// add counts the heartbeats of a viewer that took their progress from before
+// to after, before is nil for a new viewer. A viewer is counted once on
+// every day they watch, with what they played that day.
+func (e *engagement) add(assetID uuid.UUID, userID uuid.UUID, p *pendingProgress, before *model.LessonProgress, after model.LessonProgress) {
+	if assetID == uuid.Nil {
+		return
+	}
+	key := engagementKey{assetID: assetID, courseID: p.courseID, day: utcDay(p.at)}
+	buckets, ok := e.buckets[key]
+	if !ok {
+		buckets = make(map[int]*model.VideoEngagementBucket)
+		e.buckets[key] = buckets
+	}
+	bucket := func(second int) *model.VideoEngagementBucket {
+		b, ok := buckets[second]
+		if !ok {
+			b = &model.VideoEngagementBucket{AssetID: key.assetID, CourseID: key.courseID, Day: key.day, Second: second}
+			buckets[second] = b
+		}
+		return b
+	}
+	day, ok := e.days[key]
+	if !ok {
+		day = &model.VideoEngagementDay{AssetID: key.assetID, CourseID: key.courseID, Day: key.day}
+		e.days[key] = day
+	}
+
+	for second := range e.coveredBuckets(p.intervals) {
+		bucket(second).Views++
+	}
+	for _, interval := range p.intervals {
+		day.PlayedSeconds += interval.End - interval.Start
+	}
+	seen := map[int]bool{}
+	if before == nil || !sameDay(before.LastWatchedAt, p.at) {
+		day.Viewers++
+		e.viewers = append(e.viewers, model.VideoEngagementViewer{AssetID: key.assetID, CourseID: key.courseID, Day: key.day, UserID: userID})
+	} else {
+		seen = e.coveredBuckets(before.DayIntervals)
+		day.WatchedSeconds -= watchedSeconds(before.DayIntervals)
+	}
+	for second := range e.coveredBuckets(after.DayIntervals) {
+		if !seen[second] {
+			bucket(second).Viewers++
+		}
+	}
+	day.WatchedSeconds += watchedSeconds(after.DayIntervals)
+	if after.CompletedAt != nil && (before == nil || before.CompletedAt == nil) {
+		day.Completions++
+	}
+}
+
+// watchedSeconds is the length of merged intervals
+func watchedSeconds(intervals model.WatchedIntervals) float64 {
+	var seconds float64
+	for _, interval := range intervals {
+		seconds += interval.End - interval.Start
+	}
+	return seconds
+}
+
+// write adds the increments to the aggregates
+func (e *engagement) write(tx *gorm.DB) error {
+	var buckets []model.VideoEngagementBucket
+	for _, perSecond := range e.buckets {
+		for _, b := range perSecond {
+			buckets = append(buckets, *b)
+		}
+	}
+	if len(buckets) > 0 {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "asset_id"}, {Name: "course_id"}, {Name: "day"}, {Name: "second"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"views":   gorm.Expr("video_engagement_bucket.views + excluded.views"),
+				"viewers": gorm.Expr("video_engagement_bucket.viewers + excluded.viewers"),
+			}),
+		}).CreateInBatches(&buckets, 1000).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(e.viewers) > 0 {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&e.viewers, 1000).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	days := make([]model.VideoEngagementDay, 0, len(e.days))
+	for _, day := range e.days {
+		days = append(days, *day)
+	}
+	if len(days) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "asset_id"}, {Name: "course_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"viewers":         gorm.Expr("video_engagement_day.viewers + excluded.viewers"),
+			"completions":     gorm.Expr("video_engagement_day.completions + excluded.completions"),
+			"watched_seconds": gorm.Expr("video_engagement_day.watched_seconds + excluded.watched_seconds"),
+			"played_seconds":  gorm.Expr("video_engagement_day.played_seconds + excluded.played_seconds"),
+		}),
+	}).CreateInBatches(&days, 1000).Error
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,23 +9,31 @@ import (
 	"github.com/hoangtu1372k2/common-go/reposity"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
 )
 
 // CreateGrade godoc
 // @Summary      Create a new grade
-// @Description  Takes a grade JSON and stores in DB. Returns saved JSON.
+// @Description  Takes a grade JSON and stores in DB together with its first revision, graded by the caller. Returns saved JSON.
 // @Tags         Grade
 // @Accept       json
 // @Produce      json
 // @Param        grade  body  model.CreateGrade  true  "Grade JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateGrade]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateGrade]
+// @Failure      401  {object}  model.JsonDTORsp[model.CreateGrade]
+// @Failure      409  {object}  model.JsonDTORsp[model.CreateGrade]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateGrade]
 // @Router       /grades [post]
 // @Security     BearerAuth
 func CreateGrade(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.CreateGrade]()
 
+	gradedBy, ok := grader(c, jsonRsp)
+	if !ok {
+		return
+	}
+
 	var dto model.CreateGrade
 	if err := c.BindJSON(&dto); err != nil {
 		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
@@ -33,7 +42,18 @@ func CreateGrade(c *gin.Context) {
 		return
 	}
 
-	dto, err := reposity.CreateItemFromDTO[model.CreateGrade, model.Grade](dto)
+	var grade model.Grade
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		grade, err = createGrade(tx, dto, gradedBy)
+		return err
+	})
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusCreateItemFailed
 		jsonRsp.Message = err.Error()
@@ -41,6 +61,8 @@ func CreateGrade(c *gin.Context) {
 		return
 	}
 
+	dto.ID = grade.ID
+	dto.GradedBy = grade.GradedBy
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
 }
@@ -52,6 +74,7 @@ func CreateGrade(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read grade by id"
+// @Param        include  query  string  false  "Relations to embed (course, assignment, student, grader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.Grade]
 // @Failure      404  {object}  model.JsonDTORsp[model.Grade]
 // @Failure      500  {object}  model.JsonDTORsp[model.Grade]
@@ -66,6 +89,9 @@ func GetGradeByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "grade", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +102,7 @@ func GetGradeByID(c *gin.Context) {
 // @Tags         Grade
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (course, assignment, student, grader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Grade]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Grade]
 // @Router       /grades [get]
@@ -92,6 +119,9 @@ func GetGrades(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "grade", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -99,6 +129,7 @@ func GetGrades(c *gin.Context) {
 // UpdateGrade godoc
 // @Summary      Update single grade by id
 // @Description  Updates and returns a single grade whose ID value matches the id.
+// @Description  The previous state is kept, every change is stored as a new immutable revision graded by the caller.
 // @Tags         Grade
 // @Accept       json
 // @Produce      json
@@ -106,6 +137,7 @@ func GetGrades(c *gin.Context) {
 // @Param        grade  body  model.UpdateGrade  true  "Grade JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.UpdateGrade]
 // @Failure      400  {object}  model.JsonDTORsp[model.UpdateGrade]
+// @Failure      401  {object}  model.JsonDTORsp[model.UpdateGrade]
 // @Failure      404  {object}  model.JsonDTORsp[model.UpdateGrade]
 // @Failure      500  {object}  model.JsonDTORsp[model.UpdateGrade]
 // @Router       /grades/{id} [put]
@@ -113,6 +145,11 @@ func GetGrades(c *gin.Context) {
 func UpdateGrade(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.UpdateGrade]()
 
+	gradedBy, ok := grader(c, jsonRsp)
+	if !ok {
+		return
+	}
+
 	var dto model.UpdateGrade
 	if err := c.ShouldBindJSON(&dto); err != nil {
 		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
@@ -121,11 +158,17 @@ func UpdateGrade(c *gin.Context) {
 		return
 	}
 
-	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateGrade, model.Grade](c.Param("id"), dto)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return updateGrade(tx, c.Param("id"), dto, gradedBy)
+	})
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
 		jsonRsp.Message = err.Error()
-		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, &jsonRsp)
+		} else {
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+		}
 		return
 	}
 
@@ -136,6 +179,7 @@ func UpdateGrade(c *gin.Context) {
 // DeleteGrade godoc
 // @Summary      Remove single grade by id
 // @Description  Deletes a single grade from the repository based on id.
+// @Description  A deletion revision is recorded so the grade history stays complete.
 // @Tags         Grade
 // @Accept       json
 // @Produce      json
@@ -148,11 +192,17 @@ func UpdateGrade(c *gin.Context) {
 func DeleteGrade(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.Grade]()
 
-	err := reposity.DeleteItemByID[model.Grade](c.Param("id"))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return deleteGrade(tx, c.Param("id"))
+	})
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusDeleteItemFailed
 		jsonRsp.Message = err.Error()
-		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, &jsonRsp)
+		} else {
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+		}
 		return
 	}
 
@@ -166,6 +216,7 @@ func DeleteGrade(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        student_id  path  string  true  "Student ID"
+// @Param        include  query  string  false  "Relations to embed (course, assignment, student, grader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Grade]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Grade]
 // @Router       /grades/student/{student_id} [get]
@@ -185,6 +236,9 @@ func GetStudentGrades(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "grade", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -196,6 +250,7 @@ func GetStudentGrades(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        assignment_id  path  string  true  "Assignment ID"
+// @Param        include  query  string  false  "Relations to embed (course, assignment, student, grader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Grade]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Grade]
 // @Router       /grades/assignment/{assignment_id} [get]
@@ -215,6 +270,9 @@ func GetAssignmentGrades(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "grade", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -226,6 +284,7 @@ func GetAssignmentGrades(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        course_id  path  string  true  "Course ID"
+// @Param        include  query  string  false  "Relations to embed (course, assignment, student, grader), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Grade]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Grade]
 // @Router       /grades/course/{course_id} [get]
@@ -245,6 +304,9 @@ func GetCourseGrades(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "grade", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
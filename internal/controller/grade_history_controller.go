@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/gradebook"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockGrade reads a grade and locks its row until the transaction ends, so
+// concurrent changes get consecutive revision numbers.
+func lockGrade(tx *gorm.DB, id string) (model.Grade, error) {
+	var grade model.Grade
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&grade).Error
+	return grade, err
+}
+
+// grader is the authenticated caller changing a grade, recorded as its grader.
+// The request is answered when there is none.
+func grader[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T]) (uuid.UUID, bool) {
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, jsonRsp)
+		return uuid.Nil, false
+	}
+	return caller.ID, true
+}
+
+// canViewGrade tells if the caller may see the grades of the student in the
+// course: the student, the instructor of the course and admins
+func canViewGrade(tx *gorm.DB, caller Caller, studentID uuid.UUID, courseID uuid.UUID) (bool, error) {
+	if caller.IsAdmin() || caller.ID == studentID {
+		return true, nil
+	}
+	var instructs int64
+	err := tx.Model(&model.Course{}).Where("id = ? AND instructor_id = ?", courseID, caller.ID).Count(&instructs).Error
+	return instructs > 0, err
+}
+
+// createGrade stores a new grade given by gradedBy with its first revision
+func createGrade(tx *gorm.DB, dto model.CreateGrade, gradedBy uuid.UUID) (model.Grade, error) {
+	grade := model.Grade{
+		StudentID:    dto.StudentID,
+		CourseID:     dto.CourseID,
+		AssignmentID: dto.AssignmentID,
+		Score:        dto.Score,
+		GradedBy:     gradedBy,
+		GradedAt:     time.Now(),
+		Comments:     optionalString(dto.Feedback),
+	}
+	if err := tx.Create(&grade).Error; err != nil {
+		return grade, err
+	}
+	_, err := gradebook.RecordRevision(tx, grade, model.GradeRevisionReasonCreated, nil, false)
+	return grade, err
+}
+
+// updateGrade changes the score and feedback of a grade on behalf of gradedBy
+// and records the revision
+func updateGrade(tx *gorm.DB, id string, dto model.UpdateGrade, gradedBy uuid.UUID) error {
+	grade, err := lockGrade(tx, id)
+	if err != nil {
+		return err
+	}
+
+	grade.Score = dto.Score
+	grade.Comments = optionalString(dto.Feedback)
+	grade.GradedBy = gradedBy
+	grade.GradedAt = time.Now()
+	if err := tx.Save(&grade).Error; err != nil {
+		return err
+	}
+
+	reason := dto.Reason
+	if reason == "" {
+		reason = model.GradeRevisionReasonUpdated
+	}
+	_, err = gradebook.RecordRevision(tx, grade, reason, nil, false)
+	return err
+}
+
+// deleteGrade records a deletion revision and removes the grade
+func deleteGrade(tx *gorm.DB, id string) error {
+	grade, err := lockGrade(tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := gradebook.RecordRevision(tx, grade, model.GradeRevisionReasonDeleted, nil, true); err != nil {
+		return err
+	}
+	return tx.Delete(&grade).Error
+}
+
+// GetGradeHistory godoc
+// @Summary      Get the revision history of a grade
+// @Description  Returns every stored revision of the grade, oldest first. Deleted grades keep their history.
+// @Description  Only the student, the instructor of the course and admins can read it.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Grade ID"
+// @Success      200  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Router       /grades/{id}/history [get]
+// @Security     BearerAuth
+func GetGradeHistory(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.GradeRevision]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, jsonRsp)
+		return
+	}
+
+	revisions := make([]model.GradeRevision, 0)
+	err = db.Where("grade_id = ?", c.Param("id")).Order("revision ASC").Find(&revisions).Error
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if len(revisions) == 0 {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = "grade has no history"
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+	allowed, err := canViewGrade(db, caller, revisions[0].StudentID, revisions[0].CourseID)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if !allowed {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "only the student, the course instructor or an admin can read the history of a grade"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	c.Header("X-Total-Count", fmt.Sprintf("%d", len(revisions)))
+	jsonRsp.Data = revisions
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// RestoreGrade godoc
+// @Summary      Restore a previous grade revision
+// @Description  Puts the score and feedback of an earlier revision back on the grade.
+// @Description  The restore is itself recorded as a new revision pointing at the restored one, graded by the caller.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string              true  "Grade ID"
+// @Param        restore  body  model.RestoreGrade  true  "Revision to restore"
+// @Success      200  {object}  model.JsonDTORsp[model.GradeRevision]
+// @Failure      400  {object}  model.JsonDTORsp[model.GradeRevision]
+// @Failure      401  {object}  model.JsonDTORsp[model.GradeRevision]
+// @Failure      404  {object}  model.JsonDTORsp[model.GradeRevision]
+// @Failure      500  {object}  model.JsonDTORsp[model.GradeRevision]
+// @Router       /grades/{id}/restore [post]
+// @Security     BearerAuth
+func RestoreGrade(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.GradeRevision]()
+
+	gradedBy, ok := grader(c, jsonRsp)
+	if !ok {
+		return
+	}
+
+	var dto model.RestoreGrade
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+
+	var revision model.GradeRevision
+	err := db.Transaction(func(tx *gorm.DB) error {
+		grade, err := lockGrade(tx, c.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		var source model.GradeRevision
+		err = tx.Where("id = ? AND grade_id = ? AND NOT deleted", dto.RevisionID, grade.ID).First(&source).Error
+		if err != nil {
+			return err
+		}
+
+		grade.Score = source.Score
+		grade.MaxScore = source.MaxScore
+		grade.Comments = source.Feedback
+		grade.GradedBy = gradedBy
+		grade.GradedAt = time.Now()
+		if err := tx.Save(&grade).Error; err != nil {
+			return err
+		}
+
+		reason := dto.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("%s revision %d", model.GradeRevisionReasonRestored, source.Revision)
+		}
+		revision, err = gradebook.RecordRevision(tx, grade, reason, &source.ID, false)
+		return err
+	})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, &jsonRsp)
+		} else {
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+		}
+		return
+	}
+
+	jsonRsp.Data = revision
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// GetStudentGradebookAsOf godoc
+// @Summary      Get a student's gradebook at a past date
+// @Description  Returns the state of every grade of the student as it was at the given time.
+// @Description  Grades created later are left out and grades deleted later are still shown.
+// @Description  The student and admins see every grade, instructors the grades of their courses.
+// @Tags         Grade
+// @Accept       json
+// @Produce      json
+// @Param        id  path   string  true  "Student ID"
+// @Param        at  query  string  true  "Point in time, RFC3339 or YYYY-MM-DD (end of that day)"
+// @Success      200  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      400  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.GradeRevision]
+// @Router       /grades/student/{id}/as-of [get]
+// @Security     BearerAuth
+func GetStudentGradebookAsOf(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.GradeRevision]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, jsonRsp)
+		return
+	}
+
+	at, err := parsePointInTime(c.Query("at"))
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+
+	// Other callers only see the grades of the courses they teach
+	all := caller.IsAdmin() || caller.ID.String() == c.Param("id")
+	revisions := make([]model.GradeRevision, 0)
+	err = db.Raw(`
+		SELECT * FROM (
+			SELECT DISTINCT ON (grade_id) *
+			FROM grade_revision
+			WHERE student_id = ? AND created_at <= ?
+			ORDER BY grade_id, revision DESC
+		) r
+		WHERE NOT r.deleted
+			AND (? OR r.course_id IN (SELECT id FROM course WHERE instructor_id = ?))
+		ORDER BY r.created_at DESC`, c.Param("id"), at, all, caller.ID).Scan(&revisions).Error
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	c.Header("X-Total-Count", fmt.Sprintf("%d", len(revisions)))
+	jsonRsp.Data = revisions
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// parsePointInTime accepts a RFC3339 timestamp or a plain date, which means
+// the end of that day in UTC
+func parsePointInTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("query parameter at is required")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return day.Add(24*time.Hour - time.Nanosecond), nil
+}
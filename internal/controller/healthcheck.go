@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hoangtu1372k2/common-go/reposity"
 )
 
 // Health		 godoc
@@ -15,3 +16,37 @@ import (
 func Health(c *gin.Context) {
 	c.String(http.StatusOK, "Success")
 }
+
+// Ready		 godoc
+// @Summary      Ready reports whether the database and the file storage can be used.
+// @Description  Use this for readiness probes, it answers 503 with the failing checks. The malware scanner is reported
+// @Description  but does not fail the check, uploaded files wait for their scan until it is back.
+// @Tags         healthcheck
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /health/ready [get]
+func Ready(c *gin.Context) {
+	checks := gin.H{"database": "ok", "storage": "ok"}
+	status := http.StatusOK
+
+	if err := reposity.Ping(); err != nil {
+		checks["database"] = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	if fileStorage == nil {
+		checks["storage"] = "not configured"
+		status = http.StatusServiceUnavailable
+	} else if err := fileStorage.Health(c.Request.Context()); err != nil {
+		checks["storage"] = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	if fileScanner == nil {
+		checks["scanner"] = "not configured"
+	} else if err := fileScanner.Ping(c.Request.Context()); err != nil {
+		checks["scanner"] = err.Error()
+	} else {
+		checks["scanner"] = "ok"
+	}
+	c.JSON(status, checks)
+}
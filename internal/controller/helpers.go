@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/hoangtu1372k2/vms/internal/dberror"
+)
+
+// optionalString returns nil for an empty string, so it is stored as NULL
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// conflictError returns the unique constraint violation behind err, if any
+func conflictError(err error) (*dberror.ConflictError, bool) {
+	var conflict *dberror.ConflictError
+	ok := errors.As(dberror.Translate(err), &conflict)
+	return conflict, ok
+}
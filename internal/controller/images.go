@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/imaging"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// imageVariant is a resized copy of an image, size is the longest side or
+// the side of the square for avatars
+type imageVariant struct {
+	name string
+	size int
+}
+
+// Variants produced for each purpose
+var imageVariants = map[string][]imageVariant{
+	model.ImagePurposeImage:  {{"thumbnail", 320}, {"medium", 800}, {"large", 1600}},
+	model.ImagePurposeAvatar: {{"thumbnail", 64}, {"medium", 256}, {"large", 512}},
+}
+
+// imageColumn is a column holding the URL of an image next to the column
+// holding its variants
+type imageColumn struct {
+	model    interface{}
+	url      string
+	variants string
+	purpose  string
+	// tag returns the cache tag of a row, nil when the rows are not cached
+	tag func(id string) string
+}
+
+// Columns holding images with variants
+var (
+	courseThumbnail    = imageColumn{model: &model.Course{}, url: "thumbnail", variants: "thumbnail_variants", purpose: model.ImagePurposeImage, tag: courseTag}
+	profileAvatar      = imageColumn{model: &model.Profile{}, url: "avatar_url", variants: "avatar_variants", purpose: model.ImagePurposeAvatar}
+	userProfilePicture = imageColumn{model: &model.User{}, url: "profile_picture_url", variants: "profile_picture_variants", purpose: model.ImagePurposeAvatar}
+	imageColumns       = []imageColumn{courseThumbnail, profileAvatar, userProfilePicture}
+)
+
+// imagesQueued wakes up the image worker when an image was queued
+var imagesQueued = make(chan struct{}, 1)
+
+// ImagesQueued is signaled whenever an image waits for its variants
+func ImagesQueued() <-chan struct{} {
+	return imagesQueued
+}
+
+// validImagePurpose reports whether variants are made for purpose
+func validImagePurpose(purpose string) bool {
+	_, ok := imageVariants[purpose]
+	return ok
+}
+
+// queueImage records that the variants of the image stored under key have to
+// be made, images queued before are left as they are
+func queueImage(tx *gorm.DB, key string, purpose string) error {
+	row := model.ImageAsset{ID: uuid.New(), Key: key, Purpose: purpose, Status: model.ImageStatusQueued}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	wakeImages()
+	return nil
+}
+
+// wakeImages wakes up the image worker unless it is woken up already
+func wakeImages() {
+	select {
+	case imagesQueued <- struct{}{}:
+	default:
+	}
+}
+
+// imageVariantKey stores the variants next to the original:
+// images/<id>_medium.webp or images/<id>_avatar_medium.webp
+func imageVariantKey(key string, purpose string, variant string, format string) string {
+	base := strings.TrimSuffix(key, path.Ext(key))
+	if purpose != model.ImagePurposeImage {
+		base += "_" + purpose
+	}
+	return fmt.Sprintf("%s_%s.%s", base, variant, format)
+}
+
+// imageVariantURLs returns the URLs the variants of an image have once it
+// is processed
+func imageVariantURLs(key string, purpose string) model.ImageVariants {
+	variants := make(model.ImageVariants)
+	for _, v := range imageVariants[purpose] {
+		variants[v.name] = map[string]string{
+			"webp": fileStorage.URL(imageVariantKey(key, purpose, v.name, "webp")),
+			"jpeg": fileStorage.URL(imageVariantKey(key, purpose, v.name, "jpg")),
+		}
+	}
+	return variants
+}
+
+// linkImage sets the variants of the rows of col whose image URL was written
+// and returns them: the variants of the processed image, or none while it is
+// processed. Images of the file storage that were never processed for the
+// purpose of the column are queued. Failures are only logged, the variants
+// are set again once the image is processed.
+func linkImage(ctx context.Context, col imageColumn, url *string) model.ImageVariants {
+	if url == nil || *url == "" {
+		return nil
+	}
+	variants, err := imageVariantsOf(ctx, *url, col.purpose)
+	if err == nil {
+		err = setImageVariants(ctx, col, *url, variants)
+	}
+	if err != nil {
+		log.Printf("could not link the variants of %s - %s", *url, err)
+	}
+	return variants
+}
+
+// imageVariantsOf returns the variants of the image at url once they are
+// made, queueing the image when it was never processed for purpose
+func imageVariantsOf(ctx context.Context, url string, purpose string) (model.ImageVariants, error) {
+	if fileStorage == nil {
+		return nil, nil
+	}
+	key, ok := fileStorage.Key(url)
+	if !ok {
+		return nil, nil
+	}
+	if t, ok := uploadTypeOf(key); !ok || t.category != "images" || strings.HasPrefix(key, quarantinePrefix) {
+		return nil, nil
+	}
+	var asset model.ImageAsset
+	err := db.WithContext(ctx).Where("key = ? AND purpose = ?", key, purpose).Take(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, queueImage(db.WithContext(ctx), key, purpose)
+	}
+	if err != nil || asset.Status != model.ImageStatusReady {
+		return nil, err
+	}
+	return asset.Variants, nil
+}
+
+// setImageVariants writes the variants of the rows of col whose image is url
+func setImageVariants(ctx context.Context, col imageColumn, url string, variants model.ImageVariants) error {
+	query := db.WithContext(ctx).Model(col.model).Where(col.url+" = ?", url)
+	if col.tag != nil {
+		var ids []string
+		if err := query.Session(&gorm.Session{}).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		defer func() {
+			for _, id := range ids {
+				cacheStore.Invalidate(ctx, col.tag(id))
+			}
+		}()
+	}
+	return query.UpdateColumn(col.variants, variants).Error
+}
+
+// ProcessImages makes the variants of up to limit queued images and returns
+// how many were processed. Images waiting for their malware scan are left for
+// later and failures are retried image_interval later. Rows are locked while
+// they are processed so several instances share the work.
+func ProcessImages(ctx context.Context, limit int) (int, error) {
+	if fileStorage == nil {
+		return 0, nil
+	}
+	retryBefore := time.Now().Add(-cfg.GetDuration("image_interval"))
+	processed := 0
+	for processed < limit {
+		var asset model.ImageAsset
+		found := false
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND (processed_at IS NULL OR processed_at < ?)", model.ImageStatusQueued, retryBefore).
+				Where("NOT EXISTS (SELECT 1 FROM file_scan s WHERE s.key = image_asset.key AND s.status <> ?)",
+					model.FileScanStatusClean).
+				Order("created_at").Take(&asset).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+
+			updates := map[string]interface{}{"attempts": asset.Attempts + 1, "processed_at": time.Now(), "error": nil}
+			variants, err := makeImageVariants(ctx, asset.Key, asset.Purpose)
+			if err != nil {
+				updates["error"] = err.Error()
+				if asset.Attempts+1 >= cfg.GetInt("image_max_attempts") {
+					updates["status"] = model.ImageStatusFailed
+				}
+			} else {
+				updates["status"] = model.ImageStatusReady
+				updates["variants"] = variants
+				asset.Status, asset.Variants = model.ImageStatusReady, variants
+			}
+			return tx.Model(&asset).Updates(updates).Error
+		})
+		if err != nil {
+			return processed, err
+		}
+		if !found {
+			break
+		}
+		if asset.Status == model.ImageStatusReady {
+			url := fileStorage.URL(asset.Key)
+			for _, col := range imageColumns {
+				if col.purpose != asset.Purpose {
+					continue
+				}
+				if err := setImageVariants(ctx, col, url, asset.Variants); err != nil {
+					return processed, err
+				}
+			}
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// makeImageVariants stores the variants of the image under key in WebP and
+// JPEG and returns their URLs. Decoding drops the EXIF data and turns the
+// image upright.
+func makeImageVariants(ctx context.Context, key string, purpose string) (model.ImageVariants, error) {
+	r, _, err := fileStorage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(r, cfg.GetInt("image_max_pixels"))
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range imageVariants[purpose] {
+		var variant image.Image
+		if purpose == model.ImagePurposeAvatar {
+			variant = imaging.Square(img, v.size)
+		} else {
+			variant = imaging.Fit(img, v.size)
+		}
+		formats := []struct {
+			ext, contentType string
+			encode           func(io.Writer, image.Image) error
+		}{
+			{"webp", "image/webp", imaging.EncodeWebP},
+			{"jpg", "image/jpeg", func(w io.Writer, img image.Image) error {
+				return imaging.EncodeJPEG(w, img, cfg.GetInt("image_jpeg_quality"))
+			}},
+		}
+		for _, format := range formats {
+			var buf bytes.Buffer
+			if err := format.encode(&buf, variant); err != nil {
+				return nil, fmt.Errorf("could not encode the %s %s - %s", v.name, format.ext, err)
+			}
+			variantKey := imageVariantKey(key, purpose, v.name, format.ext)
+			opts := storage.PutOptions{ContentType: format.contentType}
+			if _, err := fileStorage.Put(ctx, variantKey, &buf, int64(buf.Len()), opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return imageVariantURLs(key, purpose), nil
+}
@@ -0,0 +1,505 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// Limits of the include query parameter
+const (
+	includeMaxDepth = 3
+	includeMaxPaths = 20
+)
+
+// includeAccess decides who can see the rows of a relation, based on the
+// course the parent row belongs to
+type includeAccess int
+
+const (
+	// includePublic relations are visible to every caller
+	includePublic includeAccess = iota
+	// includeMember relations are visible to admins, the course instructor and
+	// students enrolled in the course
+	includeMember
+	// includeOwner relations are fully visible to admins and the course
+	// instructor, other callers only see the rows they own
+	includeOwner
+)
+
+type includeRow = map[string]interface{}
+
+// includeRelation describes how the rows of a relation are loaded and attached
+type includeRelation struct {
+	// resource of the related rows, used to resolve nested includes
+	resource string
+	many     bool
+	// parentKey is the field of the parent row holding the lookup key,
+	// childKey the column of the related rows matched against it
+	parentKey string
+	childKey  string
+	order     string
+	access    includeAccess
+	// owner returns the user owning a related row, for includeOwner
+	owner func(parent includeRow, child includeRow) interface{}
+}
+
+// includeLoaders read the rows of every resource, keyed by resource name
+var includeLoaders = map[string]func(tx *gorm.DB) ([]includeRow, error){
+	"course":              loadIncludeRows[model.Course],
+	"lesson":              loadIncludeRows[model.Lesson],
+	"assignment":          loadIncludeRows[model.Assignment],
+	"course_document":     loadIncludeRows[model.CourseDocument],
+	"assignment_document": loadIncludeRows[model.AssignmentDocument],
+	"enrollment":          loadIncludeRows[model.CourseEnrollment],
+	"submission":          loadIncludeRows[model.AssignmentSubmission],
+	"submission_file":     loadIncludeRows[model.AssignmentSubmissionFile],
+	"grade":               loadIncludeRows[model.Grade],
+	"comment":             loadIncludeRows[model.Comment],
+	"video_asset":         loadIncludeRows[model.VideoAsset],
+	"user": func(tx *gorm.DB) ([]includeRow, error) {
+		rows, err := loadIncludeRows[model.User](tx.Select(includeUserFields))
+		for _, row := range rows {
+			maps.DeleteFunc(row, func(field string, _ interface{}) bool {
+				return !slices.Contains(includeUserFields, field)
+			})
+		}
+		return rows, err
+	},
+}
+
+// includeUserFields are the user fields shown to whoever can see a row
+// pointing at the user. Credentials and contact details are left out.
+var includeUserFields = []string{"id", "full_name", "user_name", "role", "profile_picture_url", "profile_picture_variants", "bio"}
+
+// includeCourseVia names the field leading to the assignment of rows that do
+// not carry a course_id themselves
+var includeCourseVia = map[string]string{
+	"assignment_document": "assignment_id",
+	"submission":          "assignment_id",
+}
+
+func ownedByChild(field string) func(parent includeRow, child includeRow) interface{} {
+	return func(_ includeRow, child includeRow) interface{} { return child[field] }
+}
+
+func ownedByParent(field string) func(parent includeRow, child includeRow) interface{} {
+	return func(parent includeRow, _ includeRow) interface{} { return parent[field] }
+}
+
+// includeRelations lists the relations every resource can embed
+var includeRelations = map[string]map[string]includeRelation{
+	"course": {
+		"instructor":  {resource: "user", parentKey: "instructor_id", childKey: "id", access: includePublic},
+		"lessons":     {resource: "lesson", many: true, parentKey: "id", childKey: "course_id", order: "order_index, id", access: includeMember},
+		"documents":   {resource: "course_document", many: true, parentKey: "id", childKey: "course_id", order: "created_at, id", access: includeMember},
+		"assignments": {resource: "assignment", many: true, parentKey: "id", childKey: "course_id", order: "due_date NULLS LAST, created_at, id", access: includeMember},
+		"enrollments": {resource: "enrollment", many: true, parentKey: "id", childKey: "course_id", order: "enrolled_at, id", access: includeOwner, owner: ownedByChild("student_id")},
+	},
+	"lesson": {
+		"course": {resource: "course", parentKey: "course_id", childKey: "id", access: includePublic},
+		"video":  {resource: "video_asset", parentKey: "video_asset_id", childKey: "id", access: includeMember},
+	},
+	"course_document": {
+		"course":   {resource: "course", parentKey: "course_id", childKey: "id", access: includePublic},
+		"uploader": {resource: "user", parentKey: "uploaded_by", childKey: "id", access: includePublic},
+	},
+	"assignment": {
+		"course":      {resource: "course", parentKey: "course_id", childKey: "id", access: includePublic},
+		"creator":     {resource: "user", parentKey: "created_by", childKey: "id", access: includePublic},
+		"documents":   {resource: "assignment_document", many: true, parentKey: "id", childKey: "assignment_id", order: "created_at, id", access: includeMember},
+		"submissions": {resource: "submission", many: true, parentKey: "id", childKey: "assignment_id", order: "submitted_at, id", access: includeOwner, owner: ownedByChild("student_id")},
+		"grades":      {resource: "grade", many: true, parentKey: "id", childKey: "assignment_id", order: "graded_at, id", access: includeOwner, owner: ownedByChild("student_id")},
+	},
+	"assignment_document": {
+		"assignment": {resource: "assignment", parentKey: "assignment_id", childKey: "id", access: includeMember},
+		"uploader":   {resource: "user", parentKey: "uploaded_by", childKey: "id", access: includePublic},
+	},
+	"enrollment": {
+		"course":  {resource: "course", parentKey: "course_id", childKey: "id", access: includePublic},
+		"student": {resource: "user", parentKey: "student_id", childKey: "id", access: includeOwner, owner: ownedByChild("id")},
+	},
+	"submission": {
+		"assignment": {resource: "assignment", parentKey: "assignment_id", childKey: "id", access: includeMember},
+		"student":    {resource: "user", parentKey: "student_id", childKey: "id", access: includeOwner, owner: ownedByChild("id")},
+		"files":      {resource: "submission_file", many: true, parentKey: "id", childKey: "submission_id", order: "created_at, id", access: includeOwner, owner: ownedByParent("student_id")},
+		"comments":   {resource: "comment", many: true, parentKey: "id", childKey: "submission_id", order: "created_at, id", access: includeOwner, owner: ownedByParent("student_id")},
+	},
+	"comment": {
+		"author": {resource: "user", parentKey: "user_id", childKey: "id", access: includePublic},
+	},
+	"submission_file": {
+		"submission": {resource: "submission", parentKey: "submission_id", childKey: "id", access: includeOwner, owner: ownedByChild("student_id")},
+	},
+	"grade": {
+		"course":     {resource: "course", parentKey: "course_id", childKey: "id", access: includePublic},
+		"assignment": {resource: "assignment", parentKey: "assignment_id", childKey: "id", access: includeMember},
+		"student":    {resource: "user", parentKey: "student_id", childKey: "id", access: includeOwner, owner: ownedByChild("id")},
+		"grader":     {resource: "user", parentKey: "graded_by", childKey: "id", access: includePublic},
+	},
+}
+
+// includeTree is a parsed include parameter, relation names to nested includes
+type includeTree map[string]includeTree
+
+// parseIncludes parses a comma separated list of dotted relation paths
+func parseIncludes(resource string, raw string) (includeTree, error) {
+	tree := make(includeTree)
+	paths := 0
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if paths++; paths > includeMaxPaths {
+			return nil, fmt.Errorf("at most %d includes are allowed", includeMaxPaths)
+		}
+		names := strings.Split(path, ".")
+		if len(names) > includeMaxDepth {
+			return nil, fmt.Errorf("include %q is nested deeper than %d levels", path, includeMaxDepth)
+		}
+		node, current := tree, resource
+		for _, name := range names {
+			relation, ok := includeRelations[current][name]
+			if !ok && len(includeRelations[current]) == 0 {
+				return nil, fmt.Errorf("unknown include %q, %s has no relations", path, current)
+			}
+			if !ok {
+				return nil, fmt.Errorf("unknown include %q, %s supports: %s", path, current, strings.Join(includeNames(current), ", "))
+			}
+			if node[name] == nil {
+				node[name] = make(includeTree)
+			}
+			node, current = node[name], relation.resource
+		}
+	}
+	return tree, nil
+}
+
+func includeNames(resource string) []string {
+	names := make([]string, 0, len(includeRelations[resource]))
+	for name := range includeRelations[resource] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// includeNode is a row of the response together with the course it belongs
+// to, which decides what the caller may embed in it
+type includeNode struct {
+	row    includeRow
+	course string
+}
+
+// courseRole is what the caller is in a course
+type courseRole int
+
+const (
+	courseRoleNone courseRole = iota
+	courseRoleMember
+	courseRoleStaff
+)
+
+type includer struct {
+	tx     *gorm.DB
+	caller *Caller
+	roles  map[string]courseRole
+}
+
+// resolve loads the role of the caller in the courses not seen yet, in one query
+func (in *includer) resolve(nodes []includeNode) error {
+	unknown := make([]string, 0)
+	for _, node := range nodes {
+		if _, ok := in.roles[node.course]; !ok && node.course != "" {
+			in.roles[node.course] = courseRoleNone
+			unknown = append(unknown, node.course)
+		}
+	}
+	if len(unknown) == 0 || in.caller == nil {
+		return nil
+	}
+	if in.caller.IsAdmin() {
+		for _, course := range unknown {
+			in.roles[course] = courseRoleStaff
+		}
+		return nil
+	}
+
+	var rows []struct {
+		ID    string
+		Staff bool
+	}
+	err := in.tx.Raw(`SELECT c.id::text AS id, c.instructor_id = @user_id AS staff
+		FROM course c
+		WHERE c.id IN @courses
+			AND (c.instructor_id = @user_id OR EXISTS (
+				SELECT 1 FROM course_enrollment e
+				WHERE e.course_id = c.id AND e.student_id = @user_id AND e.status <> 'dropped'))`,
+		map[string]interface{}{"user_id": in.caller.ID, "courses": unknown}).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		in.roles[row.ID] = courseRoleMember
+		if row.Staff {
+			in.roles[row.ID] = courseRoleStaff
+		}
+	}
+	return nil
+}
+
+// visible reports whether the caller may see the related row child of parent
+func (in *includer) visible(relation includeRelation, parent includeNode, child includeRow) bool {
+	switch relation.access {
+	case includePublic:
+		return true
+	case includeMember:
+		return in.roles[parent.course] >= courseRoleMember
+	case includeOwner:
+		if in.roles[parent.course] == courseRoleStaff {
+			return true
+		}
+		return in.caller != nil && fmt.Sprint(relation.owner(parent.row, child)) == in.caller.ID.String()
+	}
+	return false
+}
+
+// embed attaches the relations of tree to the nodes, one query per relation
+func (in *includer) embed(resource string, nodes []includeNode, tree includeTree) error {
+	if len(nodes) == 0 || len(tree) == 0 {
+		return nil
+	}
+	if err := in.resolve(nodes); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		relation := includeRelations[resource][name]
+		if relation.access == includeMember {
+			// Rows of courses the caller is not part of are not even loaded
+			visible := make([]includeNode, 0, len(nodes))
+			for _, node := range nodes {
+				if in.roles[node.course] >= courseRoleMember {
+					visible = append(visible, node)
+				}
+			}
+			if len(visible) == 0 {
+				continue
+			}
+			if err := in.attach(name, relation, visible, tree[name]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := in.attach(name, relation, nodes, tree[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *includer) attach(name string, relation includeRelation, nodes []includeNode, nested includeTree) error {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, node := range nodes {
+		key := includeKey(node.row[relation.parentKey])
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	byKey := make(map[string][]includeRow)
+	if len(keys) > 0 {
+		query := in.tx.Where(relation.childKey+" IN ?", keys)
+		if relation.order != "" {
+			query = query.Order(relation.order)
+		}
+		rows, err := includeLoaders[relation.resource](query)
+		if err != nil {
+			return fmt.Errorf("could not include %s - %s", name, err)
+		}
+		for _, row := range rows {
+			key := includeKey(row[relation.childKey])
+			byKey[key] = append(byKey[key], row)
+		}
+	}
+
+	children := make([]includeNode, 0)
+	for _, node := range nodes {
+		related := make([]includeRow, 0)
+		for _, row := range byKey[includeKey(node.row[relation.parentKey])] {
+			if in.visible(relation, node, row) {
+				// Rows shared by several parents are copied so nested
+				// includes are attached to each of them
+				row = maps.Clone(row)
+				related = append(related, row)
+				children = append(children, includeNode{row: row, course: includeCourse(relation.resource, row, node.course)})
+			}
+		}
+		switch {
+		case relation.many:
+			node.row[name] = related
+		case len(related) > 0:
+			node.row[name] = related[0]
+		default:
+			node.row[name] = nil
+		}
+	}
+	return in.embed(relation.resource, children, nested)
+}
+
+// includeCourse returns the course a row belongs to, inherited from its parent
+// when the row does not say
+func includeCourse(resource string, row includeRow, parent string) string {
+	if resource == "course" {
+		return includeKey(row["id"])
+	}
+	if course := includeKey(row["course_id"]); course != "" {
+		return course
+	}
+	return parent
+}
+
+func includeKey(value interface{}) string {
+	key, _ := value.(string)
+	if key == "00000000-0000-0000-0000-000000000000" {
+		return ""
+	}
+	return key
+}
+
+func loadIncludeRows[E any](tx *gorm.DB) ([]includeRow, error) {
+	items := make([]E, 0)
+	if err := tx.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return toIncludeRows(items)
+}
+
+// toIncludeRows converts rows through JSON so embedded rows look exactly like
+// the ones returned by their own endpoints
+func toIncludeRows(data interface{}) ([]includeRow, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]includeRow, 0)
+	if reflect.ValueOf(data).Kind() == reflect.Slice {
+		err = json.Unmarshal(raw, &rows)
+		return rows, err
+	}
+	var row includeRow
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+	return append(rows, row), nil
+}
+
+// respondWithIncludes answers the request with data and the relations listed
+// in the include query parameter. It returns false without responding when
+// the parameter is absent.
+//
+// Relations the caller may not see are left out of the rows: lessons,
+// documents and assignments need the caller to teach or attend the course,
+// enrollments, submissions and grades of other students are only shown to
+// the course instructor and admins.
+func respondWithIncludes(c *gin.Context, resource string, data interface{}) bool {
+	raw := c.Query("include")
+	if raw == "" {
+		return false
+	}
+	jsonRsp := model.NewJsonDTORsp[interface{}]()
+
+	tree, err := parseIncludes(resource, raw)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return true
+	}
+
+	rows, err := toIncludeRows(data)
+	if err == nil {
+		err = embedIncludes(c, resource, rows, tree)
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return true
+	}
+
+	if reflect.ValueOf(data).Kind() == reflect.Slice {
+		jsonRsp.Data = rows
+	} else {
+		jsonRsp.Data = rows[0]
+	}
+	c.JSON(http.StatusOK, &jsonRsp)
+	return true
+}
+
+func embedIncludes(c *gin.Context, resource string, rows []includeRow, tree includeTree) error {
+	in := &includer{
+		tx:    db.WithContext(c.Request.Context()),
+		roles: make(map[string]courseRole),
+	}
+	if caller, err := currentCaller(c); err == nil {
+		in.caller = &caller
+	}
+
+	nodes := make([]includeNode, 0, len(rows))
+	via := make(map[string]bool)
+	for _, row := range rows {
+		node := includeNode{row: row, course: includeCourse(resource, row, "")}
+		if field, ok := includeCourseVia[resource]; ok && node.course == "" {
+			if key := includeKey(row[field]); key != "" {
+				via[key] = true
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if len(via) > 0 {
+		// Rows without a course_id belong to the course of their assignment
+		assignments := make([]string, 0, len(via))
+		for id := range via {
+			assignments = append(assignments, id)
+		}
+		var courses []struct {
+			ID       string
+			CourseID string
+		}
+		err := in.tx.Raw("SELECT id::text AS id, course_id::text AS course_id FROM assignment WHERE id IN ?", assignments).
+			Scan(&courses).Error
+		if err != nil {
+			return err
+		}
+		courseOf := make(map[string]string, len(courses))
+		for _, course := range courses {
+			courseOf[course.ID] = course.CourseID
+		}
+		field := includeCourseVia[resource]
+		for i := range nodes {
+			if nodes[i].course == "" {
+				nodes[i].course = courseOf[includeKey(nodes[i].row[field])]
+			}
+		}
+	}
+	return in.embed(resource, nodes, tree)
+}
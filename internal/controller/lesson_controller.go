@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/hoangtu1372k2/vms/internal/cache"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
 )
@@ -19,6 +22,7 @@ import (
 // @Param        lesson  body  model.CreateLesson  true  "Lesson JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateLesson]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateLesson]
+// @Failure      422  {object}  model.JsonDTORsp[model.CreateLesson]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateLesson]
 // @Router       /lessons [post]
 // @Security     BearerAuth
@@ -32,6 +36,9 @@ func CreateLesson(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, &jsonRsp)
 		return
 	}
+	if !checkLessonVideo(c, jsonRsp, dto.VideoAssetID) {
+		return
+	}
 
 	dto, err := reposity.CreateItemFromDTO[model.CreateLesson, model.Lesson](dto)
 	if err != nil {
@@ -41,6 +48,8 @@ func CreateLesson(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(dto.CourseID.String()), courseLessonsTag(dto.CourseID.String()))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
 }
@@ -52,6 +61,7 @@ func CreateLesson(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path  string  true  "Read lesson by id"
+// @Param        include  query  string  false  "Relations to embed (course, video), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[model.Lesson]
 // @Failure      404  {object}  model.JsonDTORsp[model.Lesson]
 // @Failure      500  {object}  model.JsonDTORsp[model.Lesson]
@@ -66,6 +76,9 @@ func GetLessonByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	if respondWithIncludes(c, "lesson", dto) {
+		return
+	}
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -76,6 +89,7 @@ func GetLessonByID(c *gin.Context) {
 // @Tags         Lesson
 // @Accept       json
 // @Produce      json
+// @Param        include  query  string  false  "Relations to embed (course, video), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Lesson]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Lesson]
 // @Router       /lessons [get]
@@ -92,6 +106,9 @@ func GetLessons(c *gin.Context) {
 	}
 
 	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	if respondWithIncludes(c, "lesson", dtos) {
+		return
+	}
 	jsonRsp.Data = dtos
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -107,6 +124,7 @@ func GetLessons(c *gin.Context) {
 // @Success      200  {object}  model.JsonDTORsp[model.UpdateLesson]
 // @Failure      400  {object}  model.JsonDTORsp[model.UpdateLesson]
 // @Failure      404  {object}  model.JsonDTORsp[model.UpdateLesson]
+// @Failure      422  {object}  model.JsonDTORsp[model.UpdateLesson]
 // @Failure      500  {object}  model.JsonDTORsp[model.UpdateLesson]
 // @Router       /lessons/{id} [put]
 // @Security     BearerAuth
@@ -120,7 +138,11 @@ func UpdateLesson(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, &jsonRsp)
 		return
 	}
+	if !checkLessonVideo(c, jsonRsp, dto.VideoAssetID) {
+		return
+	}
 
+	courseID := courseIDOf[model.Lesson](c.Param("id"))
 	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateLesson, model.Lesson](c.Param("id"), dto)
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
@@ -129,6 +151,8 @@ func UpdateLesson(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(courseID), courseLessonsTag(courseID))
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
@@ -148,6 +172,7 @@ func UpdateLesson(c *gin.Context) {
 func DeleteLesson(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[model.Lesson]()
 
+	courseID := courseIDOf[model.Lesson](c.Param("id"))
 	err := reposity.DeleteItemByID[model.Lesson](c.Param("id"))
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusDeleteItemFailed
@@ -156,6 +181,8 @@ func DeleteLesson(c *gin.Context) {
 		return
 	}
 
+	cacheStore.Invalidate(c.Request.Context(), courseTag(courseID), courseLessonsTag(courseID))
+
 	c.JSON(http.StatusNoContent, &jsonRsp)
 }
 
@@ -166,17 +193,29 @@ func DeleteLesson(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        course_id  path  string  true  "Course ID"
+// @Param        include  query  string  false  "Relations to embed (course, video), nested with dots"
 // @Success      200  {object}  model.JsonDTORsp[[]model.Lesson]
+// @Failure      400  {object}  model.JsonDTORsp[[]model.Lesson]
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Lesson]
 // @Router       /lessons/course/{course_id} [get]
 // @Security     BearerAuth
 func GetLessonsByCourse(c *gin.Context) {
 	jsonRsp := model.NewJsonDTORsp[[]model.Lesson]()
 
-	courseID := c.Param("course_id")
-	filter := fmt.Sprintf("course_id = '%s' ORDER BY order_index ASC", courseID)
+	courseID, err := uuid.Parse(c.Param("course_id"))
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
 
-	dtos, total, err := reposity.ReadAllItemsIntoDTO[model.Lesson, model.Lesson](filter)
+	id := courseID.String()
+	lessons, err := cache.Remember(c.Request.Context(), cacheStore, "course_lessons", id, []string{courseLessonsTag(id)}, func() (cachedList[model.Lesson], error) {
+		filter := fmt.Sprintf("course_id = '%s' ORDER BY order_index ASC", id)
+		dtos, total, err := reposity.ReadAllItemsIntoDTO[model.Lesson, model.Lesson](filter)
+		return cachedList[model.Lesson]{Items: dtos, Total: total}, err
+	})
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusReadItemFailed
 		jsonRsp.Message = err.Error()
@@ -184,7 +223,29 @@ func GetLessonsByCourse(c *gin.Context) {
 		return
 	}
 
-	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
-	jsonRsp.Data = dtos
+	c.Header("X-Total-Count", fmt.Sprintf("%d", lessons.Total))
+	if respondWithIncludes(c, "lesson", lessons.Items) {
+		return
+	}
+	jsonRsp.Data = lessons.Items
 	c.JSON(http.StatusOK, &jsonRsp)
 }
+
+// checkLessonVideo answers the request and returns false when the video
+// asset set on a lesson does not exist
+func checkLessonVideo[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T], id *uuid.UUID) bool {
+	err := checkVideoAsset(db, id)
+	if errors.Is(err, errVideoAssetNotFound) {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnprocessableEntity, jsonRsp)
+		return false
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return false
+	}
+	return true
+}
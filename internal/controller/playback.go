@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Playback tokens let one user stream one video until they expire. They are
+// passed in the query string since players fetch playlists and segments
+// without the Authorization header:
+//
+//	<video id>.<user id>.<expiry unix>.<base64url HMAC-SHA256 of the rest>
+var (
+	errPlaybackToken   = errors.New("invalid playback token")
+	errPlaybackExpired = errors.New("playback token expired")
+)
+
+// playbackSecret signs the playback tokens, playback_secret or else the JWT
+// secret
+func playbackSecret() []byte {
+	if secret := cfg.GetString("playback_secret"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(cfg.GetString("jwt_secret"))
+}
+
+// newPlaybackToken returns a token letting userID stream the video until expires
+func newPlaybackToken(videoID uuid.UUID, userID uuid.UUID, expires time.Time) string {
+	payload := fmt.Sprintf("%s.%s.%d", videoID, userID, expires.Unix())
+	return payload + "." + playbackSignature(payload)
+}
+
+func playbackSignature(payload string) string {
+	mac := hmac.New(sha256.New, playbackSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPlaybackToken checks that token lets its user stream the video and
+// returns the user
+func verifyPlaybackToken(token string, videoID uuid.UUID) (uuid.UUID, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(playbackSignature(token[:i]))) {
+		return uuid.Nil, errPlaybackToken
+	}
+	parts := strings.Split(token[:i], ".")
+	if len(parts) != 3 || parts[0] != videoID.String() {
+		return uuid.Nil, errPlaybackToken
+	}
+	userID, err := uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, errPlaybackToken
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return uuid.Nil, errPlaybackToken
+	}
+	if time.Now().Unix() > expires {
+		return uuid.Nil, errPlaybackExpired
+	}
+	return userID, nil
+}
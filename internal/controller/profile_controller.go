@@ -128,6 +128,7 @@ func UpdateProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, &jsonRsp)
 		return
 	}
+	linkImage(c.Request.Context(), profileAvatar, dto.AvatarURL)
 
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
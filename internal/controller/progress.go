@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// progressKey is a viewer of a lesson
+type progressKey struct {
+	lessonID uuid.UUID
+	userID   uuid.UUID
+}
+
+// pendingProgress holds the heartbeats of a viewer that are not written yet
+type pendingProgress struct {
+	courseID  uuid.UUID
+	assetID   uuid.UUID
+	duration  float64 // of the video, 0 while unknown
+	intervals model.WatchedIntervals
+	position  float64
+	at        time.Time
+	// checkpointsPassed tells whether the viewer passed every checkpoint of
+	// the video, the lesson is not complete before
+	checkpointsPassed bool
+}
+
+// Heartbeats are buffered and written in batches by FlushProgress, a class
+// watching at once would otherwise write a row every few seconds per student
+var progress = struct {
+	sync.Mutex
+	pending map[progressKey]*pendingProgress
+	// stored is the progress as last written or read, to answer heartbeats
+	// without reading it
+	stored map[progressKey]model.LessonProgress
+}{
+	pending: make(map[progressKey]*pendingProgress),
+	stored:  make(map[progressKey]model.LessonProgress),
+}
+
+// progressFull wakes up the writer when progress_batch_size viewers wait
+var progressFull = make(chan struct{}, 1)
+
+// ProgressFull is signaled whenever a batch of heartbeats waits
+func ProgressFull() <-chan struct{} {
+	return progressFull
+}
+
+// mergeIntervals orders the intervals and merges the overlapping and
+// adjacent ones
+func mergeIntervals(intervals model.WatchedIntervals) model.WatchedIntervals {
+	sorted := append(model.WatchedIntervals(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := make(model.WatchedIntervals, 0, len(sorted))
+	for _, interval := range sorted {
+		if n := len(merged); n > 0 && interval.Start <= merged[n-1].End {
+			merged[n-1].End = math.Max(merged[n-1].End, interval.End)
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// creditedIntervals keeps the first seconds of the intervals of a heartbeat
+// the viewer can have played since their previous heartbeat, at the fastest
+// playback rate. previous is zero for the first heartbeat. A heartbeat thus
+// cannot claim more of the video than the time spent watching it.
+func creditedIntervals(intervals model.WatchedIntervals, previous time.Time, at time.Time) model.WatchedIntervals {
+	elapsed := cfg.GetDuration("progress_heartbeat_slack")
+	if !previous.IsZero() && at.After(previous) {
+		elapsed += at.Sub(previous)
+	}
+	budget := elapsed.Seconds() * math.Max(cfg.GetFloat64("progress_max_playback_rate"), 1)
+	credited := make(model.WatchedIntervals, 0, len(intervals))
+	for _, interval := range mergeIntervals(intervals) {
+		if budget <= 0 {
+			break
+		}
+		interval.End = math.Min(interval.End, interval.Start+budget)
+		budget -= interval.End - interval.Start
+		credited = append(credited, interval)
+	}
+	return credited
+}
+
+// withPending returns the stored progress with the pending heartbeats. The
+// lesson is complete once enough of the video was watched and its
+// checkpoints are passed.
+func withPending(stored model.LessonProgress, p *pendingProgress) model.LessonProgress {
+	stored.Intervals = mergeIntervals(append(append(model.WatchedIntervals(nil), stored.Intervals...), p.intervals...))
+	stored.WatchedSeconds = watchedSeconds(stored.Intervals)
+	if p.duration > 0 {
+		stored.WatchedPercent = math.Min(100, math.Round(stored.WatchedSeconds/p.duration*1000)/10)
+	}
+	if stored.CompletedAt == nil && p.duration > 0 && stored.WatchedPercent >= cfg.GetFloat64("lesson_complete_percent") && p.checkpointsPassed {
+		at := p.at
+		stored.CompletedAt = &at
+	}
+	// What was played is counted again by the engagement of a new day
+	if sameDay(stored.LastWatchedAt, p.at) {
+		stored.DayIntervals = mergeIntervals(append(append(model.WatchedIntervals(nil), stored.DayIntervals...), p.intervals...))
+	} else {
+		stored.DayIntervals = mergeIntervals(p.intervals)
+	}
+	stored.CourseID = p.courseID
+	stored.Position = p.position
+	stored.LastWatchedAt = p.at
+	return stored
+}
+
+// recordHeartbeat buffers a heartbeat and returns the progress of the viewer
+// including it
+func recordHeartbeat(ctx context.Context, key progressKey, heartbeat pendingProgress) (model.LessonProgress, error) {
+	progress.Lock()
+	stored, known := progress.stored[key]
+	progress.Unlock()
+	if !known {
+		// Read once, then kept up to date by FlushProgress
+		err := db.WithContext(ctx).Where("lesson_id = ? AND user_id = ?", key.lessonID, key.userID).Take(&stored).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return stored, err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			stored = model.LessonProgress{LessonID: key.lessonID, UserID: key.userID}
+		}
+	}
+
+	progress.Lock()
+	defer progress.Unlock()
+	if cached, ok := progress.stored[key]; ok {
+		stored = cached
+	} else {
+		progress.stored[key] = stored
+	}
+	p, ok := progress.pending[key]
+	if !ok {
+		p = &pendingProgress{}
+		progress.pending[key] = p
+	}
+	previous := stored.LastWatchedAt
+	if ok {
+		previous = p.at
+	}
+	credited := creditedIntervals(heartbeat.intervals, previous, heartbeat.at)
+	p.courseID, p.assetID, p.duration, p.position, p.at = heartbeat.courseID, heartbeat.assetID, heartbeat.duration, heartbeat.position, heartbeat.at
+	p.checkpointsPassed = heartbeat.checkpointsPassed
+	p.intervals = mergeIntervals(append(p.intervals, credited...))
+	if len(progress.pending) >= cfg.GetInt("progress_batch_size") {
+		select {
+		case progressFull <- struct{}{}:
+		default:
+		}
+	}
+	return withPending(stored, p), nil
+}
+
+// currentProgress returns the progress of the viewer with the heartbeats not
+// written yet, nil when the viewer never watched the lesson
+func currentProgress(ctx context.Context, key progressKey) (*model.LessonProgress, error) {
+	progress.Lock()
+	stored, known := progress.stored[key]
+	var pending *pendingProgress
+	if p, ok := progress.pending[key]; ok {
+		copied := *p
+		pending = &copied
+	}
+	progress.Unlock()
+
+	if !known {
+		err := db.WithContext(ctx).Where("lesson_id = ? AND user_id = ?", key.lessonID, key.userID).Take(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) && pending == nil {
+			return nil, nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if pending != nil {
+		stored = withPending(stored, pending)
+	}
+	return &stored, nil
+}
+
+// FlushProgress writes the buffered heartbeats in one transaction, adds them
+// to the engagement aggregates of their videos and updates the progress and
+// last activity of the enrollments of their viewers. The
+// progress of an enrollment is the share of the video lessons of its course
+// the student completed. It returns the number of viewers written, their
+// heartbeats are buffered again when writing fails.
+func FlushProgress(ctx context.Context) (int, error) {
+	progress.Lock()
+	batch := progress.pending
+	progress.pending = make(map[progressKey]*pendingProgress)
+	progress.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	written := make([]model.LessonProgress, 0, len(batch))
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		viewers := make([][]interface{}, 0, len(batch))
+		for key := range batch {
+			viewers = append(viewers, []interface{}{key.lessonID, key.userID})
+		}
+		// Other instances write the same rows, the stored intervals are
+		// merged under a lock rather than overwritten
+		var rows []model.LessonProgress
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("(lesson_id, user_id) IN ?", viewers).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		stored := make(map[progressKey]model.LessonProgress, len(rows))
+		for _, row := range rows {
+			stored[progressKey{row.LessonID, row.UserID}] = row
+		}
+
+		now := time.Now()
+		enrollments := make([][]interface{}, 0, len(batch))
+		seen := make(map[[2]uuid.UUID]bool)
+		aggregates := newEngagement()
+		for key, p := range batch {
+			row, ok := stored[key]
+			var before *model.LessonProgress
+			if ok {
+				before = &row
+			} else {
+				row = model.LessonProgress{ID: uuid.New(), LessonID: key.lessonID, UserID: key.userID}
+			}
+			after := withPending(row, p)
+			after.UpdatedAt = now
+			aggregates.add(p.assetID, key.userID, p, before, after)
+			written = append(written, after)
+			if enrollment := [2]uuid.UUID{p.courseID, key.userID}; !seen[enrollment] {
+				seen[enrollment] = true
+				enrollments = append(enrollments, []interface{}{p.courseID, key.userID})
+			}
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "lesson_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"course_id", "intervals", "watched_seconds", "watched_percent", "position", "completed_at", "last_watched_at", "day_intervals", "updated_at",
+			}),
+		}).CreateInBatches(&written, 500).Error
+		if err != nil {
+			return err
+		}
+		// Counted in the same transaction, a batch written twice would count twice
+		if err = aggregates.write(tx); err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE course_enrollment e SET last_active = GREATEST(e.last_active, @now), progress = COALESCE((
+				SELECT floor(100.0 * count(p.completed_at) / count(*))
+				FROM lesson l LEFT JOIN lesson_progress p ON p.lesson_id = l.id AND p.user_id = e.student_id
+				WHERE l.course_id = e.course_id AND l.video_asset_id IS NOT NULL
+				HAVING count(*) > 0), e.progress)
+			WHERE (e.course_id, e.student_id) IN @enrollments`,
+			map[string]interface{}{"now": now, "enrollments": enrollments}).Error
+	})
+
+	progress.Lock()
+	defer progress.Unlock()
+	if err != nil {
+		// Heartbeats that came in meanwhile are newer
+		for key, p := range batch {
+			if newer, ok := progress.pending[key]; ok {
+				newer.intervals = mergeIntervals(append(newer.intervals, p.intervals...))
+				continue
+			}
+			progress.pending[key] = p
+		}
+		return 0, err
+	}
+	for _, row := range written {
+		progress.stored[progressKey{row.LessonID, row.UserID}] = row
+	}
+	// Viewers that stopped watching are read again when they come back
+	idleBefore := time.Now().Add(-cfg.GetDuration("progress_cache_ttl"))
+	for key, row := range progress.stored {
+		if _, waiting := progress.pending[key]; !waiting && row.LastWatchedAt.Before(idleBefore) {
+			delete(progress.stored, key)
+		}
+	}
+	return len(written), nil
+}
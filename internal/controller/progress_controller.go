@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// canWatchLesson reports whether the caller teaches or is enrolled in the
+// course of the lesson. Admins watch every lesson.
+func canWatchLesson(tx *gorm.DB, caller Caller, lesson model.Lesson) (bool, error) {
+	if caller.IsAdmin() {
+		return true, nil
+	}
+	var found int64
+	err := tx.Raw(`SELECT count(*) FROM course c WHERE c.id = @course_id AND (c.instructor_id = @user_id OR EXISTS (
+			SELECT 1 FROM course_enrollment e
+			WHERE e.course_id = c.id AND e.student_id = @user_id AND e.status <> 'dropped'))`,
+		map[string]interface{}{"course_id": lesson.CourseID, "user_id": caller.ID}).Scan(&found).Error
+	return found > 0, err
+}
+
+// videoLessonOf reads the lesson of the id path parameter and its video for
+// a caller allowed to watch it, it answers the request and returns false when
+// it cannot
+func videoLessonOf[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T]) (model.Lesson, model.VideoAsset, Caller, bool) {
+	var lesson model.Lesson
+	var asset model.VideoAsset
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	err = db.Where("id = ?", c.Param("id")).Take(&lesson).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	if err == nil && lesson.VideoAssetID != nil {
+		err = db.Where("id = ?", *lesson.VideoAssetID).Take(&asset).Error
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	if lesson.VideoAssetID == nil {
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = "lesson has no video"
+		c.JSON(http.StatusUnprocessableEntity, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	allowed, err := canWatchLesson(db, caller, lesson)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	if !allowed {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "lesson belongs to a course you are not part of"
+		c.JSON(http.StatusForbidden, jsonRsp)
+		return lesson, asset, caller, false
+	}
+	return lesson, asset, caller, true
+}
+
+// RecordLessonProgress godoc
+// @Summary      Record what the viewer watched of a lesson video
+// @Description  Heartbeat of the player, sent every few seconds while the video plays with the current position and the intervals played since the
+// @Description  last heartbeat. Intervals are merged with the ones watched before, the lesson is complete once lesson_complete_percent of the
+// @Description  video was watched and every checkpoint of the video is passed. Nothing past a blocking checkpoint that is not passed yet counts.
+// @Description  A heartbeat is credited with at most progress_max_playback_rate times the time since the previous heartbeat of the viewer, plus
+// @Description  progress_heartbeat_slack, the rest of its intervals is dropped. Heartbeats are rejected until the video is ready.
+// @Description  Returns the progress with the resume position. Heartbeats are written every progress_flush_interval.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        id         path  string                   true  "Lesson ID"
+// @Param        heartbeat  body  model.ProgressHeartbeat  true  "Heartbeat"
+// @Success      200  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      400  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      401  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      403  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      404  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      422  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      500  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Router       /lessons/{id}/progress [post]
+// @Security     BearerAuth
+func RecordLessonProgress(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.LessonProgress]()
+
+	var dto model.ProgressHeartbeat
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	for _, interval := range dto.Intervals {
+		if interval.Start < 0 || interval.End < interval.Start {
+			jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+			jsonRsp.Message = "intervals must start at 0 or later and end after they start"
+			c.JSON(http.StatusBadRequest, &jsonRsp)
+			return
+		}
+	}
+	lesson, asset, caller, ok := videoLessonOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	if asset.Status != model.VideoStatusReady || asset.Duration == nil || *asset.Duration <= 0 {
+		// Intervals are bounded by the duration of the video
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = "video is not ready yet"
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	checkpoints, err := pendingCheckpoints(db, lesson.ID, asset.ID, caller.ID)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	heartbeat := pendingProgress{
+		courseID: lesson.CourseID, assetID: asset.ID, duration: *asset.Duration, position: *dto.Position, at: time.Now(),
+		checkpointsPassed: len(checkpoints) == 0,
+	}
+	// Players report a little past the end
+	limit := heartbeat.duration
+	if at, ok := blockingCheckpoint(checkpoints); ok {
+		// Nothing past a blocking checkpoint counts until it is passed
+		limit = math.Min(limit, at)
+	}
+	heartbeat.position = math.Min(heartbeat.position, limit)
+	for _, interval := range dto.Intervals {
+		interval.Start, interval.End = math.Min(interval.Start, limit), math.Min(interval.End, limit)
+		if interval.End > interval.Start {
+			heartbeat.intervals = append(heartbeat.intervals, interval)
+		}
+	}
+	current, err := recordHeartbeat(c.Request.Context(), progressKey{lesson.ID, caller.ID}, heartbeat)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = current
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// GetLessonProgress godoc
+// @Summary      Get what the caller watched of a lesson video
+// @Description  Returns the watched intervals, the share of the video watched, the resume position and when the lesson was completed.
+// @Tags         Lesson
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Lesson ID"
+// @Success      200  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      401  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      403  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      404  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      422  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Failure      500  {object}  model.JsonDTORsp[model.LessonProgress]
+// @Router       /lessons/{id}/progress [get]
+// @Security     BearerAuth
+func GetLessonProgress(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.LessonProgress]()
+
+	lesson, _, caller, ok := videoLessonOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	current, err := currentProgress(c.Request.Context(), progressKey{lesson.ID, caller.ID})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if current == nil {
+		// Not watched yet, the video starts from the beginning
+		current = &model.LessonProgress{LessonID: lesson.ID, UserID: caller.ID, CourseID: lesson.CourseID, Intervals: model.WatchedIntervals{}}
+	}
+
+	jsonRsp.Data = *current
+	c.JSON(http.StatusOK, &jsonRsp)
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+)
+
+// fileColumn is a column of rows referencing a stored file by its URL. The
+// rows of tables with a file_missing_at column are flagged while their file
+// is missing.
+type fileColumn struct {
+	table  string
+	model  interface{}
+	column string
+	flag   bool
+}
+
+// fileColumns are the columns checked for dangling references
+var fileColumns = []fileColumn{
+	{"course_document", &model.CourseDocument{}, "file_path", true},
+	{"assignment_document", &model.AssignmentDocument{}, "file_path", true},
+	{"assignment_submission_file", &model.AssignmentSubmissionFile{}, "file_path", true},
+	{"course", &model.Course{}, "thumbnail", false},
+	{"user", &model.User{}, "profile_picture_url", false},
+	{"profile", &model.Profile{}, "avatar_url", false},
+}
+
+// StorageOrphan is a stored object no row references. Expired orphans are
+// older than the grace period and deleted when the reconciliation is applied.
+type StorageOrphan struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	Expired bool
+	Deleted bool
+}
+
+// DanglingReference is a row whose file is missing from the storage. Flagged
+// rows have their file_missing_at set.
+type DanglingReference struct {
+	Table   string
+	Column  string
+	ID      uuid.UUID
+	URL     string
+	Key     string
+	Flagged bool
+}
+
+// StorageReport is the outcome of a reconciliation. Restored counts the
+// flagged rows whose file is back, their flag is cleared when applied.
+type StorageReport struct {
+	Applied     bool
+	Objects     int
+	Referenced  int
+	External    int // URLs pointing outside the storage, not checked
+	Orphans     []StorageOrphan
+	OrphanBytes int64
+	Dangling    []DanglingReference
+	Deleted     int
+	Flagged     int
+	Restored    int
+}
+
+// storageReferences are the keys rows point at, and the prefixes whose
+// objects all belong to a row
+type storageReferences struct {
+	keys     map[string]bool
+	prefixes map[string]bool
+}
+
+// has tells if the object is referenced by key or by one of its directories
+func (r storageReferences) has(key string) bool {
+	if r.keys[key] {
+		return true
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' && r.prefixes[key[:i+1]] {
+			return true
+		}
+	}
+	return false
+}
+
+// fileRow is a row of a file column
+type fileRow struct {
+	ID      uuid.UUID
+	URL     string
+	Missing bool
+}
+
+// ReconcileStorage lists the stored objects against the rows referencing
+// them. Objects no row references are orphans, rows of fileColumns whose
+// object is missing are dangling. With apply, orphans older than grace are
+// deleted, dangling rows are flagged and flagged rows whose object is back
+// are cleared. Objects are listed before the rows are read, so files stored
+// while it runs are never taken for orphans; the grace period covers those
+// stored before their row is written.
+func ReconcileStorage(ctx context.Context, apply bool, grace time.Duration) (StorageReport, error) {
+	report := StorageReport{Applied: apply}
+	if fileStorage == nil {
+		return report, errors.New("file storage is not available")
+	}
+	lister, ok := fileStorage.(storage.Lister)
+	if !ok {
+		return report, fmt.Errorf("file storage (%s) cannot list its objects", fileStorage.Driver())
+	}
+
+	objects := make(map[string]storage.Object)
+	err := lister.List(ctx, "", func(obj storage.Object) error {
+		objects[obj.Key] = obj
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("could not list the stored objects - %s", err)
+	}
+	report.Objects = len(objects)
+
+	refs := storageReferences{keys: make(map[string]bool), prefixes: make(map[string]bool)}
+	rows := make(map[*fileColumn][]fileRow, len(fileColumns))
+	for i := range fileColumns {
+		col := &fileColumns[i]
+		colRows, err := fileColumnRows(ctx, col)
+		if err != nil {
+			return report, fmt.Errorf("could not read %s.%s - %s", col.table, col.column, err)
+		}
+		rows[col] = colRows
+		for _, row := range colRows {
+			if key, ok := fileStorage.Key(row.URL); ok {
+				refs.keys[key] = true
+			}
+		}
+	}
+	if err := internalReferences(ctx, refs); err != nil {
+		return report, err
+	}
+	for key := range objects {
+		if refs.has(key) {
+			report.Referenced++
+		}
+	}
+
+	now := time.Now()
+	for key, obj := range objects {
+		if refs.has(key) {
+			continue
+		}
+		orphan := StorageOrphan{Key: key, Size: obj.Size, ModTime: obj.ModTime, Expired: now.Sub(obj.ModTime) >= grace}
+		if apply && orphan.Expired {
+			if err := fileStorage.Delete(ctx, key); err != nil {
+				log.Printf("could not delete orphaned object %s - %s", key, err)
+			} else {
+				orphan.Deleted = true
+				report.Deleted++
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+		report.OrphanBytes += obj.Size
+	}
+
+	for i := range fileColumns {
+		col := &fileColumns[i]
+		for _, row := range rows[col] {
+			key, ok := fileStorage.Key(row.URL)
+			if !ok {
+				report.External++
+				continue
+			}
+			exists := false
+			if _, listed := objects[key]; listed {
+				exists = true
+			} else if _, err := fileStorage.Stat(ctx, key); err == nil {
+				// Stored after the listing
+				exists = true
+			} else if !errors.Is(err, storage.ErrNotFound) {
+				return report, fmt.Errorf("could not check %s - %s", key, err)
+			}
+
+			if exists {
+				if row.Missing {
+					if apply {
+						if err := setFileMissing(ctx, col, row.ID, nil); err != nil {
+							return report, err
+						}
+					}
+					report.Restored++
+				}
+				continue
+			}
+			dangling := DanglingReference{Table: col.table, Column: col.column, ID: row.ID, URL: row.URL, Key: key, Flagged: row.Missing}
+			if apply && col.flag && !row.Missing {
+				if err := setFileMissing(ctx, col, row.ID, &now); err != nil {
+					return report, err
+				}
+				dangling.Flagged = true
+				report.Flagged++
+			}
+			report.Dangling = append(report.Dangling, dangling)
+		}
+	}
+	return report, nil
+}
+
+// fileColumnRows reads the rows of the column referencing a file
+func fileColumnRows(ctx context.Context, col *fileColumn) ([]fileRow, error) {
+	missing := "false"
+	if col.flag {
+		missing = "file_missing_at IS NOT NULL"
+	}
+	rows, err := db.WithContext(ctx).Model(col.model).
+		Select(fmt.Sprintf("id, %s, %s", col.column, missing)).
+		Where(fmt.Sprintf("%s IS NOT NULL AND %s <> ''", col.column, col.column)).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []fileRow
+	for rows.Next() {
+		var row fileRow
+		if err := rows.Scan(&row.ID, &row.URL, &row.Missing); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// setFileMissing sets or clears the flag of a row, leaving updated_at alone
+func setFileMissing(ctx context.Context, col *fileColumn, id uuid.UUID, at *time.Time) error {
+	err := db.WithContext(ctx).Model(col.model).Where("id = ?", id).UpdateColumn("file_missing_at", at).Error
+	if err != nil {
+		return fmt.Errorf("could not flag %s %s - %s", col.table, id, err)
+	}
+	return nil
+}
+
+// internalReferences adds the objects kept by the processing of the files:
+// image variants, HLS renditions, quarantined files and unfinished uploads
+func internalReferences(ctx context.Context, refs storageReferences) error {
+	tx := db.WithContext(ctx)
+
+	var images []model.ImageAsset
+	if err := tx.Select("key", "purpose").Find(&images).Error; err != nil {
+		return fmt.Errorf("could not read the image assets - %s", err)
+	}
+	for _, image := range images {
+		// Variants go with the image they were made of
+		if !refs.keys[image.Key] {
+			continue
+		}
+		for _, v := range imageVariants[image.Purpose] {
+			refs.keys[imageVariantKey(image.Key, image.Purpose, v.name, "webp")] = true
+			refs.keys[imageVariantKey(image.Key, image.Purpose, v.name, "jpg")] = true
+		}
+	}
+
+	var videos []string
+	if err := tx.Model(&model.VideoAsset{}).Pluck("key", &videos).Error; err != nil {
+		return fmt.Errorf("could not read the video assets - %s", err)
+	}
+	for _, key := range videos {
+		refs.keys[key] = true
+		refs.prefixes[videoHLSPrefix(key)] = true
+	}
+
+	var quarantined []string
+	err := tx.Model(&model.FileScan{}).Where("quarantine_key IS NOT NULL").Pluck("quarantine_key", &quarantined).Error
+	if err != nil {
+		return fmt.Errorf("could not read the file scans - %s", err)
+	}
+	for _, key := range quarantined {
+		refs.keys[key] = true
+	}
+
+	var uploads []string
+	err = tx.Model(&model.Upload{}).Where("status = ?", model.UploadStatusPending).Pluck("key", &uploads).Error
+	if err != nil {
+		return fmt.Errorf("could not read the uploads - %s", err)
+	}
+	for _, key := range uploads {
+		refs.keys[key] = true
+	}
+
+	var resumable []model.ResumableUpload
+	err = tx.Select("id", "key").Where("status = ?", model.ResumableUploadStatusUploading).Find(&resumable).Error
+	if err != nil {
+		return fmt.Errorf("could not read the resumable uploads - %s", err)
+	}
+	for _, upload := range resumable {
+		refs.keys[upload.Key] = true
+		refs.prefixes[fmt.Sprintf("tus/%s/", upload.ID)] = true
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/scan"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scanner of the stored files, nil when scanning is disabled and files can be
+// downloaded right after the upload
+var fileScanner scan.Scanner
+
+// scanQueued wakes up the scan worker when a file was stored
+var scanQueued = make(chan struct{}, 1)
+
+// quarantinePrefix holds the infected files, they are never served
+const quarantinePrefix = "quarantine/"
+
+// InitScanner sets the scanner checking the stored files
+func InitScanner(s scan.Scanner) {
+	fileScanner = s
+}
+
+// ScanQueued is signaled whenever a file waits for its scan
+func ScanQueued() <-chan struct{} {
+	return scanQueued
+}
+
+// queueScan records that the file stored under key waits for its scan, the
+// file cannot be downloaded until it passed
+func queueScan(tx *gorm.DB, key string, uploaderID uuid.UUID, fileName string) error {
+	if fileScanner == nil {
+		return nil
+	}
+	row := model.FileScan{ID: uuid.New(), Key: key, UploaderID: uploaderID, FileName: fileName, Status: model.FileScanStatusPending}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"status": model.FileScanStatusPending, "attempts": 0, "error": nil}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	select {
+	case scanQueued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// fileScanStatus returns the status of the scan of the file stored under key,
+// "" when the file may be served. Quarantined files are never served.
+func fileScanStatus(ctx context.Context, key string) (string, error) {
+	if strings.HasPrefix(key, quarantinePrefix) {
+		return model.FileScanStatusInfected, nil
+	}
+	var row model.FileScan
+	err := db.WithContext(ctx).Select("status").Where("key = ?", key).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if row.Status == model.FileScanStatusClean {
+		return "", nil
+	}
+	return row.Status, nil
+}
+
+// ScanPendingFiles scans up to limit files waiting for their scan and returns
+// how many were scanned. Failed scans are retried scan_interval later, rows
+// are locked while they are scanned so several instances share the work.
+func ScanPendingFiles(ctx context.Context, limit int) (int, error) {
+	if fileScanner == nil || fileStorage == nil {
+		return 0, nil
+	}
+	retryBefore := time.Now().Add(-cfg.GetDuration("scan_interval"))
+	scanned := 0
+	for scanned < limit {
+		found := false
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var row model.FileScan
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND (scanned_at IS NULL OR scanned_at < ?)", model.FileScanStatusPending, retryBefore).
+				Order("created_at").Take(&row).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+			return scanFile(ctx, tx, row)
+		})
+		if err != nil {
+			return scanned, err
+		}
+		if !found {
+			break
+		}
+		scanned++
+	}
+	return scanned, nil
+}
+
+// scanFile scans the file of row and records the verdict. Failed scans are
+// retried until scan_max_attempts, files too large to be scanned fail at once,
+// infected files are quarantined and their uploader is notified.
+func scanFile(ctx context.Context, tx *gorm.DB, row model.FileScan) error {
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": row.Attempts + 1, "scanned_at": now, "error": nil}
+
+	result, err := scanObject(ctx, row.Key)
+	switch {
+	case errors.Is(err, scan.ErrSizeLimit):
+		// Never served unscanned, scan_max_size and the StreamMaxLength of
+		// clamd must cover the largest upload
+		updates["status"] = model.FileScanStatusFailed
+		updates["error"] = err.Error()
+	case err != nil:
+		updates["error"] = err.Error()
+		if row.Attempts+1 >= cfg.GetInt("scan_max_attempts") {
+			updates["status"] = model.FileScanStatusFailed
+		}
+	case result.Infected:
+		quarantineKey := quarantinePrefix + row.Key
+		if err := moveObject(ctx, row.Key, quarantineKey); err != nil {
+			// The scan is repeated, the file stays blocked meanwhile
+			updates["error"] = fmt.Sprintf("could not quarantine the file - %s", err)
+			break
+		}
+		updates["status"] = model.FileScanStatusInfected
+		updates["signature"] = result.Signature
+		updates["quarantine_key"] = quarantineKey
+		if row.UploaderID != uuid.Nil {
+			notification := model.Notification{
+				ID:        uuid.New(),
+				UserID:    row.UploaderID,
+				Title:     "File quarantined",
+				Content:   fmt.Sprintf("%s contains %s and was quarantined, it cannot be downloaded", row.FileName, result.Signature),
+				Type:      "security",
+				RelatedID: row.ID,
+			}
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+		}
+	default:
+		updates["status"] = model.FileScanStatusClean
+	}
+	if err := tx.Model(&row).Updates(updates).Error; err != nil {
+		return err
+	}
+	if updates["status"] == model.FileScanStatusClean {
+		// Images and videos wait for their scan before they are processed
+		wakeImages()
+		wakeVideos()
+	}
+	return nil
+}
+
+// scanObject streams the object to the scanner, objects above scan_max_size
+// are not scanned and fail with scan.ErrSizeLimit
+func scanObject(ctx context.Context, key string) (scan.Result, error) {
+	r, info, err := fileStorage.Get(ctx, key)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	defer r.Close()
+	if maxSize := cfg.GetInt64("scan_max_size"); maxSize > 0 && info.Size > maxSize {
+		return scan.Result{}, scan.ErrSizeLimit
+	}
+	return fileScanner.Scan(ctx, r)
+}
+
+// moveObject copies the object to another key and deletes it
+func moveObject(ctx context.Context, from string, to string) error {
+	r, info, err := fileStorage.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	opts := storage.PutOptions{ContentType: info.ContentType, FileName: info.FileName}
+	if _, err := fileStorage.Put(ctx, to, r, info.Size, opts); err != nil {
+		return err
+	}
+	return fileStorage.Delete(ctx, from)
+}
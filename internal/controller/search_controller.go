@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoangtu1372k2/vms/internal/migration"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+)
+
+// Text search configuration created by the search migration
+const searchConfig = "'" + migration.SearchConfig + "'::regconfig"
+
+// Options passed to ts_headline when building snippets
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" ... \""
+
+// searchHeadline highlights the query in the text of expr. The text is HTML
+// escaped first, so the <mark> tags are the only markup of the snippet.
+func searchHeadline(expr string) string {
+	escaped := expr
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"''", "&#39;"}} {
+		escaped = "replace(" + escaped + ", '" + r[0] + "', '" + r[1] + "')"
+	}
+	return "ts_headline(" + searchConfig + ", " + escaped + ", q.query, @opts)"
+}
+
+// searchSources holds one SELECT per searchable type. Every branch returns the
+// same columns and only rows inside courses listed by the visible_course CTE,
+// except the course catalog itself where active courses are public.
+var searchSources = map[string]string{
+	model.SearchTypeCourse: `
+		SELECT 'course' AS type, c.id, c.id AS course_id, c.title,
+			` + searchHeadline(`coalesce(c.title, '') || ' ' || coalesce(c.description, '')`) + ` AS snippet,
+			ts_rank_cd(c.search_vector, q.query) AS rank
+		FROM course c, q
+		WHERE c.search_vector @@ q.query
+			AND (c.status = 'active' OR c.id IN (SELECT id FROM visible_course))`,
+	model.SearchTypeLesson: `
+		SELECT 'lesson' AS type, l.id, l.course_id, l.title,
+			` + searchHeadline(`coalesce(l.content, l.title)`) + ` AS snippet,
+			ts_rank_cd(l.search_vector, q.query) AS rank
+		FROM lesson l, q
+		WHERE l.search_vector @@ q.query
+			AND l.course_id IN (SELECT id FROM visible_course)`,
+	model.SearchTypeAssignment: `
+		SELECT 'assignment' AS type, a.id, a.course_id, a.title,
+			` + searchHeadline(`coalesce(a.description, a.content, a.title)`) + ` AS snippet,
+			ts_rank_cd(a.search_vector, q.query) AS rank
+		FROM assignment a, q
+		WHERE a.search_vector @@ q.query
+			AND a.course_id IN (SELECT id FROM visible_course)`,
+	model.SearchTypeCourseDocument: `
+		SELECT 'course_document' AS type, d.id, d.course_id, d.title,
+			` + searchHeadline(`d.title || ' ' || coalesce(d.description, '')`) + ` AS snippet,
+			ts_rank_cd(d.search_vector, q.query) AS rank
+		FROM course_document d, q
+		WHERE d.search_vector @@ q.query
+			AND d.course_id IN (SELECT id FROM visible_course)`,
+	model.SearchTypeAssignmentDocument: `
+		SELECT 'assignment_document' AS type, d.id, a.course_id, d.title,
+			` + searchHeadline(`d.title || ' ' || coalesce(d.description, '')`) + ` AS snippet,
+			ts_rank_cd(d.search_vector, q.query) AS rank
+		FROM assignment_document d
+		JOIN assignment a ON a.id = d.assignment_id, q
+		WHERE d.search_vector @@ q.query
+			AND a.course_id IN (SELECT id FROM visible_course)`,
+}
+
+// searchTypeOrder keeps the UNION in a stable order
+var searchTypeOrder = []string{
+	model.SearchTypeCourse,
+	model.SearchTypeLesson,
+	model.SearchTypeAssignment,
+	model.SearchTypeCourseDocument,
+	model.SearchTypeAssignmentDocument,
+}
+
+// Search godoc
+// @Summary      Full-text search
+// @Description  Searches course titles and descriptions, lesson content, assignments and document titles.
+// @Description  Accents are ignored, results are ranked and contain a highlighted snippet: HTML escaped text where matches are wrapped in <mark>.
+// @Description  Only courses the caller teaches or is enrolled in are searched, plus the catalog of active courses.
+// @Tags         Search
+// @Accept       json
+// @Produce      json
+// @Param        q      query  string  true   "Search text, supports quoted phrases, OR and -exclusion"
+// @Param        types  query  string  false  "Comma separated list of course, lesson, assignment, course_document, assignment_document"
+// @Param        limit  query  int     false  "Page size (default 20, max 100)"
+// @Param        page   query  int     false  "Page number, starting at 1"
+// @Success      200  {object}  model.JsonDTORsp[[]model.SearchResult]
+// @Failure      400  {object}  model.JsonDTORsp[[]model.SearchResult]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.SearchResult]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.SearchResult]
+// @Router       /search [get]
+// @Security     BearerAuth
+func Search(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.SearchResult]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, &jsonRsp)
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "query parameter q is required"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+
+	types := searchTypeOrder
+	if raw := c.Query("types"); raw != "" {
+		types = make([]string, 0)
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSpace(t)
+			if _, ok := searchSources[t]; !ok {
+				jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+				jsonRsp.Message = fmt.Sprintf("unknown search type %q", t)
+				c.JSON(http.StatusBadRequest, &jsonRsp)
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	branches := make([]string, 0, len(types))
+	for _, t := range types {
+		branches = append(branches, searchSources[t])
+	}
+	sql := `
+		WITH q AS (SELECT websearch_to_tsquery(` + searchConfig + `, @q) AS query),
+		visible_course AS (
+			SELECT id FROM course
+			WHERE @admin
+				OR instructor_id = @user_id
+				OR id IN (SELECT course_id FROM course_enrollment WHERE student_id = @user_id AND status <> 'dropped')
+		)
+		SELECT r.*, count(*) OVER () AS total
+		FROM (` + strings.Join(branches, " UNION ALL ") + `) r
+		ORDER BY r.rank DESC, r.title ASC
+		LIMIT @limit OFFSET @offset`
+
+	results := make([]model.SearchResult, 0)
+	err = db.Raw(sql, map[string]interface{}{
+		"opts":    searchHeadlineOptions,
+		"q":       q,
+		"admin":   caller.IsAdmin(),
+		"user_id": caller.ID,
+		"limit":   limit,
+		"offset":  limit * (page - 1),
+	}).Scan(&results).Error
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusSearchItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	var total int64
+	if len(results) > 0 {
+		total = results[0].Total
+	}
+	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
+	jsonRsp.Data = results
+	c.JSON(http.StatusOK, &jsonRsp)
+}
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+)
+
+// Store of the uploaded files, nil when storage is not available
+var fileStorage storage.Storage
+
+// InitStorage sets the store used by the upload and file endpoints
+func InitStorage(s storage.Storage) {
+	fileStorage = s
+}
+
+// uploadType mô tả một định dạng file được phép tải lên. category là thư mục
+// chứa file và phần tên của giới hạn upload_max_size_<category>, detected là
+// các MIME type mà nội dung file (magic bytes) được phép nhận diện thành.
+type uploadType struct {
+	category    string
+	contentType string
+	detected    []string
+}
+
+// Định dạng file được phép tải lên. File DOCX và XLSX là file zip, file DOC và
+// XLS là file OLE nên loại container chung cũng được chấp nhận.
+var uploadTypes = map[string]uploadType{
+	".jpg":  {"images", "image/jpeg", []string{"image/jpeg"}},
+	".jpeg": {"images", "image/jpeg", []string{"image/jpeg"}},
+	".png":  {"images", "image/png", []string{"image/png"}},
+	".mp4":  {"videos", "video/mp4", []string{"video/mp4", "video/x-m4v"}},
+	".pdf":  {"documents", "application/pdf", []string{"application/pdf"}},
+	".doc":  {"documents", "application/msword", []string{"application/msword", "application/x-ole-storage"}},
+	".docx": {"documents", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"}},
+	".xls":  {"spreadsheets", "application/vnd.ms-excel", []string{"application/vnd.ms-excel", "application/x-ole-storage"}},
+	".xlsx": {"spreadsheets", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"}},
+}
+
+// uploadSniffLen là số byte đầu file dùng để nhận diện nội dung
+const uploadSniffLen = 3072
+
+var errUploadType = errors.New("Định dạng file không hỗ trợ. Sử dụng JPG, PNG, MP4, PDF, DOC, DOCX, XLS, hoặc XLSX")
+
+// uploadTypeOf trả về định dạng của file theo phần mở rộng
+func uploadTypeOf(fileName string) (uploadType, bool) {
+	t, ok := uploadTypes[strings.ToLower(path.Ext(fileName))]
+	return t, ok
+}
+
+// checkSize trả về lỗi khi file vượt quá upload_max_size_<category>, giới hạn 0 là không giới hạn
+func (t uploadType) checkSize(size int64) error {
+	if maxSize := cfg.GetInt64("upload_max_size_" + t.category); maxSize > 0 && size > maxSize {
+		return fmt.Errorf("File vượt quá dung lượng cho phép của %s (%d bytes)", t.category, maxSize)
+	}
+	return nil
+}
+
+// checkContent nhận diện nội dung từ các byte đầu file và trả về lỗi khi
+// nội dung không khớp với phần mở rộng
+func (t uploadType) checkContent(head []byte) error {
+	detected := mimetype.Detect(head)
+	for _, m := range t.detected {
+		if detected.Is(m) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Nội dung file (%s) không khớp với định dạng %s", detected.String(), t.contentType)
+}
+
+// readUploadHead đọc các byte đầu để nhận diện nội dung, reader trả về vẫn
+// đọc được toàn bộ file
+func readUploadHead(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, uploadSniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// uploadFileName giữ lại tên gốc của file không kèm đường dẫn và ký tự điều
+// khiển, tên được lưu cùng object và trả về trong Content-Disposition
+func uploadFileName(fileName string) string {
+	fileName = fileName[strings.LastIndexAny(fileName, `/\`)+1:]
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, fileName)
+}
+
+// uploadObjectName đặt file vào thư mục theo loại (videos, documents,
+// spreadsheets hoặc images) với tên ngẫu nhiên, hai file trùng tên không ghi
+// đè lên nhau
+func uploadObjectName(t uploadType, fileName string) string {
+	return fmt.Sprintf("%s/%s%s", t.category, uuid.New(), strings.ToLower(path.Ext(fileName)))
+}
+
+// UploadFile godoc
+// @Summary      Tải file lên kho lưu trữ
+// @Description  Tải file lên kho lưu trữ đã cấu hình (MinIO hoặc ổ đĩa cục bộ). Định dạng hỗ trợ: JPG, PNG, MP4, PDF, DOC, DOCX, XLS, XLSX.
+// @Description  Nội dung file (magic bytes) phải khớp với phần mở rộng, dung lượng tối đa cấu hình theo loại bằng upload_max_size_images, _videos, _documents và _spreadsheets.
+// @Description  File được lưu với tên ngẫu nhiên trong thư mục theo loại, tên gốc trả về trong original_name và header Content-Disposition khi tải về.
+// @Description  Khi bật quét virus (clamd_address), file chỉ tải về được qua GET /file sau khi quét xong, scan_pending cho biết file đang chờ quét.
+// @Description  Video (MP4) được chuyển mã sang HLS nhiều mức chất lượng, video_asset_id trả về dùng để theo dõi tiến độ qua GET /videos/{id} và gắn vào bài học.
+// @Description  Ảnh (JPG, PNG) được tạo thêm các bản thu nhỏ thumbnail, medium và large ở định dạng WebP và JPEG, URL của chúng trả về trong variants và có sau khi ảnh được xử lý. purpose=avatar tạo các bản cắt vuông cho ảnh đại diện.
+// @Tags         minio
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file formData file true "File cần tải lên"
+// @Param        id_user  query  string  true  "Read user by id"
+// @Param        purpose  query  string  false  "Mục đích của ảnh: image (mặc định) hoặc avatar"
+// @Success      200 {object} map[string]interface{} "Tải file thành công"
+// @Failure      400 {object} map[string]string "File hoặc yêu cầu không hợp lệ"
+// @Failure      413 {object} map[string]string "File vượt quá dung lượng cho phép"
+// @Failure      415 {object} map[string]string "Nội dung file không khớp với định dạng"
+// @Failure      500 {object} map[string]string "Lỗi server"
+// @Failure      503 {object} map[string]string "Kho lưu trữ chưa sẵn sàng"
+// @Router       /upload [post]
+func UploadFile(c *gin.Context) {
+	// Kiểm tra kho lưu trữ đã được khởi tạo
+	if fileStorage == nil {
+		log.Println("Lỗi: kho lưu trữ chưa được khởi tạo")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kho lưu trữ chưa được khởi tạo"})
+		return
+	}
+
+	// Lấy file từ form-data
+	file, err := c.FormFile("file")
+	if err != nil {
+		log.Printf("Lỗi lấy file: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không có file được tải lên"})
+		return
+	}
+
+	// Kiểm tra định dạng và dung lượng file
+	fileName := uploadFileName(file.Filename)
+	t, valid := uploadTypeOf(fileName)
+	if !valid {
+		log.Printf("Định dạng file không hỗ trợ: %s", path.Ext(fileName))
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUploadType.Error()})
+		return
+	}
+	if err := t.checkSize(file.Size); err != nil {
+		log.Printf("File %s quá lớn: %d bytes", fileName, file.Size)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	purpose := c.DefaultQuery("purpose", model.ImagePurposeImage)
+	if t.category == "images" && !validImagePurpose(purpose) {
+		log.Printf("Mục đích ảnh không hợp lệ: %s", purpose)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "purpose phải là image hoặc avatar"})
+		return
+	}
+
+	// Mở file
+	f, err := file.Open()
+	if err != nil {
+		log.Printf("Lỗi mở file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi mở file"})
+		return
+	}
+	defer f.Close()
+
+	// Nhận diện nội dung file từ magic bytes
+	head, r, err := readUploadHead(f)
+	if err != nil {
+		log.Printf("Lỗi đọc file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi đọc file"})
+		return
+	}
+	if err := t.checkContent(head); err != nil {
+		log.Printf("File %s bị từ chối: %v", fileName, err)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tạo tên object ngẫu nhiên trong thư mục theo loại file
+	objectName := uploadObjectName(t, fileName)
+
+	// Tải lên kho lưu trữ, tên gốc được lưu cùng object
+	ctx := context.Background()
+	info, err := fileStorage.Put(ctx, objectName, r, file.Size, storage.PutOptions{ContentType: t.contentType, FileName: fileName})
+	if err != nil {
+		log.Printf("Lỗi tải file lên kho lưu trữ: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi tải file: %v", err)})
+		return
+	}
+
+	// Ghi nhận file chờ quét virus, file chưa tải về được cho đến khi quét xong
+	if err := queueScan(db, objectName, uploadUploader(c), fileName); err != nil {
+		log.Printf("Lỗi ghi nhận quét virus cho %s: %v", objectName, err)
+		fileStorage.Delete(ctx, objectName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi tải file: %v", err)})
+		return
+	}
+
+	// Ảnh được tạo các bản thu nhỏ và video được chuyển mã sau khi quét virus xong
+	var variants model.ImageVariants
+	var videoAssetID *uuid.UUID
+	switch t.category {
+	case "images":
+		if err := queueImage(db, objectName, purpose); err != nil {
+			log.Printf("Lỗi ghi nhận xử lý ảnh cho %s: %v", objectName, err)
+		} else {
+			variants = imageVariantURLs(objectName, purpose)
+		}
+	case "videos":
+		if asset, err := queueVideo(db, objectName, uploadUploader(c)); err != nil {
+			log.Printf("Lỗi ghi nhận chuyển mã video cho %s: %v", objectName, err)
+		} else {
+			videoAssetID = &asset.ID
+		}
+	}
+
+	// Trả về phản hồi thành công
+	log.Printf("Tải file %s thành %s, kích thước: %d bytes", fileName, objectName, info.Size)
+	c.JSON(http.StatusOK, gin.H{"message": "Tải file thành công",
+		"file_name":      objectName,
+		"original_name":  fileName,
+		"file_path":      fileStorage.URL(objectName),
+		"file_size":      info.Size,
+		"file_type":      t.contentType,
+		"file_id":        info.Key,
+		"scan_pending":   fileScanner != nil,
+		"variants":       variants,
+		"video_asset_id": videoAssetID,
+	})
+}
+
+// uploadUploader trả về người tải file lên: người dùng của token, nếu không có
+// thì id_user, uuid.Nil khi không xác định được
+func uploadUploader(c *gin.Context) uuid.UUID {
+	if caller, err := currentCaller(c); err == nil {
+		return caller.ID
+	}
+	id, _ := uuid.Parse(c.Query("id_user"))
+	return id
+}
+
+// checkFileScan trả lời yêu cầu và trả về false khi file chưa được phép tải về:
+// đang chờ quét virus, quét thất bại hoặc đã bị cách ly
+func checkFileScan(c *gin.Context, key string) bool {
+	status, err := fileScanStatus(c.Request.Context(), key)
+	switch {
+	case err != nil:
+		log.Printf("Lỗi kiểm tra trạng thái quét virus của %s: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi kiểm tra tệp: %v", err)})
+		return false
+	case status == model.FileScanStatusPending:
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusConflict, gin.H{"error": "Tệp đang chờ quét virus, vui lòng thử lại sau", "status": status})
+		return false
+	case status == model.FileScanStatusInfected:
+		c.JSON(http.StatusGone, gin.H{"error": "Tệp chứa mã độc và đã bị cách ly", "status": status})
+		return false
+	case status != "":
+		c.JSON(http.StatusConflict, gin.H{"error": "Không quét virus được tệp, vui lòng liên hệ quản trị viên", "status": status})
+		return false
+	}
+	return true
+}
+
+// GetFile godoc
+// @Summary      Lấy tệp từ kho lưu trữ
+// @Description  Trả về URL đã ký trước để truy cập tệp trong kho lưu trữ. Yêu cầu tên object của tệp.
+// @Description  Video (file video, bản gốc của video asset và file HLS của nó) không được cấp URL, chúng được xem qua POST /videos/{id}/playback.
+// @Tags         minio
+// @Accept       json
+// @Produce      json
+// @Param        objectName query string true "Tên object của tệp (bao gồm thư mục, ví dụ: images/example.jpg)"
+// @Success      200 {object} map[string]interface{} "Truy xuất tệp thành công"
+// @Failure      400 {object} map[string]string "Yêu cầu không hợp lệ"
+// @Failure      403 {object} map[string]string "Video chỉ xem được qua token phát video"
+// @Failure      404 {object} map[string]string "Tệp không tồn tại"
+// @Failure      409 {object} map[string]string "Tệp đang chờ quét virus"
+// @Failure      410 {object} map[string]string "Tệp chứa mã độc và đã bị cách ly"
+// @Failure      500 {object} map[string]string "Lỗi server"
+// @Failure      503 {object} map[string]string "Kho lưu trữ chưa sẵn sàng"
+// @Router       /file [get]
+func GetFile(c *gin.Context) {
+	// Kiểm tra kho lưu trữ đã được khởi tạo
+	if fileStorage == nil {
+		log.Println("Lỗi: kho lưu trữ chưa được khởi tạo")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kho lưu trữ chưa được khởi tạo"})
+		return
+	}
+
+	// Lấy tên object từ query parameter
+	objectName := c.Query("objectName")
+	if objectName == "" {
+		log.Println("Lỗi: Thiếu tên object")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Yêu cầu tên object của tệp"})
+		return
+	}
+
+	// Video chỉ xem được qua token phát video, không cấp URL tải trực tiếp cho
+	// file video, bản gốc của video asset hay file HLS của nó, dù nằm ở thư mục nào
+	ctx := context.Background()
+	video, err := isVideoObject(ctx, objectName)
+	if err != nil {
+		log.Printf("Lỗi kiểm tra video %s: %v", objectName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi kiểm tra tệp: %v", err)})
+		return
+	}
+	if video {
+		log.Printf("Từ chối cấp URL cho video %s", objectName)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Video chỉ xem được qua POST /videos/{id}/playback"})
+		return
+	}
+
+	// Kiểm tra tệp tồn tại
+	_, err = fileStorage.Stat(ctx, objectName)
+	if err != nil {
+		log.Printf("Lỗi kiểm tra tệp %s: %v", objectName, err)
+		// Kiểm tra nếu tệp không tồn tại
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi kiểm tra tệp: %v", err)})
+		}
+		return
+	}
+
+	// Tệp chỉ được tải về sau khi đã qua quét virus
+	if !checkFileScan(c, objectName) {
+		return
+	}
+
+	// Tạo URL đã ký trước (presigned URL) để truy cập tệp
+	presignedURL, err := fileStorage.SignedURL(ctx, objectName, time.Hour*24)
+	if err != nil {
+		log.Printf("Lỗi tạo URL đã ký cho %s: %v", objectName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi tạo URL truy cập tệp"})
+		return
+	}
+
+	// Trả về phản hồi thành công
+	log.Printf("Truy xuất tệp %s thành công", objectName)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Truy xuất tệp thành công",
+		"objectName": objectName,
+		"url":        presignedURL,
+	})
+}
+
+// ServeStoredFile godoc
+// @Summary      Tải tệp từ kho lưu trữ cục bộ
+// @Description  Trả về nội dung tệp của kho lưu trữ cục bộ qua URL đã ký do GET /file trả về. Hỗ trợ header Range.
+// @Tags         minio
+// @Produce      octet-stream
+// @Param        key        path   string  true  "Tên object của tệp, gồm cả storage_prefix"
+// @Param        expires    query  string  true  "Thời điểm hết hạn (unix)"
+// @Param        signature  query  string  true  "Chữ ký"
+// @Success      200
+// @Success      206
+// @Failure      403 {object} map[string]string "Chữ ký không hợp lệ hoặc đã hết hạn"
+// @Failure      404 {object} map[string]string "Tệp không tồn tại"
+// @Failure      409 {object} map[string]string "Tệp đang chờ quét virus"
+// @Failure      410 {object} map[string]string "Tệp chứa mã độc và đã bị cách ly"
+// @Router       /storage/{key} [get]
+func ServeStoredFile(c *gin.Context) {
+	local, ok := fileStorage.(*storage.Local)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		return
+	}
+
+	key, ok := local.ObjectKey(strings.TrimPrefix(c.Param("key"), "/"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		return
+	}
+	if err := local.Verify(http.MethodGet, key, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chữ ký không hợp lệ hoặc đã hết hạn"})
+		return
+	}
+	if !checkFileScan(c, key) {
+		return
+	}
+
+	r, info, err := local.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		} else {
+			log.Printf("Lỗi đọc tệp %s: %v", key, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi đọc tệp: %v", err)})
+		}
+		return
+	}
+	defer r.Close()
+
+	c.Header("Content-Type", info.ContentType)
+	if disposition := storage.ContentDisposition(info.FileName); disposition != "" {
+		c.Header("Content-Disposition", disposition)
+	}
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	http.ServeContent(c.Writer, c.Request, filepath.Base(key), info.ModTime, r)
+}
+
+// ReceiveStoredFile godoc
+// @Summary      Tải tệp lên kho lưu trữ cục bộ
+// @Description  Nhận nội dung tệp qua URL đã ký do POST /uploads/initiate trả về khi dùng kho lưu trữ cục bộ.
+// @Tags         minio
+// @Accept       octet-stream
+// @Param        key        path   string  true  "Tên object của tệp, gồm cả storage_prefix"
+// @Param        expires    query  string  true  "Thời điểm hết hạn (unix)"
+// @Param        signature  query  string  true  "Chữ ký"
+// @Success      200
+// @Failure      403 {object} map[string]string "Chữ ký không hợp lệ hoặc đã hết hạn"
+// @Failure      500 {object} map[string]string "Lỗi server"
+// @Router       /storage/{key} [put]
+func ReceiveStoredFile(c *gin.Context) {
+	local, ok := fileStorage.(*storage.Local)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		return
+	}
+
+	key, ok := local.ObjectKey(strings.TrimPrefix(c.Param("key"), "/"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tệp không tồn tại"})
+		return
+	}
+	if err := local.Verify(http.MethodPut, key, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chữ ký không hợp lệ hoặc đã hết hạn"})
+		return
+	}
+
+	_, err := local.Put(c.Request.Context(), key, c.Request.Body, c.Request.ContentLength, storage.PutOptions{ContentType: c.ContentType()})
+	if err != nil {
+		log.Printf("Lỗi ghi tệp %s: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Lỗi ghi tệp: %v", err)})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// maxPlaylistSize bounds the playlists read into memory to add the token
+const maxPlaylistSize = 4 << 20
+
+// CreatePlaybackToken godoc
+// @Summary      Start watching a video
+// @Description  Returns a playback token and the URLs of the HLS master playlist, the poster, the thumbnails and chapters tracks and of the
+// @Description  original video, all carrying the token. Encrypted videos have no stream_url, their original needs a bearer token.
+// @Description  Tokens belong to the caller and the video and expire playback_token_ttl plus the video duration from now. Only the uploader, admins,
+// @Description  the teacher and the enrolled students of a course with a lesson showing the video get one. HLS needs the video to be ready.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Video asset ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoPlayback]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoPlayback]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoPlayback]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoPlayback]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoPlayback]
+// @Router       /videos/{id}/playback [post]
+// @Security     BearerAuth
+func CreatePlaybackToken(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoPlayback]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, &jsonRsp)
+		return
+	}
+	var asset model.VideoAsset
+	err = db.Where("id = ?", c.Param("id")).Take(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	allowed, err := canViewVideo(db, caller, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if !allowed {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "video belongs to a course you are not part of"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	// Segments are fetched while the video plays, the token outlives it
+	ttl := cfg.GetDuration("playback_token_ttl")
+	if asset.Duration != nil {
+		ttl += time.Duration(*asset.Duration * float64(time.Second))
+	}
+	expires := time.Now().Add(ttl)
+	token := newPlaybackToken(asset.ID, caller.ID, expires)
+	base := path.Join(cfg.GetString("service_path"), "videos", asset.ID.String())
+	query := "?token=" + url.QueryEscape(token)
+	encrypted, err := videoEncrypted(db, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	playback := model.VideoPlayback{
+		Token:     token,
+		ExpiresAt: expires,
+		Status:    asset.Status,
+	}
+	if !encrypted {
+		playback.StreamURL = base + "/stream" + query
+	}
+	if asset.Status == model.VideoStatusReady {
+		playback.PlaylistURL = base + "/hls/master.m3u8" + query
+		playback.PosterURL = base + "/hls/poster.jpg" + query
+		playback.ChaptersURL = base + "/hls/chapters.vtt" + query
+		if asset.Thumbnails != nil {
+			playback.ThumbnailsURL = base + "/hls/thumbnails.vtt" + query
+		}
+	}
+
+	jsonRsp.Data = playback
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// StreamVideo godoc
+// @Summary      Stream the original of a video
+// @Description  Serves the uploaded video with Range, If-Range and 206 Partial Content support. Takes the playback token of
+// @Description  POST /videos/{id}/playback in the token parameter, or a bearer token of a user allowed to watch the video. The original of a
+// @Description  video with encrypted HLS renditions only takes a bearer token, a shared playlist URL must not give away the whole video.
+// @Tags         Video
+// @Produce      video/mp4
+// @Param        id     path   string  true   "Video asset ID"
+// @Param        token  query  string  false  "Playback token"
+// @Success      200
+// @Success      206
+// @Failure      401
+// @Failure      403
+// @Failure      404
+// @Failure      416
+// @Router       /videos/{id}/stream [get]
+func StreamVideo(c *gin.Context) {
+	asset, ok := authorizeStream(c, true)
+	if !ok || !checkFileScan(c, asset.Key) {
+		return
+	}
+	serveObject(c, asset.Key)
+}
+
+// StreamHLS godoc
+// @Summary      Stream the HLS renditions of a video
+// @Description  Serves the master playlist (master.m3u8), the media playlists (<rendition>/index.m3u8) and the segments of a ready video,
+// @Description  the subtitle renditions of its caption tracks (captions/<caption id>.m3u8 and .vtt), the poster (poster.jpg),
+// @Description  the WebVTT thumbnails track (thumbnails.vtt) pointing at the sprite sheets (thumbnails/sprite_000.jpg) and the WebVTT chapters track (chapters.vtt).
+// @Description  The URIs of the playlists are rewritten to carry the playback token, so players need no other authentication. Segments support Range requests.
+// @Tags         Video
+// @Produce      application/vnd.apple.mpegurl
+// @Param        id     path   string  true   "Video asset ID"
+// @Param        path   path   string  true   "Playlist or segment, e.g. master.m3u8"
+// @Param        token  query  string  false  "Playback token"
+// @Success      200
+// @Success      206
+// @Failure      401
+// @Failure      403
+// @Failure      404
+// @Router       /videos/{id}/hls/{path} [get]
+func StreamHLS(c *gin.Context) {
+	asset, ok := authorizeStream(c, false)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(c.Param("path"), "/")
+	if asset.Status != model.VideoStatusReady || name == "" || path.Clean(name) != name || strings.HasPrefix(name, "..") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist or segment not found"})
+		return
+	}
+	key := videoHLSPrefix(asset.Key) + name
+	var playlist []byte
+	switch {
+	case strings.HasPrefix(name, "captions/"):
+		serveCaptionRendition(c, asset, strings.TrimPrefix(name, "captions/"))
+		return
+	case name == "chapters.vtt", name == "thumbnails.vtt":
+		serveVideoTrack(c, asset, name)
+		return
+	case path.Ext(name) != ".m3u8":
+		serveObject(c, key)
+		return
+	case name == "master.m3u8":
+		// Written on every request, caption tracks come and go
+		var err error
+		if playlist, err = masterPlaylist(asset); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		r, _, err := fileStorage.Get(c.Request.Context(), key)
+		if err != nil {
+			respondStorageError(c, key, err)
+			return
+		}
+		defer r.Close()
+		if playlist, err = io.ReadAll(io.LimitReader(r, maxPlaylistSize)); err != nil {
+			respondStorageError(c, key, err)
+			return
+		}
+	}
+	// Playlists carry the token of the viewer, they are never shared
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, hlsContentType(key), withPlaybackToken(playlist, c.Query("token")))
+}
+
+// authorizeStream reads the video of the id path parameter and checks that the
+// request may stream it, with a playback token or a bearer token. Playback
+// tokens do not give the original of encrypted videos. It answers the request
+// and returns false when it may not.
+func authorizeStream(c *gin.Context, original bool) (model.VideoAsset, bool) {
+	var asset model.VideoAsset
+	if fileStorage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file storage is not available"})
+		return asset, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return asset, false
+	}
+	err = db.Where("id = ?", id).Take(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return asset, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return asset, false
+	}
+
+	if token := c.Query("token"); token != "" {
+		if _, err := verifyPlaybackToken(token, asset.ID); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return asset, false
+		}
+		if !original {
+			return asset, true
+		}
+		encrypted, err := videoEncrypted(db, asset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return asset, false
+		}
+		if encrypted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the original of an encrypted video needs a bearer token"})
+			return asset, false
+		}
+		return asset, true
+	}
+	caller, err := currentCaller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "a playback token or a bearer token is required"})
+		return asset, false
+	}
+	allowed, err := canViewVideo(db, caller, asset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return asset, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "video belongs to a course you are not part of"})
+		return asset, false
+	}
+	return asset, true
+}
+
+// videoEncrypted tells whether the HLS renditions of the video are encrypted,
+// or will be once it is transcoded
+func videoEncrypted(tx *gorm.DB, asset model.VideoAsset) (bool, error) {
+	if asset.Status != model.VideoStatusReady {
+		return cfg.GetInt("video_key_rotation") > 0, nil
+	}
+	var keys int64
+	err := tx.Model(&model.VideoKey{}).Where("asset_id = ?", asset.ID).Count(&keys).Error
+	return keys > 0, err
+}
+
+// serveObject proxies a stored object, answering Range, If-Range and
+// conditional requests
+func serveObject(c *gin.Context, key string) {
+	r, info, err := fileStorage.Get(c.Request.Context(), key)
+	if err != nil {
+		respondStorageError(c, key, err)
+		return
+	}
+	defer r.Close()
+	c.Header("Content-Type", info.ContentType)
+	c.Header("Cache-Control", "private, max-age=3600")
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, r)
+}
+
+func respondStorageError(c *gin.Context, key string, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	log.Printf("could not read %s - %s", key, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// playlistURI matches the URI attributes of playlist tags
+var playlistURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+// withPlaybackToken adds the token to the relative URIs of a playlist, the
+// URI lines and the URI attributes of tags
+func withPlaybackToken(playlist []byte, token string) []byte {
+	if token == "" {
+		return playlist
+	}
+	addToken := func(uri string) string {
+		if u, err := url.Parse(uri); err != nil || u.IsAbs() || strings.HasPrefix(uri, "/") {
+			return uri
+		}
+		separator := "?"
+		if strings.Contains(uri, "?") {
+			separator = "&"
+		}
+		return uri + separator + "token=" + url.QueryEscape(token)
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			line = playlistURI.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + addToken(playlistURI.FindStringSubmatch(attr)[1]) + `"`
+			})
+		case strings.TrimSpace(line) != "":
+			line = addToken(strings.TrimSpace(line))
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+)
+
+// createAttempt stores submission as the next attempt of its student for the
+// assignment. Earlier attempts still waiting for grading are superseded, two
+// concurrent attempts collide on the unique attempt index.
+func createAttempt(tx *gorm.DB, submission *model.AssignmentSubmission) error {
+	var last int
+	err := tx.Model(&model.AssignmentSubmission{}).
+		Where("assignment_id = ? AND student_id = ?", submission.AssignmentID, submission.StudentID).
+		Select("coalesce(max(attempt), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.AssignmentSubmission{}).
+		Where("assignment_id = ? AND student_id = ?", submission.AssignmentID, submission.StudentID).
+		Where("coalesce(status, '') NOT IN ?", []string{model.SubmissionStatusGraded, model.SubmissionStatusSuperseded}).
+		Update("status", model.SubmissionStatusSuperseded).Error
+	if err != nil {
+		return err
+	}
+
+	submission.Attempt = last + 1
+	return tx.Create(submission).Error
+}
+
+// firstFiles returns the earliest attached file of every submission
+func firstFiles(tx *gorm.DB, ids []uuid.UUID) (map[uuid.UUID]model.AssignmentSubmissionFile, error) {
+	files := make(map[uuid.UUID]model.AssignmentSubmissionFile, len(ids))
+	if len(ids) == 0 {
+		return files, nil
+	}
+	var rows []model.AssignmentSubmissionFile
+	err := tx.Where("submission_id IN ?", ids).Order("created_at, id").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, ok := files[*row.SubmissionID]; !ok {
+			files[*row.SubmissionID] = row
+		}
+	}
+	return files, nil
+}
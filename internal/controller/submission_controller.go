@@ -1,28 +1,92 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"path"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hoangtu1372k2/common-go/reposity"
+	"github.com/google/uuid"
 	"github.com/hoangtu1372k2/vms/internal/model"
 	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
 )
 
+// The /submissions routes are compatibility aliases over assignment
+// submissions, kept for one release. The content and the first attached file
+// of an attempt are rendered in the old shape.
+
+func deprecatedSubmissionRoute(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	c.Header("Link", "<"+path.Join(cfg.GetString("service_path"), "assignment-submissions")+`>; rel="successor-version"`)
+}
+
+func legacySubmission(sub model.AssignmentSubmission, file *model.AssignmentSubmissionFile) model.Submission {
+	dto := model.Submission{
+		ID:           sub.ID,
+		StudentID:    sub.StudentID,
+		AssignmentID: sub.AssignmentID,
+		Status:       model.SubmissionStatusSubmitted,
+		CreatedAt:    sub.CreatedAt,
+		UpdatedAt:    sub.UpdatedAt,
+	}
+	if sub.Content != nil {
+		dto.Content = *sub.Content
+	}
+	if sub.Status == model.SubmissionStatusGraded {
+		dto.Status = model.SubmissionStatusGraded
+	}
+	if file != nil {
+		dto.FileURL = file.FilePath
+	}
+	return dto
+}
+
+func legacySubmissions(subs []model.AssignmentSubmission) ([]model.Submission, error) {
+	ids := make([]uuid.UUID, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+	files, err := firstFiles(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]model.Submission, len(subs))
+	for i, sub := range subs {
+		var file *model.AssignmentSubmissionFile
+		if f, ok := files[sub.ID]; ok {
+			file = &f
+		}
+		dtos[i] = legacySubmission(sub, file)
+	}
+	return dtos, nil
+}
+
+func submissionFileFromURL(submissionID uuid.UUID, url string) model.AssignmentSubmissionFile {
+	return model.AssignmentSubmissionFile{
+		SubmissionID: &submissionID,
+		FileName:     path.Base(url),
+		FilePath:     url,
+	}
+}
+
 // CreateSubmission godoc
 // @Summary      Create a new submission
-// @Description  Takes a submission JSON and stores in DB. Returns saved JSON.
+// @Description  Deprecated, use POST /assignment-submissions. Stores the submission as the next attempt of the student.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
 // @Param        submission  body  model.CreateSubmission  true  "Submission JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateSubmission]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateSubmission]
+// @Failure      409  {object}  model.JsonDTORsp[model.CreateSubmission]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateSubmission]
 // @Router       /submissions [post]
 // @Security     BearerAuth
+// @Deprecated
 func CreateSubmission(c *gin.Context) {
+	deprecatedSubmissionRoute(c)
 	jsonRsp := model.NewJsonDTORsp[model.CreateSubmission]()
 
 	var dto model.CreateSubmission
@@ -33,7 +97,28 @@ func CreateSubmission(c *gin.Context) {
 		return
 	}
 
-	dto, err := reposity.CreateItemFromDTO[model.CreateSubmission, model.Submission](dto)
+	submission := model.AssignmentSubmission{
+		AssignmentID: dto.AssignmentID,
+		StudentID:    dto.StudentID,
+		Content:      &dto.Content,
+		Status:       model.SubmissionStatusSubmitted,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := createAttempt(tx, &submission); err != nil {
+			return err
+		}
+		if dto.FileURL == "" {
+			return nil
+		}
+		file := submissionFileFromURL(submission.ID, dto.FileURL)
+		return tx.Create(&file).Error
+	})
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusCreateItemFailed
 		jsonRsp.Message = err.Error()
@@ -47,7 +132,7 @@ func CreateSubmission(c *gin.Context) {
 
 // GetSubmissionByID godoc
 // @Summary      Get single submission by id
-// @Description  Returns the submission whose ID value matches the id.
+// @Description  Deprecated, use GET /assignment-submissions/{id}. Returns the submission whose ID value matches the id.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -57,22 +142,32 @@ func CreateSubmission(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[model.Submission]
 // @Router       /submissions/{id} [get]
 // @Security     BearerAuth
+// @Deprecated
 func GetSubmissionByID(c *gin.Context) {
+	deprecatedSubmissionRoute(c)
 	jsonRsp := model.NewJsonDTORsp[model.Submission]()
-	dto, err := reposity.ReadItemByIDIntoDTO[model.Submission, model.Submission](c.Param("id"))
-	if err != nil {
+
+	var sub model.AssignmentSubmission
+	if err := db.Where("id = ?", c.Param("id")).Take(&sub).Error; err != nil {
 		jsonRsp.Code = statuscode.StatusReadItemFailed
 		jsonRsp.Message = err.Error()
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
-	jsonRsp.Data = dto
+	dtos, err := legacySubmissions([]model.AssignmentSubmission{sub})
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	jsonRsp.Data = dtos[0]
 	c.JSON(http.StatusOK, &jsonRsp)
 }
 
 // GetSubmissions godoc
 // @Summary      Get all submissions
-// @Description  Returns all submissions from the database.
+// @Description  Deprecated, use GET /assignment-submissions. Returns all submissions from the database.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -80,25 +175,15 @@ func GetSubmissionByID(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Submission]
 // @Router       /submissions [get]
 // @Security     BearerAuth
+// @Deprecated
 func GetSubmissions(c *gin.Context) {
-	jsonRsp := model.NewJsonDTORsp[[]model.Submission]()
-
-	dtos, total, err := reposity.ReadAllItemsIntoDTO[model.Submission, model.Submission]("")
-	if err != nil {
-		jsonRsp.Code = statuscode.StatusReadItemFailed
-		jsonRsp.Message = err.Error()
-		c.JSON(http.StatusInternalServerError, &jsonRsp)
-		return
-	}
-
-	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
-	jsonRsp.Data = dtos
-	c.JSON(http.StatusOK, &jsonRsp)
+	deprecatedSubmissionRoute(c)
+	listLegacySubmissions(c, db.Order("created_at DESC"))
 }
 
 // UpdateSubmission godoc
 // @Summary      Update single submission by id
-// @Description  Updates and returns a single submission whose ID value matches the id.
+// @Description  Deprecated, use PUT /assignment-submissions/{id}. Updates and returns a single submission whose ID value matches the id.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -110,7 +195,9 @@ func GetSubmissions(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[model.UpdateSubmission]
 // @Router       /submissions/{id} [put]
 // @Security     BearerAuth
+// @Deprecated
 func UpdateSubmission(c *gin.Context) {
+	deprecatedSubmissionRoute(c)
 	jsonRsp := model.NewJsonDTORsp[model.UpdateSubmission]()
 
 	var dto model.UpdateSubmission
@@ -121,7 +208,41 @@ func UpdateSubmission(c *gin.Context) {
 		return
 	}
 
-	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateSubmission, model.Submission](c.Param("id"), dto)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var sub model.AssignmentSubmission
+		if err := tx.Where("id = ?", c.Param("id")).Take(&sub).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"status": dto.Status}
+		if dto.Content != "" {
+			updates["content"] = dto.Content
+		}
+		if err := tx.Model(&sub).Updates(updates).Error; err != nil {
+			return err
+		}
+		if dto.FileURL == "" {
+			return nil
+		}
+		files, err := firstFiles(tx, []uuid.UUID{sub.ID})
+		if err != nil {
+			return err
+		}
+		file, ok := files[sub.ID]
+		if !ok {
+			file = submissionFileFromURL(sub.ID, dto.FileURL)
+			return tx.Create(&file).Error
+		}
+		return tx.Model(&file).Updates(map[string]interface{}{
+			"file_name": path.Base(dto.FileURL),
+			"file_path": dto.FileURL,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
 		jsonRsp.Message = err.Error()
@@ -135,7 +256,7 @@ func UpdateSubmission(c *gin.Context) {
 
 // DeleteSubmission godoc
 // @Summary      Remove single submission by id
-// @Description  Deletes a single submission from the repository based on id.
+// @Description  Deprecated, use DELETE /assignment-submissions/{id}. Deletes a single submission and its files.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -145,10 +266,31 @@ func UpdateSubmission(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[model.Submission]
 // @Router       /submissions/{id} [delete]
 // @Security     BearerAuth
+// @Deprecated
 func DeleteSubmission(c *gin.Context) {
+	deprecatedSubmissionRoute(c)
 	jsonRsp := model.NewJsonDTORsp[model.Submission]()
 
-	err := reposity.DeleteItemByID[model.Submission](c.Param("id"))
+	id := c.Param("id")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("submission_id = ?", id).Delete(&model.AssignmentSubmissionFile{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&model.AssignmentSubmission{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusDeleteItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusDeleteItemFailed
 		jsonRsp.Message = err.Error()
@@ -161,7 +303,7 @@ func DeleteSubmission(c *gin.Context) {
 
 // GetStudentSubmissions godoc
 // @Summary      Get student's submissions
-// @Description  Returns all submissions for a specific student.
+// @Description  Deprecated, use GET /assignment-submissions/student/{student_id}. Returns all submissions for a specific student.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -170,28 +312,15 @@ func DeleteSubmission(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[[]model.Submission]
 // @Router       /submissions/student/{student_id} [get]
 // @Security     BearerAuth
+// @Deprecated
 func GetStudentSubmissions(c *gin.Context) {
-	jsonRsp := model.NewJsonDTORsp[[]model.Submission]()
-
-	studentID := c.Param("student_id")
-	filter := fmt.Sprintf("student_id = '%s' ORDER BY created_at DESC", studentID)
-
-	dtos, total, err := reposity.ReadAllItemsIntoDTO[model.Submission, model.Submission](filter)
-	if err != nil {
-		jsonRsp.Code = statuscode.StatusReadItemFailed
-		jsonRsp.Message = err.Error()
-		c.JSON(http.StatusInternalServerError, &jsonRsp)
-		return
-	}
-
-	c.Header("X-Total-Count", fmt.Sprintf("%d", total))
-	jsonRsp.Data = dtos
-	c.JSON(http.StatusOK, &jsonRsp)
+	deprecatedSubmissionRoute(c)
+	listLegacySubmissions(c, db.Where("student_id = ?", c.Param("student_id")).Order("created_at DESC"))
 }
 
 // GetLatestSubmission godoc
 // @Summary      Get latest submission for a student and assignment
-// @Description  Returns the most recent submission for a specific student and assignment.
+// @Description  Deprecated, use GET /assignment-submissions/assignment/{assignment_id}/student/{student_id}. Returns the last attempt.
 // @Tags         Submission
 // @Accept       json
 // @Produce      json
@@ -202,21 +331,49 @@ func GetStudentSubmissions(c *gin.Context) {
 // @Failure      500  {object}  model.JsonDTORsp[model.Submission]
 // @Router       /submissions/latest/{student_id}/{assignment_id} [get]
 // @Security     BearerAuth
+// @Deprecated
 func GetLatestSubmission(c *gin.Context) {
+	deprecatedSubmissionRoute(c)
 	jsonRsp := model.NewJsonDTORsp[model.Submission]()
 
-	studentID := c.Param("student_id")
-	assignmentID := c.Param("assignment_id")
-	filter := fmt.Sprintf("student_id = '%s' AND assignment_id = '%s' ORDER BY created_at DESC LIMIT 1", studentID, assignmentID)
-
-	dtos, _, err := reposity.ReadAllItemsIntoDTO[model.Submission, model.Submission](filter)
-	if err != nil || len(dtos) == 0 {
+	var subs []model.AssignmentSubmission
+	err := db.Where("student_id = ? AND assignment_id = ?", c.Param("student_id"), c.Param("assignment_id")).
+		Order("attempt DESC").Limit(1).Find(&subs).Error
+	if err != nil || len(subs) == 0 {
 		jsonRsp.Code = statuscode.StatusReadItemFailed
 		jsonRsp.Message = "No submission found"
 		c.JSON(http.StatusNotFound, &jsonRsp)
 		return
 	}
+	dtos, err := legacySubmissions(subs)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
 
 	jsonRsp.Data = dtos[0]
 	c.JSON(http.StatusOK, &jsonRsp)
 }
+
+func listLegacySubmissions(c *gin.Context, query *gorm.DB) {
+	jsonRsp := model.NewJsonDTORsp[[]model.Submission]()
+
+	var subs []model.AssignmentSubmission
+	err := query.Find(&subs).Error
+	var dtos []model.Submission
+	if err == nil {
+		dtos, err = legacySubmissions(subs)
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	c.Header("X-Total-Count", fmt.Sprintf("%d", len(dtos)))
+	jsonRsp.Data = dtos
+	c.JSON(http.StatusOK, &jsonRsp)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	dtoMapper "github.com/dranikpg/dto-mapper"
+	"gorm.io/gorm"
+)
+
+// The reposity helpers always run on their own connection. The functions below
+// do the same mapping between DTO and entity but inside a caller's transaction,
+// so several writes can be committed or rolled back together.
+
+// createFromDTO maps the dto to a new entity, inserts it and returns the
+// stored entity with its generated id
+func createFromDTO[M any, E any](tx *gorm.DB, dto M) (E, error) {
+	var item E
+	if err := dtoMapper.Map(&item, dto); err != nil {
+		return item, err
+	}
+	if err := tx.Create(&item).Error; err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+// updateFromDTO patches the entity with the non-empty fields of the dto
+func updateFromDTO[M any, E any](tx *gorm.DB, id string, dto M) (M, error) {
+	var item E
+	if err := tx.Where("id = ?", id).First(&item).Error; err != nil {
+		return dto, err
+	}
+	if err := dtoMapper.Map(&item, dto); err != nil {
+		return dto, err
+	}
+	if err := tx.Model(&item).Where("id = ?", id).Updates(&item).Error; err != nil {
+		return dto, err
+	}
+	if err := dtoMapper.Map(&dto, item); err != nil {
+		return dto, err
+	}
+	return dto, nil
+}
+
+// deleteByID deletes the entity and returns gorm.ErrRecordNotFound when there
+// was nothing to delete
+func deleteByID[E any](tx *gorm.DB, id string) error {
+	var item E
+	result := tx.Where("id = ?", id).Delete(&item)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,573 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"gorm.io/gorm"
+)
+
+// tus 1.0 resumable uploads, https://tus.io/protocols/resumable-upload
+//
+// Supported extensions: creation, expiration and termination. Every PATCH is
+// stored in chunks of at most tus_chunk_size bytes, so a dropped connection
+// loses at most one chunk. Once all bytes arrived the content is checked like
+// UploadFile checks it and the chunks are joined into an object named the same
+// way, the upload is rejected when the content does not match the extension.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+// TusAllowHeaders and TusExposeHeaders are the request and response headers
+// browsers have to be allowed to use across origins
+var (
+	TusAllowHeaders  = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"}
+	TusExposeHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Expires", "X-File-Name", "X-File-Path"}
+)
+
+var (
+	errTusOffsetMoved = errors.New("upload offset moved concurrently")
+	errTusRejected    = errors.New("upload rejected")
+)
+
+// tusRequest checks the protocol version and sets the headers of every
+// response, it answers the request itself when the version is not supported
+func tusRequest(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.String(http.StatusPreconditionFailed, "unsupported tus version, expected Tus-Resumable: "+tusVersion)
+		return false
+	}
+	if fileStorage == nil {
+		c.String(http.StatusServiceUnavailable, "file storage is not available")
+		return false
+	}
+	return true
+}
+
+// tusUpload loads the upload addressed by the request for its owner
+func tusUpload(c *gin.Context) (model.ResumableUpload, Caller, bool) {
+	var upload model.ResumableUpload
+	caller, err := currentCaller(c)
+	if err != nil {
+		c.String(http.StatusUnauthorized, err.Error())
+		return upload, caller, false
+	}
+	if err := db.Where("id = ?", c.Param("id")).Take(&upload).Error; err != nil {
+		c.String(http.StatusNotFound, "upload not found")
+		return upload, caller, false
+	}
+	if upload.UserID != caller.ID && !caller.IsAdmin() {
+		c.String(http.StatusForbidden, "upload belongs to another user")
+		return upload, caller, false
+	}
+	switch {
+	case upload.Status == model.ResumableUploadStatusTerminated:
+		c.String(http.StatusNotFound, "upload not found")
+		return upload, caller, false
+	case upload.Status == model.ResumableUploadStatusRejected:
+		c.String(http.StatusGone, "upload rejected, the content does not match the file type")
+		return upload, caller, false
+	case upload.Status == model.ResumableUploadStatusExpired,
+		upload.Status == model.ResumableUploadStatusUploading && time.Now().After(upload.ExpiresAt):
+		c.String(http.StatusGone, "upload expired")
+		return upload, caller, false
+	}
+	return upload, caller, true
+}
+
+// newTusChunkKey names the object of a chunk stored at offset, unique so a
+// PATCH losing the race for the offset only deletes its own object
+func newTusChunkKey(upload model.ResumableUpload, offset int64) string {
+	return fmt.Sprintf("tus/%s/%020d-%s", upload.ID, offset, uuid.New())
+}
+
+// tusChunkKey is the object of a stored chunk
+func tusChunkKey(upload model.ResumableUpload, chunk model.ResumableUploadChunk) string {
+	if chunk.Key != "" {
+		return chunk.Key
+	}
+	return fmt.Sprintf("tus/%s/%020d", upload.ID, chunk.Offset)
+}
+
+func tusSetUploadHeaders(c *gin.Context, upload model.ResumableUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Status == model.ResumableUploadStatusCompleted {
+		c.Header("X-File-Name", upload.Key)
+		c.Header("X-File-Path", fileStorage.URL(upload.Key))
+	} else {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma separated "key base64value"
+// pairs, the value may be omitted
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value of %s", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// TusOptions godoc
+// @Summary      Describe the tus server
+// @Description  Returns the supported tus version, extensions and maximum upload size.
+// @Tags         tus
+// @Success      204
+// @Router       /tus [options]
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(cfg.GetInt64("tus_max_size"), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload godoc
+// @Summary      Create a resumable upload
+// @Description  tus creation extension. Requires Upload-Length and the filename in Upload-Metadata, the file types and size limits of POST /upload apply.
+// @Description  Answers 429 when the user already has tus_max_concurrent uploads in progress. Finished videos are queued for transcoding, POST /videos with the file URL returns their asset.
+// @Tags         tus
+// @Param        Tus-Resumable    header  string  true   "1.0.0"
+// @Param        Upload-Length    header  int     true   "Size of the file in bytes"
+// @Param        Upload-Metadata  header  string  true   "filename and optionally filetype and purpose (image or avatar, for images), base64 encoded"
+// @Success      201
+// @Failure      400
+// @Failure      412
+// @Failure      413
+// @Failure      429
+// @Router       /tus [post]
+// @Security     BearerAuth
+func CreateTusUpload(c *gin.Context) {
+	if !tusRequest(c) {
+		return
+	}
+	caller, err := currentCaller(c)
+	if err != nil {
+		c.String(http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.String(http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.String(http.StatusBadRequest, "invalid Upload-Length")
+		return
+	}
+	if maxSize := cfg.GetInt64("tus_max_size"); maxSize > 0 && length > maxSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload-Length exceeds Tus-Max-Size %d", maxSize))
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	fileName := uploadFileName(metadata["filename"])
+	t, valid := uploadTypeOf(fileName)
+	if !valid {
+		c.String(http.StatusBadRequest, "filename metadata with a JPG, PNG, MP4, PDF, DOC, DOCX, XLS or XLSX file is required")
+		return
+	}
+	if err := t.checkSize(length); err != nil {
+		c.String(http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if purpose, ok := metadata["purpose"]; ok && t.category == "images" && !validImagePurpose(purpose) {
+		c.String(http.StatusBadRequest, "purpose metadata must be image or avatar")
+		return
+	}
+
+	upload := model.ResumableUpload{
+		ID:          uuid.New(),
+		UserID:      caller.ID,
+		FileName:    fileName,
+		ContentType: t.contentType,
+		Key:         uploadObjectName(t, fileName),
+		Length:      length,
+		Metadata:    c.GetHeader("Upload-Metadata"),
+		Status:      model.ResumableUploadStatusUploading,
+		ExpiresAt:   time.Now().Add(cfg.GetDuration("tus_expiry")),
+	}
+	limit := cfg.GetInt64("tus_max_concurrent")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Serializes the creations of one user so the limit holds
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "tus:"+caller.ID.String()).Error; err != nil {
+			return err
+		}
+		var active int64
+		err := tx.Model(&model.ResumableUpload{}).
+			Where("user_id = ? AND status = ? AND expires_at > now()", caller.ID, model.ResumableUploadStatusUploading).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if limit > 0 && active >= limit {
+			return errTusTooManyUploads
+		}
+		return tx.Create(&upload).Error
+	})
+	if errors.Is(err, errTusTooManyUploads) {
+		c.String(http.StatusTooManyRequests, fmt.Sprintf("at most %d uploads may be in progress, finish or terminate one first", limit))
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if length == 0 {
+		if err := finishTusUpload(c.Request.Context(), &upload); err != nil {
+			c.String(tusFinishStatus(err), err.Error())
+			return
+		}
+	}
+
+	c.Header("Location", path.Join(cfg.GetString("service_path"), "tus", upload.ID.String()))
+	tusSetUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+var errTusTooManyUploads = errors.New("too many uploads in progress")
+
+// GetTusUploadOffset godoc
+// @Summary      Get the offset of a resumable upload
+// @Description  tus HEAD request, Upload-Offset tells where to resume. Completed uploads also return X-File-Name and X-File-Path.
+// @Tags         tus
+// @Param        Tus-Resumable  header  string  true  "1.0.0"
+// @Param        id             path    string  true  "Upload ID"
+// @Success      200
+// @Failure      404
+// @Failure      410
+// @Router       /tus/{id} [head]
+// @Security     BearerAuth
+func GetTusUploadOffset(c *gin.Context) {
+	if !tusRequest(c) {
+		return
+	}
+	upload, _, ok := tusUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	tusSetUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload godoc
+// @Summary      Append to a resumable upload
+// @Description  tus PATCH request. The body is stored from Upload-Offset on, the upload is finalised when all bytes arrived.
+// @Description  Answers 415 and rejects the upload when the content of the completed file does not match its extension.
+// @Tags         tus
+// @Accept       application/offset+octet-stream
+// @Param        Tus-Resumable  header  string  true  "1.0.0"
+// @Param        Upload-Offset  header  int     true  "Offset of the first byte of the body"
+// @Param        id             path    string  true  "Upload ID"
+// @Success      204
+// @Failure      404
+// @Failure      409
+// @Failure      410
+// @Failure      415
+// @Router       /tus/{id} [patch]
+// @Security     BearerAuth
+func PatchTusUpload(c *gin.Context) {
+	if !tusRequest(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.String(http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	upload, _, ok := tusUpload(c)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.String(http.StatusConflict, "Upload-Offset does not match the offset of the upload")
+		return
+	}
+	if upload.Status == model.ResumableUploadStatusCompleted {
+		tusSetUploadHeaders(c, upload)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	ctx := c.Request.Context()
+	body := io.LimitReader(c.Request.Body, upload.Length-upload.Offset)
+	buf := make([]byte, max(cfg.GetInt64("tus_chunk_size"), 1))
+	for upload.Offset < upload.Length {
+		n, readErr := io.ReadFull(body, buf)
+		if n > 0 {
+			if err := storeTusChunk(ctx, &upload, buf[:n]); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, errTusOffsetMoved) {
+					status = http.StatusConflict
+				}
+				c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+				c.String(status, err.Error())
+				return
+			}
+		}
+		if readErr != nil {
+			// End of the body, or the connection dropped and the client
+			// resumes from the stored offset
+			break
+		}
+	}
+
+	if upload.Offset == upload.Length {
+		if err := finishTusUpload(ctx, &upload); err != nil {
+			c.String(tusFinishStatus(err), err.Error())
+			return
+		}
+	}
+	tusSetUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// storeTusChunk stores data at the offset of the upload and moves the offset,
+// a concurrent PATCH that moved it first wins
+func storeTusChunk(ctx context.Context, upload *model.ResumableUpload, data []byte) error {
+	key := newTusChunkKey(*upload, upload.Offset)
+	if _, err := fileStorage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), storage.PutOptions{ContentType: "application/octet-stream"}); err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	expires := time.Now().Add(cfg.GetDuration("tus_expiry"))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(upload).Where("\"offset\" = ? AND status = ?", upload.Offset, model.ResumableUploadStatusUploading).
+			Updates(map[string]interface{}{"offset": upload.Offset + size, "expires_at": expires})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTusOffsetMoved
+		}
+		return tx.Create(&model.ResumableUploadChunk{UploadID: upload.ID, Offset: upload.Offset, Size: size, Key: key}).Error
+	})
+	if err != nil {
+		fileStorage.Delete(ctx, key)
+		return err
+	}
+	upload.Offset += size
+	upload.ExpiresAt = expires
+	return nil
+}
+
+// finishTusUpload checks the content and joins the chunks into the final
+// object, the chunks are dropped either way once the content was checked
+func finishTusUpload(ctx context.Context, upload *model.ResumableUpload) error {
+	var chunks []model.ResumableUploadChunk
+	if err := db.Where("upload_id = ?", upload.ID).Order("\"offset\"").Find(&chunks).Error; err != nil {
+		return err
+	}
+	r := &tusChunkReader{ctx: ctx, upload: *upload, chunks: chunks}
+	defer r.Close()
+	head, body, err := readUploadHead(r)
+	if err != nil {
+		return fmt.Errorf("could not read the chunks - %s", err)
+	}
+	t, _ := uploadTypeOf(upload.FileName)
+	if err := t.checkContent(head); err != nil {
+		if dropErr := dropTusUpload(ctx, *upload, model.ResumableUploadStatusRejected); dropErr != nil {
+			return dropErr
+		}
+		upload.Status = model.ResumableUploadStatusRejected
+		return fmt.Errorf("%w - %s", errTusRejected, err)
+	}
+	opts := storage.PutOptions{ContentType: upload.ContentType, FileName: upload.FileName}
+	if _, err := fileStorage.Put(ctx, upload.Key, body, upload.Length, opts); err != nil {
+		return fmt.Errorf("could not join the chunks - %s", err)
+	}
+	if err := queueScan(db, upload.Key, upload.UserID, upload.FileName); err != nil {
+		return err
+	}
+	switch t.category {
+	case "images":
+		if err := queueImage(db, upload.Key, tusImagePurpose(upload.Metadata)); err != nil {
+			return err
+		}
+	case "videos":
+		if _, err := queueVideo(db, upload.Key, upload.UserID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	err = db.Model(upload).Updates(map[string]interface{}{
+		"status":       model.ResumableUploadStatusCompleted,
+		"completed_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	upload.Status, upload.CompletedAt = model.ResumableUploadStatusCompleted, &now
+	dropTusChunks(ctx, *upload, chunks)
+	return nil
+}
+
+// tusImagePurpose returns the purpose of an uploaded image from its
+// Upload-Metadata, image when none was given
+func tusImagePurpose(header string) string {
+	metadata, _ := parseTusMetadata(header)
+	if purpose := metadata["purpose"]; validImagePurpose(purpose) {
+		return purpose
+	}
+	return model.ImagePurposeImage
+}
+
+// tusFinishStatus is the response status of a failed finishTusUpload
+func tusFinishStatus(err error) int {
+	if errors.Is(err, errTusRejected) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+// dropTusChunks deletes the stored chunks, failures leave orphans behind
+// that do not affect the upload
+func dropTusChunks(ctx context.Context, upload model.ResumableUpload, chunks []model.ResumableUploadChunk) {
+	for _, chunk := range chunks {
+		fileStorage.Delete(ctx, tusChunkKey(upload, chunk))
+	}
+	db.Where("upload_id = ?", upload.ID).Delete(&model.ResumableUploadChunk{})
+}
+
+// tusChunkReader reads the chunks of an upload one after the other
+type tusChunkReader struct {
+	ctx     context.Context
+	upload  model.ResumableUpload
+	chunks  []model.ResumableUploadChunk
+	current io.ReadCloser
+}
+
+func (r *tusChunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			chunk, _, err := fileStorage.Get(r.ctx, tusChunkKey(r.upload, r.chunks[0]))
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.chunks = chunk, r.chunks[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *tusChunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// TerminateTusUpload godoc
+// @Summary      Terminate a resumable upload
+// @Description  tus termination extension, the received bytes are dropped.
+// @Tags         tus
+// @Param        Tus-Resumable  header  string  true  "1.0.0"
+// @Param        id             path    string  true  "Upload ID"
+// @Success      204
+// @Failure      404
+// @Failure      410
+// @Router       /tus/{id} [delete]
+// @Security     BearerAuth
+func TerminateTusUpload(c *gin.Context) {
+	if !tusRequest(c) {
+		return
+	}
+	upload, _, ok := tusUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Status == model.ResumableUploadStatusUploading {
+		if err := dropTusUpload(c.Request.Context(), upload, model.ResumableUploadStatusTerminated); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else {
+		db.Model(&upload).Update("status", model.ResumableUploadStatusTerminated)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// dropTusUpload marks an upload in progress with status and drops its chunks
+func dropTusUpload(ctx context.Context, upload model.ResumableUpload, status string) error {
+	result := db.Model(&upload).Where("status = ?", model.ResumableUploadStatusUploading).Update("status", status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	var chunks []model.ResumableUploadChunk
+	if err := db.Where("upload_id = ?", upload.ID).Find(&chunks).Error; err != nil {
+		return err
+	}
+	dropTusChunks(ctx, upload, chunks)
+	return nil
+}
+
+// ExpireTusUploads drops the resumable uploads left unfinished past their
+// expiry and returns how many were dropped
+func ExpireTusUploads(ctx context.Context, limit int) (int, error) {
+	if fileStorage == nil {
+		return 0, nil
+	}
+	var uploads []model.ResumableUpload
+	err := db.WithContext(ctx).Where("status = ? AND expires_at < ?", model.ResumableUploadStatusUploading, time.Now()).
+		Order("expires_at").Limit(limit).Find(&uploads).Error
+	if err != nil {
+		return 0, err
+	}
+	for i, upload := range uploads {
+		if err := dropTusUpload(ctx, upload, model.ResumableUploadStatusExpired); err != nil {
+			return i, err
+		}
+	}
+	return len(uploads), nil
+}
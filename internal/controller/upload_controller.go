@@ -0,0 +1,506 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+var errUploadForbidden = errors.New("not allowed to attach files to this resource")
+
+// uploadParentQueries return the course of the row an upload is attached to
+// and the user allowed to attach files besides admins
+var uploadParentQueries = map[string]string{
+	model.UploadKindCourseDocument: `SELECT id AS course_id, instructor_id AS owner_id FROM course WHERE id = ?`,
+	model.UploadKindAssignmentDocument: `SELECT c.id AS course_id, c.instructor_id AS owner_id
+		FROM assignment a JOIN course c ON c.id = a.course_id WHERE a.id = ?`,
+	model.UploadKindSubmissionFile: `SELECT a.course_id, s.student_id AS owner_id
+		FROM assignment_submission s JOIN assignment a ON a.id = s.assignment_id WHERE s.id = ?`,
+}
+
+// uploadParent checks that the caller may attach a file of kind to parentID
+// and returns the course of the parent
+func uploadParent(tx *gorm.DB, caller Caller, kind string, parentID uuid.UUID) (uuid.UUID, error) {
+	var parent struct {
+		CourseID uuid.UUID
+		OwnerID  uuid.UUID
+	}
+	result := tx.Raw(uploadParentQueries[kind], parentID).Scan(&parent)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, gorm.ErrRecordNotFound
+	}
+	if !caller.IsAdmin() && parent.OwnerID != caller.ID {
+		return uuid.Nil, errUploadForbidden
+	}
+	return parent.CourseID, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// uploadKey scopes the object of an upload to its parent and upload id
+func uploadKey(upload model.Upload) string {
+	name := unsafeFileNameChars.ReplaceAllString(filepath.Base(upload.FileName), "_")
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+	return fmt.Sprintf("uploads/%s/%s/%s/%s", upload.Kind, upload.ParentID, upload.ID, name)
+}
+
+// uploadPartSize keeps parts above the S3 minimum and below its part count
+func uploadPartSize(size int64) int64 {
+	partSize := max(cfg.GetInt64("upload_part_size"), storage.MinPartSize)
+	return max(partSize, (size+storage.MaxParts-1)/storage.MaxParts)
+}
+
+// InitiateUpload godoc
+// @Summary      Start a direct upload to the file storage
+// @Description  Returns a presigned PUT URL, or one URL per part for large files, scoped to a generated object key.
+// @Description  The file becomes a course document, assignment document or submission file once POST /uploads/complete succeeds.
+// @Description  Uploads that are not completed before expires_at are dropped. The file types and size limits of POST /upload apply,
+// @Description  the content type follows the file extension.
+// @Tags         Upload
+// @Accept       json
+// @Produce      json
+// @Param        upload  body  model.InitiateUpload  true  "Upload JSON"
+// @Success      201  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      400  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      401  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      403  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      404  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      413  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      500  {object}  model.JsonDTORsp[model.UploadSession]
+// @Failure      503  {object}  model.JsonDTORsp[model.UploadSession]
+// @Router       /uploads/initiate [post]
+// @Security     BearerAuth
+func InitiateUpload(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.UploadSession]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, &jsonRsp)
+		return
+	}
+
+	var dto model.InitiateUpload
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	fileName := uploadFileName(dto.FileName)
+	t, valid := uploadTypeOf(fileName)
+	if !valid {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = errUploadType.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	if err := t.checkSize(dto.Size); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusRequestEntityTooLarge, &jsonRsp)
+		return
+	}
+
+	uploader, ok := fileStorage.(storage.Uploader)
+	if !ok {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = "file storage does not accept direct uploads"
+		c.JSON(http.StatusServiceUnavailable, &jsonRsp)
+		return
+	}
+
+	_, err = uploadParent(db, caller, dto.Kind, dto.ParentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = fmt.Sprintf("%s parent %s not found", dto.Kind, dto.ParentID)
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+	if errors.Is(err, errUploadForbidden) {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	expiry := cfg.GetDuration("upload_expiry")
+	upload := model.Upload{
+		ID:             uuid.New(),
+		UploaderID:     caller.ID,
+		Kind:           dto.Kind,
+		ParentID:       dto.ParentID,
+		FileName:       fileName,
+		ContentType:    t.contentType,
+		Size:           dto.Size,
+		ChecksumSHA256: strings.ToLower(dto.ChecksumSHA256),
+		Title:          dto.Title,
+		Description:    dto.Description,
+		Status:         model.UploadStatusPending,
+		ExpiresAt:      time.Now().Add(expiry),
+	}
+	upload.Key = uploadKey(upload)
+	session := model.UploadSession{ID: upload.ID, Key: upload.Key, Method: http.MethodPut, ExpiresAt: upload.ExpiresAt}
+
+	ctx := c.Request.Context()
+	multipart, ok := uploader.(storage.MultipartUploader)
+	if ok && dto.Size > cfg.GetInt64("upload_multipart_threshold") {
+		upload.PartSize = uploadPartSize(dto.Size)
+		uploadID, err := multipart.CreateMultipart(ctx, upload.Key, upload.ContentType)
+		if err == nil {
+			upload.MultipartID = &uploadID
+			session.PartSize = upload.PartSize
+			for n, offset := 1, int64(0); offset < dto.Size && err == nil; n, offset = n+1, offset+upload.PartSize {
+				part := model.UploadPartURL{Number: n, Size: min(upload.PartSize, dto.Size-offset)}
+				part.URL, err = multipart.SignedPartURL(ctx, upload.Key, uploadID, n, expiry)
+				session.Parts = append(session.Parts, part)
+			}
+		}
+		if err != nil {
+			if upload.MultipartID != nil {
+				multipart.AbortMultipart(ctx, upload.Key, *upload.MultipartID)
+			}
+			jsonRsp.Code = statuscode.StatusServerError
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+			return
+		}
+	} else {
+		session.URL, err = uploader.SignedPutURL(ctx, upload.Key, expiry)
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusServerError
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+			return
+		}
+	}
+
+	if err := db.Create(&upload).Error; err != nil {
+		if upload.MultipartID != nil {
+			multipart.AbortMultipart(ctx, upload.Key, *upload.MultipartID)
+		}
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = session
+	c.JSON(http.StatusCreated, &jsonRsp)
+}
+
+// CompleteUpload godoc
+// @Summary      Complete a direct upload
+// @Description  Checks that the object was stored with the announced size and SHA-256 checksum and that its content matches
+// @Description  the file extension, then creates the
+// @Description  course document, assignment document or submission file in the same transaction that completes the upload.
+// @Description  A mismatching object is deleted and the upload fails, completing an upload twice returns the same result.
+// @Tags         Upload
+// @Accept       json
+// @Produce      json
+// @Param        upload  body  model.CompleteUpload  true  "Upload id"
+// @Success      200  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      400  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      401  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      403  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      404  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      409  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      410  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      422  {object}  model.JsonDTORsp[model.Upload]
+// @Failure      500  {object}  model.JsonDTORsp[model.Upload]
+// @Router       /uploads/complete [post]
+// @Security     BearerAuth
+func CompleteUpload(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.Upload]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, &jsonRsp)
+		return
+	}
+
+	var dto model.CompleteUpload
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+
+	var upload model.Upload
+	if err := db.Where("id = ?", dto.UploadID).Take(&upload).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+	if upload.UploaderID != caller.ID && !caller.IsAdmin() {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "upload belongs to another user"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+	switch {
+	case upload.Status == model.UploadStatusCompleted:
+		jsonRsp.Data = upload
+		c.JSON(http.StatusOK, &jsonRsp)
+		return
+	case upload.Status != model.UploadStatusPending:
+		jsonRsp.Code = statuscode.StatusGone
+		jsonRsp.Message = fmt.Sprintf("upload is %s, start a new one", upload.Status)
+		c.JSON(http.StatusGone, &jsonRsp)
+		return
+	case time.Now().After(upload.ExpiresAt):
+		jsonRsp.Code = statuscode.StatusGone
+		jsonRsp.Message = "upload is expired, start a new one"
+		c.JSON(http.StatusGone, &jsonRsp)
+		return
+	}
+	if fileStorage == nil {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = "file storage is not available"
+		c.JSON(http.StatusServiceUnavailable, &jsonRsp)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if upload.MultipartID != nil {
+		multipart, ok := fileStorage.(storage.MultipartUploader)
+		if !ok {
+			err = errors.New("file storage does not accept multipart uploads")
+		} else {
+			err = multipart.CompleteMultipart(ctx, upload.Key, *upload.MultipartID)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			jsonRsp.Code = statuscode.StatusConflict
+			jsonRsp.Message = "no part of the upload was received yet"
+			c.JSON(http.StatusConflict, &jsonRsp)
+			return
+		}
+		if err == nil {
+			// The parts are now one object, retries and expiry handle it as such
+			err = db.Model(&upload).Update("multipart_id", nil).Error
+		}
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusServerError
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+			return
+		}
+	}
+
+	mismatch, err := verifyUpload(ctx, upload)
+	if errors.Is(err, storage.ErrNotFound) {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = "the file was not uploaded yet"
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if mismatch != "" {
+		fileStorage.Delete(ctx, upload.Key)
+		db.Model(&upload).Where("status = ?", model.UploadStatusPending).Update("status", model.UploadStatusFailed)
+		jsonRsp.Code = statuscode.StatusUnprocessableEntity
+		jsonRsp.Message = mismatch
+		c.JSON(http.StatusUnprocessableEntity, &jsonRsp)
+		return
+	}
+
+	var courseID uuid.UUID
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if courseID, err = uploadParent(tx, caller, upload.Kind, upload.ParentID); err != nil {
+			return err
+		}
+		resultID, err := createUploadResult(tx, upload)
+		if err != nil {
+			return err
+		}
+		if err := queueScan(tx, upload.Key, upload.UploaderID, upload.FileName); err != nil {
+			return err
+		}
+		now := time.Now()
+		result := tx.Model(&upload).Where("status = ?", model.UploadStatusPending).Updates(map[string]interface{}{
+			"status":       model.UploadStatusCompleted,
+			"completed_at": now,
+			"result_id":    resultID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errUploadNotPending
+		}
+		upload.Status, upload.CompletedAt, upload.ResultID = model.UploadStatusCompleted, &now, &resultID
+		return nil
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = fmt.Sprintf("%s parent %s no longer exists", upload.Kind, upload.ParentID)
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	case errors.Is(err, errUploadForbidden):
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	case errors.Is(err, errUploadNotPending):
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	case err != nil:
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	if upload.Kind == model.UploadKindCourseDocument {
+		cacheStore.Invalidate(ctx, courseDocumentsTag(courseID.String()))
+	}
+
+	jsonRsp.Data = upload
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+var errUploadNotPending = errors.New("upload was completed or expired concurrently")
+
+// verifyUpload reads the stored object back and describes how it differs from
+// what the client announced, "" when it matches
+func verifyUpload(ctx context.Context, upload model.Upload) (string, error) {
+	info, err := fileStorage.Stat(ctx, upload.Key)
+	if err != nil {
+		return "", err
+	}
+	if info.Size != upload.Size {
+		return fmt.Sprintf("stored file has %d bytes, %d were announced", info.Size, upload.Size), nil
+	}
+
+	r, _, err := fileStorage.Get(ctx, upload.Key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	head, body, err := readUploadHead(r)
+	if err != nil {
+		return "", err
+	}
+	t, _ := uploadTypeOf(upload.FileName)
+	if err := t.checkContent(head); err != nil {
+		return err.Error(), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != upload.ChecksumSHA256 {
+		return fmt.Sprintf("stored file has SHA-256 %s, %s was announced", sum, upload.ChecksumSHA256), nil
+	}
+	return "", nil
+}
+
+// createUploadResult creates the row the upload becomes and returns its id
+func createUploadResult(tx *gorm.DB, upload model.Upload) (uuid.UUID, error) {
+	url := fileStorage.URL(upload.Key)
+	title := upload.FileName
+	if upload.Title != nil && *upload.Title != "" {
+		title = *upload.Title
+	}
+
+	var row interface{}
+	id := uuid.New()
+	switch upload.Kind {
+	case model.UploadKindCourseDocument:
+		row = &model.CourseDocument{
+			ID: id, CourseID: upload.ParentID, Title: title, Description: upload.Description,
+			FileName: upload.FileName, FilePath: url, FileSize: &upload.Size, FileType: &upload.ContentType,
+			UploadedBy: upload.UploaderID,
+		}
+	case model.UploadKindAssignmentDocument:
+		row = &model.AssignmentDocument{
+			ID: id, AssignmentID: upload.ParentID, Title: title, Description: upload.Description,
+			FileName: upload.FileName, FilePath: url, FileSize: &upload.Size, FileType: &upload.ContentType,
+			UploadedBy: upload.UploaderID,
+		}
+	case model.UploadKindSubmissionFile:
+		row = &model.AssignmentSubmissionFile{
+			ID: id, SubmissionID: &upload.ParentID,
+			FileName: upload.FileName, FilePath: url, FileSize: &upload.Size, FileType: &upload.ContentType,
+		}
+	default:
+		return uuid.Nil, fmt.Errorf("unknown upload kind %s", upload.Kind)
+	}
+	return id, tx.Create(row).Error
+}
+
+// ExpireUploads drops the uploads left pending past their expiry together with
+// their object and returns how many were dropped
+func ExpireUploads(ctx context.Context, limit int) (int, error) {
+	if fileStorage == nil {
+		return 0, nil
+	}
+	var uploads []model.Upload
+	err := db.WithContext(ctx).Where("status = ? AND expires_at < ?", model.UploadStatusPending, time.Now()).
+		Order("expires_at").Limit(limit).Find(&uploads).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, upload := range uploads {
+		result := db.WithContext(ctx).Model(&upload).Where("status = ?", model.UploadStatusPending).
+			Update("status", model.UploadStatusExpired)
+		if result.Error != nil {
+			return expired, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if multipart, ok := fileStorage.(storage.MultipartUploader); ok && upload.MultipartID != nil {
+			err = multipart.AbortMultipart(ctx, upload.Key, *upload.MultipartID)
+		} else {
+			err = fileStorage.Delete(ctx, upload.Key)
+		}
+		if err != nil {
+			return expired, fmt.Errorf("could not drop the object of upload %s - %s", upload.ID, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
@@ -22,6 +22,7 @@ import (
 // @Param        user  body  model.CreateUser  true  "User JSON"
 // @Success      200  {object}  model.JsonDTORsp[model.CreateUser]
 // @Failure      400  {object}  model.JsonDTORsp[model.CreateUser]
+// @Failure      409  {object}  model.JsonDTORsp[model.CreateUser]
 // @Failure      500  {object}  model.JsonDTORsp[model.CreateUser]
 // @Router       /users [post]
 // @Security     BearerAuth
@@ -44,12 +45,19 @@ func CreateUser(c *gin.Context) {
 	}
 	dto.Password = string(hashedPassword)
 	dto, err = reposity.CreateItemFromDTO[model.CreateUser, model.User](dto)
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusCreateItemFailed
 		jsonRsp.Message = err.Error()
 		c.JSON(http.StatusInternalServerError, &jsonRsp)
 		return
 	}
+	linkImage(c.Request.Context(), userProfilePicture, &dto.ProfilePictureURL)
 
 	jsonRsp.Data = dto
 	c.JSON(http.StatusCreated, &jsonRsp)
@@ -124,6 +132,7 @@ func Get(c *gin.Context) {
 // @Success      200  {object}  model.JsonDTORsp[model.UpdateUser]
 // @Failure      400  {object}  model.JsonDTORsp[model.UpdateUser]
 // @Failure      404  {object}  model.JsonDTORsp[model.UpdateUser]
+// @Failure      409  {object}  model.JsonDTORsp[model.UpdateUser]
 // @Failure      500  {object}  model.JsonDTORsp[model.UpdateUser]
 // @Router       /users/{id} [put]
 // @Security     BearerAuth
@@ -137,8 +146,15 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, &jsonRsp)
 		return
 	}
+	dto.ProfilePictureVariants = nil // set from the picture below
 
 	dto, err := reposity.UpdateItemByIDFromDTO[model.UpdateUser, model.User](c.Param("id"), dto)
+	if conflict, ok := conflictError(err); ok {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = conflict.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
 	if err != nil {
 		jsonRsp.Code = statuscode.StatusUpdateItemFailed
 		jsonRsp.Message = err.Error()
@@ -146,6 +162,10 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if dto.ProfilePictureURL != "" {
+		dto.ProfilePictureVariants = linkImage(c.Request.Context(), userProfilePicture, &dto.ProfilePictureURL)
+	}
+
 	jsonRsp.Data = dto
 	c.JSON(http.StatusOK, &jsonRsp)
 }
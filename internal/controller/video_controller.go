@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// canViewVideo reports whether the caller uploaded the video, or teaches or
+// is enrolled in a course with a lesson showing it. Admins see every video.
+func canViewVideo(tx *gorm.DB, caller Caller, asset model.VideoAsset) (bool, error) {
+	if caller.IsAdmin() || asset.UploaderID == caller.ID {
+		return true, nil
+	}
+	var found int64
+	err := tx.Raw(`SELECT count(*) FROM lesson l JOIN course c ON c.id = l.course_id
+		WHERE l.video_asset_id = @asset
+			AND (c.instructor_id = @user_id OR EXISTS (
+				SELECT 1 FROM course_enrollment e
+				WHERE e.course_id = c.id AND e.student_id = @user_id AND e.status <> 'dropped'))`,
+		map[string]interface{}{"asset": asset.ID, "user_id": caller.ID}).Scan(&found).Error
+	return found > 0, err
+}
+
+// canEditVideo reports whether the caller uploaded the video or teaches a
+// course with a lesson showing it. Admins edit every video.
+func canEditVideo(tx *gorm.DB, caller Caller, asset model.VideoAsset) (bool, error) {
+	if caller.IsAdmin() || asset.UploaderID == caller.ID {
+		return true, nil
+	}
+	var found int64
+	err := tx.Raw(`SELECT count(*) FROM lesson l JOIN course c ON c.id = l.course_id
+		WHERE l.video_asset_id = ? AND c.instructor_id = ?`, asset.ID, caller.ID).Scan(&found).Error
+	return found > 0, err
+}
+
+// authorizeVideo answers the request and returns false unless the caller may
+// watch the video, or edit it with edit
+func authorizeVideo[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T], caller Caller, asset model.VideoAsset, edit bool) bool {
+	check, message := canViewVideo, "video belongs to a course you are not part of"
+	if edit {
+		check, message = canEditVideo, "only the uploader and the teachers of the video can change it"
+	}
+	allowed, err := check(db, caller, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return false
+	}
+	if !allowed {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = message
+		c.JSON(http.StatusForbidden, jsonRsp)
+		return false
+	}
+	return true
+}
+
+// checkVideoAsset reports whether the video asset a lesson points at exists
+func checkVideoAsset(tx *gorm.DB, id *uuid.UUID) error {
+	if id == nil {
+		return nil
+	}
+	var found int64
+	if err := tx.Model(&model.VideoAsset{}).Where("id = ?", *id).Count(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return errVideoAssetNotFound
+	}
+	return nil
+}
+
+var errVideoAssetNotFound = errors.New("video asset does not exist")
+
+// CreateVideoAsset godoc
+// @Summary      Transcode an uploaded video
+// @Description  Queues the transcoding of a video already in the file storage to HLS, for videos uploaded another way than POST /upload or /tus which queue it themselves.
+// @Description  Teachers can only add the files they uploaded, admins any video. Returns the existing asset when the video was queued before
+// @Description  and the caller may see it. Set the asset on a lesson with video_asset_id.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        video  body  model.CreateVideoAsset  true  "Uploaded video"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Success      201  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Router       /videos [post]
+// @Security     BearerAuth
+func CreateVideoAsset(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoAsset]()
+
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, &jsonRsp)
+		return
+	}
+	if caller.Role != "teacher" && !caller.IsAdmin() {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "only teachers and admins can add videos"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	var dto model.CreateVideoAsset
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	if fileStorage == nil {
+		jsonRsp.Code = statuscode.StatusServerError
+		jsonRsp.Message = "file storage is not available"
+		c.JSON(http.StatusServiceUnavailable, &jsonRsp)
+		return
+	}
+	key, ok := fileStorage.Key(dto.FileURL)
+	if !ok {
+		key = dto.FileURL
+	}
+	if t, ok := uploadTypeOf(key); !ok || t.category != "videos" || strings.HasPrefix(key, quarantinePrefix) {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = "file_url must point at an uploaded MP4 video"
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	if _, err := fileStorage.Stat(c.Request.Context(), key); err != nil {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, &jsonRsp)
+		return
+	}
+
+	var existing model.VideoAsset
+	if err := db.Where("key = ?", key).Limit(1).Find(&existing).Error; err != nil {
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if existing.ID != uuid.Nil {
+		if !authorizeVideo(c, jsonRsp, caller, existing, false) {
+			return
+		}
+		jsonRsp.Data = existing
+		c.JSON(http.StatusOK, &jsonRsp)
+		return
+	}
+	// The scan of the upload records its uploader, other files are only
+	// added by admins
+	if !caller.IsAdmin() {
+		var uploaded int64
+		err := db.Model(&model.FileScan{}).Where("key = ? AND uploader_id = ?", key, caller.ID).Count(&uploaded).Error
+		if err != nil {
+			jsonRsp.Code = statuscode.StatusCreateItemFailed
+			jsonRsp.Message = err.Error()
+			c.JSON(http.StatusInternalServerError, &jsonRsp)
+			return
+		}
+		if uploaded == 0 {
+			jsonRsp.Code = statuscode.StatusForbidden
+			jsonRsp.Message = "only the uploader of the file and admins can add it as a video"
+			c.JSON(http.StatusForbidden, &jsonRsp)
+			return
+		}
+	}
+	asset, err := queueVideo(db, key, caller.ID)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusCreateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = asset
+	c.JSON(http.StatusCreated, &jsonRsp)
+}
+
+// GetVideoAsset godoc
+// @Summary      Get the transcoding of a video
+// @Description  Returns the status (queued, processing, ready or failed) and progress of the transcoding, and the playlists once the video is ready.
+// @Description  Visible to the uploader, admins and the teachers and students of courses with a lesson showing the video.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Video asset ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Router       /videos/{id} [get]
+// @Security     BearerAuth
+func GetVideoAsset(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoAsset]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	allowed, err := canViewVideo(db, caller, asset)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if !allowed {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "video belongs to a course you are not part of"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = asset
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// RetryVideoAsset godoc
+// @Summary      Transcode a failed video again
+// @Description  Queues a video whose transcoding failed video_max_attempts times for another round of attempts. Only the uploader and admins can retry.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "Video asset ID"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      409  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Router       /videos/{id}/retry [post]
+// @Security     BearerAuth
+func RetryVideoAsset(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoAsset]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	if asset.UploaderID != caller.ID && !caller.IsAdmin() {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "video belongs to another user"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	result := db.Model(&asset).Where("status = ?", model.VideoStatusFailed).Updates(map[string]interface{}{
+		"status": model.VideoStatusQueued, "attempts": 0, "progress": 0, "processed_at": nil,
+	})
+	if result.Error != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = result.Error.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if result.RowsAffected == 0 {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = "only failed videos can be retried, the video is " + asset.Status
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
+	wakeVideos()
+
+	asset.Status, asset.Attempts, asset.Progress, asset.ProcessedAt = model.VideoStatusQueued, 0, 0, nil
+	jsonRsp.Data = asset
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+// videoAssetOf reads the video asset of the id path parameter for the
+// caller, it answers the request and returns false when it cannot
+func videoAssetOf[T any](c *gin.Context, jsonRsp *model.JsonDTORsp[T]) (model.VideoAsset, Caller, bool) {
+	var asset model.VideoAsset
+	caller, err := currentCaller(c)
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUnauthorized
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusUnauthorized, jsonRsp)
+		return asset, caller, false
+	}
+	err = db.Where("id = ?", c.Param("id")).Take(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jsonRsp.Code = statuscode.StatusItemNotFound
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusNotFound, jsonRsp)
+		return asset, caller, false
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, jsonRsp)
+		return asset, caller, false
+	}
+	return asset, caller, true
+}
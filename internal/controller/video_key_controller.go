@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/pkg/statuscode"
+	"gorm.io/gorm"
+)
+
+// GetVideoKey godoc
+// @Summary      Get the decryption key of HLS segments
+// @Description  Key server of the encrypted HLS renditions, the media playlists point at it. Releases the 16 byte AES-128 key to
+// @Description  the holder of a valid playback token of the video, as long as its user may still watch the video and the key is not revoked.
+// @Description  Every request is recorded, see GET /videos/{id}/key-accesses.
+// @Tags         Video
+// @Produce      application/octet-stream
+// @Param        id      path   string  true  "Video asset ID"
+// @Param        key_id  path   string  true  "Key ID"
+// @Param        token   query  string  true  "Playback token"
+// @Success      200
+// @Failure      403
+// @Failure      404
+// @Failure      410
+// @Router       /videos/{id}/keys/{key_id} [get]
+func GetVideoKey(c *gin.Context) {
+	assetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	var key model.VideoKey
+	err = db.Where("id = ? AND asset_id = ?", keyID, assetID).Take(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	access := model.VideoKeyAccess{AssetID: assetID, KeyID: keyID, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	status, err := authorizeVideoKey(c.Query("token"), key, &access)
+	access.Granted = err == nil
+	if err != nil {
+		access.Reason = err.Error()
+	}
+	if err := db.Create(&access).Error; err != nil {
+		log.Printf("could not record the access to key %s of video %s - %s", keyID, assetID, err)
+	}
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/octet-stream", key.Key)
+}
+
+// authorizeVideoKey checks that the playback token may get the key and sets
+// the user of the access. It returns the status to answer when it may not.
+func authorizeVideoKey(token string, key model.VideoKey, access *model.VideoKeyAccess) (int, error) {
+	userID, err := verifyPlaybackToken(token, key.AssetID)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	access.UserID = &userID
+	if key.RevokedAt != nil {
+		return http.StatusGone, errors.New("key was revoked")
+	}
+
+	// Tokens outlive enrollments, the user is checked again
+	var asset model.VideoAsset
+	if err := db.Where("id = ?", key.AssetID).Take(&asset).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var user model.User
+	err = db.Select("id", "role").Where("id = ?", userID).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusForbidden, errors.New("user of the playback token does not exist")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	allowed, err := canViewVideo(db, Caller{ID: user.ID, Role: user.Role}, asset)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !allowed {
+		return http.StatusForbidden, errors.New("video belongs to a course the user is not part of")
+	}
+	return http.StatusOK, nil
+}
+
+// RevokeVideoKeys godoc
+// @Summary      Revoke the keys of a video
+// @Description  Revokes every key of the encrypted HLS renditions, players cannot decrypt the segments anymore. With reencrypt the video is
+// @Description  transcoded again with new keys. Only the uploader and admins can revoke keys, not while the video is processing.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id      path  string                 true  "Video asset ID"
+// @Param        revoke  body  model.RevokeVideoKeys  true  "Revocation"
+// @Success      200  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      400  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      401  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      403  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      404  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      409  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Failure      500  {object}  model.JsonDTORsp[model.VideoAsset]
+// @Router       /videos/{id}/keys/revoke [post]
+// @Security     BearerAuth
+func RevokeVideoKeys(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[model.VideoAsset]()
+
+	var dto model.RevokeVideoKeys
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		jsonRsp.Code = statuscode.StatusBindingInputJsonFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusBadRequest, &jsonRsp)
+		return
+	}
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	if asset.UploaderID != caller.ID && !caller.IsAdmin() {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "video belongs to another user"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+
+	var revoked int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// A running transcoding would publish keys made before the revocation
+		result := tx.Model(&asset).Where("status <> ?", model.VideoStatusProcessing).Update("updated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVideoProcessing
+		}
+		result = tx.Model(&model.VideoKey{}).Where("asset_id = ? AND revoked_at IS NULL", asset.ID).Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		revoked = result.RowsAffected
+		if !dto.Reencrypt || asset.Status == model.VideoStatusQueued {
+			return nil
+		}
+		asset.Status, asset.Attempts, asset.Progress, asset.ProcessedAt = model.VideoStatusQueued, 0, 0, nil
+		return tx.Model(&asset).Updates(map[string]interface{}{
+			"status": asset.Status, "attempts": 0, "progress": 0, "processed_at": nil,
+		}).Error
+	})
+	if errors.Is(err, errVideoProcessing) {
+		jsonRsp.Code = statuscode.StatusConflict
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusConflict, &jsonRsp)
+		return
+	}
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusUpdateItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+	if dto.Reencrypt {
+		wakeVideos()
+	}
+	log.Printf("%d keys of video %s revoked by %s", revoked, asset.ID, caller.ID)
+
+	jsonRsp.Message = fmt.Sprintf("%d keys revoked", revoked)
+	jsonRsp.Data = asset
+	c.JSON(http.StatusOK, &jsonRsp)
+}
+
+var errVideoProcessing = errors.New("video is processing, revoke its keys once it is done")
+
+// ListVideoKeyAccesses godoc
+// @Summary      List the requests for the keys of a video
+// @Description  Returns the granted and refused requests to the key server for the video, newest first. Only the uploader and admins see them.
+// @Tags         Video
+// @Accept       json
+// @Produce      json
+// @Param        id     path   string  true   "Video asset ID"
+// @Param        limit  query  int     false  "Number of requests, at most 1000"  default(100)
+// @Success      200  {object}  model.JsonDTORsp[[]model.VideoKeyAccess]
+// @Failure      401  {object}  model.JsonDTORsp[[]model.VideoKeyAccess]
+// @Failure      403  {object}  model.JsonDTORsp[[]model.VideoKeyAccess]
+// @Failure      404  {object}  model.JsonDTORsp[[]model.VideoKeyAccess]
+// @Failure      500  {object}  model.JsonDTORsp[[]model.VideoKeyAccess]
+// @Router       /videos/{id}/key-accesses [get]
+// @Security     BearerAuth
+func ListVideoKeyAccesses(c *gin.Context) {
+	jsonRsp := model.NewJsonDTORsp[[]model.VideoKeyAccess]()
+
+	asset, caller, ok := videoAssetOf(c, jsonRsp)
+	if !ok {
+		return
+	}
+	if asset.UploaderID != caller.ID && !caller.IsAdmin() {
+		jsonRsp.Code = statuscode.StatusForbidden
+		jsonRsp.Message = "video belongs to another user"
+		c.JSON(http.StatusForbidden, &jsonRsp)
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	accesses := make([]model.VideoKeyAccess, 0)
+	err := db.Where("asset_id = ?", asset.ID).Order("created_at DESC").Limit(limit).Find(&accesses).Error
+	if err != nil {
+		jsonRsp.Code = statuscode.StatusReadItemFailed
+		jsonRsp.Message = err.Error()
+		c.JSON(http.StatusInternalServerError, &jsonRsp)
+		return
+	}
+
+	jsonRsp.Data = accesses
+	c.JSON(http.StatusOK, &jsonRsp)
+}
@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"github.com/hoangtu1372k2/vms/internal/storage"
+	"github.com/hoangtu1372k2/vms/internal/video"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transcoder of the uploaded videos, nil when ffmpeg is not available and
+// videos stay queued
+var videoTranscoder *video.Transcoder
+
+// videosQueued wakes up a video worker when a video was queued
+var videosQueued = make(chan struct{}, 1)
+
+// InitTranscoder sets the transcoder of the uploaded videos
+func InitTranscoder(t *video.Transcoder) {
+	videoTranscoder = t
+}
+
+// VideosQueued is signaled whenever a video waits for its transcoding
+func VideosQueued() <-chan struct{} {
+	return videosQueued
+}
+
+// wakeVideos wakes up a video worker unless one is woken up already
+func wakeVideos() {
+	select {
+	case videosQueued <- struct{}{}:
+	default:
+	}
+}
+
+// videoHLSPrefix holds the playlists and segments of the video stored under
+// key: videos/<id>/hls/ for videos/<id>.mp4
+func videoHLSPrefix(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "/hls/"
+}
+
+// isVideoObject tells if the object is a video or belongs to one: a file with
+// a video extension, the original of a video asset or a file of its HLS output
+func isVideoObject(ctx context.Context, key string) (bool, error) {
+	if t, ok := uploadTypeOf(key); ok && t.category == "videos" {
+		return true, nil
+	}
+	var assets int64
+	if err := db.WithContext(ctx).Model(&model.VideoAsset{}).Where("key = ?", key).Count(&assets).Error; err != nil {
+		return false, err
+	}
+	if assets > 0 {
+		return true, nil
+	}
+	// The output of videos/<id>.mp4 is under videos/<id>/hls/, every /hls/ of
+	// the key may be the one of a video
+	for i := strings.Index(key, "/hls/"); i >= 0; {
+		base := key[:i]
+		var keys []string
+		err := db.WithContext(ctx).Model(&model.VideoAsset{}).
+			Where("starts_with(key, ?)", base+".").Pluck("key", &keys).Error
+		if err != nil {
+			return false, err
+		}
+		for _, k := range keys {
+			if strings.HasPrefix(key, videoHLSPrefix(k)) {
+				return true, nil
+			}
+		}
+		next := strings.Index(key[i+1:], "/hls/")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false, nil
+}
+
+// queueVideo records that the video stored under key has to be transcoded
+// and returns its asset, videos queued before keep their asset
+func queueVideo(tx *gorm.DB, key string, uploaderID uuid.UUID) (model.VideoAsset, error) {
+	asset := model.VideoAsset{ID: uuid.New(), Key: key, UploaderID: uploaderID, Status: model.VideoStatusQueued}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&asset).Error
+	if err != nil {
+		return asset, err
+	}
+	if err := tx.Where("key = ?", key).Take(&asset).Error; err != nil {
+		return asset, err
+	}
+	wakeVideos()
+	return asset, nil
+}
+
+// TranscodeVideos transcodes up to limit queued videos and returns how many
+// were processed. Videos waiting for their malware scan are left for later
+// and failures are retried video_interval later. A video is claimed by
+// setting it processing, claims older than video_timeout are taken over since
+// their worker stopped.
+func TranscodeVideos(ctx context.Context, limit int) (int, error) {
+	if videoTranscoder == nil || fileStorage == nil {
+		return 0, nil
+	}
+	processed := 0
+	for processed < limit {
+		asset, err := claimVideo(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if asset == nil {
+			break
+		}
+		if err := transcodeVideo(ctx, *asset); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// claimVideo sets the next video to transcode processing and returns it, nil
+// when no video waits
+func claimVideo(ctx context.Context) (*model.VideoAsset, error) {
+	// Postgres keeps microseconds, the claim is matched on started_at
+	now := time.Now().Truncate(time.Microsecond)
+	retryBefore := now.Add(-cfg.GetDuration("video_interval"))
+	staleBefore := now.Add(-cfg.GetDuration("video_timeout"))
+	var claimed *model.VideoAsset
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for {
+			var asset model.VideoAsset
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("(status = ? AND (processed_at IS NULL OR processed_at < ?)) OR (status = ? AND started_at < ?)",
+					model.VideoStatusQueued, retryBefore, model.VideoStatusProcessing, staleBefore).
+				Where("NOT EXISTS (SELECT 1 FROM file_scan s WHERE s.key = video_asset.key AND s.status <> ?)",
+					model.FileScanStatusClean).
+				Order("created_at").Take(&asset).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if asset.Status == model.VideoStatusProcessing && asset.Attempts >= cfg.GetInt("video_max_attempts") {
+				// Its last worker stopped, it is not retried
+				err := tx.Model(&asset).Updates(map[string]interface{}{
+					"status": model.VideoStatusFailed, "error": "transcoding did not finish within video_timeout", "processed_at": now,
+				}).Error
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			asset.Status, asset.Progress, asset.StartedAt, asset.Attempts = model.VideoStatusProcessing, 0, &now, asset.Attempts+1
+			claimed = &asset
+			return tx.Model(&asset).Updates(map[string]interface{}{
+				"status": asset.Status, "progress": 0, "started_at": now, "attempts": asset.Attempts,
+			}).Error
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// transcodeVideo transcodes a claimed video and records the outcome. Only
+// database errors are returned, transcoding errors are recorded on the asset.
+func transcodeVideo(ctx context.Context, asset model.VideoAsset) error {
+	// Writes are ignored once another worker took the video over
+	claim := db.WithContext(ctx).Model(&asset).Where("status = ? AND started_at = ?", model.VideoStatusProcessing, asset.StartedAt)
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.GetDuration("video_timeout"))
+	defer cancel()
+	updates, err := makeVideoRenditions(runCtx, asset, func(progress float64) {
+		if err := claim.Session(&gorm.Session{}).UpdateColumn("progress", progress).Error; err != nil {
+			log.Printf("could not record the progress of video %s - %s", asset.ID, err)
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down, the video is taken over once its claim is stale
+			return nil
+		}
+		updates["error"] = err.Error()
+		updates["progress"] = 0
+		updates["status"] = model.VideoStatusQueued
+		if asset.Attempts >= cfg.GetInt("video_max_attempts") {
+			updates["status"] = model.VideoStatusFailed
+		}
+	}
+	updates["processed_at"] = time.Now()
+	return claim.Session(&gorm.Session{}).Updates(updates).Error
+}
+
+// makeVideoRenditions probes the video, transcodes it and stores its HLS
+// renditions, master playlist, poster and thumbnails under the prefix of the
+// asset. It returns
+// the columns to update, the probed ones even when transcoding failed.
+func makeVideoRenditions(ctx context.Context, asset model.VideoAsset, progress func(float64)) (map[string]interface{}, error) {
+	updates := map[string]interface{}{"error": nil}
+	dir, err := os.MkdirTemp(cfg.GetString("video_work_dir"), "video-")
+	if err != nil {
+		return updates, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "source"+path.Ext(asset.Key))
+	if err := downloadObject(ctx, asset.Key, input); err != nil {
+		return updates, err
+	}
+	info, err := videoTranscoder.Probe(ctx, input)
+	if err != nil {
+		return updates, err
+	}
+	updates["duration"], updates["width"], updates["height"] = info.Duration, info.Width, info.Height
+	if maxDuration := cfg.GetDuration("video_max_duration"); maxDuration > 0 && info.Duration > maxDuration.Seconds() {
+		return updates, fmt.Errorf("video is %.0f seconds long, at most %.0f are accepted", info.Duration, maxDuration.Seconds())
+	}
+
+	// Progress is recorded in steps of a percent, the upload takes the last one
+	renditions := video.Renditions(info)
+	output := filepath.Join(dir, "hls")
+	recorded := 0.0
+	err = videoTranscoder.Transcode(ctx, input, output, info, renditions, func(share float64) {
+		if percent := math.Floor(share * 99); percent > recorded {
+			recorded = percent
+			progress(percent)
+		}
+	})
+	if err != nil {
+		return updates, err
+	}
+	thumbnails, err := makeVideoThumbnails(ctx, input, output, info)
+	if err != nil {
+		return updates, err
+	}
+	var keys []model.VideoKey
+	if every := cfg.GetInt("video_key_rotation"); every > 0 {
+		if keys, err = encryptRenditions(ctx, asset, output, renditions, every); err != nil {
+			return updates, err
+		}
+	}
+	if err := storeHLS(ctx, output, videoHLSPrefix(asset.Key)); err != nil {
+		return updates, err
+	}
+	master := video.MasterPlaylist(renditions)
+	masterKey := videoHLSPrefix(asset.Key) + "master.m3u8"
+	opts := storage.PutOptions{ContentType: hlsContentType(masterKey)}
+	if _, err := fileStorage.Put(ctx, masterKey, bytes.NewReader(master), int64(len(master)), opts); err != nil {
+		return updates, err
+	}
+
+	stored := make(model.VideoRenditions, 0, len(renditions))
+	for _, r := range renditions {
+		stored = append(stored, model.VideoRendition{
+			Name: r.Name, Width: r.Width, Height: r.Height, VideoBitrate: r.VideoBitrate, AudioBitrate: r.AudioBitrate,
+			PlaylistURL: fileStorage.URL(videoHLSPrefix(asset.Key) + r.Name + "/index.m3u8"),
+		})
+	}
+	if err := retireVideoKeys(ctx, asset.ID, keys); err != nil {
+		return updates, err
+	}
+	updates["status"] = model.VideoStatusReady
+	updates["progress"] = 100
+	updates["playlist_url"] = fileStorage.URL(masterKey)
+	updates["renditions"] = stored
+	updates["poster_url"] = fileStorage.URL(videoHLSPrefix(asset.Key) + "poster.jpg")
+	updates["thumbnails"] = thumbnails
+	return updates, nil
+}
+
+// makeVideoThumbnails writes the poster (poster.jpg) and the sprite sheets of
+// the preview thumbnails (thumbnails/sprite_000.jpg) of the video to dir. It
+// returns the layout of the sprites, nil when video_thumbnail_interval is 0.
+func makeVideoThumbnails(ctx context.Context, input string, dir string, info video.Info) (*model.VideoThumbnails, error) {
+	if err := videoTranscoder.Poster(ctx, input, filepath.Join(dir, "poster.jpg"), info, cfg.GetInt("video_poster_width")); err != nil {
+		return nil, err
+	}
+	interval := cfg.GetDuration("video_thumbnail_interval")
+	if interval <= 0 {
+		return nil, nil
+	}
+	sprites := video.NewSprites(info, interval.Seconds(), cfg.GetInt("video_thumbnail_width"))
+	if err := videoTranscoder.SpriteSheets(ctx, input, filepath.Join(dir, "thumbnails"), sprites); err != nil {
+		return nil, err
+	}
+	return &model.VideoThumbnails{
+		Interval: sprites.Interval, Width: sprites.Width, Height: sprites.Height,
+		Columns: sprites.Columns, Rows: sprites.Rows, Count: sprites.Count, Sheets: sprites.Sheets(),
+	}, nil
+}
+
+// encryptRenditions encrypts the segments of the renditions written to dir
+// with new keys of the asset, a key per run of `every` segments shared by the
+// renditions. The keys are stored before the segments so players find them.
+func encryptRenditions(ctx context.Context, asset model.VideoAsset, dir string, renditions []video.Rendition, every int) ([]model.VideoKey, error) {
+	var keys []model.VideoKey
+	key := func(run int) ([]byte, string, error) {
+		for len(keys) <= run {
+			k := model.VideoKey{ID: uuid.New(), AssetID: asset.ID, Run: len(keys), Key: make([]byte, video.KeySize)}
+			if _, err := rand.Read(k.Key); err != nil {
+				return nil, "", err
+			}
+			keys = append(keys, k)
+		}
+		// Relative to <rendition>/index.m3u8, the key server of the video
+		return keys[run].Key, "../../keys/" + keys[run].ID.String(), nil
+	}
+	for _, r := range renditions {
+		if err := video.EncryptPlaylist(filepath.Join(dir, r.Name, "index.m3u8"), every, key); err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys, db.WithContext(ctx).Create(&keys).Error
+}
+
+// retireVideoKeys revokes the keys of the asset other than the ones its
+// segments are encrypted with now
+func retireVideoKeys(ctx context.Context, assetID uuid.UUID, current []model.VideoKey) error {
+	query := db.WithContext(ctx).Model(&model.VideoKey{}).Where("asset_id = ? AND revoked_at IS NULL", assetID)
+	if len(current) > 0 {
+		ids := make([]uuid.UUID, 0, len(current))
+		for _, k := range current {
+			ids = append(ids, k.ID)
+		}
+		query = query.Where("id NOT IN ?", ids)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+// downloadObject copies the object stored under key to the file at name
+func downloadObject(ctx context.Context, key string, name string) error {
+	r, _, err := fileStorage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// storeHLS puts the playlists and segments written to dir under prefix
+func storeHLS(ctx context.Context, dir string, prefix string) error {
+	return filepath.WalkDir(dir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		_, err = fileStorage.Put(ctx, key, f, stat.Size(), storage.PutOptions{ContentType: hlsContentType(key)})
+		return err
+	})
+}
+
+// hlsContentType is the content type of a playlist, segment or image stored
+// with the renditions
+func hlsContentType(key string) string {
+	switch path.Ext(key) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".jpg":
+		return "image/jpeg"
+	case ".vtt":
+		return "text/vtt; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,63 @@
+/*
+Package dberror turns Postgres errors into typed errors that callers can
+inspect with errors.As instead of matching driver messages.
+*/
+package dberror
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/hoangtu1372k2/vms/internal/migration"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres SQLSTATE of a unique constraint violation
+const codeUniqueViolation = "23505"
+
+// ConflictError is returned when a write violates a unique constraint
+type ConflictError struct {
+	Constraint string
+	Field      string
+	err        error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Field)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.err
+}
+
+// Columns reported by Postgres in details such as "Key (a, b)=(1, 2) already exists."
+var detailKey = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+// Translate returns a typed error for the constraint violations it knows and
+// the error unchanged otherwise. It is safe to call with nil.
+func Translate(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	if pgErr.Code == codeUniqueViolation {
+		return &ConflictError{Constraint: pgErr.ConstraintName, Field: field(pgErr), err: err}
+	}
+	return err
+}
+
+// field names the columns of the violated constraint, preferring the names
+// registered by the migrations over the raw key in the error detail
+func field(pgErr *pgconn.PgError) string {
+	if f, ok := migration.UniqueFields[pgErr.ConstraintName]; ok {
+		return f
+	}
+	if m := detailKey.FindStringSubmatch(pgErr.Detail); m != nil {
+		return m[1]
+	}
+	if pgErr.ColumnName != "" {
+		return pgErr.ColumnName
+	}
+	return pgErr.ConstraintName
+}
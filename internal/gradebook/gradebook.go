@@ -0,0 +1,65 @@
+/*
+Package gradebook keeps the history of grades.
+
+Every write of a grade, from the API or from an archive import, stores the new
+state of the grade as its next revision in grade_revision. Revisions are
+immutable and numbered per grade, callers lock the grade row so concurrent
+changes get consecutive numbers.
+*/
+package gradebook
+
+import (
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+)
+
+// RecordRevision stores the current state of the grade as its next revision
+func RecordRevision(tx *gorm.DB, grade model.Grade, reason string, restoredFrom *uuid.UUID, deleted bool) (model.GradeRevision, error) {
+	var last int
+	err := tx.Model(&model.GradeRevision{}).
+		Where("grade_id = ?", grade.ID).
+		Select("coalesce(max(revision), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return model.GradeRevision{}, err
+	}
+
+	revision := model.GradeRevision{
+		GradeID:      grade.ID,
+		Revision:     last + 1,
+		StudentID:    grade.StudentID,
+		CourseID:     grade.CourseID,
+		AssignmentID: grade.AssignmentID,
+		Score:        grade.Score,
+		MaxScore:     grade.MaxScore,
+		Feedback:     grade.Comments,
+		GradedBy:     grade.GradedBy,
+		Reason:       reason,
+		RestoredFrom: restoredFrom,
+		Deleted:      deleted,
+	}
+	err = tx.Create(&revision).Error
+	return revision, err
+}
+
+// Current tells if the latest revision of the grade holds its current state
+func Current(tx *gorm.DB, grade model.Grade) (bool, error) {
+	var latest model.GradeRevision
+	err := tx.Where("grade_id = ?", grade.ID).Order("revision DESC").Limit(1).Find(&latest).Error
+	if err != nil || latest.ID == uuid.Nil {
+		return false, err
+	}
+	return !latest.Deleted &&
+		latest.Score == grade.Score &&
+		latest.MaxScore == grade.MaxScore &&
+		latest.GradedBy == grade.GradedBy &&
+		equalString(latest.Feedback, grade.Comments), nil
+}
+
+func equalString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
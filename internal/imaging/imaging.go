@@ -0,0 +1,253 @@
+/*
+Package imaging resizes uploaded images in pure Go.
+
+Images are decoded from JPEG or PNG, turned upright following their EXIF
+orientation and encoded again as JPEG or lossless WebP. Metadata such as EXIF
+is never copied to the output.
+*/
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// Decode reads a JPEG or PNG image of at most maxPixels pixels and applies its
+// EXIF orientation
+func Decode(r io.Reader, maxPixels int) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if maxPixels > 0 && config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image has %dx%d pixels, at most %d are accepted", config.Width, config.Height, maxPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return orient(img, orientation(data)), nil
+}
+
+// EncodeJPEG writes img as a baseline JPEG
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// Fit scales img down so that its longest side is at most size pixels,
+// smaller images are returned as they are
+func Fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return img
+	}
+	width, height := size, b.Dy()*size/b.Dx()
+	if b.Dy() > b.Dx() {
+		width, height = b.Dx()*size/b.Dy(), size
+	}
+	return resize(img, max(width, 1), max(height, 1))
+}
+
+// Square crops the center square of img and scales it down to size pixels
+func Square(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, crop.Min, draw.Src)
+	if side <= size {
+		return square
+	}
+	return resize(square, size, size)
+}
+
+// resize scales img with an area average, each output pixel is the mean of the
+// input pixels it covers. Colors are averaged premultiplied by alpha.
+func resize(img image.Image, width int, height int) *image.RGBA {
+	src := rgba(img)
+	b := src.Bounds()
+	columns := weights(b.Dx(), width)
+	rows := weights(b.Dy(), height)
+
+	// Horizontal pass into float rows, then the vertical pass
+	tmp := make([]float64, 4*width*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		line := src.Pix[y*src.Stride:]
+		for x, w := range columns {
+			var sum [4]float64
+			for i, weight := range w.weights {
+				p := line[4*(w.first+i):]
+				sum[0] += weight * float64(p[0])
+				sum[1] += weight * float64(p[1])
+				sum[2] += weight * float64(p[2])
+				sum[3] += weight * float64(p[3])
+			}
+			copy(tmp[4*(y*width+x):], sum[:])
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, w := range rows {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for i, weight := range w.weights {
+				p := tmp[4*((w.first+i)*width+x):]
+				sum[0] += weight * p[0]
+				sum[1] += weight * p[1]
+				sum[2] += weight * p[2]
+				sum[3] += weight * p[3]
+			}
+			d := dst.Pix[y*dst.Stride+4*x:]
+			for c := range sum {
+				d[c] = uint8(min(max(sum[c]+0.5, 0), 255))
+			}
+		}
+	}
+	return dst
+}
+
+// span is the input pixels an output pixel covers and their share of it
+type span struct {
+	first   int
+	weights []float64
+}
+
+func weights(from int, to int) []span {
+	scale := float64(from) / float64(to)
+	spans := make([]span, to)
+	for i := range spans {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		first := int(start)
+		s := span{first: first}
+		for p := first; p < from && float64(p) < end; p++ {
+			covered := min(end, float64(p+1)) - max(start, float64(p))
+			s.weights = append(s.weights, covered/scale)
+		}
+		spans[i] = s
+	}
+	return spans
+}
+
+// rgba returns img as premultiplied RGBA with bounds starting at 0, 0
+func rgba(img image.Image) *image.RGBA {
+	if m, ok := img.(*image.RGBA); ok && m.Bounds().Min == (image.Point{}) {
+		return m
+	}
+	b := img.Bounds()
+	m := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+	return m
+}
+
+// nrgba returns a copy of img as non premultiplied RGBA
+func nrgba(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	m := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+	return m
+}
+
+// orientation returns the EXIF orientation of a JPEG, 1 when it has none
+func orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || length < 2 || i+2+length > len(data) {
+			// Start of scan, metadata comes before it
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads tag 0x0112 of the first IFD of a TIFF header
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+	return 1
+}
+
+// orient turns an image stored with an EXIF orientation upright
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := rgba(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+4*x:y*dst.Stride+4*x+4], src.Pix[sy*src.Stride+4*sx:])
+		}
+	}
+	return dst
+}
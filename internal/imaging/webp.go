@@ -0,0 +1,291 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+)
+
+// EncodeWebP writes img as a lossless WebP (VP8L) image. Pixels are coded
+// with the subtract green transform and one set of prefix codes built from
+// the image histograms, without backward references or a color cache. It
+// compresses less than libwebp but needs no C library.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("webp images are 1 to 16384 pixels wide and high")
+	}
+	pixels := nrgba(img)
+
+	// Subtract green, the decoder adds green back to red and blue
+	alpha := false
+	var histograms [4][256]uint32 // green, red, blue, alpha
+	for i := 0; i < len(pixels.Pix); i += 4 {
+		p := pixels.Pix[i : i+4 : i+4]
+		p[0] -= p[1]
+		p[2] -= p[1]
+		histograms[0][p[1]]++
+		histograms[1][p[0]]++
+		histograms[2][p[2]]++
+		histograms[3][p[3]]++
+		alpha = alpha || p[3] != 0xff
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(alpha), 1)
+	bw.write(0, 3) // version
+	bw.write(1, 1) // transform present
+	bw.write(2, 2) // subtract green
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // no meta prefix codes
+
+	// Green has 24 length prefix symbols after the literals, distance has 40
+	// symbols, both unused
+	var codes [4]prefixCode
+	for i := range codes {
+		size := 256
+		if i == 0 {
+			size = 256 + 24
+		}
+		codes[i] = newPrefixCode(histograms[i][:], size)
+		codes[i].writeTo(bw)
+	}
+	newPrefixCode(nil, 40).writeTo(bw)
+
+	for i := 0; i < len(pixels.Pix); i += 4 {
+		codes[0].writeSymbol(bw, pixels.Pix[i+1])
+		codes[1].writeSymbol(bw, pixels.Pix[i])
+		codes[2].writeSymbol(bw, pixels.Pix[i+2])
+		codes[3].writeSymbol(bw, pixels.Pix[i+3])
+	}
+	data := bw.bytes()
+
+	// RIFF container, chunks are padded to an even size
+	padded := len(data) + len(data)&1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)&1 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	bits uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.acc |= uint64(value) << w.bits
+	w.bits += n
+	for w.bits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.bits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bits = 0, 0
+	}
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// prefixCode is a canonical Huffman code over an alphabet
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16 // bit reversed, ready to be written LSB first
+	// simple codes of one symbol take no bits per symbol
+	single int
+}
+
+// maxCodeLength limits the codes of the alphabets, maxCodeLengthCode the
+// code of the code lengths
+const (
+	maxCodeLength     = 15
+	maxCodeLengthCode = 7
+)
+
+// Order in which the lengths of the code length code are written
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+func newPrefixCode(histogram []uint32, size int) prefixCode {
+	counts := make([]uint32, size)
+	copy(counts, histogram)
+	used, last := 0, 0
+	for s, n := range counts {
+		if n > 0 {
+			used, last = used+1, s
+		}
+	}
+	if used <= 1 {
+		return prefixCode{single: last}
+	}
+	lengths := huffmanLengths(counts, maxCodeLength)
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths), single: -1}
+}
+
+func (c prefixCode) writeTo(w *bitWriter) {
+	if c.single >= 0 {
+		// Simple code: one symbol, written with 8 bits
+		w.write(1, 1)
+		w.write(0, 1)
+		w.write(1, 1)
+		w.write(uint32(c.single), 8)
+		return
+	}
+	w.write(0, 1)
+
+	// The lengths are written with a prefix code of their own, which needs
+	// two symbols at least
+	counts := make([]uint32, 19)
+	for _, l := range c.lengths {
+		counts[l]++
+	}
+	if counts[0] == 0 {
+		counts[0]++
+	}
+	lengthLengths := huffmanLengths(counts, maxCodeLengthCode)
+	lengthCodes := canonicalCodes(lengthLengths)
+
+	n := 4
+	for i, s := range codeLengthOrder {
+		if lengthLengths[s] > 0 && i+1 > n {
+			n = i + 1
+		}
+	}
+	w.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		w.write(uint32(lengthLengths[s]), 3)
+	}
+	w.write(0, 1) // lengths of all symbols follow
+	for _, l := range c.lengths {
+		w.write(uint32(lengthCodes[l]), uint(lengthLengths[l]))
+	}
+}
+
+func (c prefixCode) writeSymbol(w *bitWriter, s byte) {
+	if c.single < 0 {
+		w.write(uint32(c.codes[s]), uint(c.lengths[s]))
+	}
+}
+
+// huffmanLengths returns the code lengths of a Huffman code for counts, at
+// most maxLength bits long. Rare symbols are made more frequent until the
+// code fits.
+func huffmanLengths(counts []uint32, maxLength int) []uint8 {
+	adjusted := make([]uint64, len(counts))
+	for floor := uint64(1); ; floor *= 2 {
+		for i, n := range counts {
+			if n > 0 {
+				adjusted[i] = max(uint64(n), floor)
+			}
+		}
+		lengths := huffmanTree(adjusted)
+		longest := uint8(0)
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if int(longest) <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// huffmanTree builds the tree of the symbols with a weight and returns the
+// depth of every symbol, two symbols are used at least
+func huffmanTree(weights []uint64) []uint8 {
+	type node struct {
+		weight uint64
+		parent int
+	}
+	nodes := make([]node, 0, 2*len(weights))
+	var active []int
+	symbols := make([]int, len(weights))
+	for s, weight := range weights {
+		symbols[s] = -1
+		if weight > 0 {
+			symbols[s] = len(nodes)
+			active = append(active, len(nodes))
+			nodes = append(nodes, node{weight: weight, parent: -1})
+		}
+	}
+	for len(active) > 1 {
+		// Take the two lightest nodes
+		for k := 0; k < 2; k++ {
+			lightest := k
+			for i := k + 1; i < len(active); i++ {
+				if nodes[active[i]].weight < nodes[active[lightest]].weight {
+					lightest = i
+				}
+			}
+			active[k], active[lightest] = active[lightest], active[k]
+		}
+		parent := len(nodes)
+		nodes = append(nodes, node{weight: nodes[active[0]].weight + nodes[active[1]].weight, parent: -1})
+		nodes[active[0]].parent, nodes[active[1]].parent = parent, parent
+		active = append(active[2:], parent)
+	}
+
+	lengths := make([]uint8, len(weights))
+	for s, n := range symbols {
+		for ; n >= 0 && nodes[n].parent >= 0; n = nodes[n].parent {
+			lengths[s]++
+		}
+	}
+	return lengths
+}
+
+// canonicalCodes assigns the codes of the lengths in symbol order, like
+// DEFLATE, and reverses their bits
+func canonicalCodes(lengths []uint8) []uint16 {
+	var count [maxCodeLength + 1]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [maxCodeLength + 2]int
+	code := 0
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint16, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		reversed := 0
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		codes[s] = uint16(reversed)
+	}
+	return codes
+}
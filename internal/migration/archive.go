@@ -0,0 +1,32 @@
+package migration
+
+// Each database gets a random instance id the first time it is migrated.
+// Archives record the id of the instance they were exported from, and imports
+// remember which row every source id became so re-running them updates the
+// same rows instead of creating copies.
+var archiveSteps = []step{
+	{
+		name: "archive_instance",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS vms_instance (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+				singleton boolean NOT NULL DEFAULT true UNIQUE CHECK (singleton),
+				created_at timestamptz NOT NULL DEFAULT now()
+			)`,
+			`INSERT INTO vms_instance (singleton) VALUES (true) ON CONFLICT (singleton) DO NOTHING`,
+		},
+	},
+	{
+		name: "archive_import_map",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS archive_import_map (
+				source_instance uuid NOT NULL,
+				entity text NOT NULL,
+				source_id uuid NOT NULL,
+				target_id uuid NOT NULL,
+				imported_at timestamptz NOT NULL DEFAULT now(),
+				PRIMARY KEY (source_instance, entity, source_id)
+			)`,
+		},
+	},
+}
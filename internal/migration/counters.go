@@ -0,0 +1,155 @@
+package migration
+
+// RecountCourseCounters recomputes every course aggregate counter from the
+// underlying rows and only touches courses whose counters drifted.
+//
+// Enrollments count as students unless they are dropped, and submissions are
+// pending grading until they are graded or superseded by a later attempt. The
+// triggers below follow the same rules.
+const RecountCourseCounters = `
+	UPDATE course c SET
+		lessons_count = f.lessons_count,
+		students_count = f.students_count,
+		assignments_count = f.assignments_count,
+		submissions_count = f.submissions_count,
+		pending_grading_count = f.pending_grading_count
+	FROM (
+		SELECT c.id,
+			(SELECT count(*) FROM lesson l WHERE l.course_id = c.id) AS lessons_count,
+			(SELECT count(*) FROM course_enrollment e WHERE e.course_id = c.id AND e.status IS DISTINCT FROM 'dropped') AS students_count,
+			(SELECT count(*) FROM assignment a WHERE a.course_id = c.id) AS assignments_count,
+			(SELECT count(*) FROM assignment_submission s JOIN assignment a ON a.id = s.assignment_id
+				WHERE a.course_id = c.id) AS submissions_count,
+			(SELECT count(*) FROM assignment_submission s JOIN assignment a ON a.id = s.assignment_id
+				WHERE a.course_id = c.id AND coalesce(s.status, '') NOT IN ('graded', 'superseded')) AS pending_grading_count
+		FROM course c
+	) f
+	WHERE f.id = c.id
+		AND (c.lessons_count, c.students_count, c.assignments_count, c.submissions_count, c.pending_grading_count)
+			IS DISTINCT FROM (f.lessons_count, f.students_count, f.assignments_count, f.submissions_count, f.pending_grading_count)`
+
+// CounterTables lists the tables whose rows feed the course counters. The
+// recount command locks them against writes while it runs.
+var CounterTables = []string{"lesson", "course_enrollment", "assignment", "assignment_submission"}
+
+// The counters are kept by row level triggers so that every write path,
+// including bulk and raw SQL ones, updates them inside the same transaction.
+// Each trigger removes the old row's contribution and adds the new one, and
+// the increments are single UPDATE statements so concurrent writers serialize
+// on the course row instead of overwriting each other.
+var counterSteps = []step{
+	{
+		name: "counter_functions",
+		statements: []string{
+			`CREATE OR REPLACE FUNCTION vms_bump_course_counter(course_id uuid, counter text, delta integer) RETURNS void AS $$
+			BEGIN
+				IF course_id IS NULL OR delta = 0 THEN
+					RETURN;
+				END IF;
+				EXECUTE format('UPDATE course SET %I = %I + $1 WHERE id = $2', counter, counter) USING delta, course_id;
+			END
+			$$ LANGUAGE plpgsql`,
+			`CREATE OR REPLACE FUNCTION vms_lesson_counters() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP = 'UPDATE' AND OLD.course_id IS NOT DISTINCT FROM NEW.course_id THEN
+					RETURN NULL;
+				END IF;
+				IF TG_OP IN ('UPDATE', 'DELETE') THEN
+					PERFORM vms_bump_course_counter(OLD.course_id, 'lessons_count', -1);
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') THEN
+					PERFORM vms_bump_course_counter(NEW.course_id, 'lessons_count', 1);
+				END IF;
+				RETURN NULL;
+			END
+			$$ LANGUAGE plpgsql`,
+			// Submissions count in the course of their assignment: they leave the
+			// counters with it when it is deleted or moved, deleted assignments
+			// leave their submissions behind without a course. Submission writes
+			// lock their assignment, so its submissions are counted once they
+			// are committed.
+			`CREATE OR REPLACE FUNCTION vms_assignment_counters() RETURNS trigger AS $$
+			DECLARE
+				submissions integer;
+				pending integer;
+			BEGIN
+				IF TG_OP = 'UPDATE' AND OLD.course_id IS NOT DISTINCT FROM NEW.course_id THEN
+					RETURN NULL;
+				END IF;
+				IF TG_OP IN ('UPDATE', 'DELETE') THEN
+					SELECT count(*), count(*) FILTER (WHERE coalesce(status, '') NOT IN ('graded', 'superseded'))
+						INTO submissions, pending
+						FROM assignment_submission WHERE assignment_id = OLD.id;
+					PERFORM vms_bump_course_counter(OLD.course_id, 'assignments_count', -1);
+					PERFORM vms_bump_course_counter(OLD.course_id, 'submissions_count', -submissions);
+					PERFORM vms_bump_course_counter(OLD.course_id, 'pending_grading_count', -pending);
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') THEN
+					SELECT count(*), count(*) FILTER (WHERE coalesce(status, '') NOT IN ('graded', 'superseded'))
+						INTO submissions, pending
+						FROM assignment_submission WHERE assignment_id = NEW.id;
+					PERFORM vms_bump_course_counter(NEW.course_id, 'assignments_count', 1);
+					PERFORM vms_bump_course_counter(NEW.course_id, 'submissions_count', submissions);
+					PERFORM vms_bump_course_counter(NEW.course_id, 'pending_grading_count', pending);
+				END IF;
+				RETURN NULL;
+			END
+			$$ LANGUAGE plpgsql`,
+			`CREATE OR REPLACE FUNCTION vms_enrollment_counters() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.status IS DISTINCT FROM 'dropped' THEN
+					PERFORM vms_bump_course_counter(OLD.course_id, 'students_count', -1);
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.status IS DISTINCT FROM 'dropped' THEN
+					PERFORM vms_bump_course_counter(NEW.course_id, 'students_count', 1);
+				END IF;
+				RETURN NULL;
+			END
+			$$ LANGUAGE plpgsql`,
+			`CREATE OR REPLACE FUNCTION vms_submission_counters() RETURNS trigger AS $$
+			DECLARE
+				old_course uuid;
+				new_course uuid;
+			BEGIN
+				IF TG_OP IN ('UPDATE', 'DELETE') THEN
+					SELECT course_id INTO old_course FROM assignment WHERE id = OLD.assignment_id FOR SHARE;
+					PERFORM vms_bump_course_counter(old_course, 'submissions_count', -1);
+					IF coalesce(OLD.status, '') NOT IN ('graded', 'superseded') THEN
+						PERFORM vms_bump_course_counter(old_course, 'pending_grading_count', -1);
+					END IF;
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') THEN
+					SELECT course_id INTO new_course FROM assignment WHERE id = NEW.assignment_id FOR SHARE;
+					PERFORM vms_bump_course_counter(new_course, 'submissions_count', 1);
+					IF coalesce(NEW.status, '') NOT IN ('graded', 'superseded') THEN
+						PERFORM vms_bump_course_counter(new_course, 'pending_grading_count', 1);
+					END IF;
+				END IF;
+				RETURN NULL;
+			END
+			$$ LANGUAGE plpgsql`,
+		},
+	},
+	{
+		// Triggers are created once per schema; the first time also
+		// backfills the counters of existing courses.
+		name: "counter_triggers",
+		statements: []string{
+			`DO $$
+			BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'trg_lesson_counters' AND tgrelid = 'lesson'::regclass) THEN
+					CREATE TRIGGER trg_lesson_counters AFTER INSERT OR DELETE OR UPDATE OF course_id
+						ON lesson FOR EACH ROW EXECUTE FUNCTION vms_lesson_counters();
+					CREATE TRIGGER trg_assignment_counters AFTER INSERT OR DELETE OR UPDATE OF course_id
+						ON assignment FOR EACH ROW EXECUTE FUNCTION vms_assignment_counters();
+					CREATE TRIGGER trg_enrollment_counters AFTER INSERT OR DELETE OR UPDATE OF course_id, status
+						ON course_enrollment FOR EACH ROW EXECUTE FUNCTION vms_enrollment_counters();
+					CREATE TRIGGER trg_submission_counters AFTER INSERT OR DELETE OR UPDATE OF assignment_id, status
+						ON assignment_submission FOR EACH ROW EXECUTE FUNCTION vms_submission_counters();
+					` + RecountCourseCounters + `;
+				END IF;
+			END
+			$$`,
+		},
+	},
+}
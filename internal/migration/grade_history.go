@@ -0,0 +1,36 @@
+package migration
+
+// Grade revisions are append-only: a trigger rejects any UPDATE or DELETE, and
+// grades that existed before the history was introduced get an initial
+// revision so point-in-time views have a starting state.
+var gradeHistorySteps = []step{
+	{
+		name: "grade_revision_immutable",
+		statements: []string{
+			`CREATE OR REPLACE FUNCTION vms_grade_revision_immutable() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'grade revisions are immutable';
+			END
+			$$ LANGUAGE plpgsql`,
+			`DO $$
+			BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'trg_grade_revision_immutable' AND tgrelid = 'grade_revision'::regclass) THEN
+					CREATE TRIGGER trg_grade_revision_immutable BEFORE UPDATE OR DELETE
+						ON grade_revision FOR EACH ROW EXECUTE FUNCTION vms_grade_revision_immutable();
+				END IF;
+			END
+			$$`,
+		},
+	},
+	{
+		name: "grade_revision_backfill",
+		statements: []string{
+			`INSERT INTO grade_revision (grade_id, revision, student_id, course_id, assignment_id,
+				score, max_score, feedback, graded_by, reason, deleted, created_at)
+			SELECT g.id, 1, g.student_id, g.course_id, g.assignment_id,
+				g.score, g.max_score, g.comments, g.graded_by, 'imported', false, coalesce(g.graded_at, g.created_at)
+			FROM grade g
+			WHERE NOT EXISTS (SELECT 1 FROM grade_revision r WHERE r.grade_id = g.id)`,
+		},
+	},
+}
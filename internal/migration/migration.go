@@ -0,0 +1,44 @@
+/*
+Package migration holds the schema changes that gorm's AutoMigrate cannot
+express, such as extensions, generated columns and special indexes.
+
+Every statement must be idempotent because the steps run on each startup,
+right after the tables are auto-migrated.
+*/
+package migration
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// step is a named group of SQL statements applied in order
+type step struct {
+	name       string
+	statements []string
+}
+
+// steps lists every schema change in the order it must be applied
+var steps = [][]step{
+	searchSteps,
+	counterSteps,
+	gradeHistorySteps,
+	uniquenessSteps,
+	archiveSteps,
+	submissionSteps,
+}
+
+// Apply runs all migration steps against the database
+func Apply(db *gorm.DB) error {
+	for _, group := range steps {
+		for _, s := range group {
+			for _, stmt := range s.statements {
+				if err := db.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("migration %s failed - %s", s.name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package migration
+
+// SearchConfig is the text search configuration used for every search vector.
+// It is the "simple" parser with unaccent in front of it, so "Lập trình" and
+// "lap trinh" produce the same lexemes while ts_headline still highlights the
+// original, accented text.
+const SearchConfig = "vms_simple"
+
+var searchSteps = []step{
+	{
+		name: "search_config",
+		statements: []string{
+			`CREATE EXTENSION IF NOT EXISTS unaccent`,
+			`DO $$
+			BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '` + SearchConfig + `') THEN
+					CREATE TEXT SEARCH CONFIGURATION ` + SearchConfig + ` (COPY = simple);
+					ALTER TEXT SEARCH CONFIGURATION ` + SearchConfig + `
+						ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+				END IF;
+			END
+			$$`,
+		},
+	},
+	{
+		name: "search_course",
+		statements: []string{
+			`ALTER TABLE course ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'B')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_course_search_vector ON course USING GIN (search_vector)`,
+		},
+	},
+	{
+		name: "search_lesson",
+		statements: []string{
+			`ALTER TABLE lesson ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(content, '')), 'B')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_lesson_search_vector ON lesson USING GIN (search_vector)`,
+		},
+	},
+	{
+		name: "search_assignment",
+		statements: []string{
+			`ALTER TABLE assignment ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'B') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(content, '')), 'C')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_assignment_search_vector ON assignment USING GIN (search_vector)`,
+		},
+	},
+	{
+		name: "search_course_document",
+		statements: []string{
+			`ALTER TABLE course_document ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'B')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_course_document_search_vector ON course_document USING GIN (search_vector)`,
+		},
+	},
+	{
+		name: "search_assignment_document",
+		statements: []string{
+			`ALTER TABLE assignment_document ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'B')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_assignment_document_search_vector ON assignment_document USING GIN (search_vector)`,
+		},
+	},
+}
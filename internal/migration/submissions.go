@@ -0,0 +1,69 @@
+package migration
+
+// The legacy submission table of the removed /submissions API is merged into
+// assignment_submission: each row becomes the next attempt of its student for
+// the assignment and keeps its id, so comments pointing at it stay valid, and
+// its file_url becomes an attached file. The table is then renamed to
+// submission_legacy so the merge runs once and the original rows are kept.
+//
+// Attempts are numbered by submission time where existing rows share a number,
+// and earlier attempts still waiting for grading are marked superseded.
+var submissionSteps = []step{
+	{
+		name: "submission_merge_legacy",
+		statements: []string{
+			`DO $$
+			BEGIN
+				IF to_regclass('submission') IS NOT NULL THEN
+					INSERT INTO assignment_submission (id, assignment_id, student_id, attempt, submitted_at,
+						content, status, created_at, updated_at)
+					SELECT l.id, l.assignment_id, l.student_id,
+						coalesce((SELECT max(s.attempt) FROM assignment_submission s
+							WHERE s.assignment_id = l.assignment_id AND s.student_id = l.student_id), 0)
+							+ row_number() OVER (PARTITION BY l.assignment_id, l.student_id ORDER BY l.created_at, l.id),
+						l.created_at, l.content, l.status, l.created_at, l.updated_at
+					FROM submission l
+					WHERE l.deleted_at IS NULL
+						AND NOT EXISTS (SELECT 1 FROM assignment_submission s WHERE s.id = l.id);
+
+					INSERT INTO assignment_submission_file (submission_id, file_name, file_path, created_at, updated_at)
+					SELECT l.id, regexp_replace(l.file_url, '^.*/', ''), l.file_url, l.created_at, l.updated_at
+					FROM submission l
+					WHERE l.deleted_at IS NULL AND coalesce(l.file_url, '') <> ''
+						AND EXISTS (SELECT 1 FROM assignment_submission s WHERE s.id = l.id)
+						AND NOT EXISTS (SELECT 1 FROM assignment_submission_file f
+							WHERE f.submission_id = l.id AND f.file_path = l.file_url);
+
+					ALTER TABLE submission RENAME TO submission_legacy;
+				END IF;
+			END
+			$$`,
+		},
+	},
+	{
+		name: "submission_attempts",
+		statements: []string{
+			`WITH duplicated AS (
+				SELECT assignment_id, student_id FROM assignment_submission
+				GROUP BY assignment_id, student_id
+				HAVING count(*) <> count(DISTINCT attempt)
+			), numbered AS (
+				SELECT s.id, row_number() OVER (
+					PARTITION BY s.assignment_id, s.student_id
+					ORDER BY s.submitted_at, s.created_at, s.id
+				) AS attempt
+				FROM assignment_submission s
+				JOIN duplicated d ON d.assignment_id = s.assignment_id AND d.student_id = s.student_id
+			)
+			UPDATE assignment_submission s SET attempt = n.attempt
+			FROM numbered n
+			WHERE n.id = s.id AND s.attempt <> n.attempt`,
+			`UPDATE assignment_submission s SET status = 'superseded'
+			WHERE coalesce(s.status, '') NOT IN ('graded', 'superseded')
+				AND EXISTS (SELECT 1 FROM assignment_submission l
+					WHERE l.assignment_id = s.assignment_id AND l.student_id = s.student_id AND l.attempt > s.attempt)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueSubmissionAttempt + `
+				ON assignment_submission (assignment_id, student_id, attempt)`,
+		},
+	},
+}
@@ -0,0 +1,93 @@
+package migration
+
+// Unique index names, shared with the error translation so a violation can be
+// reported with the field that conflicts
+const (
+	UniqueEnrollmentCourseStudent = "uq_course_enrollment_course_student"
+	UniqueGradeStudentAssignment  = "uq_grade_student_assignment"
+	UniqueUserName                = "uq_user_user_name"
+	UniqueUserEmail               = "uq_user_email"
+	UniqueSubmissionAttempt       = "uq_assignment_submission_attempt"
+)
+
+// UniqueFields maps every unique index to the request field(s) it protects
+var UniqueFields = map[string]string{
+	UniqueEnrollmentCourseStudent: "course_id,student_id",
+	UniqueGradeStudentAssignment:  "student_id,assignment_id",
+	UniqueUserName:                "user_name",
+	UniqueUserEmail:               "email",
+	UniqueSubmissionAttempt:       "assignment_id,student_id,attempt",
+}
+
+// Duplicates cannot be merged safely, so the migration stops and names them
+// instead of deleting rows: enrollments carry progress and grades have a
+// history in grade_revision that would keep showing a deleted grade.
+// Usernames are only unique when set and emails are compared
+// case-insensitively.
+var uniquenessSteps = []step{
+	{
+		name: "unique_course_enrollment",
+		statements: []string{
+			`DO $$
+			DECLARE
+				duplicates text;
+			BEGIN
+				SELECT string_agg(value, ', ') INTO duplicates FROM (
+					SELECT 'course ' || course_id || ' student ' || student_id || ': ' || string_agg(id::text, ' ' ORDER BY created_at) AS value
+					FROM course_enrollment GROUP BY course_id, student_id HAVING count(*) > 1
+				) d;
+				IF duplicates IS NOT NULL THEN
+					RAISE EXCEPTION 'duplicate enrollments must be merged by hand before adding unique constraints: %', duplicates;
+				END IF;
+			END
+			$$`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueEnrollmentCourseStudent + `
+				ON course_enrollment (course_id, student_id)`,
+		},
+	},
+	{
+		name: "unique_grade",
+		statements: []string{
+			`DO $$
+			DECLARE
+				duplicates text;
+			BEGIN
+				SELECT string_agg(value, ', ') INTO duplicates FROM (
+					SELECT 'student ' || student_id || ' assignment ' || assignment_id || ': ' || string_agg(id::text, ' ' ORDER BY created_at) AS value
+					FROM grade GROUP BY student_id, assignment_id HAVING count(*) > 1
+				) d;
+				IF duplicates IS NOT NULL THEN
+					RAISE EXCEPTION 'duplicate grades must be merged by hand before adding unique constraints: %', duplicates;
+				END IF;
+			END
+			$$`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueGradeStudentAssignment + `
+				ON grade (student_id, assignment_id)`,
+		},
+	},
+	{
+		name: "unique_user",
+		statements: []string{
+			`DO $$
+			DECLARE
+				duplicates text;
+			BEGIN
+				SELECT string_agg(value, ', ') INTO duplicates FROM (
+					SELECT 'user_name ' || user_name AS value FROM "user"
+					WHERE user_name <> '' GROUP BY user_name HAVING count(*) > 1
+					UNION ALL
+					SELECT 'email ' || lower(email) FROM "user"
+					WHERE email <> '' GROUP BY lower(email) HAVING count(*) > 1
+				) d;
+				IF duplicates IS NOT NULL THEN
+					RAISE EXCEPTION 'duplicate users must be merged by hand before adding unique constraints: %', duplicates;
+				END IF;
+			END
+			$$`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueUserName + `
+				ON "user" (user_name) WHERE user_name <> ''`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueUserEmail + `
+				ON "user" (lower(email)) WHERE email <> ''`,
+		},
+	},
+}
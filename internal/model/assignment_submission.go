@@ -6,10 +6,14 @@ import (
 	"github.com/google/uuid"
 )
 
+// AssignmentSubmission is one attempt of a student at an assignment. Every new
+// submission of the same student for the same assignment is the next attempt,
+// files and comments hang off the attempt they belong to.
 type AssignmentSubmission struct {
 	ID           uuid.UUID `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
 	AssignmentID uuid.UUID `json:"assignment_id" gorm:"type:uuid;not null"`
 	StudentID    uuid.UUID `json:"student_id" gorm:"type:uuid;not null"`
+	Attempt      int       `json:"attempt" gorm:"not null;default:1"`
 	SubmittedAt  time.Time `json:"submitted_at" gorm:"default:now()"`
 	Grade        *float64  `json:"grade"` //gorm:"check:grade >= 0 AND grade <= 10"
 	Feedback     *string   `json:"feedback"`
@@ -18,3 +22,12 @@ type AssignmentSubmission struct {
 	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
 	UpdatedAt    time.Time `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
 }
+
+// Submission statuses. Superseded attempts were replaced by a later attempt
+// before being graded and no longer wait for grading.
+const (
+	SubmissionStatusPending    = "pending"
+	SubmissionStatusSubmitted  = "submitted"
+	SubmissionStatusGraded     = "graded"
+	SubmissionStatusSuperseded = "superseded"
+)
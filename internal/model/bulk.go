@@ -0,0 +1,50 @@
+package model
+
+// Bulk execution modes
+const (
+	// BulkModeAtomic applies every item in one transaction, or none of them
+	BulkModeAtomic = "atomic"
+	// BulkModeBestEffort applies each item on its own and keeps the successful ones
+	BulkModeBestEffort = "best_effort"
+)
+
+// BulkCreate is the request body of the bulk create endpoints
+type BulkCreate[M any] struct {
+	Mode  string `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Items []M    `json:"items" binding:"required"`
+}
+
+// BulkUpdateItem is one item of a bulk update, the id of the row and its new values
+type BulkUpdateItem[M any] struct {
+	ID   string `json:"id" binding:"required,uuid"`
+	Data M      `json:"data"`
+}
+
+// BulkUpdate is the request body of the bulk update endpoints
+type BulkUpdate[M any] struct {
+	Mode  string              `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Items []BulkUpdateItem[M] `json:"items" binding:"required"`
+}
+
+// BulkDelete is the request body of the bulk delete endpoints
+type BulkDelete struct {
+	Mode string   `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	IDs  []string `json:"ids" binding:"required"`
+}
+
+// BulkItemResult is the outcome of one item, reported by its index in the request
+type BulkItemResult struct {
+	Index  int         `json:"index"`
+	ID     string      `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// BulkResult is the response of the bulk endpoints
+type BulkResult struct {
+	Mode      string           `json:"mode"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+}
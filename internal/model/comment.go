@@ -10,7 +10,7 @@ import (
 type Comment struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
 	UserID       uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	SubmissionID uuid.UUID `gorm:"type:uuid;not null" json:"submission_id"`
+	SubmissionID uuid.UUID `gorm:"type:uuid;not null;index" json:"submission_id"` // assignment submission
 	Content      string    `gorm:"type:text;not null" json:"content"`
 	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
 	UpdatedAt    time.Time `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
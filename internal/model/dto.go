@@ -48,20 +48,22 @@ type UpdateCourse struct {
 
 // Lesson DTOs
 type CreateLesson struct {
-	CourseID   uuid.UUID `json:"course_id" binding:"required"`
-	Title      string    `json:"title" binding:"required"`
-	Content    *string   `json:"content"`
-	Duration   *int      `json:"duration"`
-	OrderIndex int       `json:"order_index" binding:"required"`
-	Type       string    `json:"type"`
+	CourseID     uuid.UUID  `json:"course_id" binding:"required"`
+	Title        string     `json:"title" binding:"required"`
+	Content      *string    `json:"content"`
+	Duration     *int       `json:"duration"`
+	OrderIndex   int        `json:"order_index" binding:"required"`
+	Type         string     `json:"type"`
+	VideoAssetID *uuid.UUID `json:"video_asset_id"`
 }
 
 type UpdateLesson struct {
-	Title      string  `json:"title"`
-	Content    *string `json:"content"`
-	Duration   *int    `json:"duration"`
-	OrderIndex int     `json:"order_index"`
-	Type       string  `json:"type"`
+	Title        string     `json:"title"`
+	Content      *string    `json:"content"`
+	Duration     *int       `json:"duration"`
+	OrderIndex   int        `json:"order_index"`
+	Type         string     `json:"type"`
+	VideoAssetID *uuid.UUID `json:"video_asset_id"`
 }
 
 // Profile DTOs
@@ -122,16 +124,24 @@ type UpdateCourseEnrollment struct {
 
 // Grade DTOs
 type CreateGrade struct {
+	ID           uuid.UUID `json:"id"`
 	StudentID    uuid.UUID `json:"student_id" binding:"required"`
 	AssignmentID uuid.UUID `json:"assignment_id" binding:"required"`
 	CourseID     uuid.UUID `json:"course_id" binding:"required"`
 	Score        float64   `json:"score" binding:"required,min=0,max=100"`
 	Feedback     string    `json:"feedback"`
+	GradedBy     uuid.UUID `json:"graded_by"` // set to the caller, ignored in requests
 }
 
 type UpdateGrade struct {
 	Score    float64 `json:"score" binding:"required,min=0,max=100"`
 	Feedback string  `json:"feedback"`
+	Reason   string  `json:"reason"`
+}
+
+type RestoreGrade struct {
+	RevisionID uuid.UUID `json:"revision_id" binding:"required"`
+	Reason     string    `json:"reason"`
 }
 
 // Submission DTOs
@@ -222,6 +232,7 @@ type CreateAssignmentSubmission struct {
 	ID           uuid.UUID `json:"id"`
 	AssignmentID uuid.UUID `json:"assignment_id" binding:"required"`
 	StudentID    uuid.UUID `json:"student_id" binding:"required"`
+	Attempt      int       `json:"attempt"` // numbered by the server
 	Content      *string   `json:"content"`
 	Grade        *float64  `json:"grade" binding:"omitempty,min=0,max=10"`
 	Feedback     *string   `json:"feedback"`
@@ -234,3 +245,191 @@ type UpdateAssignmentSubmission struct {
 	Feedback *string  `json:"feedback"`
 	Status   string   `json:"status" binding:"required,oneof=pending submitted graded"`
 }
+
+// Upload DTOs
+type InitiateUpload struct {
+	Kind           string    `json:"kind" binding:"required,oneof=course_document assignment_document submission_file"`
+	ParentID       uuid.UUID `json:"parent_id" binding:"required"` // course, assignment or submission id
+	FileName       string    `json:"file_name" binding:"required,max=255"`
+	ContentType    string    `json:"content_type"` // ignored, the content type follows the file extension
+	Size           int64     `json:"size" binding:"required,min=1"`
+	ChecksumSHA256 string    `json:"checksum_sha256" binding:"required,len=64,hexadecimal"`
+	Title          *string   `json:"title"`
+	Description    *string   `json:"description"`
+}
+
+type UploadPartURL struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+}
+
+// UploadSession tells the client where to PUT the file: URL for a single
+// request, or one URL per part of PartSize bytes
+type UploadSession struct {
+	ID        uuid.UUID       `json:"id"`
+	Key       string          `json:"key"`
+	Method    string          `json:"method"`
+	URL       string          `json:"url,omitempty"`
+	PartSize  int64           `json:"part_size,omitempty"`
+	Parts     []UploadPartURL `json:"parts,omitempty"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+type CompleteUpload struct {
+	UploadID uuid.UUID `json:"upload_id" binding:"required"`
+}
+
+// Video DTOs
+type CreateVideoAsset struct {
+	FileURL string `json:"file_url" binding:"required"` // URL or object name of an uploaded video
+}
+
+// CreateVideoCaption describes an uploaded caption file, sent as a multipart
+// form with the file in the file field
+type CreateVideoCaption struct {
+	Language  string `form:"language" binding:"required"` // BCP 47 tag, e.g. en or vi
+	Kind      string `form:"kind" binding:"omitempty,oneof=subtitles captions"`
+	Label     string `form:"label"` // defaults to the language
+	IsDefault bool   `form:"is_default"`
+}
+
+type UpdateVideoCaption struct {
+	Label     *string `json:"label"`
+	IsDefault *bool   `json:"is_default"`
+}
+
+// CaptionCueInput is a cue added to or changed in a caption track
+type CaptionCueInput struct {
+	Identifier string `json:"identifier"`
+	StartMS    *int64 `json:"start_ms" binding:"required"`
+	EndMS      *int64 `json:"end_ms" binding:"required"`
+	Settings   string `json:"settings"`
+	Text       string `json:"text" binding:"required"`
+}
+
+// VideoChapterInput is a chapter of a video
+type VideoChapterInput struct {
+	Title string   `json:"title" binding:"required,max=200"`
+	Start *float64 `json:"start" binding:"required,min=0"` // seconds
+}
+
+// SetVideoChapters replaces the chapters of a video, no chapters removes them
+type SetVideoChapters struct {
+	Chapters []VideoChapterInput `json:"chapters" binding:"max=500,dive"`
+}
+
+// CheckpointOptionInput is a possible answer to the question of a checkpoint
+type CheckpointOptionInput struct {
+	Text    string `json:"text" binding:"required,max=500"`
+	Correct bool   `json:"correct"`
+}
+
+// SaveVideoCheckpoint creates a checkpoint of a video or replaces one
+type SaveVideoCheckpoint struct {
+	At          *float64                `json:"at" binding:"required,min=0"` // seconds
+	Question    string                  `json:"question" binding:"required,max=2000"`
+	Kind        string                  `json:"kind" binding:"omitempty,oneof=single multiple"` // single by default
+	Options     []CheckpointOptionInput `json:"options" binding:"required,min=2,max=10,dive"`
+	Explanation *string                 `json:"explanation"`
+	Blocking    *bool                   `json:"blocking"` // video_checkpoint_blocking by default
+}
+
+// CheckpointAnswerInput is the answer of a student to a checkpoint
+type CheckpointAnswerInput struct {
+	OptionIDs []uuid.UUID `json:"option_ids" binding:"required,min=1,max=10"`
+}
+
+// CheckpointResult is a graded answer. The checkpoint is passed once answered
+// correctly, or answered at all when it is not blocking, then the video may go
+// on and the correct options are shown.
+type CheckpointResult struct {
+	Answer           CheckpointAnswer `json:"answer"`
+	Passed           bool             `json:"passed"`
+	CorrectOptionIDs []uuid.UUID      `json:"correct_option_ids,omitempty"`
+	Explanation      *string          `json:"explanation,omitempty"`
+}
+
+// LessonCheckpoint is a checkpoint of a lesson video as the player gets it,
+// with the answers of the caller
+type LessonCheckpoint struct {
+	VideoCheckpoint
+	Attempts int  `json:"attempts"`
+	Passed   bool `json:"passed"`
+}
+
+// CheckpointStudentResult sums up the answers of a student to a checkpoint
+type CheckpointStudentResult struct {
+	CheckpointID    uuid.UUID `json:"checkpoint_id"`
+	Attempts        int       `json:"attempts"`
+	Correct         bool      `json:"correct"`           // answered correctly at some attempt
+	FirstTryCorrect bool      `json:"first_try_correct"` // answered correctly at the first attempt
+	Passed          bool      `json:"passed"`
+	LastAnsweredAt  time.Time `json:"last_answered_at"`
+}
+
+// CheckpointStudentResults are the answers of a student to the checkpoints of
+// a lesson, checkpoints not answered yet are left out
+type CheckpointStudentResults struct {
+	UserID      uuid.UUID                 `json:"user_id"`
+	Passed      int                       `json:"passed"` // checkpoints
+	Correct     int                       `json:"correct"`
+	Checkpoints []CheckpointStudentResult `json:"checkpoints"`
+}
+
+// LessonCheckpointResults are the answers of the students to the checkpoints
+// of a lesson video
+type LessonCheckpointResults struct {
+	LessonID    uuid.UUID                  `json:"lesson_id"`
+	Checkpoints int                        `json:"checkpoints"`
+	Students    []CheckpointStudentResults `json:"students"`
+}
+
+// RevokeVideoKeys asks to revoke the keys of a video
+type RevokeVideoKeys struct {
+	// Encrypt the video again with new keys, otherwise it cannot be played anymore
+	Reencrypt bool `json:"reencrypt"`
+}
+
+// VideoPlayback gives access to a video until ExpiresAt, the URLs other than
+// StreamURL are empty until the video is ready. StreamURL is empty for
+// encrypted videos.
+type VideoPlayback struct {
+	Token         string    `json:"token"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Status        string    `json:"status"`
+	PlaylistURL   string    `json:"playlist_url,omitempty"`
+	StreamURL     string    `json:"stream_url,omitempty"`
+	PosterURL     string    `json:"poster_url,omitempty"`
+	ThumbnailsURL string    `json:"thumbnails_url,omitempty"` // WebVTT thumbnails track
+	ChaptersURL   string    `json:"chapters_url,omitempty"`   // WebVTT chapters track
+}
+
+// ProgressHeartbeat is sent by the player while a lesson video plays
+type ProgressHeartbeat struct {
+	Position  *float64          `json:"position" binding:"required,min=0"` // seconds
+	Intervals []WatchedInterval `json:"intervals" binding:"max=100"`       // played since the last heartbeat
+}
+
+// VideoAnalyticsBucket is a stretch of the video in the analytics of a video
+type VideoAnalyticsBucket struct {
+	Start     int     `json:"start"` // seconds
+	Views     int64   `json:"views"`
+	Viewers   int64   `json:"viewers"`   // once per viewer and day
+	Rewatches int64   `json:"rewatches"` // views by viewers who had watched it before that day
+	Retention float64 `json:"retention"` // percent of the viewers who watched it, the drop-off curve
+}
+
+// VideoAnalytics is how the viewers of a video watched it
+type VideoAnalytics struct {
+	AssetID             uuid.UUID              `json:"asset_id"`
+	CourseID            *uuid.UUID             `json:"course_id,omitempty"`
+	From                *string                `json:"from,omitempty"`
+	To                  *string                `json:"to,omitempty"`
+	Duration            float64                `json:"duration"`
+	BucketSeconds       int                    `json:"bucket_seconds"`
+	UniqueViewers       int64                  `json:"unique_viewers"`
+	Completions         int64                  `json:"completions"`
+	AverageWatchPercent float64                `json:"average_watch_percent"`
+	Heatmap             []VideoAnalyticsBucket `json:"heatmap"`
+}
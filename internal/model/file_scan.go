@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileScan tracks the malware scan of a stored file. Files with a scan that
+// is not clean cannot be downloaded, infected files are moved to
+// QuarantineKey.
+type FileScan struct {
+	ID            uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	Key           string     `json:"key" gorm:"not null;uniqueIndex"`
+	UploaderID    uuid.UUID  `json:"uploader_id" gorm:"type:uuid"`
+	FileName      string     `json:"file_name" gorm:"not null"`
+	Status        string     `json:"status" gorm:"not null;default:'pending_scan';index"`
+	Signature     *string    `json:"signature"` // malware found in infected files
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	Error         *string    `json:"error"` // last scan error
+	QuarantineKey *string    `json:"quarantine_key"`
+	ScannedAt     *time.Time `json:"scanned_at"`
+	CreatedAt     time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt     time.Time  `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// File scan statuses
+const (
+	FileScanStatusPending  = "pending_scan"
+	FileScanStatusClean    = "clean"
+	FileScanStatusInfected = "infected"
+	FileScanStatusSkipped  = "skipped" // no longer written, files skipped as too large stay blocked
+	FileScanStatusFailed   = "failed"  // scan_max_attempts scans failed
+)
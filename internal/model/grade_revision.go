@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GradeRevision is an immutable snapshot of a grade, written every time the
+// grade is created, changed, restored or deleted. Rows are never updated.
+type GradeRevision struct {
+	ID           uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	GradeID      uuid.UUID  `json:"grade_id" gorm:"type:uuid;not null;uniqueIndex:idx_grade_revision_grade_revision"`
+	Revision     int        `json:"revision" gorm:"not null;uniqueIndex:idx_grade_revision_grade_revision"`
+	StudentID    uuid.UUID  `json:"student_id" gorm:"type:uuid;index"`
+	CourseID     uuid.UUID  `json:"course_id" gorm:"type:uuid"`
+	AssignmentID uuid.UUID  `json:"assignment_id" gorm:"type:uuid"`
+	Score        float64    `json:"score" gorm:"not null"`
+	MaxScore     float64    `json:"max_score" gorm:"not null;default:100"`
+	Feedback     *string    `json:"feedback"`
+	GradedBy     uuid.UUID  `json:"graded_by" gorm:"type:uuid"`
+	Reason       string     `json:"reason"`
+	RestoredFrom *uuid.UUID `json:"restored_from,omitempty" gorm:"type:uuid"`
+	Deleted      bool       `json:"deleted" gorm:"default:false"`
+	CreatedAt    time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+}
+
+// Reasons recorded when the client does not give one
+const (
+	GradeRevisionReasonCreated  = "created"
+	GradeRevisionReasonUpdated  = "updated"
+	GradeRevisionReasonDeleted  = "deleted"
+	GradeRevisionReasonRestored = "restored"
+	GradeRevisionReasonImported = "imported"
+)
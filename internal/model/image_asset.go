@@ -0,0 +1,65 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImageVariants maps the variants of an image (thumbnail, medium, large) to
+// the URL of each of their formats (webp, jpeg)
+type ImageVariants map[string]map[string]string
+
+// For gorm:"type:jsonb", no variants are stored as NULL
+func (v *ImageVariants) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, v)
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	}
+	return fmt.Errorf("cannot scan %T into ImageVariants", src)
+}
+
+func (v ImageVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	val, err := json.Marshal(v)
+	return string(val), err
+}
+
+// ImageAsset is the processing of an uploaded image into resized variants
+// stored next to it. Avatars are processed separately from other images
+// since their variants are cropped square.
+type ImageAsset struct {
+	ID          uuid.UUID     `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	Key         string        `json:"key" gorm:"not null;uniqueIndex:idx_image_asset_key_purpose"`
+	Purpose     string        `json:"purpose" gorm:"not null;uniqueIndex:idx_image_asset_key_purpose"`
+	Status      string        `json:"status" gorm:"not null;default:'queued';index"`
+	Variants    ImageVariants `json:"variants" gorm:"type:jsonb"`
+	Attempts    int           `json:"attempts" gorm:"not null;default:0"`
+	Error       *string       `json:"error"` // last processing error
+	ProcessedAt *time.Time    `json:"processed_at"`
+	CreatedAt   time.Time     `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt   time.Time     `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// Image purposes
+const (
+	ImagePurposeImage  = "image"
+	ImagePurposeAvatar = "avatar"
+)
+
+// Image asset statuses
+const (
+	ImageStatusQueued = "queued"
+	ImageStatusReady  = "ready"
+	ImageStatusFailed = "failed"
+)
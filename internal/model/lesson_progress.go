@@ -0,0 +1,59 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WatchedInterval is a stretch of a video a viewer played, in seconds
+type WatchedInterval struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// WatchedIntervals are stored as jsonb, merged and ordered by start
+type WatchedIntervals []WatchedInterval
+
+func (w *WatchedIntervals) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*w = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, w)
+	case string:
+		return json.Unmarshal([]byte(src), w)
+	}
+	return fmt.Errorf("cannot scan %T into WatchedIntervals", src)
+}
+
+func (w WatchedIntervals) Value() (driver.Value, error) {
+	if w == nil {
+		return "[]", nil
+	}
+	val, err := json.Marshal(w)
+	return string(val), err
+}
+
+// LessonProgress is what a user watched of the video of a lesson. The lesson
+// is complete once WatchedPercent reaches lesson_complete_percent and every
+// checkpoint of the video is passed.
+type LessonProgress struct {
+	ID             uuid.UUID        `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	LessonID       uuid.UUID        `json:"lesson_id" gorm:"type:uuid;not null;uniqueIndex:idx_lesson_progress_viewer"`
+	UserID         uuid.UUID        `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_lesson_progress_viewer;index"`
+	CourseID       uuid.UUID        `json:"course_id" gorm:"type:uuid;not null;index"`
+	Intervals      WatchedIntervals `json:"intervals" gorm:"type:jsonb;not null"`
+	WatchedSeconds float64          `json:"watched_seconds" gorm:"not null;default:0"` // unique seconds
+	WatchedPercent float64          `json:"watched_percent" gorm:"not null;default:0"` // of the video duration
+	Position       float64          `json:"position" gorm:"not null;default:0"`        // resume position, seconds
+	CompletedAt    *time.Time       `json:"completed_at"`
+	LastWatchedAt  time.Time        `json:"last_watched_at"`
+	DayIntervals   WatchedIntervals `json:"-" gorm:"type:jsonb;not null;default:'[]'"` // played on the day of LastWatchedAt, UTC
+	CreatedAt      time.Time        `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt      time.Time        `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
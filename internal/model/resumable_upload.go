@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResumableUpload is a tus upload. The bytes received so far are stored as
+// chunks next to the final object and joined once Offset reaches Length.
+type ResumableUpload struct {
+	ID          uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	FileName    string     `json:"file_name" gorm:"not null"`
+	ContentType string     `json:"content_type" gorm:"not null"`
+	Key         string     `json:"key" gorm:"not null"` // final object, named like UploadFile names it
+	Length      int64      `json:"length" gorm:"not null"`
+	Offset      int64      `json:"offset" gorm:"not null;default:0"`
+	Metadata    string     `json:"metadata"` // Upload-Metadata header as sent
+	Status      string     `json:"status" gorm:"not null;default:'uploading';index:idx_resumable_upload_status_expires_at"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null;index:idx_resumable_upload_status_expires_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt   time.Time  `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// ResumableUploadChunk is a stored run of bytes of a resumable upload. Key
+// is unique per PATCH, so concurrent PATCHes at the same offset never write
+// the same object; it is empty for chunks stored before it was recorded.
+type ResumableUploadChunk struct {
+	UploadID uuid.UUID `json:"upload_id" gorm:"type:uuid;primaryKey"`
+	Offset   int64     `json:"offset" gorm:"primaryKey;autoIncrement:false"`
+	Size     int64     `json:"size" gorm:"not null"`
+	Key      string    `json:"key" gorm:"not null;default:''"`
+}
+
+// Resumable upload statuses
+const (
+	ResumableUploadStatusUploading  = "uploading"
+	ResumableUploadStatusCompleted  = "completed"
+	ResumableUploadStatusTerminated = "terminated"
+	ResumableUploadStatusExpired    = "expired"
+	ResumableUploadStatusRejected   = "rejected" // content does not match the file extension
+)
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+// Searchable resource types returned by the search endpoint
+const (
+	SearchTypeCourse             = "course"
+	SearchTypeLesson             = "lesson"
+	SearchTypeAssignment         = "assignment"
+	SearchTypeCourseDocument     = "course_document"
+	SearchTypeAssignmentDocument = "assignment_document"
+)
+
+// SearchResult is one ranked hit of the full-text search
+type SearchResult struct {
+	Type     string    `json:"type"`
+	ID       uuid.UUID `json:"id"`
+	CourseID uuid.UUID `json:"course_id"`
+	Title    string    `json:"title"`
+	Snippet  string    `json:"snippet"` // HTML escaped, matches wrapped in <mark>
+	Rank     float64   `json:"rank"`
+	Total    int64     `json:"-"`
+}
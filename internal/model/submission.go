@@ -4,17 +4,19 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
+// Submission is the shape of the deprecated /submissions API. Its rows were
+// merged into AssignmentSubmission, the routes render attempts in this shape
+// until they are removed.
 type Submission struct {
-	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	StudentID    uuid.UUID `gorm:"type:uuid;not null" json:"student_id"`
-	AssignmentID uuid.UUID `gorm:"type:uuid;not null" json:"assignment_id"`
-	Content      string    `gorm:"type:text;not null" json:"content"`
-	FileURL      string    `gorm:"type:text" json:"file_url"`
-	Status       string    `gorm:"type:varchar(20);not null;default:'submitted'" json:"status"` // submitted, graded
-	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
-	UpdatedAt    time.Time `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
-	DeletedAt    gorm.DeletedAt
+	ID           uuid.UUID  `json:"id"`
+	StudentID    uuid.UUID  `json:"student_id"`
+	AssignmentID uuid.UUID  `json:"assignment_id"`
+	Content      string     `json:"content"`
+	FileURL      string     `json:"file_url"`
+	Status       string     `json:"status"` // submitted, graded
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	DeletedAt    *time.Time `json:"DeletedAt"` // always null, kept for existing clients
 }
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload is a file sent by the client straight to the file storage. The row
+// it becomes is only created when the upload is completed, uploads left
+// pending past ExpiresAt are dropped with their object.
+type Upload struct {
+	ID             uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	UploaderID     uuid.UUID  `json:"uploader_id" gorm:"type:uuid;not null"`
+	Kind           string     `json:"kind" gorm:"not null"`
+	ParentID       uuid.UUID  `json:"parent_id" gorm:"type:uuid;not null"`
+	Key            string     `json:"key" gorm:"not null;uniqueIndex"`
+	FileName       string     `json:"file_name" gorm:"not null"`
+	ContentType    string     `json:"content_type" gorm:"not null"`
+	Size           int64      `json:"size" gorm:"not null"`
+	ChecksumSHA256 string     `json:"checksum_sha256" gorm:"column:checksum_sha256;not null"`
+	Title          *string    `json:"title"`
+	Description    *string    `json:"description"`
+	MultipartID    *string    `json:"-"`
+	PartSize       int64      `json:"part_size"`
+	Status         string     `json:"status" gorm:"not null;default:'pending';index:idx_upload_status_expires_at"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null;index:idx_upload_status_expires_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	ResultID       *uuid.UUID `json:"result_id" gorm:"type:uuid"` // row created on completion
+	CreatedAt      time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt      time.Time  `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// Rows an upload can become
+const (
+	UploadKindCourseDocument     = "course_document"
+	UploadKindAssignmentDocument = "assignment_document"
+	UploadKindSubmissionFile     = "submission_file"
+)
+
+// Upload statuses
+const (
+	UploadStatusPending   = "pending"
+	UploadStatusCompleted = "completed"
+	UploadStatusFailed    = "failed"
+	UploadStatusExpired   = "expired"
+)
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoRendition is one quality of the HLS ladder of a video
+type VideoRendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	VideoBitrate int    `json:"video_bitrate"` // kbit/s
+	AudioBitrate int    `json:"audio_bitrate"` // kbit/s
+	PlaylistURL  string `json:"playlist_url"`
+}
+
+// VideoRenditions are stored as jsonb, no renditions as NULL
+type VideoRenditions []VideoRendition
+
+func (r *VideoRenditions) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, r)
+	case string:
+		return json.Unmarshal([]byte(src), r)
+	}
+	return fmt.Errorf("cannot scan %T into VideoRenditions", src)
+}
+
+func (r VideoRenditions) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	val, err := json.Marshal(r)
+	return string(val), err
+}
+
+// VideoThumbnails lays out the preview thumbnails of a video on the sprite
+// sheets stored under thumbnails/ next to the master playlist
+type VideoThumbnails struct {
+	Interval float64 `json:"interval"` // seconds between thumbnails
+	Width    int     `json:"width"`    // of a thumbnail
+	Height   int     `json:"height"`
+	Columns  int     `json:"columns"` // thumbnails per row of a sheet
+	Rows     int     `json:"rows"`    // rows per sheet
+	Count    int     `json:"count"`
+	Sheets   int     `json:"sheets"`
+}
+
+func (t *VideoThumbnails) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, t)
+	case string:
+		return json.Unmarshal([]byte(src), t)
+	}
+	return fmt.Errorf("cannot scan %T into VideoThumbnails", src)
+}
+
+func (t VideoThumbnails) Value() (driver.Value, error) {
+	val, err := json.Marshal(t)
+	return string(val), err
+}
+
+// VideoAsset is the transcoding of an uploaded video into HLS renditions,
+// stored next to the video with the master playlist at PlaylistURL. Progress
+// goes from 0 to 100 while the video is processing.
+type VideoAsset struct {
+	ID          uuid.UUID        `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	Key         string           `json:"key" gorm:"not null;uniqueIndex"` // uploaded original
+	UploaderID  uuid.UUID        `json:"uploader_id" gorm:"type:uuid"`
+	Status      string           `json:"status" gorm:"not null;default:'queued';index"`
+	Progress    float64          `json:"progress" gorm:"not null;default:0"`
+	Duration    *float64         `json:"duration"` // seconds, once probed
+	Width       *int             `json:"width"`
+	Height      *int             `json:"height"`
+	PlaylistURL *string          `json:"playlist_url"`
+	Renditions  VideoRenditions  `json:"renditions" gorm:"type:jsonb"`
+	PosterURL   *string          `json:"poster_url"`
+	Thumbnails  *VideoThumbnails `json:"thumbnails" gorm:"type:jsonb"`
+	Attempts    int              `json:"attempts" gorm:"not null;default:0"`
+	Error       *string          `json:"error"` // last transcoding error
+	StartedAt   *time.Time       `json:"started_at"`
+	ProcessedAt *time.Time       `json:"processed_at"`
+	CreatedAt   time.Time        `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt   time.Time        `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// Video asset statuses
+const (
+	VideoStatusQueued     = "queued"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed" // video_max_attempts transcodings failed
+)
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CaptionCue is one cue of a caption track, times in milliseconds from the
+// start of the video
+type CaptionCue struct {
+	ID         uuid.UUID `json:"id"`
+	Identifier string    `json:"identifier,omitempty"` // WebVTT cue identifier
+	StartMS    int64     `json:"start_ms"`
+	EndMS      int64     `json:"end_ms"`
+	Settings   string    `json:"settings,omitempty"` // WebVTT cue settings
+	Text       string    `json:"text"`
+}
+
+// CaptionCues are stored as jsonb, ordered by start
+type CaptionCues []CaptionCue
+
+func (c *CaptionCues) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	}
+	return fmt.Errorf("cannot scan %T into CaptionCues", src)
+}
+
+func (c CaptionCues) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	val, err := json.Marshal(c)
+	return string(val), err
+}
+
+// VideoCaption is a caption track of a video in one language, listed in the
+// HLS master playlist as a subtitle rendition
+type VideoCaption struct {
+	ID        uuid.UUID   `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	AssetID   uuid.UUID   `json:"asset_id" gorm:"type:uuid;not null;uniqueIndex:idx_video_caption_track"`
+	Language  string      `json:"language" gorm:"not null;uniqueIndex:idx_video_caption_track"` // BCP 47 tag
+	Kind      string      `json:"kind" gorm:"not null;default:'subtitles';uniqueIndex:idx_video_caption_track"`
+	Label     string      `json:"label" gorm:"not null"`
+	IsDefault bool        `json:"is_default" gorm:"not null;default:false"`
+	Format    string      `json:"format"` // of the uploaded file, vtt or srt
+	Cues      CaptionCues `json:"cues,omitempty" gorm:"type:jsonb;not null"`
+	CreatedBy uuid.UUID   `json:"created_by" gorm:"type:uuid"`
+	CreatedAt time.Time   `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt time.Time   `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// Caption kinds
+const (
+	CaptionKindSubtitles = "subtitles" // translate the dialog
+	CaptionKindCaptions  = "captions"  // transcribe dialog and sounds for the deaf and hard of hearing
+)
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoChapter is a named part of a video, from Start to the start of the
+// next chapter or the end of the video
+type VideoChapter struct {
+	ID        uuid.UUID `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	AssetID   uuid.UUID `json:"asset_id" gorm:"type:uuid;not null;uniqueIndex:idx_video_chapter_start"`
+	Title     string    `json:"title" gorm:"not null"`
+	Start     float64   `json:"start" gorm:"not null;uniqueIndex:idx_video_chapter_start"` // seconds
+	End       float64   `json:"end" gorm:"-"`                                              // seconds, worked out from the next chapter
+	CreatedBy uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CheckpointOption is a possible answer to the question of a checkpoint
+type CheckpointOption struct {
+	ID      uuid.UUID `json:"id"`
+	Text    string    `json:"text"`
+	Correct bool      `json:"correct,omitempty"` // not shown to students
+}
+
+// CheckpointOptions are stored as jsonb
+type CheckpointOptions []CheckpointOption
+
+func (o *CheckpointOptions) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, o)
+	case string:
+		return json.Unmarshal([]byte(src), o)
+	}
+	return fmt.Errorf("cannot scan %T into CheckpointOptions", src)
+}
+
+func (o CheckpointOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "[]", nil
+	}
+	val, err := json.Marshal(o)
+	return string(val), err
+}
+
+// CheckpointChoices are the options picked in an answer, stored as jsonb
+type CheckpointChoices []uuid.UUID
+
+func (c *CheckpointChoices) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	}
+	return fmt.Errorf("cannot scan %T into CheckpointChoices", src)
+}
+
+func (c CheckpointChoices) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	val, err := json.Marshal(c)
+	return string(val), err
+}
+
+// VideoCheckpoint is a question the player asks when the video reaches At.
+// Blocking checkpoints keep the video paused until the viewer answers
+// correctly, the others go on after any answer. A lesson is only complete
+// once every checkpoint of its video is answered, the blocking ones correctly.
+type VideoCheckpoint struct {
+	ID          uuid.UUID         `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	AssetID     uuid.UUID         `json:"asset_id" gorm:"type:uuid;not null;index"`
+	At          float64           `json:"at" gorm:"not null"` // seconds
+	Question    string            `json:"question" gorm:"not null"`
+	Kind        string            `json:"kind" gorm:"not null;default:'single'"`
+	Options     CheckpointOptions `json:"options" gorm:"type:jsonb;not null"`
+	Explanation *string           `json:"explanation,omitempty"` // shown once answered correctly
+	Blocking    bool              `json:"blocking" gorm:"not null"`
+	CreatedBy   uuid.UUID         `json:"created_by" gorm:"type:uuid"`
+	CreatedAt   time.Time         `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+	UpdatedAt   time.Time         `json:"updatedAt" gorm:"column:updated_at;autoUpdateTime:true"`
+}
+
+// Checkpoint kinds
+const (
+	CheckpointKindSingle   = "single"   // one correct option
+	CheckpointKindMultiple = "multiple" // every correct option and no other
+)
+
+// CheckpointAnswer is an attempt of a student at a checkpoint of a lesson
+// video, graded when it is submitted
+type CheckpointAnswer struct {
+	ID           uuid.UUID         `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	CheckpointID uuid.UUID         `json:"checkpoint_id" gorm:"type:uuid;not null;index:idx_checkpoint_answer_viewer"`
+	UserID       uuid.UUID         `json:"user_id" gorm:"type:uuid;not null;index:idx_checkpoint_answer_viewer"`
+	LessonID     uuid.UUID         `json:"lesson_id" gorm:"type:uuid;not null;index"`
+	CourseID     uuid.UUID         `json:"course_id" gorm:"type:uuid;not null"`
+	OptionIDs    CheckpointChoices `json:"option_ids" gorm:"type:jsonb;not null"`
+	Correct      bool              `json:"correct" gorm:"not null"`
+	Attempt      int               `json:"attempt" gorm:"not null"` // counted from 1 per student and checkpoint
+	CreatedAt    time.Time         `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoEngagementBucket counts what the viewers of a course watched of a
+// video on a day, for the video_analytics_bucket seconds from Second. Rows
+// are incremented as watch progress is written.
+type VideoEngagementBucket struct {
+	AssetID  uuid.UUID `json:"asset_id" gorm:"type:uuid;primaryKey"`
+	CourseID uuid.UUID `json:"course_id" gorm:"type:uuid;primaryKey"`
+	Day      time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Second   int       `json:"second" gorm:"primaryKey;autoIncrement:false"`
+	Views    int64     `json:"views" gorm:"not null;default:0"`   // plays, rewatches included
+	Viewers  int64     `json:"viewers" gorm:"not null;default:0"` // viewers watching it for the first time that day
+}
+
+// VideoEngagementDay sums up what the viewers of a course watched of a video
+// on a day
+type VideoEngagementDay struct {
+	AssetID        uuid.UUID `json:"asset_id" gorm:"type:uuid;primaryKey"`
+	CourseID       uuid.UUID `json:"course_id" gorm:"type:uuid;primaryKey"`
+	Day            time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Viewers        int64     `json:"viewers" gorm:"not null;default:0"`         // watched that day
+	Completions    int64     `json:"completions" gorm:"not null;default:0"`     // completed the lesson that day
+	WatchedSeconds float64   `json:"watched_seconds" gorm:"not null;default:0"` // unique seconds of each viewer that day
+	PlayedSeconds  float64   `json:"played_seconds" gorm:"not null;default:0"`  // rewatches included
+}
+
+// VideoEngagementViewer records that a viewer of a course watched a video on
+// a day, so the distinct viewers of any range of days can be counted
+type VideoEngagementViewer struct {
+	AssetID  uuid.UUID `json:"asset_id" gorm:"type:uuid;primaryKey"`
+	CourseID uuid.UUID `json:"course_id" gorm:"type:uuid;primaryKey"`
+	Day      time.Time `json:"day" gorm:"type:date;primaryKey"`
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoKey is the AES-128 key of a run of HLS segments of a video. Players get
+// it from the key server with a playback token, never once it is revoked.
+type VideoKey struct {
+	ID        uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	AssetID   uuid.UUID  `json:"asset_id" gorm:"type:uuid;not null;index"`
+	Run       int        `json:"run" gorm:"not null"` // segments run*video_key_rotation onwards
+	Key       []byte     `json:"-" gorm:"type:bytea;not null"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true"`
+}
+
+// VideoKeyAccess records a request for a key, granted or not. Rows are never
+// updated.
+type VideoKeyAccess struct {
+	ID        uuid.UUID  `json:"id" gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
+	AssetID   uuid.UUID  `json:"asset_id" gorm:"type:uuid;not null;index"`
+	KeyID     uuid.UUID  `json:"key_id" gorm:"type:uuid;not null"`
+	UserID    *uuid.UUID `json:"user_id" gorm:"type:uuid;index"` // nil for invalid tokens
+	Granted   bool       `json:"granted" gorm:"not null"`
+	Reason    string     `json:"reason,omitempty"` // why the key was refused
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"column:created_at;autoCreateTime:true;index"`
+}
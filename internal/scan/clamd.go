@@ -0,0 +1,164 @@
+/*
+Package scan checks uploaded files for malware.
+
+Clamd talks to a ClamAV daemon over its socket protocol: the file is streamed
+with INSTREAM in length prefixed chunks and clamd answers with OK, the name of
+the signature it found, or an error. Anything speaking the same protocol, such
+as a fake daemon in tests, can stand in for clamd.
+*/
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Result is the verdict on a file, Signature names the malware found
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks files for malware
+type Scanner interface {
+	// Scan reads r to its end and returns the verdict
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+	// Ping checks that the scanner can be used
+	Ping(ctx context.Context) error
+}
+
+// ErrSizeLimit is returned when the file exceeds the StreamMaxLength of clamd
+var ErrSizeLimit = errors.New("file exceeds the clamd stream size limit")
+
+// chunkSize is the size of the INSTREAM chunks
+const chunkSize = 64 << 10
+
+// Clamd scans files with a ClamAV daemon
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd returns a client of the daemon listening on address:
+// tcp://host:port, unix:///path/to/clamd.sock or host:port. Every command
+// must complete within timeout.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	network, addr := "tcp", address
+	if scheme, rest, ok := strings.Cut(address, "://"); ok {
+		network, addr = scheme, rest
+	}
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("unsupported clamd address %s, expected tcp://host:port or unix:///path", address)
+	}
+	if addr == "" {
+		return nil, errors.New("clamd address is empty")
+	}
+	return &Clamd{network: network, address: addr, timeout: timeout}, nil
+}
+
+// command connects to the daemon and sends a null terminated command
+func (c *Clamd) command(ctx context.Context, name string) (net.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte("z" + name + "\x00")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// reply reads the null terminated answer of the daemon
+func reply(conn net.Conn) (string, error) {
+	line, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\x00\n"), nil
+}
+
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.command(ctx, "PING")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	answer, err := reply(conn)
+	if err != nil {
+		return err
+	}
+	if answer != "PONG" {
+		return fmt.Errorf("unexpected clamd answer %q", answer)
+	}
+	return nil
+}
+
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.command(ctx, "INSTREAM")
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the connection once the size limit is hit,
+				// its answer tells why
+				break
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	// A zero length chunk ends the stream
+	conn.Write([]byte{0, 0, 0, 0})
+
+	answer, err := reply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseReply(answer)
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or
+// "<message> ERROR"
+func parseReply(answer string) (Result, error) {
+	answer = strings.TrimPrefix(answer, "stream: ")
+	switch {
+	case answer == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(answer, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(answer, " FOUND")}, nil
+	case strings.Contains(answer, "size limit exceeded"):
+		return Result{}, ErrSizeLimit
+	case strings.HasSuffix(answer, " ERROR"):
+		return Result{}, fmt.Errorf("clamd error: %s", strings.TrimSuffix(answer, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("unexpected clamd answer %q", answer)
+}
@@ -0,0 +1,175 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd speaks the clamd protocol on a local socket. It answers PING
+// with PONG and INSTREAM with answer(content), closing the stream once it
+// exceeds maxLength like clamd's StreamMaxLength does.
+type fakeClamd struct {
+	listener  net.Listener
+	maxLength int
+	answer    func(content []byte) string
+}
+
+func newFakeClamd(t *testing.T, maxLength int, answer func(content []byte) string) *Clamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeClamd{listener: listener, maxLength: maxLength, answer: answer}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	clamd, err := NewClamd("tcp://"+listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clamd
+}
+
+func (f *fakeClamd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch strings.TrimSuffix(command, "\x00") {
+	case "zPING":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM":
+		var content bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+				return
+			}
+			if f.maxLength > 0 && content.Len() > f.maxLength {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+		}
+		conn.Write([]byte(f.answer(content.Bytes()) + "\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+// eicar answers like clamd with the EICAR test signature
+func eicar(content []byte) string {
+	if bytes.Contains(content, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+		return "stream: Eicar-Test-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamdPing(t *testing.T) {
+	clamd := newFakeClamd(t, 0, eicar)
+	if err := clamd.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClamdScan(t *testing.T) {
+	clamd := newFakeClamd(t, 1<<20, eicar)
+	tests := []struct {
+		name     string
+		content  []byte
+		infected bool
+		err      error
+	}{
+		{name: "empty", content: nil},
+		{name: "clean", content: bytes.Repeat([]byte("a"), 3*chunkSize+17)},
+		{name: "infected", content: []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`), infected: true},
+		{name: "too large", content: bytes.Repeat([]byte("a"), 2<<20), err: ErrSizeLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := clamd.Scan(context.Background(), bytes.NewReader(tt.content))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if result.Infected != tt.infected {
+				t.Fatalf("got infected %v, want %v", result.Infected, tt.infected)
+			}
+			if tt.infected && result.Signature != "Eicar-Test-Signature" {
+				t.Fatalf("got signature %q", result.Signature)
+			}
+		})
+	}
+}
+
+func TestClamdScanError(t *testing.T) {
+	clamd := newFakeClamd(t, 0, func([]byte) string { return "Can't allocate memory ERROR" })
+	_, err := clamd.Scan(context.Background(), strings.NewReader("content"))
+	if err == nil || errors.Is(err, ErrSizeLimit) || !strings.Contains(err.Error(), "Can't allocate memory") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	clamd, err := NewClamd(address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clamd.Ping(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("content")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		answer   string
+		infected bool
+		err      bool
+	}{
+		{answer: "stream: OK"},
+		{answer: "stream: Win.Test.EICAR_HDB-1 FOUND", infected: true},
+		{answer: "INSTREAM size limit exceeded. ERROR", err: true},
+		{answer: "stream: lstat() failed ERROR", err: true},
+		{answer: "garbage", err: true},
+	}
+	for _, tt := range tests {
+		result, err := parseReply(tt.answer)
+		if (err != nil) != tt.err || result.Infected != tt.infected {
+			t.Errorf("parseReply(%q) = %+v, %v", tt.answer, result, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package seed
+
+var familyNames = []string{
+	"Nguyễn", "Trần", "Lê", "Phạm", "Hoàng", "Huỳnh", "Phan", "Vũ", "Võ", "Đặng", "Bùi", "Đỗ", "Hồ", "Ngô", "Dương", "Lý",
+}
+
+var middleNames = []string{
+	"Văn", "Thị", "Minh", "Ngọc", "Đức", "Thanh", "Quốc", "Hữu", "Thu", "Gia", "Bảo", "Khánh",
+}
+
+var givenNames = []string{
+	"An", "Bình", "Châu", "Dũng", "Giang", "Hà", "Hải", "Hạnh", "Hùng", "Khánh", "Linh", "Long", "Mai", "Nam",
+	"Nhung", "Phúc", "Quân", "Sơn", "Thảo", "Trang", "Tuấn", "Vy", "Yến", "Đạt", "Hiếu", "Lan", "Tâm", "Tú",
+}
+
+var cities = []string{
+	"Hà Nội", "TP. Hồ Chí Minh", "Đà Nẵng", "Hải Phòng", "Cần Thơ", "Huế", "Nha Trang", "Vinh",
+}
+
+var specializations = []string{
+	"Software Engineering", "Data Science", "Computer Networks", "Databases", "Mathematics", "Information Security",
+	"Embedded Systems", "Artificial Intelligence",
+}
+
+// subjects are combined with levels to build course titles
+var subjects = []string{
+	"Go Programming", "Relational Databases", "Data Structures", "Algorithms", "Computer Networks", "Operating Systems",
+	"Web Development", "Machine Learning", "Linear Algebra", "Probability and Statistics", "Software Testing",
+	"Distributed Systems", "Cloud Computing", "Mobile Development", "Computer Graphics", "Information Security",
+}
+
+var levels = []string{"Introduction to", "Fundamentals of", "Applied", "Advanced"}
+
+var lessonTopics = []string{
+	"Overview and course goals", "Setting up the environment", "Core concepts", "Worked examples", "Common pitfalls",
+	"Hands-on lab", "Design trade-offs", "Performance", "Testing strategies", "Case study", "Review session",
+	"Project kickoff", "Tooling", "Best practices", "Going further", "Recap and next steps",
+}
+
+var lessonTypes = []string{"text", "text", "video", "video", "quiz"}
+
+var assignmentKinds = []string{"Exercise", "Lab", "Quiz", "Project", "Essay"}
+
+var feedbacks = []string{
+	"Good work, clear and well structured.",
+	"Correct approach but the explanation is too short.",
+	"Some edge cases are missing, see the comments.",
+	"Excellent, nothing to add.",
+	"Please review the lesson on this topic and resubmit next time.",
+	"Solid solution, the tests could be more thorough.",
+}
+
+var messageSubjects = []string{
+	"Question about the assignment", "Deadline extension", "Lesson materials", "Office hours", "Project group",
+}
+
+var messageBodies = []string{
+	"Could you explain the second part of the exercise once more?",
+	"I was sick this week, is it possible to submit a few days later?",
+	"The slides of the last lesson are missing from the documents.",
+	"Are you available on Thursday afternoon?",
+	"Can we work in groups of three for the project?",
+}
+
+var replyBodies = []string{
+	"Sure, let's go through it after the next lesson.",
+	"Yes, you have two more days.",
+	"Thanks, I uploaded them again.",
+	"Thursday at 3pm works for me.",
+	"Groups of up to three are fine.",
+}
@@ -0,0 +1,577 @@
+/*
+Package seed generates the demo dataset written by the seed command.
+
+The dataset only depends on the options: the same seed, size and epoch always
+give the same ids, names, scores and timestamps. The password hash is the only
+exception since bcrypt salts it.
+*/
+package seed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoangtu1372k2/vms/internal/model"
+	"gorm.io/gorm"
+)
+
+// Size controls how many rows are generated
+type Size struct {
+	Admins               int `json:"admins"`
+	Teachers             int `json:"teachers"`
+	Students             int `json:"students"`
+	Courses              int `json:"courses"`
+	LessonsPerCourse     int `json:"lessons_per_course"`
+	AssignmentsPerCourse int `json:"assignments_per_course"`
+	StudentsPerCourse    int `json:"students_per_course"`
+}
+
+// Sizes are the presets accepted by the seed command
+var Sizes = map[string]Size{
+	"small":  {Admins: 1, Teachers: 3, Students: 30, Courses: 4, LessonsPerCourse: 8, AssignmentsPerCourse: 3, StudentsPerCourse: 15},
+	"medium": {Admins: 2, Teachers: 10, Students: 200, Courses: 15, LessonsPerCourse: 12, AssignmentsPerCourse: 5, StudentsPerCourse: 40},
+	"large":  {Admins: 3, Teachers: 40, Students: 2000, Courses: 80, LessonsPerCourse: 20, AssignmentsPerCourse: 8, StudentsPerCourse: 120},
+}
+
+// EmailDomain is the domain of every generated email address
+const EmailDomain = "demo.vms.local"
+
+// Options of Generate
+type Options struct {
+	Seed uint64
+	Size Size
+	// Epoch is the start date of the generated courses, every timestamp is
+	// derived from it
+	Epoch time.Time
+	// PasswordHash is stored for every generated user
+	PasswordHash string
+	// URL returns the file URL stored in document and submission file rows.
+	// No files are generated when nil.
+	URL func(key string) string
+}
+
+// File is the content of a generated document
+type File struct {
+	Key         string
+	ContentType string
+	Data        []byte
+}
+
+// Dataset holds the generated rows in insertion order
+type Dataset struct {
+	Users               []model.User
+	Profiles            []model.Profile
+	Courses             []model.Course
+	Lessons             []model.Lesson
+	CourseDocuments     []model.CourseDocument
+	Assignments         []model.Assignment
+	AssignmentDocuments []model.AssignmentDocument
+	Enrollments         []model.CourseEnrollment
+	Submissions         []model.AssignmentSubmission
+	SubmissionFiles     []model.AssignmentSubmissionFile
+	Grades              []model.Grade
+	GradeRevisions      []model.GradeRevision
+	Messages            []model.Message
+	Notifications       []model.Notification
+	Files               []File
+}
+
+// Tables lists every table the seed command empties before a reset: the
+// seeded ones and every table referencing them.
+var Tables = []string{
+	"grade_revision", "grade", "comment", "assignment_submission_file", "assignment_submission", "assignment_document",
+	"assignment", "course_document", "course_enrollment", "lesson", "course", "message", "notification",
+	"profile", `"user"`, "archive_import_map",
+	"upload", "resumable_upload_chunk", "resumable_upload", "file_scan", "image_asset", "video_asset",
+	"video_key_access", "video_key", "video_caption", "lesson_progress", "video_engagement_bucket",
+	"video_engagement_day", "video_chapter", "checkpoint_answer", "video_checkpoint",
+	"video_engagement_viewer",
+}
+
+// Reset empties the tables filled by the seed command
+func Reset(tx *gorm.DB) error {
+	return tx.Exec("TRUNCATE TABLE " + strings.Join(Tables, ", ")).Error
+}
+
+type generator struct {
+	opts Options
+	src  *rand.ChaCha8
+	rng  *rand.Rand
+	data *Dataset
+
+	admins   []model.User
+	teachers []model.User
+	students []model.User
+	titles   []int
+}
+
+// Generate builds the dataset described by opts
+func Generate(opts Options) (*Dataset, error) {
+	s := opts.Size
+	for name, n := range map[string]int{
+		"admins": s.Admins, "teachers": s.Teachers, "students": s.Students, "courses": s.Courses,
+		"lessons per course": s.LessonsPerCourse, "assignments per course": s.AssignmentsPerCourse,
+		"students per course": s.StudentsPerCourse,
+	} {
+		if n < 0 {
+			return nil, fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if s.Courses > 0 && s.Teachers == 0 {
+		return nil, fmt.Errorf("courses need at least one teacher")
+	}
+	if s.Students > 9999 || s.Teachers > 999 || s.Admins > 99 {
+		return nil, fmt.Errorf("at most 99 admins, 999 teachers and 9999 students are supported")
+	}
+	if opts.Size.StudentsPerCourse > s.Students {
+		opts.Size.StudentsPerCourse = s.Students
+	}
+
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], opts.Seed)
+	src := rand.NewChaCha8(key)
+	g := &generator{opts: opts, src: src, rng: rand.New(src), data: &Dataset{}}
+
+	g.titles = g.rng.Perm(len(levels) * len(subjects))
+	g.users()
+	for i := 0; i < s.Courses; i++ {
+		g.course(i)
+	}
+	g.messages()
+	return g.data, nil
+}
+
+func (g *generator) id() uuid.UUID {
+	return uuid.Must(uuid.NewRandomFromReader(g.src))
+}
+
+// at returns the epoch moved by days, with a random time of day
+func (g *generator) at(days int) time.Time {
+	return g.opts.Epoch.AddDate(0, 0, days).Add(time.Duration(8*60+g.rng.IntN(12*60)) * time.Minute)
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rng.IntN(len(list))]
+}
+
+func (g *generator) chance(p float64) bool {
+	return g.rng.Float64() < p
+}
+
+func (g *generator) users() {
+	for i := 1; i <= g.opts.Size.Admins; i++ {
+		g.admins = append(g.admins, g.user("admin", fmt.Sprintf("admin%02d", i), 30, 50))
+	}
+	for i := 1; i <= g.opts.Size.Teachers; i++ {
+		g.teachers = append(g.teachers, g.user("teacher", fmt.Sprintf("teacher%03d", i), 28, 60))
+	}
+	for i := 1; i <= g.opts.Size.Students; i++ {
+		g.students = append(g.students, g.user("student", fmt.Sprintf("student%04d", i), 18, 24))
+	}
+}
+
+func (g *generator) user(role string, userName string, minAge int, maxAge int) model.User {
+	fullName := fmt.Sprintf("%s %s %s", g.pick(familyNames), g.pick(middleNames), g.pick(givenNames))
+	created := g.at(-60 + g.rng.IntN(45))
+	user := model.User{
+		ID:          g.id(),
+		Email:       userName + "@" + EmailDomain,
+		FullName:    fullName,
+		UserName:    userName,
+		Password:    g.opts.PasswordHash,
+		Role:        role,
+		PhoneNumber: fmt.Sprintf("09%08d", g.rng.IntN(100000000)),
+		DateOfBirth: g.opts.Epoch.AddDate(-minAge-g.rng.IntN(maxAge-minAge+1), 0, -g.rng.IntN(365)).Truncate(24 * time.Hour),
+		Address:     g.pick(cities),
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	}
+	profile := model.Profile{
+		ID:          user.ID,
+		FullName:    user.FullName,
+		Email:       user.Email,
+		Role:        role,
+		PhoneNumber: &user.PhoneNumber,
+		Address:     &user.Address,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	}
+	if role == "teacher" {
+		first, second := g.pick(specializations), g.pick(specializations)
+		years := 2 + g.rng.IntN(20)
+		user.Bio = fmt.Sprintf("Lecturer in %s with %d years of teaching experience.", first, years)
+		profile.Bio = &user.Bio
+		education := "PhD in " + first
+		experience := fmt.Sprintf("%d years", years)
+		profile.Education = &education
+		profile.Experience = &experience
+		profile.Specializations = first
+		if second != first {
+			profile.Specializations += "," + second
+		}
+	}
+	g.data.Users = append(g.data.Users, user)
+	g.data.Profiles = append(g.data.Profiles, profile)
+	return user
+}
+
+func (g *generator) course(index int) {
+	instructor := g.teachers[index%len(g.teachers)]
+	// Titles repeat only once every level and subject combination is used
+	combo := g.titles[index%len(g.titles)]
+	title := fmt.Sprintf("%s %s", levels[combo%len(levels)], subjects[combo/len(levels)])
+	if index >= len(g.titles) {
+		title = fmt.Sprintf("%s (group %d)", title, index/len(g.titles)+1)
+	}
+	description := fmt.Sprintf("A %d week course taught by %s.", g.opts.Size.LessonsPerCourse, instructor.FullName)
+	duration := fmt.Sprintf("%d weeks", max(g.opts.Size.LessonsPerCourse, 1))
+	status := "active"
+	switch {
+	case g.chance(0.15):
+		status = "draft"
+	case g.chance(0.15):
+		status = "completed"
+	}
+	created := g.at(-30 + g.rng.IntN(14))
+	course := model.Course{
+		ID:           g.id(),
+		Title:        title,
+		Description:  &description,
+		InstructorID: instructor.ID,
+		Duration:     &duration,
+		Status:       status,
+		CreatedAt:    created,
+		UpdatedAt:    created,
+	}
+	g.data.Courses = append(g.data.Courses, course)
+
+	for i := 1; i <= g.opts.Size.LessonsPerCourse; i++ {
+		g.lesson(course, i)
+	}
+	if g.opts.URL != nil {
+		key := fmt.Sprintf("seed/courses/%s/syllabus.md", course.ID)
+		g.data.CourseDocuments = append(g.data.CourseDocuments, model.CourseDocument{
+			ID:         g.id(),
+			CourseID:   course.ID,
+			Title:      "Syllabus",
+			FileName:   "syllabus.md",
+			FilePath:   g.file(key, "text/markdown", fmt.Sprintf("# %s\n\n%s\n", course.Title, description)),
+			FileSize:   g.size(),
+			FileType:   g.fileType("text/markdown"),
+			UploadedBy: instructor.ID,
+			CreatedAt:  created,
+			UpdatedAt:  created,
+		})
+	}
+
+	var assignments []model.Assignment
+	for i := 1; i <= g.opts.Size.AssignmentsPerCourse; i++ {
+		assignments = append(assignments, g.assignment(course, i))
+	}
+	if status == "draft" {
+		return
+	}
+	for _, n := range g.rng.Perm(len(g.students))[:g.opts.Size.StudentsPerCourse] {
+		g.enroll(course, assignments, g.students[n])
+	}
+}
+
+// file stores a generated file and returns its URL
+func (g *generator) file(key string, contentType string, content string) string {
+	g.data.Files = append(g.data.Files, File{Key: key, ContentType: contentType, Data: []byte(content)})
+	return g.opts.URL(key)
+}
+
+// size returns the size of the last generated file
+func (g *generator) size() *int64 {
+	size := int64(len(g.data.Files[len(g.data.Files)-1].Data))
+	return &size
+}
+
+func (g *generator) fileType(contentType string) *string {
+	return &contentType
+}
+
+func (g *generator) lesson(course model.Course, index int) {
+	content := fmt.Sprintf("## %s\n\nNotes for lesson %d of %s.", g.pick(lessonTopics), index, course.Title)
+	duration := 20 + 5*g.rng.IntN(15)
+	created := course.CreatedAt.Add(time.Duration(index) * time.Hour)
+	g.data.Lessons = append(g.data.Lessons, model.Lesson{
+		ID:         g.id(),
+		CourseID:   course.ID,
+		Title:      fmt.Sprintf("Lesson %d: %s", index, g.pick(lessonTopics)),
+		Content:    &content,
+		Duration:   &duration,
+		OrderIndex: index,
+		Type:       g.pick(lessonTypes),
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	})
+}
+
+func (g *generator) assignment(course model.Course, index int) model.Assignment {
+	kind := g.pick(assignmentKinds)
+	maxScore := 100
+	if kind == "Quiz" {
+		maxScore = 10
+	}
+	description := fmt.Sprintf("%s %d of %s.", kind, index, course.Title)
+	due := g.opts.Epoch.AddDate(0, 0, 14*index).Add(23*time.Hour + 59*time.Minute)
+	created := g.opts.Epoch.AddDate(0, 0, 14*(index-1))
+	assignment := model.Assignment{
+		ID:               g.id(),
+		CourseID:         course.ID,
+		Title:            fmt.Sprintf("%s %d: %s", kind, index, g.pick(lessonTopics)),
+		Description:      &description,
+		DueDate:          &due,
+		CreatedBy:        course.InstructorID,
+		Status:           "active",
+		MaxScore:         maxScore,
+		AssignmentStatus: "published",
+		CreatedAt:        created,
+		UpdatedAt:        created,
+	}
+	g.data.Assignments = append(g.data.Assignments, assignment)
+
+	if g.opts.URL != nil {
+		key := fmt.Sprintf("seed/assignments/%s/instructions.md", assignment.ID)
+		g.data.AssignmentDocuments = append(g.data.AssignmentDocuments, model.AssignmentDocument{
+			ID:           g.id(),
+			AssignmentID: assignment.ID,
+			Title:        "Instructions",
+			FileName:     "instructions.md",
+			FilePath:     g.file(key, "text/markdown", fmt.Sprintf("# %s\n\n%s\n", assignment.Title, description)),
+			FileSize:     g.size(),
+			FileType:     g.fileType("text/markdown"),
+			UploadedBy:   course.InstructorID,
+			CreatedAt:    created,
+			UpdatedAt:    created,
+		})
+	}
+	return assignment
+}
+
+func (g *generator) enroll(course model.Course, assignments []model.Assignment, student model.User) {
+	enrolled := g.at(-g.rng.IntN(10))
+	enrollment := model.CourseEnrollment{
+		ID:         g.id(),
+		CourseID:   course.ID,
+		StudentID:  student.ID,
+		EnrolledAt: enrolled,
+		Status:     "enrolled",
+		Progress:   g.rng.IntN(101),
+		LastActive: g.at(g.rng.IntN(60)),
+		CreatedAt:  enrolled,
+		UpdatedAt:  enrolled,
+	}
+	switch {
+	case g.chance(0.08):
+		enrollment.Status = "dropped"
+		enrollment.Progress = g.rng.IntN(40)
+	case course.Status == "completed":
+		enrollment.Status = "completed"
+		enrollment.Progress = 100
+	}
+	g.data.Enrollments = append(g.data.Enrollments, enrollment)
+
+	g.notify(student.ID, "Welcome", "You are enrolled in "+course.Title, "system", course.ID, enrolled)
+	if enrollment.Status == "dropped" {
+		return
+	}
+	for _, assignment := range assignments {
+		g.notify(student.ID, "New assignment", assignment.Title+" is due "+assignment.DueDate.Format("2006-01-02"),
+			"assignment", assignment.ID, assignment.CreatedAt)
+		if g.chance(0.85) {
+			g.submit(course, assignment, student)
+		}
+	}
+}
+
+func (g *generator) submit(course model.Course, assignment model.Assignment, student model.User) {
+	submitted := assignment.DueDate.Add(-time.Duration(1+g.rng.IntN(13*24)) * time.Hour)
+	content := fmt.Sprintf("Submission of %s for %s.", student.FullName, assignment.Title)
+	submission := model.AssignmentSubmission{
+		ID:           g.id(),
+		AssignmentID: assignment.ID,
+		StudentID:    student.ID,
+		Attempt:      1,
+		SubmittedAt:  submitted,
+		Content:      &content,
+		Status:       model.SubmissionStatusSubmitted,
+		CreatedAt:    submitted,
+		UpdatedAt:    submitted,
+	}
+	if g.opts.URL != nil && g.chance(0.5) {
+		key := fmt.Sprintf("seed/submissions/%s/answer.txt", submission.ID)
+		g.data.SubmissionFiles = append(g.data.SubmissionFiles, model.AssignmentSubmissionFile{
+			ID:           g.id(),
+			SubmissionID: &submission.ID,
+			FileName:     "answer.txt",
+			FilePath:     g.file(key, "text/plain", content+"\n"),
+			FileSize:     g.size(),
+			FileType:     g.fileType("text/plain"),
+			CreatedAt:    submitted,
+			UpdatedAt:    submitted,
+		})
+	}
+	if !g.chance(0.6) {
+		g.data.Submissions = append(g.data.Submissions, submission)
+		return
+	}
+
+	maxScore := float64(assignment.MaxScore)
+	score := math.Round(maxScore*(0.4+0.6*g.rng.Float64())*2) / 2
+	feedback := g.pick(feedbacks)
+	graded := submitted.Add(time.Duration(24+g.rng.IntN(5*24)) * time.Hour)
+	grade := model.Grade{
+		ID:           g.id(),
+		StudentID:    student.ID,
+		CourseID:     course.ID,
+		AssignmentID: assignment.ID,
+		Score:        score,
+		MaxScore:     maxScore,
+		GradedBy:     course.InstructorID,
+		GradedAt:     graded,
+		Comments:     &feedback,
+		CreatedAt:    graded,
+		UpdatedAt:    graded,
+	}
+	g.revision(grade, 1, model.GradeRevisionReasonCreated)
+	if g.chance(0.1) {
+		// Some grades are corrected after a review
+		grade.Score = math.Min(maxScore, grade.Score+math.Round(maxScore*0.1))
+		grade.GradedAt = graded.Add(48 * time.Hour)
+		grade.UpdatedAt = grade.GradedAt
+		g.revision(grade, 2, model.GradeRevisionReasonUpdated)
+	}
+	grade.Percentage = math.Round(grade.Score/maxScore*10000) / 100
+	g.data.Grades = append(g.data.Grades, grade)
+
+	tenths := math.Round(grade.Score/maxScore*100) / 10
+	submission.Grade = &tenths
+	submission.Feedback = &feedback
+	submission.Status = model.SubmissionStatusGraded
+	submission.UpdatedAt = grade.GradedAt
+	g.data.Submissions = append(g.data.Submissions, submission)
+
+	g.notify(student.ID, "Grade published", fmt.Sprintf("%s: %.1f/%.0f", assignment.Title, grade.Score, maxScore),
+		"grade", grade.ID, grade.GradedAt)
+}
+
+func (g *generator) revision(grade model.Grade, revision int, reason string) {
+	g.data.GradeRevisions = append(g.data.GradeRevisions, model.GradeRevision{
+		ID:           g.id(),
+		GradeID:      grade.ID,
+		Revision:     revision,
+		StudentID:    grade.StudentID,
+		CourseID:     grade.CourseID,
+		AssignmentID: grade.AssignmentID,
+		Score:        grade.Score,
+		MaxScore:     grade.MaxScore,
+		Feedback:     grade.Comments,
+		GradedBy:     grade.GradedBy,
+		Reason:       reason,
+		CreatedAt:    grade.GradedAt,
+	})
+}
+
+func (g *generator) notify(userID uuid.UUID, title string, content string, kind string, relatedID uuid.UUID, at time.Time) {
+	g.data.Notifications = append(g.data.Notifications, model.Notification{
+		ID:        g.id(),
+		UserID:    userID,
+		Title:     title,
+		Content:   content,
+		Type:      kind,
+		IsRead:    g.chance(0.5),
+		RelatedID: relatedID,
+		CreatedAt: at,
+		UpdatedAt: at,
+	})
+}
+
+// messages lets some students ask the instructor of one of their courses,
+// most questions get an answer
+func (g *generator) messages() {
+	instructors := make(map[uuid.UUID]uuid.UUID, len(g.data.Courses))
+	for _, course := range g.data.Courses {
+		instructors[course.ID] = course.InstructorID
+	}
+	for _, enrollment := range g.data.Enrollments {
+		if !g.chance(0.15) {
+			continue
+		}
+		n := g.rng.IntN(len(messageSubjects))
+		subject := messageSubjects[n]
+		sent := g.at(g.rng.IntN(60))
+		answered := g.chance(0.7)
+		question := model.Message{
+			ID:         g.id(),
+			SenderID:   enrollment.StudentID,
+			ReceiverID: instructors[enrollment.CourseID],
+			Subject:    &subject,
+			Content:    messageBodies[n],
+			IsRead:     answered || g.chance(0.5),
+			CreatedAt:  sent,
+			UpdatedAt:  sent,
+		}
+		g.data.Messages = append(g.data.Messages, question)
+		if !answered {
+			continue
+		}
+		reply := "Re: " + subject
+		replied := sent.Add(time.Duration(1+g.rng.IntN(48)) * time.Hour)
+		g.data.Messages = append(g.data.Messages, model.Message{
+			ID:         g.id(),
+			SenderID:   question.ReceiverID,
+			ReceiverID: question.SenderID,
+			Subject:    &reply,
+			Content:    replyBodies[n],
+			IsRead:     g.chance(0.6),
+			RepliedTo:  question.ID,
+			CreatedAt:  replied,
+			UpdatedAt:  replied,
+		})
+	}
+}
+
+// Counts returns the number of generated rows per table
+func (d *Dataset) Counts() map[string]int {
+	return map[string]int{
+		"user":                       len(d.Users),
+		"profile":                    len(d.Profiles),
+		"course":                     len(d.Courses),
+		"lesson":                     len(d.Lessons),
+		"course_document":            len(d.CourseDocuments),
+		"assignment":                 len(d.Assignments),
+		"assignment_document":        len(d.AssignmentDocuments),
+		"course_enrollment":          len(d.Enrollments),
+		"assignment_submission":      len(d.Submissions),
+		"assignment_submission_file": len(d.SubmissionFiles),
+		"grade":                      len(d.Grades),
+		"grade_revision":             len(d.GradeRevisions),
+		"message":                    len(d.Messages),
+		"notification":               len(d.Notifications),
+	}
+}
+
+// Insert writes the dataset, parents before children
+func (d *Dataset) Insert(tx *gorm.DB) error {
+	for _, rows := range []interface{}{
+		d.Users, d.Profiles, d.Courses, d.Lessons, d.CourseDocuments, d.Assignments, d.AssignmentDocuments,
+		d.Enrollments, d.Submissions, d.SubmissionFiles, d.Grades, d.GradeRevisions, d.Messages, d.Notifications,
+	} {
+		if reflect.ValueOf(rows).Len() == 0 {
+			continue
+		}
+		if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
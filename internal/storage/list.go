@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Lister is implemented by stores able to enumerate their objects
+type Lister interface {
+	// List calls fn with every object whose key starts with prefix, in no
+	// particular order, and stops at the first error fn returns
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// List walks the directory, skipping the metadata and the files being written
+func (l *Local) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	root := filepath.Join(l.root, filepath.FromSlash(l.prefix))
+	err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, name)
+		if err != nil {
+			return err
+		}
+		object := filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if object == metaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if base := entry.Name(); strings.HasPrefix(base, ".upload-") || strings.HasPrefix(base, ".health-") {
+			return nil
+		}
+		key, ok := l.ObjectKey(object)
+		if !ok || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(l.info(key, info))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List lists the bucket below the prefix of the store
+func (m *MinIO) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for info := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: m.object(prefix), Recursive: true}) {
+		if info.Err != nil {
+			return info.Err
+		}
+		key, ok := m.ObjectKey(info.Key)
+		if !ok {
+			continue
+		}
+		if err := fn(m.info(key, info)); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
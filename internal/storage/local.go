@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalOptions configures the local disk backend. PublicURL is where the API
+// serves the directory, SigningKey signs the URLs returned by SignedURL.
+type LocalOptions struct {
+	Root       string
+	Prefix     string
+	PublicURL  string
+	SigningKey []byte
+}
+
+// Local stores the files in a directory. The content type and file name given
+// to Put are kept in a JSON file below the .meta directory, objects stored
+// without them get the content type of their extension.
+type Local struct {
+	locator
+	root string
+	key  []byte
+}
+
+// ErrSignature is returned by Verify for missing, invalid or expired signatures
+var ErrSignature = errors.New("invalid or expired signature")
+
+// NewLocal creates the directory when it is missing
+func NewLocal(opts LocalOptions) (*Local, error) {
+	if len(opts.SigningKey) == 0 {
+		return nil, errors.New("a signing key is required")
+	}
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	loc, err := newLocator(opts.PublicURL, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public url - %s", err)
+	}
+	return &Local{locator: loc, root: root, key: opts.SigningKey}, nil
+}
+
+func (l *Local) Driver() string {
+	return "local"
+}
+
+// metaDir holds the metadata of the objects, keys cannot point into it
+const metaDir = ".meta"
+
+// localMeta is the metadata stored next to an object
+type localMeta struct {
+	ContentType string `json:"content_type,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+}
+
+func (l *Local) checkKey(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if l.object(key) == metaDir || strings.HasPrefix(l.object(key), metaDir+"/") {
+		return errors.New("invalid object key " + key)
+	}
+	return nil
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(l.object(key)))
+}
+
+func (l *Local) metaPath(key string) string {
+	return filepath.Join(l.root, metaDir, filepath.FromSlash(l.object(key))+".json")
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (Object, error) {
+	if err := l.checkKey(key); err != nil {
+		return Object{}, err
+	}
+	if err := l.writeMeta(key, localMeta{ContentType: opts.ContentType, FileName: opts.FileName}); err != nil {
+		return Object{}, err
+	}
+	name := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return Object{}, err
+	}
+
+	// Write next to the target and rename, readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, r)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("expected %d bytes, read %d", size, written)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return Object{}, err
+	}
+	return l.Stat(ctx, key)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	if err := l.checkKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	f, err := os.Open(l.path(key))
+	if err != nil {
+		return nil, Object{}, l.error(err)
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, Object{}, ErrNotFound
+	}
+	return f, l.info(key, info), nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	if err := l.checkKey(key); err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		return Object{}, l.error(err)
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotFound
+	}
+	return l.info(key, info), nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(l.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(l.metaPath(key)); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL returns URL(key) with an expiry and a signature checked by Verify
+func (l *Local) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return l.signedURL(http.MethodGet, key, expiry)
+}
+
+// SignedPutURL returns URL(key) signed for one PUT, the API stores the body
+func (l *Local) SignedPutURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return l.signedURL(http.MethodPut, key, expiry)
+}
+
+func (l *Local) signedURL(method string, key string, expiry time.Duration) (string, error) {
+	if err := l.checkKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(method, key, expires))
+	return l.URL(key) + "?" + query.Encode(), nil
+}
+
+// Verify checks the expiry and signature query parameters of a URL signed
+// for method
+func (l *Local) Verify(method string, key string, query url.Values) error {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrSignature
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return ErrSignature
+	}
+	expected, _ := hex.DecodeString(l.sign(method, key, expires))
+	if !hmac.Equal(signature, expected) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func (l *Local) sign(method string, key string, expires string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Health checks that a file can be written to the directory
+func (l *Local) Health(ctx context.Context) error {
+	f, err := os.CreateTemp(l.root, ".health-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// writeMeta stores the metadata of an object before the object itself, a
+// stale file left by an earlier object is replaced or removed
+func (l *Local) writeMeta(key string, meta localMeta) error {
+	name := l.metaPath(key)
+	if meta == (localMeta{}) {
+		if err := os.Remove(name); !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+func (l *Local) info(key string, info fs.FileInfo) Object {
+	var meta localMeta
+	if data, err := os.ReadFile(l.metaPath(key)); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// Files are replaced by a rename, their modification time changes with them
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	return Object{Key: key, Size: info.Size(), ContentType: contentType, FileName: meta.FileName, ModTime: info.ModTime(), ETag: etag}
+}
+
+func (l *Local) error(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// MinIOOptions configures the MinIO backend. PublicURL defaults to the bucket
+// URL on the endpoint.
+type MinIOOptions struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	Region    string
+	Bucket    string
+	Prefix    string
+	PublicURL string
+}
+
+// MinIO stores the files in a bucket of MinIO or another S3 compatible service
+type MinIO struct {
+	locator
+	client *minio.Client
+	bucket string
+}
+
+// NewMinIO connects to the service and creates the bucket when it is missing
+func NewMinIO(ctx context.Context, opts MinIOOptions) (*MinIO, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	base := opts.PublicURL
+	if base == "" {
+		base = fmt.Sprintf("%s://%s/%s", client.EndpointURL().Scheme, client.EndpointURL().Host, opts.Bucket)
+	}
+	loc, err := newLocator(base, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public url - %s", err)
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach %s - %s", opts.Endpoint, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("could not create bucket %s - %s", opts.Bucket, err)
+		}
+	}
+	return &MinIO{locator: loc, client: client, bucket: opts.Bucket}, nil
+}
+
+// Client returns the underlying client
+func (m *MinIO) Client() *minio.Client {
+	return m.client
+}
+
+// Bucket returns the bucket holding the objects
+func (m *MinIO) Bucket() string {
+	return m.bucket
+}
+
+func (m *MinIO) Driver() string {
+	return "minio"
+}
+
+// fileNameMeta is the user metadata holding the original file name, escaped
+// since S3 metadata is ASCII
+const fileNameMeta = "Original-Name"
+
+func (m *MinIO) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	putOpts := minio.PutObjectOptions{ContentType: opts.ContentType}
+	if opts.FileName != "" {
+		putOpts.ContentDisposition = ContentDisposition(opts.FileName)
+		putOpts.UserMetadata = map[string]string{fileNameMeta: url.PathEscape(opts.FileName)}
+	}
+	info, err := m.client.PutObject(ctx, m.bucket, m.object(key), r, size, putOpts)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size, ContentType: opts.ContentType, FileName: opts.FileName, ModTime: info.LastModified}, nil
+}
+
+func (m *MinIO) Get(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	obj, err := m.client.GetObject(ctx, m.bucket, m.object(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Object{}, m.error(err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, Object{}, m.error(err)
+	}
+	return obj, m.info(key, info), nil
+}
+
+func (m *MinIO) Stat(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	info, err := m.client.StatObject(ctx, m.bucket, m.object(key), minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, m.error(err)
+	}
+	return m.info(key, info), nil
+}
+
+func (m *MinIO) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.client.RemoveObject(ctx, m.bucket, m.object(key), minio.RemoveObjectOptions{})
+}
+
+func (m *MinIO) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	u, err := m.client.PresignedGetObject(ctx, m.bucket, m.object(key), expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (m *MinIO) Health(ctx context.Context) error {
+	exists, err := m.client.BucketExists(ctx, m.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", m.bucket)
+	}
+	return nil
+}
+
+func (m *MinIO) info(key string, info minio.ObjectInfo) Object {
+	obj := Object{Key: key, Size: info.Size, ContentType: info.ContentType, ModTime: info.LastModified}
+	if info.ETag != "" {
+		obj.ETag = `"` + info.ETag + `"`
+	}
+	for name, value := range info.UserMetadata {
+		if strings.EqualFold(name, fileNameMeta) {
+			obj.FileName, _ = url.PathUnescape(value)
+		}
+	}
+	return obj
+}
+
+func (m *MinIO) error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return ErrNotFound
+	}
+	return err
+}
+
+func (m *MinIO) SignedPutURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	u, err := m.client.PresignedPutObject(ctx, m.bucket, m.object(key), expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (m *MinIO) CreateMultipart(ctx context.Context, key string, contentType string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	core := minio.Core{Client: m.client}
+	return core.NewMultipartUpload(ctx, m.bucket, m.object(key), minio.PutObjectOptions{ContentType: contentType})
+}
+
+func (m *MinIO) SignedPartURL(ctx context.Context, key string, uploadID string, part int, expiry time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(part))
+	params.Set("uploadId", uploadID)
+	u, err := m.client.Presign(ctx, http.MethodPut, m.bucket, m.object(key), expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// CompleteMultipart lists the uploaded parts itself, clients do not have to
+// report the ETag of every part
+func (m *MinIO) CompleteMultipart(ctx context.Context, key string, uploadID string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	core := minio.Core{Client: m.client}
+	var parts []minio.CompletePart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, m.bucket, m.object(key), uploadID, marker, 1000)
+		if err != nil {
+			return m.error(err)
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	if len(parts) == 0 {
+		return ErrNotFound
+	}
+	_, err := core.CompleteMultipartUpload(ctx, m.bucket, m.object(key), uploadID, parts, minio.PutObjectOptions{})
+	return err
+}
+
+func (m *MinIO) AbortMultipart(ctx context.Context, key string, uploadID string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	core := minio.Core{Client: m.client}
+	err := core.AbortMultipartUpload(ctx, m.bucket, m.object(key), uploadID)
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return nil
+	}
+	return err
+}
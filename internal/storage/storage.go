@@ -0,0 +1,135 @@
+/*
+Package storage keeps the uploaded files.
+
+Files are addressed by a key such as documents/report.pdf. Rows reference them
+by the URL returned by URL, which Key turns back into the key. Two backends
+are available: MinIO or any S3 compatible service, and a directory on the
+local disk served by the API itself.
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for keys that hold no object
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored file. FileName is the name the file was uploaded
+// with, empty when it was not recorded. ETag is a quoted strong entity tag
+// that changes whenever the object does.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	FileName    string
+	ModTime     time.Time
+	ETag        string
+}
+
+// PutOptions describe the stored file. FileName is kept with the object and
+// served in the Content-Disposition header.
+type PutOptions struct {
+	ContentType string
+	FileName    string
+}
+
+// ContentDisposition returns the inline Content-Disposition header naming the
+// file, empty without a name
+func ContentDisposition(fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+	return mime.FormatMediaType("inline", map[string]string{"filename": fileName})
+}
+
+// Storage stores files under keys
+type Storage interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (Object, error)
+	// Get opens the object stored under key, the caller closes it. Seeking
+	// reads from another offset, so byte ranges can be served.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+	// Stat describes the object stored under key
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes the object, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL giving read access to the object until expiry
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// URL returns the URL rows use to reference the object
+	URL(key string) string
+	// Key returns the key of a URL written by URL, false when the URL does
+	// not point into this store. The host is ignored so URLs written by
+	// another instance are recognized too.
+	Key(url string) (string, bool)
+	// Health checks that the store can be used
+	Health(ctx context.Context) error
+	// Driver names the backend
+	Driver() string
+}
+
+// locator maps keys to the URLs stored in rows. Objects are stored under
+// prefix + key below base.
+type locator struct {
+	base   *url.URL
+	prefix string
+}
+
+func newLocator(base string, prefix string) (locator, error) {
+	u, err := url.Parse(strings.TrimRight(base, "/"))
+	if err != nil {
+		return locator{}, err
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	return locator{base: u, prefix: prefix}, nil
+}
+
+func (l locator) object(key string) string {
+	return l.prefix + key
+}
+
+func (l locator) URL(key string) string {
+	u := *l.base
+	u.Path = u.Path + "/" + l.object(key)
+	return u.String()
+}
+
+// ObjectKey returns the key of an object name, the name with the prefix
+func (l locator) ObjectKey(object string) (string, bool) {
+	key, ok := strings.CutPrefix(object, l.prefix)
+	return key, ok && validKey(key)
+}
+
+func (l locator) Key(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(u.Path, l.base.Path+"/"+l.prefix)
+	return key, ok && validKey(key)
+}
+
+// validKey rejects keys that are empty, absolute or leave their directory
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	return path.Clean(key) == key && key != "." && !strings.HasPrefix(key, "../")
+}
+
+// checkKey is called by the backends before touching an object
+func checkKey(key string) error {
+	if !validKey(key) {
+		return errors.New("invalid object key " + key)
+	}
+	return nil
+}
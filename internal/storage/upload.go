@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Uploader is implemented by stores accepting uploads straight from clients
+type Uploader interface {
+	// SignedPutURL returns a URL accepting one PUT of the object until expiry
+	SignedPutURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// MultipartUploader is implemented by stores accepting an object in parts
+// uploaded by clients
+type MultipartUploader interface {
+	Uploader
+	// CreateMultipart starts a multipart upload and returns its id
+	CreateMultipart(ctx context.Context, key string, contentType string) (string, error)
+	// SignedPartURL returns a URL accepting one PUT of a part until expiry,
+	// parts are numbered from 1
+	SignedPartURL(ctx context.Context, key string, uploadID string, part int, expiry time.Duration) (string, error)
+	// CompleteMultipart assembles the uploaded parts into the object
+	CompleteMultipart(ctx context.Context, key string, uploadID string) error
+	// AbortMultipart drops the upload and its parts
+	AbortMultipart(ctx context.Context, key string, uploadID string) error
+}
+
+// Limits of S3 multipart uploads
+const (
+	MinPartSize = 5 << 20
+	MaxParts    = 10000
+)
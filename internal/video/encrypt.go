@@ -0,0 +1,104 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// KeySize is the size of the AES-128 keys of the segments
+const KeySize = 16
+
+// EncryptPlaylist encrypts the segments of the media playlist at name with
+// AES-128, in place, and adds the EXT-X-KEY tags to the playlist. Every run of
+// `every` segments shares a key, key returns the key of a run and the URI the
+// player fetches it from. Segments use the default IV, their media sequence
+// number, so a key is never used twice with the same IV.
+func EncryptPlaylist(name string, every int, key func(run int) ([]byte, string, error)) error {
+	if every < 1 {
+		return fmt.Errorf("segments per key must be positive, got %d", every)
+	}
+	playlist, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(name)
+
+	var out bytes.Buffer
+	var tags []string // tags of the next segment
+	var current []byte
+	sequence, segment := int64(0), 0
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-KEY"):
+			return fmt.Errorf("%s is encrypted already", name)
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, err = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid media sequence in %s: %w", name, err)
+			}
+			out.WriteString(line + "\n")
+		case strings.HasPrefix(line, "#EXTINF") || (strings.HasPrefix(line, "#") && len(tags) > 0):
+			tags = append(tags, line)
+		case strings.HasPrefix(line, "#") || line == "":
+			out.WriteString(line + "\n")
+		default:
+			if segment%every == 0 {
+				k, uri, err := key(segment / every)
+				if err != nil {
+					return err
+				}
+				if len(k) != KeySize {
+					return fmt.Errorf("key of run %d is %d bytes, not %d", segment/every, len(k), KeySize)
+				}
+				fmt.Fprintf(&out, "#EXT-X-KEY:METHOD=AES-128,URI=%q\n", uri)
+				current = k
+			}
+			if err := encryptSegment(filepath.Join(dir, filepath.FromSlash(line)), current, sequence+int64(segment)); err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				out.WriteString(tag + "\n")
+			}
+			out.WriteString(line + "\n")
+			tags = tags[:0]
+			segment++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		out.WriteString(tag + "\n")
+	}
+	return os.WriteFile(name, out.Bytes(), 0o644)
+}
+
+// encryptSegment encrypts the segment at name with AES-128-CBC and PKCS#7
+// padding, the IV being the media sequence number of the segment
+func encryptSegment(name string, key []byte, sequence int64) error {
+	plain, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return os.WriteFile(name, data, 0o644)
+}
@@ -0,0 +1,110 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/hoangtu1372k2/vms/internal/caption"
+)
+
+// Sprites lays out the preview thumbnails of a video on sprite sheets, a
+// thumbnail every Interval seconds placed row by row
+type Sprites struct {
+	Interval float64 // seconds
+	Width    int     // of a thumbnail
+	Height   int
+	Columns  int // thumbnails per row of a sheet
+	Rows     int // rows per sheet
+	Count    int // thumbnails of the whole video
+}
+
+// NewSprites lays out the thumbnails of a video width pixels wide on sheets
+// of 10 by 10 thumbnails
+func NewSprites(info Info, interval float64, width int) Sprites {
+	width = min(width, info.Width)
+	return Sprites{
+		Interval: interval,
+		Width:    even(float64(width)),
+		Height:   even(float64(width) * float64(info.Height) / float64(info.Width)),
+		Columns:  10,
+		Rows:     10,
+		Count:    max(1, int(math.Ceil(info.Duration/interval))),
+	}
+}
+
+// Sheets is the number of sprite sheets
+func (s Sprites) Sheets() int {
+	perSheet := s.Columns * s.Rows
+	return (s.Count + perSheet - 1) / perSheet
+}
+
+// SpriteName is the file name of a sprite sheet, counted from 0
+func SpriteName(sheet int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", sheet)
+}
+
+// VTT is the WebVTT thumbnails track of the sprites, a cue per thumbnail
+// pointing at its area of the sheet at uri(sheet) with a #xywh fragment
+func (s Sprites) VTT(duration float64, uri func(sheet int) string) []byte {
+	perSheet := s.Columns * s.Rows
+	cues := make([]caption.Cue, 0, s.Count)
+	for i := 0; i < s.Count; i++ {
+		start := float64(i) * s.Interval
+		if i > 0 && start >= duration {
+			break
+		}
+		end := math.Min(start+s.Interval, duration)
+		place := i % perSheet
+		cues = append(cues, caption.Cue{
+			Start: seconds(start),
+			End:   seconds(end),
+			Text: fmt.Sprintf("%s#xywh=%d,%d,%d,%d", uri(i/perSheet),
+				place%s.Columns*s.Width, place/s.Columns*s.Height, s.Width, s.Height),
+		})
+	}
+	return caption.VTT(cues)
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(math.Round(v * float64(time.Second)))
+}
+
+// Poster writes a JPEG poster of the video at most width pixels wide to
+// output. It is a representative frame, not a black or blurred one, picked
+// past the first tenth of the video or its first 10 seconds.
+func (t Transcoder) Poster(ctx context.Context, input string, output string, info Info, width int) error {
+	width = min(width, info.Width)
+	height := even(float64(width) * float64(info.Height) / float64(info.Width))
+	at := math.Min(info.Duration/10, 10)
+	return t.run(ctx, "-ss", fmt.Sprintf("%.3f", at), "-i", input,
+		"-vf", fmt.Sprintf("thumbnail=50,scale=%d:%d,setsar=1", even(float64(width)), height),
+		"-frames:v", "1", "-q:v", "3", output)
+}
+
+// SpriteSheets writes the sprite sheets of the video laid out by s to dir,
+// named by SpriteName
+func (t Transcoder) SpriteSheets(ctx context.Context, input string, dir string, s Sprites) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return t.run(ctx, "-i", input, "-an", "-sn",
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,setsar=1,tile=%dx%d", s.Interval, s.Width, s.Height, s.Columns, s.Rows),
+		"-q:v", "5", "-start_number", "0", filepath.Join(dir, "sprite_%03d.jpg"))
+}
+
+// run runs ffmpeg with args, overwriting the output
+func (t Transcoder) run(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, t.FFmpeg, append([]string{"-hide_banner", "-nostats", "-loglevel", "error", "-y"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed - %s: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
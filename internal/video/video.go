@@ -0,0 +1,340 @@
+/*
+Package video transcodes uploaded videos to HLS with ffmpeg.
+
+Videos are probed with ffprobe, then encoded in one ffmpeg run to every
+rendition of the ladder that is not larger than the source. Each rendition
+gets its own media playlist and MPEG-TS segments, the master playlist listing
+them and the subtitle renditions is written by MasterPlaylist.
+EncryptPlaylist encrypts the segments of a media playlist with AES-128
+afterwards. Poster and SpriteSheets extract the poster frame and the preview
+thumbnails of the scrub bar, listed by the WebVTT track of Sprites.VTT.
+*/
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Info is what ffprobe found in a video
+type Info struct {
+	Duration float64 // seconds
+	Width    int     // as displayed, after rotation
+	Height   int
+	HasAudio bool
+}
+
+// Rendition is one quality of the HLS ladder
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	VideoBitrate int    `json:"video_bitrate"` // kbit/s
+	AudioBitrate int    `json:"audio_bitrate"` // kbit/s, 0 without audio
+}
+
+// Bandwidth is the peak bit rate announced in the master playlist, in bit/s
+func (r Rendition) Bandwidth() int {
+	// The encoder is capped at 107% of the video bit rate, the container
+	// adds a few percent on top
+	return (r.VideoBitrate*107/100 + r.AudioBitrate) * 1000 * 105 / 100
+}
+
+// Ladder lists the renditions from the highest to the lowest, by height
+var Ladder = []Rendition{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+// Renditions returns the renditions of the ladder a video is encoded to: the
+// ones not taller than the video, or the lowest one at the size of the video
+// for small videos. Heights apply to the shorter side so portrait videos get
+// the same quality.
+func Renditions(info Info) []Rendition {
+	short, long := min(info.Width, info.Height), max(info.Width, info.Height)
+	var renditions []Rendition
+	for _, r := range Ladder {
+		if r.Height <= short {
+			renditions = append(renditions, r)
+		}
+	}
+	if len(renditions) == 0 {
+		renditions = append(renditions, Ladder[len(Ladder)-1])
+	}
+	for i := range renditions {
+		r := &renditions[i]
+		side := min(r.Height, short)
+		r.Width, r.Height = even(float64(long)*float64(side)/float64(short)), even(float64(side))
+		if info.Height > info.Width {
+			r.Width, r.Height = r.Height, r.Width
+		}
+		if !info.HasAudio {
+			r.AudioBitrate = 0
+		}
+	}
+	return renditions
+}
+
+func even(v float64) int {
+	return max(2, int(math.Round(v/2))*2)
+}
+
+// level is the H.264 level of a rendition: 3.1 up to 720p, 4.0 above
+func (r Rendition) level() (name string, codec string) {
+	if max(r.Width, r.Height) <= 1280 {
+		return "3.1", "avc1.4d401f"
+	}
+	return "4.0", "avc1.4d4028"
+}
+
+// Transcoder runs ffprobe and ffmpeg
+type Transcoder struct {
+	FFmpeg  string // path of the ffmpeg binary
+	FFprobe string // path of the ffprobe binary
+	// SegmentDuration is the target duration of the segments in seconds
+	SegmentDuration int
+	// Preset is the x264 preset, slower presets compress better
+	Preset string
+}
+
+// Probe reads the duration, size and streams of the video at input
+func (t Transcoder) Probe(ctx context.Context, input string) (Info, error) {
+	cmd := exec.CommandContext(ctx, t.FFprobe, "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return Info{}, fmt.Errorf("ffprobe failed - %s: %s", err, lastLine(stderr.String()))
+	}
+	return parseProbe(out)
+}
+
+type probeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		Duration     string            `json:"duration"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+func parseProbe(out []byte) (Info, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return Info{}, fmt.Errorf("could not read the ffprobe output - %s", err)
+	}
+	var info Info
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	video := false
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "audio":
+			info.HasAudio = true
+		case "video":
+			if video || s.Width == 0 || s.Height == 0 {
+				// Cover art and other streams after the first
+				continue
+			}
+			video = true
+			info.Width, info.Height = s.Width, s.Height
+			rotation, _ := strconv.ParseFloat(s.Tags["rotate"], 64)
+			for _, side := range s.SideDataList {
+				if side.Rotation != 0 {
+					rotation = side.Rotation
+				}
+			}
+			// ffmpeg turns rotated videos upright
+			if int(math.Abs(rotation))%180 == 90 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+			if info.Duration == 0 {
+				info.Duration, _ = strconv.ParseFloat(s.Duration, 64)
+			}
+		}
+	}
+	if !video {
+		return Info{}, errors.New("file has no video stream")
+	}
+	if info.Duration <= 0 {
+		return Info{}, errors.New("video has no duration")
+	}
+	return info, nil
+}
+
+// Transcode encodes the video at input to the renditions and writes them to
+// dir: <rendition>/index.m3u8 and <rendition>/segment_00000.ts. progress is
+// called with the share of the video encoded so far, from 0 to 1.
+func (t Transcoder) Transcode(ctx context.Context, input string, dir string, info Info, renditions []Rendition, progress func(float64)) error {
+	for _, r := range renditions {
+		if err := os.MkdirAll(filepath.Join(dir, r.Name), 0o755); err != nil {
+			return err
+		}
+	}
+	cmd := exec.CommandContext(ctx, t.FFmpeg, t.args(input, dir, info, renditions)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	readProgress(stdout, info.Duration, progress)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed - %s: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+func (t Transcoder) args(input string, dir string, info Info, renditions []Rendition) []string {
+	args := []string{"-hide_banner", "-nostats", "-loglevel", "error", "-progress", "pipe:1", "-y", "-i", input}
+
+	// Split the decoded video once and scale each copy
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v:0]split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	for i, r := range renditions {
+		fmt.Fprintf(&filter, ";[v%d]scale=%d:%d,setsar=1[v%dout]", i, r.Width, r.Height, i)
+	}
+	args = append(args, "-filter_complex", filter.String())
+
+	// Keyframes on segment boundaries so every rendition switches cleanly
+	gop := fmt.Sprintf("expr:gte(t,n_forced*%d)", t.SegmentDuration)
+	var streams []string
+	for i, r := range renditions {
+		args = append(args, "-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2))
+		level, _ := r.level()
+		args = append(args, fmt.Sprintf("-level:v:%d", i), level)
+		stream := fmt.Sprintf("v:%d,name:%s", i, r.Name)
+		if info.HasAudio {
+			args = append(args, "-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrate))
+			stream = fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.Name)
+		}
+		streams = append(streams, stream)
+	}
+	args = append(args,
+		"-preset", t.Preset, "-profile:v", "main", "-pix_fmt", "yuv420p",
+		"-force_key_frames", gop, "-sc_threshold", "0",
+		"-ac", "2", "-ar", "48000",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(t.SegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(dir, "%v", "segment_%05d.ts"),
+		"-var_stream_map", strings.Join(streams, " "),
+		filepath.Join(dir, "%v", "index.m3u8"))
+	return args
+}
+
+// readProgress reports the out_time of the -progress output of ffmpeg
+func readProgress(r io.Reader, duration float64, progress func(float64)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		// out_time_ms is in microseconds too, despite its name
+		if !ok || key != "out_time_us" || progress == nil {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || us < 0 {
+			continue
+		}
+		progress(min(float64(us)/1e6/duration, 1))
+	}
+}
+
+// Subtitle is a subtitle rendition of the master playlist
+type Subtitle struct {
+	Name     string // shown in the player menu
+	Language string // BCP 47 tag
+	URI      string // media playlist, relative to the master playlist
+	Default  bool
+	Captions bool // transcribes dialog and sounds for the deaf and hard of hearing
+}
+
+// subtitleGroup is the group of the subtitle renditions
+const subtitleGroup = "subs"
+
+// MasterPlaylist lists the renditions, their media playlists are at
+// <rendition>/index.m3u8 next to it, and the subtitle renditions
+func MasterPlaylist(renditions []Rendition, subtitles ...Subtitle) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, s := range subtitles {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=%q,LANGUAGE=%q,DEFAULT=%s,AUTOSELECT=YES,FORCED=NO",
+			subtitleGroup, strings.ReplaceAll(s.Name, `"`, "'"), s.Language, yesNo(s.Default))
+		if s.Captions {
+			b.WriteString(`,CHARACTERISTICS="public.accessibility.transcribes-spoken-dialog,public.accessibility.describes-music-and-sound"`)
+		}
+		fmt.Fprintf(&b, ",URI=%q\n", s.URI)
+	}
+	for _, r := range renditions {
+		_, codecs := r.level()
+		if r.AudioBitrate > 0 {
+			codecs += ",mp4a.40.2"
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"",
+			r.Bandwidth(), (r.VideoBitrate+r.AudioBitrate)*1000, r.Width, r.Height, codecs)
+		if len(subtitles) > 0 {
+			fmt.Fprintf(&b, ",SUBTITLES=\"%s\"", subtitleGroup)
+		}
+		fmt.Fprintf(&b, "\n%s/index.m3u8\n", r.Name)
+	}
+	return b.Bytes()
+}
+
+// SubtitleTimestampMap aligns WebVTT cues with the MPEG-TS segments, whose
+// timestamps ffmpeg starts at 1.4 seconds
+const SubtitleTimestampMap = "X-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000"
+
+// SubtitlePlaylist is the media playlist of a subtitle rendition, a single
+// WebVTT segment at uri lasting the whole video
+func SubtitlePlaylist(uri string, duration float64) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n",
+		int(math.Ceil(duration)))
+	fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n#EXT-X-ENDLIST\n", duration, uri)
+	return b.Bytes()
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "YES"
+	}
+	return "NO"
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
@@ -13,5 +13,9 @@ const (
 	StatusServerError            = 1007
 	StatusAuthenticationFailed   = 1008
 	StatusUnauthorized           = 401
+	StatusForbidden              = 403
+	StatusConflict               = 409
+	StatusGone                   = 410
+	StatusUnprocessableEntity    = 422
 	StatusInternalServerError    = 500
 )